@@ -43,7 +43,10 @@ func (c *Client) Clouds() (map[names.CloudTag]jujucloud.Cloud, error) {
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
-		clouds[tag] = common.CloudFromParams(tag.Id(), cloud)
+		clouds[tag], err = common.CloudFromParams(tag.Id(), cloud)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
 	}
 	return clouds, nil
 }
@@ -61,7 +64,8 @@ func (c *Client) Cloud(tag names.CloudTag) (jujucloud.Cloud, error) {
 	if results.Results[0].Error != nil {
 		return jujucloud.Cloud{}, results.Results[0].Error
 	}
-	return common.CloudFromParams(tag.Id(), *results.Results[0].Cloud), nil
+	cloud, err := common.CloudFromParams(tag.Id(), *results.Results[0].Cloud)
+	return cloud, errors.Trace(err)
 }
 
 // DefaultCloud returns the tag of the cloud that models will be
@@ -4,6 +4,8 @@
 package common
 
 import (
+	"github.com/juju/errors"
+
 	"github.com/juju/juju/apiserver/params"
 	jujucloud "github.com/juju/juju/cloud"
 )
@@ -15,12 +17,7 @@ func CloudToParams(cloud jujucloud.Cloud) params.Cloud {
 	}
 	regions := make([]params.CloudRegion, len(cloud.Regions))
 	for i, region := range cloud.Regions {
-		regions[i] = params.CloudRegion{
-			Name:             region.Name,
-			Endpoint:         region.Endpoint,
-			IdentityEndpoint: region.IdentityEndpoint,
-			StorageEndpoint:  region.StorageEndpoint,
-		}
+		regions[i] = CloudRegionToParams(region)
 	}
 	return params.Cloud{
 		Type:             cloud.Type,
@@ -33,19 +30,21 @@ func CloudToParams(cloud jujucloud.Cloud) params.Cloud {
 	}
 }
 
-func CloudFromParams(cloudName string, p params.Cloud) jujucloud.Cloud {
+// CloudFromParams returns the cloud described by the params, or a
+// NotValid error if the params name the same region more than once.
+func CloudFromParams(cloudName string, p params.Cloud) (jujucloud.Cloud, error) {
 	authTypes := make([]jujucloud.AuthType, len(p.AuthTypes))
 	for i, authType := range p.AuthTypes {
 		authTypes[i] = jujucloud.AuthType(authType)
 	}
 	regions := make([]jujucloud.Region, len(p.Regions))
+	regionNames := make(map[string]bool, len(p.Regions))
 	for i, region := range p.Regions {
-		regions[i] = jujucloud.Region{
-			Name:             region.Name,
-			Endpoint:         region.Endpoint,
-			IdentityEndpoint: region.IdentityEndpoint,
-			StorageEndpoint:  region.StorageEndpoint,
+		if regionNames[region.Name] {
+			return jujucloud.Cloud{}, errors.NotValidf("duplicate region %q in cloud %q", region.Name, cloudName)
 		}
+		regionNames[region.Name] = true
+		regions[i] = CloudRegionFromParams(region)
 	}
 	return jujucloud.Cloud{
 		Name:             cloudName,
@@ -56,5 +55,59 @@ func CloudFromParams(cloudName string, p params.Cloud) jujucloud.Cloud {
 		StorageEndpoint:  p.StorageEndpoint,
 		Regions:          regions,
 		CACertificates:   p.CACertificates,
+	}, nil
+}
+
+func CloudRegionToParams(region jujucloud.Region) params.CloudRegion {
+	return params.CloudRegion{
+		Name:             region.Name,
+		Endpoint:         region.Endpoint,
+		IdentityEndpoint: region.IdentityEndpoint,
+		StorageEndpoint:  region.StorageEndpoint,
+		CACertificates:   region.CACertificates,
+	}
+}
+
+func CloudRegionFromParams(p params.CloudRegion) jujucloud.Region {
+	return jujucloud.Region{
+		Name:             p.Name,
+		Endpoint:         p.Endpoint,
+		IdentityEndpoint: p.IdentityEndpoint,
+		StorageEndpoint:  p.StorageEndpoint,
+		CACertificates:   p.CACertificates,
+	}
+}
+
+// AddCloudRegion returns a copy of the cloud with the region added,
+// or an AlreadyExists error if the cloud already has a region with
+// the same name.
+func AddCloudRegion(cloud jujucloud.Cloud, p params.CloudRegion) (jujucloud.Cloud, error) {
+	if p.Name == "" {
+		return jujucloud.Cloud{}, errors.NotValidf("empty region name")
+	}
+	for _, region := range cloud.Regions {
+		if region.Name == p.Name {
+			return jujucloud.Cloud{}, errors.AlreadyExistsf("region %q in cloud %q", p.Name, cloud.Name)
+		}
+	}
+	regions := make([]jujucloud.Region, len(cloud.Regions), len(cloud.Regions)+1)
+	copy(regions, cloud.Regions)
+	cloud.Regions = append(regions, CloudRegionFromParams(p))
+	return cloud, nil
+}
+
+// RemoveCloudRegion returns a copy of the cloud without the named
+// region, or a NotFound error if the cloud has no such region.
+func RemoveCloudRegion(cloud jujucloud.Cloud, regionName string) (jujucloud.Cloud, error) {
+	regions := make([]jujucloud.Region, 0, len(cloud.Regions))
+	for _, region := range cloud.Regions {
+		if region.Name != regionName {
+			regions = append(regions, region)
+		}
+	}
+	if len(regions) == len(cloud.Regions) {
+		return jujucloud.Cloud{}, errors.NotFoundf("region %q in cloud %q", regionName, cloud.Name)
 	}
+	cloud.Regions = regions
+	return cloud, nil
 }
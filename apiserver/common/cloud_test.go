@@ -0,0 +1,84 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package common_test
+
+import (
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/apiserver/common"
+	"github.com/juju/juju/apiserver/params"
+	jujucloud "github.com/juju/juju/cloud"
+)
+
+type cloudSuite struct{}
+
+var _ = gc.Suite(&cloudSuite{})
+
+var testCloud = jujucloud.Cloud{
+	Name: "dummy",
+	Type: "dummy",
+	Regions: []jujucloud.Region{
+		{Name: "east", Endpoint: "https://east.example.com"},
+		{Name: "west", Endpoint: "https://west.example.com"},
+	},
+}
+
+func (s *cloudSuite) TestCloudFromParams(c *gc.C) {
+	cloud, err := common.CloudFromParams("dummy", common.CloudToParams(testCloud))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cloud, jc.DeepEquals, testCloud)
+}
+
+func (s *cloudSuite) TestCloudFromParamsDuplicateRegion(c *gc.C) {
+	_, err := common.CloudFromParams("dummy", params.Cloud{
+		Type: "dummy",
+		Regions: []params.CloudRegion{
+			{Name: "east", Endpoint: "https://east.example.com"},
+			{Name: "east", Endpoint: "https://other.example.com"},
+		},
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(err, gc.ErrorMatches, `duplicate region "east" in cloud "dummy" not valid`)
+}
+
+func (s *cloudSuite) TestAddCloudRegion(c *gc.C) {
+	cloud, err := common.AddCloudRegion(testCloud, params.CloudRegion{
+		Name:     "north",
+		Endpoint: "https://north.example.com",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cloud.Regions, jc.DeepEquals, []jujucloud.Region{
+		{Name: "east", Endpoint: "https://east.example.com"},
+		{Name: "west", Endpoint: "https://west.example.com"},
+		{Name: "north", Endpoint: "https://north.example.com"},
+	})
+	c.Assert(testCloud.Regions, gc.HasLen, 2)
+}
+
+func (s *cloudSuite) TestAddCloudRegionDuplicate(c *gc.C) {
+	_, err := common.AddCloudRegion(testCloud, params.CloudRegion{Name: "west"})
+	c.Assert(err, jc.Satisfies, errors.IsAlreadyExists)
+	c.Assert(err, gc.ErrorMatches, `region "west" in cloud "dummy" already exists`)
+}
+
+func (s *cloudSuite) TestAddCloudRegionEmptyName(c *gc.C) {
+	_, err := common.AddCloudRegion(testCloud, params.CloudRegion{})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (s *cloudSuite) TestRemoveCloudRegion(c *gc.C) {
+	cloud, err := common.RemoveCloudRegion(testCloud, "east")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cloud.Regions, jc.DeepEquals, []jujucloud.Region{
+		{Name: "west", Endpoint: "https://west.example.com"},
+	})
+	c.Assert(testCloud.Regions, gc.HasLen, 2)
+}
+
+func (s *cloudSuite) TestRemoveCloudRegionNotFound(c *gc.C) {
+	_, err := common.RemoveCloudRegion(testCloud, "north")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
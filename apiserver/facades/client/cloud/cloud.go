@@ -278,6 +278,7 @@ func cloudToParams(cloud cloud.Cloud) params.CloudDetails {
 			Endpoint:         region.Endpoint,
 			IdentityEndpoint: region.IdentityEndpoint,
 			StorageEndpoint:  region.StorageEndpoint,
+			CACertificates:   region.CACertificates,
 		}
 	}
 	return params.CloudDetails{
@@ -889,7 +890,11 @@ func (api *CloudAPI) Credential(args params.Entities) (params.CloudCredentialRes
 
 // AddCloud adds a new cloud, different from the one managed by the controller.
 func (api *CloudAPI) AddCloud(cloudArgs params.AddCloudArgs) error {
-	err := api.backend.AddCloud(common.CloudFromParams(cloudArgs.Name, cloudArgs.Cloud), api.apiUser.Name())
+	newCloud, err := common.CloudFromParams(cloudArgs.Name, cloudArgs.Cloud)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	err = api.backend.AddCloud(newCloud, api.apiUser.Name())
 	if err != nil {
 		return err
 	}
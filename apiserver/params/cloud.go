@@ -16,10 +16,11 @@ type Cloud struct {
 
 // CloudRegion holds information about a cloud region.
 type CloudRegion struct {
-	Name             string `json:"name"`
-	Endpoint         string `json:"endpoint,omitempty"`
-	IdentityEndpoint string `json:"identity-endpoint,omitempty"`
-	StorageEndpoint  string `json:"storage-endpoint,omitempty"`
+	Name             string   `json:"name"`
+	Endpoint         string   `json:"endpoint,omitempty"`
+	IdentityEndpoint string   `json:"identity-endpoint,omitempty"`
+	StorageEndpoint  string   `json:"storage-endpoint,omitempty"`
+	CACertificates   []string `json:"ca-certificates,omitempty"`
 }
 
 // AddCloudArgs holds a cloud to be added with its name
@@ -28,6 +29,19 @@ type AddCloudArgs struct {
 	Name  string `json:"name"`
 }
 
+// AddCloudRegionArgs holds a region to be added to an existing cloud.
+type AddCloudRegionArgs struct {
+	CloudTag string      `json:"cloud-tag"`
+	Region   CloudRegion `json:"region"`
+}
+
+// RemoveCloudRegionArgs holds the name of a region
+// to be removed from an existing cloud.
+type RemoveCloudRegionArgs struct {
+	CloudTag string `json:"cloud-tag"`
+	Region   string `json:"region"`
+}
+
 // CloudResult contains a cloud definition or an error.
 type CloudResult struct {
 	Cloud *Cloud `json:"cloud,omitempty"`
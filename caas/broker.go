@@ -5,6 +5,7 @@ package caas
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/juju/errors"
 	"github.com/juju/version"
@@ -93,19 +94,64 @@ type ServiceParams struct {
 
 	// Devices is a set of parameters for Devices that is required.
 	Devices []devices.KubernetesDeviceParams
+
+	// Track, if set, names a version of the application to run
+	// alongside its other tracks, eg for blue/green deployments.
+	// The application's service is not changed until it is
+	// switched to the track.
+	Track string
 }
 
+// ErrUnreachable is the cause of the error returned by a broker's Ping
+// method when the cluster's API server can't be reached.
+var ErrUnreachable = errors.New("cluster unreachable")
+
 // Broker instances interact with the CAAS substrate.
 type Broker interface {
 	// Provider returns the ContainerEnvironProvider that created this Broker.
 	Provider() ContainerEnvironProvider
 
+	// StorageEndpoint returns the object storage endpoint of the
+	// cloud, used for fetching charms and resources; it is empty
+	// if the cloud does not have one.
+	StorageEndpoint() string
+
+	// ConnectionInfo returns details of how the broker connects to
+	// the cluster, without any passwords, keys or tokens.
+	ConnectionInfo() (ConnectionInfo, error)
+
+	// DefaultStorageClass returns details of the cluster's default
+	// storage class, or a NotFound error if there is none.
+	DefaultStorageClass() (*StorageClassInfo, error)
+
+	// StorageClasses returns details of all the cluster's storage classes.
+	StorageClasses() ([]StorageClassInfo, error)
+
+	// ServerVersion returns the version of the cluster's API server.
+	ServerVersion() (version.Number, error)
+
+	// Ping checks that the cluster can be reached and accepts the
+	// broker's credential, without changing anything. An error whose
+	// cause is ErrUnreachable is returned if the cluster can't be
+	// reached, and Unauthorized or Forbidden errors if the cluster
+	// rejects the credential.
+	Ping() error
+
+	// UpdateCredential replaces the cloud credential and CA
+	// certificates used to connect to the cloud with those
+	// in the specified cloud spec.
+	UpdateCredential(cloudSpec environs.CloudSpec) error
+
 	// Destroy terminates all containers and other resources in this broker's namespace.
 	Destroy(context.ProviderCallContext) error
 
 	// Namespaces returns name names of the namespaces on the cluster.
 	Namespaces() ([]string, error)
 
+	// ListManagedNamespaces returns the names of the namespaces on the
+	// cluster which are labelled as belonging to this broker's controller.
+	ListManagedNamespaces() ([]string, error)
+
 	// EnsureNamespace ensures this broker's namespace is created.
 	EnsureNamespace() error
 
@@ -113,6 +159,10 @@ type Broker interface {
 	// a charm for the specified application.
 	EnsureOperator(appName, agentPath string, config *OperatorConfig) error
 
+	// ReconcileOperator creates or updates an operator pod like
+	// EnsureOperator, and reports what, if anything, was changed.
+	ReconcileOperator(appName, agentPath string, config *OperatorConfig) (OperatorChange, error)
+
 	// OperatorExists returns true if the operator for the specified
 	// application exists.
 	OperatorExists(appName string) (bool, error)
@@ -120,28 +170,106 @@ type Broker interface {
 	// DeleteOperator deletes the specified operator.
 	DeleteOperator(appName string) error
 
+	// OperatorStorageStatus returns the status of the persistent
+	// volume claim used by the specified application's operator.
+	OperatorStorageStatus(appName string) (StorageInfo, error)
+
+	// OperatorEvents returns the events recorded for the specified
+	// application's operator pod, oldest first.
+	OperatorEvents(appName string) ([]Event, error)
+
 	// EnsureService creates or updates a service for pods with the given params.
 	EnsureService(appName string, statusCallback StatusCallbackFunc, params *ServiceParams, numUnits int, config application.ConfigAttributes) error
 
+	// ScaleService scales the specified application to the given number of
+	// units. Scaling to zero stops all pods but retains the application's
+	// service, ingress and storage, so that its data and external address
+	// are preserved and the application can be quickly resumed.
+	ScaleService(appName string, scale int) error
+
+	// ApplicationStatus returns the status of the specified
+	// application, summarising the readiness of its units. An
+	// application whose service selects none of its pods is blocked.
+	ApplicationStatus(appName string) (status.StatusInfo, error)
+
+	// SwitchServiceTrack points the specified application's service
+	// at the pods of the given track; an empty track points the
+	// service at all of the application's pods.
+	SwitchServiceTrack(appName, track string) error
+
+	// DeleteServiceTrack deletes the specified track of the
+	// application, which must not be in use by its service.
+	DeleteServiceTrack(appName, track string) error
+
+	// StopApplication stops all pods of the specified application,
+	// retaining all its other resources and recording its number of
+	// units so that StartApplication can restore them.
+	StopApplication(appName string) error
+
+	// StartApplication restores the units of the specified
+	// application stopped by StopApplication.
+	StartApplication(appName string) error
+
+	// RollbackApplication reverts the pods of the specified application
+	// to those of an earlier revision of its deployment. A NotFound
+	// error listing the retained revisions is returned if the revision
+	// is no longer retained.
+	RollbackApplication(appName string, toRevision int64) error
+
+	// EnsureCustomConfigMap creates or updates a config map with the
+	// given name, data and labels, for sharing config between units.
+	// The name must be prefixed with the application name, and must
+	// not use the "juju-" prefix reserved for Juju's own config maps.
+	EnsureCustomConfigMap(name string, data map[string]string, labels map[string]string) error
+
 	// EnsureCustomResourceDefinition creates or updates a custom resource definition resource.
 	EnsureCustomResourceDefinition(appName string, podSpec *PodSpec) error
 
 	// Service returns the service for the specified application.
+	// When each container has its own service, this is the primary
+	// service used for ingress.
 	Service(appName string) (*Service, error)
 
+	// ContainerServices returns the services of the specified application
+	// which each front a single container, keyed by container name. It is
+	// empty unless the application has a service per container.
+	ContainerServices(appName string) (map[string]*Service, error)
+
 	// DeleteService deletes the specified service.
 	DeleteService(appName string) error
 
+	// EnsureServiceOnly creates or updates the service for the specified
+	// application's existing pods, without changing the pods or storage.
+	EnsureServiceOnly(appName string, ports []ContainerPort, config application.ConfigAttributes) error
+
 	// ExposeService sets up external access to the specified service.
 	ExposeService(appName string, resourceTags map[string]string, config application.ConfigAttributes) error
 
 	// UnexposeService removes external access to the specified service.
 	UnexposeService(appName string) error
 
+	// ApplicationIngress returns details of the ingress which
+	// exposes the specified application.
+	ApplicationIngress(appName string) (*IngressInfo, error)
+
+	// DetectDrift compares the resources currently applied for the
+	// specified application with those EnsureService would generate
+	// from the same parameters, and returns the fields which differ.
+	// Nothing is modified.
+	DetectDrift(appName string, params *ServiceParams, numUnits int, config application.ConfigAttributes) ([]DriftEntry, error)
+
 	// WatchUnits returns a watcher which notifies when there
 	// are changes to units of the specified application.
 	WatchUnits(appName string) (watcher.NotifyWatcher, error)
 
+	// ResourceNames returns the names of the resources created
+	// for the specified application, whether or not they exist.
+	ResourceNames(appName string) (ResourceNames, error)
+
+	// WaitForApplicationReady waits until all the desired units of the
+	// specified application are available, or the timeout elapses.
+	WaitForApplicationReady(appName string, timeout time.Duration) error
+
 	// Units returns all units and any associated filesystems
 	// of the specified application. Filesystems are mounted
 	// via volumes bound to the unit.
@@ -187,6 +315,36 @@ type Service struct {
 	Addresses []network.Address
 }
 
+// IngressInfo represents information about the ingress
+// resource used to expose an application.
+type IngressInfo struct {
+	Rules     []IngressRule
+	TLSHosts  []string
+	Addresses []network.Address
+}
+
+// IngressRule represents an ingress rule routing
+// traffic for a host to the application.
+type IngressRule struct {
+	Host  string
+	Paths []string
+}
+
+// DriftEntry describes a field of an application's resource
+// which differs from the value Juju would set.
+type DriftEntry struct {
+	// Resource identifies the resource, eg "service/juju-mariadb".
+	Resource string
+
+	// Field is the path of the field which differs.
+	Field string
+
+	// Expected is the value Juju would set, and Actual the
+	// value found. Either may be empty if the field is unset.
+	Expected string
+	Actual   string
+}
+
 // FilesystemInfo represents information about a filesystem
 // mounted by a unit.
 type FilesystemInfo struct {
@@ -206,6 +364,17 @@ type VolumeInfo struct {
 	Size       uint64
 	Persistent bool
 	Status     status.StatusInfo
+
+	// ReclaimPolicy is what happens to the volume when it is
+	// released, eg Retain or Delete.
+	ReclaimPolicy string
+
+	// Source is the type of the volume's backing storage, eg csi
+	// or awsElasticBlockStore, and Handle identifies the backing
+	// storage to its provider, eg the cloud disk id. Both are
+	// empty if the source type is not recognised.
+	Source string
+	Handle string
 }
 
 // Unit represents information about the status of a "pod".
@@ -216,13 +385,167 @@ type Unit struct {
 	Dying          bool
 	Status         status.StatusInfo
 	FilesystemInfo []FilesystemInfo
+
+	// QOSClass is the quality of service class of the unit's pod,
+	// eg BestEffort, which determines the order in which pods are
+	// evicted when a node is under resource pressure.
+	QOSClass string
+
+	// Image is the image running in the unit's workload container and
+	// ImageID is the digest it resolved to, eg docker-pullable://repo@sha256:...
+	// Comparing image IDs across units shows whether a rollout is complete.
+	Image   string
+	ImageID string
 }
 
+// OperatorChange describes what reconciling an operator changed.
+type OperatorChange string
+
+const (
+	// OperatorUnchanged means the operator already matched its config.
+	OperatorUnchanged OperatorChange = "unchanged"
+
+	// OperatorCreated means the operator did not exist and was created.
+	OperatorCreated OperatorChange = "created"
+
+	// OperatorUpdated means the operator's config or spec was updated
+	// in place, without replacing the operator pod.
+	OperatorUpdated OperatorChange = "updated"
+
+	// OperatorRecreated means the operator image changed, so the
+	// operator pod is replaced.
+	OperatorRecreated OperatorChange = "recreated"
+)
+
 // Operator represents information about the status of an "operator pod".
 type Operator struct {
 	Id     string
 	Dying  bool
 	Status status.StatusInfo
+
+	// RestartCount is the number of times the operator
+	// container has been restarted.
+	RestartCount int
+
+	// LastTerminationReason is why the operator container last
+	// exited, eg Error or OOMKilled, if it has been restarted.
+	LastTerminationReason string
+}
+
+// ConnectionInfo describes how a broker connects to its cluster.
+// It never holds any secret material, only whether it is configured.
+type ConnectionInfo struct {
+	// Endpoint is the address of the cluster's API server.
+	Endpoint string
+
+	// AuthType is the type of the cloud credential in use,
+	// and Username is the user it authenticates as, if any.
+	AuthType string
+	Username string
+
+	// HasCACertificate is true if the API server's certificate
+	// is verified against configured CA certificates.
+	HasCACertificate bool
+
+	// HasPassword, HasClientCertificate and HasToken report
+	// which credentials are sent to the API server.
+	HasPassword          bool
+	HasClientCertificate bool
+	HasToken             bool
+}
+
+// ResourceNames holds the names of the cluster resources
+// created for an application and its operator.
+type ResourceNames struct {
+	// Workload is the name of the application's deployment or
+	// stateful set.
+	Workload string
+
+	// Service is the name of the application's primary service.
+	Service string
+
+	// Ingress is the name of the ingress resource created
+	// when the application is exposed.
+	Ingress string
+
+	// ConfigMapPrefix prefixes the names of the config maps holding
+	// the application's file sets, which are named
+	// <prefix><file set name>-config.
+	ConfigMapPrefix string
+
+	// Operator is the name of the operator's stateful set
+	// and OperatorPod is the name of its pod.
+	Operator    string
+	OperatorPod string
+
+	// OperatorConfigMap is the name of the config map holding
+	// the operator's agent config.
+	OperatorConfigMap string
+
+	// OperatorConfigurationsConfigMap is the name of the config map
+	// holding the application's config for the operator.
+	OperatorConfigurationsConfigMap string
+}
+
+// StorageClassInfo represents information about a storage class.
+type StorageClassInfo struct {
+	// Name is the name of the storage class.
+	Name string
+
+	// Provisioner is the volume plugin used to provision
+	// persistent volumes of the storage class.
+	Provisioner string
+
+	// Parameters are the provisioner parameters.
+	Parameters map[string]string
+
+	// ReclaimPolicy is what happens to persistent volumes of
+	// the storage class when they are released, eg Delete.
+	ReclaimPolicy string
+
+	// VolumeBindingMode is when persistent volumes of the storage
+	// class are bound, eg Immediate or WaitForFirstConsumer.
+	VolumeBindingMode string
+
+	// Default is true if this is the cluster's default storage class.
+	Default bool
+}
+
+// StorageInfo represents information about the persistent
+// volume claim used by an operator for charm storage.
+type StorageInfo struct {
+	// ClaimName is the name of the persistent volume claim.
+	ClaimName string
+
+	// Phase is the phase of the claim, eg Pending or Bound.
+	Phase string
+
+	// VolumeName is the name of the persistent volume
+	// bound to the claim, if any.
+	VolumeName string
+
+	// StorageClass is the storage class of the claim.
+	StorageClass string
+
+	// Message explains why the claim is not yet bound,
+	// eg because there is no persistent volume available.
+	Message string
+}
+
+// Event represents an event recorded by the substrate
+// for a resource, eg a pod failing to be scheduled.
+type Event struct {
+	// Type is the type of the event, eg Normal or Warning.
+	Type string
+
+	// Reason is a short, machine readable reason for the event.
+	Reason string
+
+	// Message is a human readable description of the event.
+	Message string
+
+	// Time is when the event last occurred.
+	Time time.Time
 }
 
 // CharmStorageParams defines parameters used to create storage
@@ -260,4 +583,31 @@ type OperatorConfig struct {
 
 	// ResourceTags is a set of tags to set on the operator pod.
 	ResourceTags map[string]string
+
+	// Command, if set, overrides the command run by the operator image.
+	Command []string
+
+	// ImagePullSecrets are the names of existing secrets
+	// used to pull the operator image.
+	ImagePullSecrets []string
+
+	// LivenessProbe, if set, is used to determine whether the operator
+	// is healthy, instead of the broker's default probe. Operators which
+	// fail the probe are restarted.
+	LivenessProbe *Probe
+
+	// AgentConfMountPath, if set, is the absolute path at which the
+	// template agent.conf file is mounted in the operator container,
+	// for operator images which do not use the standard agent layout.
+	AgentConfMountPath string
+
+	// ConfigFiles are additional config files, keyed by file name, which
+	// are written along with AgentConf and mounted in the same directory
+	// as the template agent.conf file.
+	ConfigFiles map[string]string
+
+	// PodAnnotations are annotations to set on the operator pod, for
+	// example to opt the operator out of service mesh sidecar injection.
+	// Annotations prefixed with "juju-" are reserved for Juju.
+	PodAnnotations map[string]string
 }
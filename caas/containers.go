@@ -4,6 +4,8 @@
 package caas
 
 import (
+	"fmt"
+
 	"github.com/juju/errors"
 	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 )
@@ -14,13 +16,33 @@ type FileSet struct {
 	Name      string            `yaml:"name" json:"name"`
 	MountPath string            `yaml:"mountPath" json:"mountPath"`
 	Files     map[string]string `yaml:"files" json:"files"`
+
+	// MountPropagation determines how mounts are propagated
+	// between the host and the container. It is one of
+	// None (the default), HostToContainer or Bidirectional.
+	MountPropagation string `yaml:"mountPropagation,omitempty" json:"mountPropagation,omitempty"`
 }
 
+const (
+	MountPropagationNone            = "None"
+	MountPropagationHostToContainer = "HostToContainer"
+	MountPropagationBidirectional   = "Bidirectional"
+)
+
 // ContainerPort defines a port on a container.
 type ContainerPort struct {
 	Name          string `yaml:"name,omitempty" json:"name,omitempty"`
 	ContainerPort int32  `yaml:"containerPort" json:"containerPort"`
 	Protocol      string `yaml:"protocol" json:"protocol"`
+
+	// HostPort, if set, is the port on the node on which the container
+	// port is also exposed. Only one pod binding a given host port and
+	// protocol can be scheduled on each node.
+	HostPort int32 `yaml:"hostPort,omitempty" json:"hostPort,omitempty"`
+
+	// Internal ports, eg for debugging or metrics scraped by a sidecar,
+	// are left off the application's service.
+	Internal bool `yaml:"internal,omitempty" json:"internal,omitempty"`
 }
 
 // ImageDetails defines all details required to pull a docker image from any registry
@@ -30,11 +52,68 @@ type ImageDetails struct {
 	Password  string `yaml:"password,omitempty" json:"password,omitempty"`
 }
 
+// Probe defines a health check run periodically against a container.
+// Exactly one of Command, HTTPGet or TCPPort must be set.
+type Probe struct {
+	// Command is run in the container; the check succeeds
+	// if it exits with status 0.
+	Command []string `yaml:"command,omitempty" json:"command,omitempty"`
+
+	// HTTPGet is a request made to the container; the check
+	// succeeds if the response has a 2xx or 3xx status.
+	HTTPGet *HTTPGetProbe `yaml:"httpGet,omitempty" json:"httpGet,omitempty"`
+
+	// TCPPort is a port of the container to which the check
+	// succeeds if a connection can be opened.
+	TCPPort int32 `yaml:"tcpPort,omitempty" json:"tcpPort,omitempty"`
+
+	InitialDelaySeconds int32 `yaml:"initialDelaySeconds,omitempty" json:"initialDelaySeconds,omitempty"`
+	PeriodSeconds       int32 `yaml:"periodSeconds,omitempty" json:"periodSeconds,omitempty"`
+	TimeoutSeconds      int32 `yaml:"timeoutSeconds,omitempty" json:"timeoutSeconds,omitempty"`
+	FailureThreshold    int32 `yaml:"failureThreshold,omitempty" json:"failureThreshold,omitempty"`
+}
+
+// HTTPGetProbe defines an HTTP request made by a probe.
+type HTTPGetProbe struct {
+	Path   string `yaml:"path,omitempty" json:"path,omitempty"`
+	Port   int32  `yaml:"port" json:"port"`
+	Scheme string `yaml:"scheme,omitempty" json:"scheme,omitempty"`
+}
+
+// Validate returns an error if the probe is not valid.
+func (p *Probe) Validate() error {
+	handlers := 0
+	if len(p.Command) > 0 {
+		handlers++
+	}
+	if p.HTTPGet != nil {
+		handlers++
+		if p.HTTPGet.Port <= 0 {
+			return errors.NotValidf("http probe port %d", p.HTTPGet.Port)
+		}
+	}
+	if p.TCPPort != 0 {
+		handlers++
+		if p.TCPPort < 0 {
+			return errors.NotValidf("tcp probe port %d", p.TCPPort)
+		}
+	}
+	if handlers != 1 {
+		return errors.NotValidf("probe with %d handlers", handlers)
+	}
+	return nil
+}
+
 // ProviderContainer defines a provider specific container.
 type ProviderContainer interface {
 	Validate() error
 }
 
+// ProviderPod defines a provider specific pod.
+type ProviderPod interface {
+	Validate() error
+}
+
 // ContainerSpec defines the data values used to configure
 // a container on the CAAS substrate.
 type ContainerSpec struct {
@@ -51,6 +130,17 @@ type ContainerSpec struct {
 	Config map[string]interface{} `yaml:"config,omitempty"`
 	Files  []FileSet              `yaml:"files,omitempty"`
 
+	// LivenessProbe and ReadinessProbe are substrate independent
+	// health checks. They are declared under the same keys as any
+	// provider specific probes, so the provider parses them itself.
+	LivenessProbe  *Probe `yaml:"-" json:"-"`
+	ReadinessProbe *Probe `yaml:"-" json:"-"`
+
+	// AutoReadinessProbe requests a readiness probe checking that the
+	// container's first port accepts connections, for containers
+	// which do not declare a probe of their own.
+	AutoReadinessProbe bool `yaml:"autoReadinessProbe,omitempty"`
+
 	// ProviderContainer defines config which is specific to a substrate, eg k8s
 	ProviderContainer `yaml:"-"`
 }
@@ -61,6 +151,9 @@ type PodSpec struct {
 	Containers                []ContainerSpec            `yaml:"-"`
 	OmitServiceFrontend       bool                       `yaml:"omitServiceFrontend"`
 	CustomResourceDefinitions []CustomResourceDefinition `yaml:"customResourceDefinition,omitempty"`
+
+	// ProviderPod defines config which is specific to a substrate, eg k8s
+	ProviderPod ProviderPod `yaml:"-"`
 }
 
 // CustomResourceDefinitionValidation defines the custom resource definition validation schema.
@@ -101,11 +194,17 @@ func (spec *PodSpec) Validate() error {
 			return errors.Trace(err)
 		}
 	}
+	if err := validateHostPorts(spec.Containers); err != nil {
+		return errors.Trace(err)
+	}
 	for _, crd := range spec.CustomResourceDefinitions {
 		if err := crd.Validate(); err != nil {
 			return errors.Trace(err)
 		}
 	}
+	if spec.ProviderPod != nil {
+		return spec.ProviderPod.Validate()
+	}
 	return nil
 }
 
@@ -124,9 +223,64 @@ func (spec *ContainerSpec) Validate() error {
 		if fs.MountPath == "" {
 			return errors.Errorf("mount path is missing for file set %q", fs.Name)
 		}
+		switch fs.MountPropagation {
+		case "", MountPropagationNone, MountPropagationHostToContainer, MountPropagationBidirectional:
+		default:
+			return errors.NotValidf("mount propagation %q for file set %q", fs.MountPropagation, fs.Name)
+		}
+	}
+	if spec.LivenessProbe != nil {
+		if err := spec.LivenessProbe.Validate(); err != nil {
+			return errors.Annotatef(err, "liveness probe for container %q", spec.Name)
+		}
+	}
+	if spec.ReadinessProbe != nil {
+		if err := spec.ReadinessProbe.Validate(); err != nil {
+			return errors.Annotatef(err, "readiness probe for container %q", spec.Name)
+		}
+	}
+	if spec.AutoReadinessProbe {
+		if spec.ReadinessProbe != nil {
+			return errors.NotValidf("automatic and declared readiness probes for container %q", spec.Name)
+		}
+		if len(spec.Ports) == 0 {
+			return errors.NotValidf("automatic readiness probe for container %q without ports", spec.Name)
+		}
+	}
+	for _, p := range spec.Ports {
+		if p.HostPort == 0 {
+			continue
+		}
+		if p.HostPort < 0 || p.HostPort > 65535 {
+			return errors.NotValidf("host port %d for container %q", p.HostPort, spec.Name)
+		}
+		switch p.Protocol {
+		case "TCP", "UDP", "SCTP":
+		default:
+			return errors.NotValidf("host port %d with protocol %q for container %q", p.HostPort, p.Protocol, spec.Name)
+		}
 	}
 	if spec.ProviderContainer != nil {
 		return spec.ProviderContainer.Validate()
 	}
 	return nil
 }
+
+// validateHostPorts returns an error if more than one container
+// port binds the same host port and protocol.
+func validateHostPorts(containers []ContainerSpec) error {
+	bound := make(map[string]string)
+	for _, c := range containers {
+		for _, p := range c.Ports {
+			if p.HostPort == 0 {
+				continue
+			}
+			key := fmt.Sprintf("%d/%s", p.HostPort, p.Protocol)
+			if other, ok := bound[key]; ok {
+				return errors.NotValidf("host port %s for both containers %q and %q", key, other, c.Name)
+			}
+			bound[key] = c.Name
+		}
+	}
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/golang/mock/gomock"
 	jujuclock "github.com/juju/clock"
 	testclock "github.com/juju/clock/testclock"
+	"github.com/juju/errors"
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
 	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
@@ -35,23 +36,30 @@ type BaseSuite struct {
 
 	broker caas.Broker
 
-	cfg *config.Config
+	cfg       *config.Config
+	cloudSpec environs.CloudSpec
 
 	k8sClient                  *mocks.MockInterface
 	mockNamespaces             *mocks.MockNamespaceInterface
 	mockApps                   *mocks.MockAppsV1Interface
 	mockExtensions             *mocks.MockExtensionsV1beta1Interface
 	mockSecrets                *mocks.MockSecretInterface
+	mockEvents                 *mocks.MockEventInterface
+	mockNodes                  *mocks.MockNodeInterface
 	mockDeployments            *mocks.MockDeploymentInterface
+	mockReplicaSets            *mocks.MockReplicaSetInterface
 	mockStatefulSets           *mocks.MockStatefulSetInterface
 	mockPods                   *mocks.MockPodInterface
 	mockServices               *mocks.MockServiceInterface
+	mockEndpoints              *mocks.MockEndpointsInterface
 	mockConfigMaps             *mocks.MockConfigMapInterface
 	mockPersistentVolumes      *mocks.MockPersistentVolumeInterface
 	mockPersistentVolumeClaims *mocks.MockPersistentVolumeClaimInterface
 	mockStorage                *mocks.MockStorageV1Interface
 	mockStorageClass           *mocks.MockStorageClassInterface
 	mockIngressInterface       *mocks.MockIngressInterface
+	mockNetworking             *mocks.MockNetworkingV1Interface
+	mockNetworkPolicies        *mocks.MockNetworkPolicyInterface
 
 	mockApiextensionsV1          *mocks.MockApiextensionsV1beta1Interface
 	mockApiextensionsClient      *mocks.MockApiExtensionsClientInterface
@@ -70,9 +78,10 @@ func (s *BaseSuite) setupBroker(c *gc.C) *gomock.Controller {
 		"ClientKeyData":         "cert-key",
 	})
 	cloudSpec := environs.CloudSpec{
-		Endpoint:       "some-host",
-		Credential:     &cred,
-		CACertificates: []string{testing.CACert},
+		Endpoint:        "some-host",
+		StorageEndpoint: "https://storage.example.com",
+		Credential:      &cred,
+		CACertificates:  []string{testing.CACert},
 	}
 	cfg, err := config.New(config.UseDefaults, testing.FakeConfig().Merge(testing.Attrs{
 		config.NameKey: testNamespace,
@@ -99,6 +108,9 @@ func (s *BaseSuite) setupBroker(c *gc.C) *gomock.Controller {
 	s.mockServices = mocks.NewMockServiceInterface(ctrl)
 	mockCoreV1.EXPECT().Services(testNamespace).AnyTimes().Return(s.mockServices)
 
+	s.mockEndpoints = mocks.NewMockEndpointsInterface(ctrl)
+	mockCoreV1.EXPECT().Endpoints(testNamespace).AnyTimes().Return(s.mockEndpoints)
+
 	s.mockConfigMaps = mocks.NewMockConfigMapInterface(ctrl)
 	mockCoreV1.EXPECT().ConfigMaps(testNamespace).AnyTimes().Return(s.mockConfigMaps)
 
@@ -111,6 +123,12 @@ func (s *BaseSuite) setupBroker(c *gc.C) *gomock.Controller {
 	s.mockSecrets = mocks.NewMockSecretInterface(ctrl)
 	mockCoreV1.EXPECT().Secrets(testNamespace).AnyTimes().Return(s.mockSecrets)
 
+	s.mockEvents = mocks.NewMockEventInterface(ctrl)
+	mockCoreV1.EXPECT().Events(testNamespace).AnyTimes().Return(s.mockEvents)
+
+	s.mockNodes = mocks.NewMockNodeInterface(ctrl)
+	mockCoreV1.EXPECT().Nodes().AnyTimes().Return(s.mockNodes)
+
 	s.mockApps = mocks.NewMockAppsV1Interface(ctrl)
 	s.mockExtensions = mocks.NewMockExtensionsV1beta1Interface(ctrl)
 	s.mockStatefulSets = mocks.NewMockStatefulSetInterface(ctrl)
@@ -120,6 +138,8 @@ func (s *BaseSuite) setupBroker(c *gc.C) *gomock.Controller {
 	s.k8sClient.EXPECT().AppsV1().AnyTimes().Return(s.mockApps)
 	s.mockApps.EXPECT().StatefulSets(testNamespace).AnyTimes().Return(s.mockStatefulSets)
 	s.mockApps.EXPECT().Deployments(testNamespace).AnyTimes().Return(s.mockDeployments)
+	s.mockReplicaSets = mocks.NewMockReplicaSetInterface(ctrl)
+	s.mockApps.EXPECT().ReplicaSets(testNamespace).AnyTimes().Return(s.mockReplicaSets)
 	s.mockExtensions.EXPECT().Ingresses(testNamespace).AnyTimes().Return(s.mockIngressInterface)
 
 	s.mockStorage = mocks.NewMockStorageV1Interface(ctrl)
@@ -127,6 +147,11 @@ func (s *BaseSuite) setupBroker(c *gc.C) *gomock.Controller {
 	s.k8sClient.EXPECT().StorageV1().AnyTimes().Return(s.mockStorage)
 	s.mockStorage.EXPECT().StorageClasses().AnyTimes().Return(s.mockStorageClass)
 
+	s.mockNetworking = mocks.NewMockNetworkingV1Interface(ctrl)
+	s.mockNetworkPolicies = mocks.NewMockNetworkPolicyInterface(ctrl)
+	s.k8sClient.EXPECT().NetworkingV1().AnyTimes().Return(s.mockNetworking)
+	s.mockNetworking.EXPECT().NetworkPolicies(testNamespace).AnyTimes().Return(s.mockNetworkPolicies)
+
 	s.mockApiextensionsClient = mocks.NewMockApiExtensionsClientInterface(ctrl)
 	s.mockApiextensionsV1 = mocks.NewMockApiextensionsV1beta1Interface(ctrl)
 	s.mockCustomResourceDefinition = mocks.NewMockCustomResourceDefinitionInterface(ctrl)
@@ -134,6 +159,7 @@ func (s *BaseSuite) setupBroker(c *gc.C) *gomock.Controller {
 	s.mockApiextensionsV1.EXPECT().CustomResourceDefinitions().AnyTimes().Return(s.mockCustomResourceDefinition)
 
 	// Set up the mock k8sClient we pass to our broker under test.
+	var timeouts []time.Duration
 	newClient := func(cfg *rest.Config) (kubernetes.Interface, apiextensionsclientset.Interface, error) {
 		c.Assert(cfg.Username, gc.Equals, "fred")
 		c.Assert(cfg.Password, gc.Equals, "secret")
@@ -143,6 +169,10 @@ func (s *BaseSuite) setupBroker(c *gc.C) *gomock.Controller {
 			KeyData:  []byte("cert-key"),
 			CAData:   []byte(testing.CACert),
 		})
+		c.Assert(cfg.WrapTransport, gc.NotNil)
+		c.Assert(cfg.QPS, gc.Equals, float32(50))
+		c.Assert(cfg.Burst, gc.Equals, 100)
+		timeouts = append(timeouts, cfg.Timeout)
 		return s.k8sClient, s.mockApiextensionsClient, nil
 	}
 
@@ -153,8 +183,11 @@ func (s *BaseSuite) setupBroker(c *gc.C) *gomock.Controller {
 		s.watcher = w
 		return s.watcher, err
 	}
-	s.broker, err = provider.NewK8sBroker(cloudSpec, cfg, newClient, newK8sWatcherForTest, s.clock)
+	s.cloudSpec = cloudSpec
+	s.broker, err = provider.NewK8sBroker(cloudSpec, cfg, testing.ControllerTag.Id(), newClient, newK8sWatcherForTest, s.clock)
 	c.Assert(err, jc.ErrorIsNil)
+	// The watch client has no request timeout.
+	c.Assert(timeouts, jc.DeepEquals, []time.Duration{10 * time.Minute, 0})
 	return ctrl
 }
 
@@ -166,6 +199,18 @@ func (s *BaseSuite) k8sAlreadyExists() *k8serrors.StatusError {
 	return k8serrors.NewAlreadyExists(schema.GroupResource{}, "test")
 }
 
+func (s *BaseSuite) k8sForbiddenError() *k8serrors.StatusError {
+	return k8serrors.NewForbidden(schema.GroupResource{}, "test", errors.New("access denied"))
+}
+
+func (s *BaseSuite) k8sUnauthorizedError() *k8serrors.StatusError {
+	return k8serrors.NewUnauthorized("invalid bearer token")
+}
+
+func (s *BaseSuite) k8sInvalidError() *k8serrors.StatusError {
+	return k8serrors.NewInvalid(schema.GroupKind{}, "test", nil)
+}
+
 func (s *BaseSuite) deleteOptions(policy v1.DeletionPropagation) *v1.DeleteOptions {
 	return &v1.DeleteOptions{PropagationPolicy: &policy}
 }
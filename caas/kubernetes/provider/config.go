@@ -4,9 +4,13 @@
 package provider
 
 import (
+	"time"
+
+	"github.com/juju/errors"
 	"github.com/juju/schema"
 	"gopkg.in/juju/environschema.v1"
 	core "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
@@ -15,6 +19,12 @@ const (
 	defaultIngressSSLRedirect    = false
 	defaultIngressSSLPassthrough = false
 	defaultIngressAllowHTTPKey   = false
+	defaultIngressBackendProto   = ingressBackendHTTP
+	defaultServicePerContainer   = false
+	defaultPreserveReplicas      = false
+	defaultAdoptExisting         = false
+	defaultSpreadReplicas        = false
+	defaultTopologyAwareHints    = false
 
 	serviceTypeConfigKey               = "kubernetes-service-type"
 	serviceExternalIPsConfigKey        = "kubernetes-service-external-ips"
@@ -22,11 +32,41 @@ const (
 	serviceLoadBalancerIPKey           = "kubernetes-service-loadbalancer-ip"
 	serviceLoadBalancerSourceRangesKey = "kubernetes-service-loadbalancer-sourceranges"
 	serviceExternalNameKey             = "kubernetes-service-externalname"
+	servicePerContainerKey             = "kubernetes-service-per-container"
+	serviceSelectorKey                 = "kubernetes-service-selector"
+	serviceEndpointsKey                = "kubernetes-service-endpoints"
+	serviceTopologyAwareHintsKey       = "kubernetes-service-topology-aware-hints"
 
 	ingressClassKey          = "kubernetes-ingress-class"
 	ingressSSLRedirectKey    = "kubernetes-ingress-ssl-redirect"
 	ingressSSLPassthroughKey = "kubernetes-ingress-ssl-passthrough"
 	ingressAllowHTTPKey      = "kubernetes-ingress-allow-http"
+	ingressBackendProtoKey   = "kubernetes-ingress-backend-protocol"
+
+	ingressRateLimitKey        = "kubernetes-ingress-rate-limit"
+	ingressProxyBodySizeKey    = "kubernetes-ingress-proxy-body-size"
+	ingressProxyReadTimeoutKey = "kubernetes-ingress-proxy-read-timeout"
+	ingressProxySendTimeoutKey = "kubernetes-ingress-proxy-send-timeout"
+
+	ingressBackendHTTP  = "HTTP"
+	ingressBackendHTTPS = "HTTPS"
+
+	deploymentProgressDeadlineKey = "kubernetes-deployment-progress-deadline"
+	deploymentMinReadySecondsKey  = "kubernetes-deployment-min-ready-seconds"
+	deploymentPreserveReplicasKey = "kubernetes-deployment-preserve-replicas"
+	deploymentRevisionHistoryKey  = "kubernetes-deployment-revision-history-limit"
+
+	terminationGracePeriodKey = "kubernetes-termination-grace-period"
+
+	spreadReplicasKey         = "kubernetes-spread-replicas"
+	spreadReplicasRequiredKey = "kubernetes-spread-replicas-required"
+
+	networkPolicyIngressKey = "kubernetes-network-policy-ingress"
+
+	adoptExistingResourcesKey = "kubernetes-adopt-existing-resources"
+
+	autoProbeInitialDelayKey = "kubernetes-auto-probe-initial-delay"
+	autoProbePeriodKey       = "kubernetes-auto-probe-period"
 )
 
 var configFields = environschema.Fields{
@@ -60,6 +100,26 @@ var configFields = environschema.Fields{
 		Type:        environschema.Tstring,
 		Group:       environschema.ProviderGroup,
 	},
+	servicePerContainerKey: {
+		Description: "whether to create a separate service for the ports of each container",
+		Type:        environschema.Tbool,
+		Group:       environschema.ProviderGroup,
+	},
+	serviceSelectorKey: {
+		Description: "comma separated key=value pod labels which, in addition to the application, select the pods targeted by the service",
+		Type:        environschema.Tstring,
+		Group:       environschema.ProviderGroup,
+	},
+	serviceEndpointsKey: {
+		Description: "comma separated IP addresses of external backends targeted by a service without a selector, eg an off-cluster database",
+		Type:        environschema.Tstring,
+		Group:       environschema.ProviderGroup,
+	},
+	serviceTopologyAwareHintsKey: {
+		Description: "whether to route traffic to the service's endpoints in the same zone as the client where possible; requires a cluster with EndpointSlices and topology aware hints enabled, and enough endpoints in each zone",
+		Type:        environschema.Tbool,
+		Group:       environschema.ProviderGroup,
+	},
 	ingressClassKey: {
 		Description: "the class of the ingress controller to be used by the ingress resource",
 		Type:        environschema.Tstring,
@@ -80,6 +140,87 @@ var configFields = environschema.Fields{
 		Type:        environschema.Tbool,
 		Group:       environschema.ProviderGroup,
 	},
+	ingressBackendProtoKey: {
+		Description: "the protocol used by the ingress controller to talk to the service, HTTP or HTTPS",
+		Type:        environschema.Tstring,
+		Values:      []interface{}{ingressBackendHTTP, ingressBackendHTTPS},
+		Group:       environschema.ProviderGroup,
+	},
+	ingressRateLimitKey: {
+		Description: "requests per second each client may make through the ingress controller",
+		Type:        environschema.Tint,
+		Group:       environschema.ProviderGroup,
+	},
+	ingressProxyBodySizeKey: {
+		Description: "maximum size of a request body accepted by the ingress controller, eg 8m",
+		Type:        environschema.Tstring,
+		Group:       environschema.ProviderGroup,
+	},
+	ingressProxyReadTimeoutKey: {
+		Description: "seconds the ingress controller waits to read a response from the service",
+		Type:        environschema.Tint,
+		Group:       environschema.ProviderGroup,
+	},
+	ingressProxySendTimeoutKey: {
+		Description: "seconds the ingress controller waits to send a request to the service",
+		Type:        environschema.Tint,
+		Group:       environschema.ProviderGroup,
+	},
+	deploymentProgressDeadlineKey: {
+		Description: "seconds a deployment rollout may take to progress before it is considered failed",
+		Type:        environschema.Tint,
+		Group:       environschema.ProviderGroup,
+	},
+	deploymentMinReadySecondsKey: {
+		Description: "seconds a new pod must stay ready, after first passing its readiness probe, before it is considered available and the rollout continues",
+		Type:        environschema.Tint,
+		Group:       environschema.ProviderGroup,
+	},
+	deploymentPreserveReplicasKey: {
+		Description: "whether to keep the replica count of an existing deployment, for when it is scaled outside of Juju",
+		Type:        environschema.Tbool,
+		Group:       environschema.ProviderGroup,
+	},
+	deploymentRevisionHistoryKey: {
+		Description: "number of old replica sets of a deployment to retain for rollback",
+		Type:        environschema.Tint,
+		Group:       environschema.ProviderGroup,
+	},
+	terminationGracePeriodKey: {
+		Description: "seconds the application's pods have to shut down, including running any preStop hooks, unless their pod spec sets its own period",
+		Type:        environschema.Tint,
+		Group:       environschema.ProviderGroup,
+	},
+	spreadReplicasKey: {
+		Description: "whether the scheduler should prefer to run the application's pods on different nodes",
+		Type:        environschema.Tbool,
+		Group:       environschema.ProviderGroup,
+	},
+	spreadReplicasRequiredKey: {
+		Description: "whether the application's pods must run on different nodes when spreading replicas; pods which can't be placed are left pending",
+		Type:        environschema.Tbool,
+		Group:       environschema.ProviderGroup,
+	},
+	networkPolicyIngressKey: {
+		Description: "YAML or JSON list of network policy ingress rules; if set, only traffic matching the rules may reach the application pods",
+		Type:        environschema.Tstring,
+		Group:       environschema.ProviderGroup,
+	},
+	adoptExistingResourcesKey: {
+		Description: "whether to take over an existing deployment or service of the same name which was not created by Juju",
+		Type:        environschema.Tbool,
+		Group:       environschema.ProviderGroup,
+	},
+	autoProbeInitialDelayKey: {
+		Description: "seconds after a container starts before its automatic readiness probe is first run",
+		Type:        environschema.Tint,
+		Group:       environschema.ProviderGroup,
+	},
+	autoProbePeriodKey: {
+		Description: "seconds between runs of a container's automatic readiness probe",
+		Type:        environschema.Tint,
+		Group:       environschema.ProviderGroup,
+	},
 }
 
 var schemaDefaults = schema.Defaults{
@@ -88,6 +229,14 @@ var schemaDefaults = schema.Defaults{
 	ingressSSLRedirectKey:    defaultIngressSSLRedirect,
 	ingressSSLPassthroughKey: defaultIngressSSLPassthrough,
 	ingressAllowHTTPKey:      defaultIngressAllowHTTPKey,
+	ingressBackendProtoKey:   defaultIngressBackendProto,
+	servicePerContainerKey:   defaultServicePerContainer,
+
+	serviceTopologyAwareHintsKey: defaultTopologyAwareHints,
+
+	deploymentPreserveReplicasKey: defaultPreserveReplicas,
+	adoptExistingResourcesKey:     defaultAdoptExisting,
+	spreadReplicasKey:             defaultSpreadReplicas,
 }
 
 // ConfigSchema returns the configuration schema for
@@ -101,3 +250,161 @@ func ConfigSchema() environschema.Fields {
 func ConfigDefaults() schema.Defaults {
 	return schemaDefaults
 }
+
+const (
+	// The client QPS and burst limit the rate at which the broker
+	// talks to the API server. The client-go defaults (5 and 10) are
+	// tuned for a single controller loop and serialise operations
+	// badly when reconciling many applications; higher values make the
+	// broker more responsive at the cost of more load on the API server,
+	// which may in turn throttle other clients of the cluster.
+	defaultClientQPS   = 50
+	defaultClientBurst = 100
+
+	// defaultClientTimeout bounds how long a single request to the API
+	// server may take, so a hung API server does not block a broker call
+	// forever. Watches use a separate client without the timeout.
+	defaultClientTimeout = 10 * time.Minute
+
+	clientQPSKey     = "kubernetes-client-qps"
+	clientBurstKey   = "kubernetes-client-burst"
+	clientTimeoutKey = "kubernetes-client-timeout"
+)
+
+var clientConfigFields = schema.Fields{
+	clientQPSKey:     schema.ForceInt(),
+	clientBurstKey:   schema.ForceInt(),
+	clientTimeoutKey: schema.String(),
+}
+
+var clientConfigDefaults = schema.Defaults{
+	clientQPSKey:     defaultClientQPS,
+	clientBurstKey:   defaultClientBurst,
+	clientTimeoutKey: defaultClientTimeout.String(),
+}
+
+// clientLimits holds the rate limits and timeout used by the client
+// talking to the cluster.
+type clientLimits struct {
+	qps     float32
+	burst   int
+	timeout time.Duration
+}
+
+// parseClientLimits returns the client limits from the model config
+// attributes (typically inherited from the cloud config), falling back
+// to the defaults for any which are not set.
+func parseClientLimits(attrs map[string]interface{}) (clientLimits, error) {
+	checker := schema.FieldMap(clientConfigFields, clientConfigDefaults)
+	coerced, err := checker.Coerce(attrs, nil)
+	if err != nil {
+		return clientLimits{}, errors.Annotate(err, "validating client config")
+	}
+	values := coerced.(map[string]interface{})
+	qps := values[clientQPSKey].(int)
+	if qps <= 0 {
+		return clientLimits{}, errors.NotValidf("%s %d", clientQPSKey, qps)
+	}
+	burst := values[clientBurstKey].(int)
+	if burst < qps {
+		return clientLimits{}, errors.NotValidf("%s %d less than %s %d", clientBurstKey, burst, clientQPSKey, qps)
+	}
+	timeout, err := time.ParseDuration(values[clientTimeoutKey].(string))
+	if err != nil {
+		return clientLimits{}, errors.Annotatef(err, "parsing %s", clientTimeoutKey)
+	}
+	if timeout < 0 {
+		return clientLimits{}, errors.NotValidf("negative %s %v", clientTimeoutKey, timeout)
+	}
+	return clientLimits{
+		qps:     float32(qps),
+		burst:   burst,
+		timeout: timeout,
+	}, nil
+}
+
+// deletionPropagationKey selects how the dependents of resources deleted
+// by the broker are removed. Foreground deletion (the default) waits for
+// all dependents, such as the pods of a deployment, to be removed first;
+// Background deletion returns once the resource itself is removed and
+// leaves Kubernetes to garbage collect its dependents, which is faster for
+// large applications; Orphan leaves the dependents in place.
+const deletionPropagationKey = "kubernetes-deletion-propagation"
+
+// fallbackStorageClassKey names an existing storage class used for
+// workload filesystems which don't specify a storage class, if no
+// storage class matching their labels and no cluster default storage
+// class is found.
+const fallbackStorageClassKey = "kubernetes-fallback-storage-class"
+
+// parseFallbackStorageClass returns the fallback storage class from
+// the model config attributes, or "" if not set.
+func parseFallbackStorageClass(attrs map[string]interface{}) (string, error) {
+	checker := schema.FieldMap(
+		schema.Fields{fallbackStorageClassKey: schema.String()},
+		schema.Defaults{fallbackStorageClassKey: ""},
+	)
+	coerced, err := checker.Coerce(attrs, nil)
+	if err != nil {
+		return "", errors.Annotate(err, "validating fallback storage class config")
+	}
+	return coerced.(map[string]interface{})[fallbackStorageClassKey].(string), nil
+}
+
+// namespaceTakeoverKey allows a model to take over a namespace which
+// is labelled as owned by a different controller. Without it, the
+// broker refuses to use such a namespace so that two controllers don't
+// fight over the same resources.
+const namespaceTakeoverKey = "kubernetes-namespace-takeover"
+
+// parseNamespaceTakeover returns whether the model config attributes
+// allow taking over a namespace owned by another controller.
+func parseNamespaceTakeover(attrs map[string]interface{}) (bool, error) {
+	checker := schema.FieldMap(
+		schema.Fields{namespaceTakeoverKey: schema.Bool()},
+		schema.Defaults{namespaceTakeoverKey: false},
+	)
+	coerced, err := checker.Coerce(attrs, nil)
+	if err != nil {
+		return false, errors.Annotate(err, "validating namespace takeover config")
+	}
+	return coerced.(map[string]interface{})[namespaceTakeoverKey].(bool), nil
+}
+
+// destroyKeepStorageKey makes destroying the model keep the persistent
+// volumes bound to its claims, by changing their reclaim policy to
+// Retain before the namespace is deleted. The retained volumes must be
+// bound to new claims manually to reuse their data.
+const destroyKeepStorageKey = "kubernetes-destroy-keep-storage"
+
+// parseDestroyKeepStorage returns whether the model config attributes
+// require persistent volumes to be kept when the model is destroyed.
+func parseDestroyKeepStorage(attrs map[string]interface{}) (bool, error) {
+	checker := schema.FieldMap(
+		schema.Fields{destroyKeepStorageKey: schema.Bool()},
+		schema.Defaults{destroyKeepStorageKey: false},
+	)
+	coerced, err := checker.Coerce(attrs, nil)
+	if err != nil {
+		return false, errors.Annotate(err, "validating destroy storage config")
+	}
+	return coerced.(map[string]interface{})[destroyKeepStorageKey].(bool), nil
+}
+
+// parseDeletionPropagation returns the deletion propagation policy from
+// the model config attributes, falling back to the default if not set.
+func parseDeletionPropagation(attrs map[string]interface{}) (v1.DeletionPropagation, error) {
+	value, ok := attrs[deletionPropagationKey]
+	if !ok || value == "" {
+		return defaultPropagationPolicy, nil
+	}
+	policy, ok := value.(string)
+	if !ok {
+		return "", errors.NotValidf("%s %v", deletionPropagationKey, value)
+	}
+	switch v1.DeletionPropagation(policy) {
+	case v1.DeletePropagationForeground, v1.DeletePropagationBackground, v1.DeletePropagationOrphan:
+		return v1.DeletionPropagation(policy), nil
+	}
+	return "", errors.NotValidf("%s %q", deletionPropagationKey, policy)
+}
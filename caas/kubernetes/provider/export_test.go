@@ -5,6 +5,7 @@ package provider
 
 import (
 	core "k8s.io/api/core/v1"
+	k8sstorage "k8s.io/api/storage/v1"
 	"k8s.io/client-go/kubernetes"
 
 	"github.com/juju/juju/caas"
@@ -12,13 +13,27 @@ import (
 )
 
 var (
-	MakeUnitSpec           = makeUnitSpec
-	ParseK8sPodSpec        = parseK8sPodSpec
-	OperatorPod            = operatorPod
-	ExtractRegistryURL     = extractRegistryURL
-	CreateDockerConfigJSON = createDockerConfigJSON
-	NewStorageConfig       = newStorageConfig
-	NewKubernetesWatcher   = newKubernetesWatcher
+	MakeUnitSpec                 = makeUnitSpec
+	ParseK8sPodSpec              = parseK8sPodSpec
+	OperatorPod                  = operatorPod
+	ConfigureOperatorContainer   = configureOperatorContainer
+	ExtractRegistryURL           = extractRegistryURL
+	CreateDockerConfigJSON       = createDockerConfigJSON
+	NewStorageConfig             = newStorageConfig
+	NewKubernetesWatcher         = newKubernetesWatcher
+	DeploymentRolloutStatus      = deploymentRolloutStatus
+	ProxyTransport               = proxyTransport
+	ServiceTargetPort            = serviceTargetPort
+	ParseServerVersion           = parseServerVersion
+	ConfigureAutoProbes          = configureAutoProbes
+	PodQOSClass                  = podQOSClass
+	ConfigureTerminationGrace    = configureTerminationGrace
+	PodTemplateLabels            = podTemplateLabels
+	ConfigureSpreadReplicas      = configureSpreadReplicas
+	PodPorts                     = podPorts
+	ConfigureOperatorAnnotations = configureOperatorAnnotations
+	PersistentVolumeSource       = persistentVolumeSource
+	DeploymentSpecHash           = deploymentSpecHash
 )
 
 type KubernetesWatcher = kubernetesWatcher
@@ -27,12 +42,16 @@ func PodSpec(u *unitSpec) core.PodSpec {
 	return u.Pod
 }
 
+func UnitSpecLabels(u *unitSpec) map[string]string {
+	return u.Labels
+}
+
 func NewProvider() caas.ContainerEnvironProvider {
 	return kubernetesEnvironProvider{}
 }
 
 func StorageProvider(k8sClient kubernetes.Interface, namespace string) storage.Provider {
-	return &storageProvider{&kubernetesClient{Interface: k8sClient, namespace: namespace}}
+	return &storageProvider{&kubernetesClient{clientUnlocked: k8sClient, namespace: namespace}}
 }
 
 func StorageClass(cfg *storageConfig) string {
@@ -50,3 +69,19 @@ func StorageProvisioner(cfg *storageConfig) string {
 func StorageParameters(cfg *storageConfig) map[string]string {
 	return cfg.parameters
 }
+
+func StorageReclaimPolicy(cfg *storageConfig) core.PersistentVolumeReclaimPolicy {
+	return cfg.reclaimPolicy
+}
+
+func StorageVolumeBindingMode(cfg *storageConfig) *k8sstorage.VolumeBindingMode {
+	return cfg.volumeBindingMode
+}
+
+func DefaultVolumeBindingMode(broker caas.Broker) *k8sstorage.VolumeBindingMode {
+	return broker.(*kubernetesClient).defaultVolumeBindingMode()
+}
+
+func CheckRuntimeClass(broker caas.Broker, name string) error {
+	return broker.(*kubernetesClient).checkRuntimeClass(&name)
+}
@@ -5,9 +5,18 @@ package provider
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -15,14 +24,17 @@ import (
 	"time"
 
 	jujuclock "github.com/juju/clock"
+	"github.com/juju/collections/set"
 	"github.com/juju/errors"
 	"github.com/juju/loggo"
 	"github.com/juju/utils/arch"
 	"github.com/juju/utils/keyvalues"
+	"github.com/juju/version"
 	"gopkg.in/juju/names.v2"
 	apps "k8s.io/api/apps/v1"
 	core "k8s.io/api/core/v1"
 	"k8s.io/api/extensions/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	k8sstorage "k8s.io/api/storage/v1"
 	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
@@ -30,13 +42,17 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/yaml"
+	k8sversion "k8s.io/apimachinery/pkg/version"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 
 	"github.com/juju/juju/agent"
+	"github.com/juju/juju/agent/tools"
 	"github.com/juju/juju/caas"
 	"github.com/juju/juju/cloudconfig/podcfg"
 	"github.com/juju/juju/core/application"
@@ -46,9 +62,11 @@ import (
 	"github.com/juju/juju/environs"
 	"github.com/juju/juju/environs/config"
 	"github.com/juju/juju/environs/context"
+	jujunames "github.com/juju/juju/juju/names"
 	"github.com/juju/juju/juju/paths"
 	"github.com/juju/juju/network"
 	"github.com/juju/juju/storage"
+	"github.com/juju/juju/utils/proxy"
 )
 
 var logger = loggo.GetLogger("juju.kubernetes.provider")
@@ -59,18 +77,72 @@ const (
 	labelVersion     = "juju-version"
 	labelApplication = "juju-application"
 	labelModel       = "juju-model"
+	labelTrack       = "juju-track"
+	labelContainer   = "juju-container"
+
+	// defaultTrack is the track label value of the pods of an
+	// application's main deployment, so that its service can be
+	// switched back to them from another track.
+	defaultTrack = "default"
+
+	labelModelUUID      = "juju-model-uuid"
+	labelControllerUUID = "juju-controller-uuid"
+
+	// annotationStoppedReplicas records the number of replicas
+	// of an application's workload before it was stopped.
+	annotationStoppedReplicas = "juju-stopped-replicas"
+
+	// annotationSpecHash records a hash of the fields Juju sets on
+	// an application's deployment, so that it is only updated when
+	// they change.
+	annotationSpecHash = "juju-spec-hash"
+
+	// annotationDeploymentRevision is the annotation on which the
+	// deployment controller records the revision of a deployment's
+	// replica sets.
+	annotationDeploymentRevision = "deployment.kubernetes.io/revision"
+
+	// annotationTopologyAwareHints enables topology aware routing of
+	// traffic to a service's endpoints. It is ignored by clusters
+	// without EndpointSlice topology aware hints, and by clusters
+	// whose zones have too few endpoints to allocate hints.
+	annotationTopologyAwareHints = "service.kubernetes.io/topology-aware-hints"
 
 	defaultOperatorStorageClassName = "juju-operator-storage"
 
 	gpuAffinityNodeSelectorKey = "gpu"
+
+	// labelZone is the well known node label holding the
+	// availability zone a node is running in.
+	labelZone = "failure-domain.beta.kubernetes.io/zone"
+
+	// containerReasonOOMKilled is the reason given for a container
+	// which was killed for exceeding its memory limit.
+	containerReasonOOMKilled = "OOMKilled"
+
+	// containerReasonErrImagePull and containerReasonImagePullBackOff
+	// are the reasons given for a container waiting on an image which
+	// can't be pulled, first when the pull fails and then while kubelet
+	// backs off retrying it.
+	containerReasonErrImagePull     = "ErrImagePull"
+	containerReasonImagePullBackOff = "ImagePullBackOff"
 )
 
 var defaultPropagationPolicy = v1.DeletePropagationForeground
 
 type kubernetesClient struct {
 	clock jujuclock.Clock
-	kubernetes.Interface
-	apiextensionsClient apiextensionsclientset.Interface
+
+	// The k8s clients are replaced when the cloud credential is
+	// updated, so they must be accessed under lock, using the
+	// client, extendedClient and watchClient methods.
+	clientUnlocked              kubernetes.Interface
+	apiextensionsClientUnlocked apiextensionsclientset.Interface
+
+	// watchClientUnlocked is used to create watches. Watches are long
+	// lived requests, so unlike the other clients it has no request
+	// timeout.
+	watchClientUnlocked kubernetes.Interface
 
 	// namespace is the k8s namespace to use when
 	// creating k8s resources.
@@ -82,17 +154,37 @@ type kubernetesClient struct {
 	// modelUUID is the UUID of the model this client acts on.
 	modelUUID string
 
+	// controllerUUID is the UUID of the controller managing the model.
+	// It may be empty if the broker was opened without it.
+	controllerUUID string
+
+	// storageEndpoint is the cloud's object storage endpoint, if any.
+	storageEndpoint string
+
+	// connectionInfo describes the k8s client config,
+	// without any secrets.
+	connectionInfo caas.ConnectionInfo
+
+	// newClient is used to create the k8s clients, and to
+	// recreate them when the cloud credential is updated.
+	newClient NewK8sClientFunc
+
 	// newWatcher is the k8s watcher generator.
 	newWatcher NewK8sWatcherFunc
+
+	// watchers holds the running watchers created with the current
+	// k8s client, which are stopped if the client is replaced.
+	watchers map[*kubernetesWatcher]bool
 }
 
 // To regenerate the mocks for the kubernetes Client used by this broker,
 // run "go generate" from the package directory.
 //go:generate mockgen -package mocks -destination mocks/k8sclient_mock.go k8s.io/client-go/kubernetes Interface
-//go:generate mockgen -package mocks -destination mocks/appv1_mock.go k8s.io/client-go/kubernetes/typed/apps/v1 AppsV1Interface,DeploymentInterface,StatefulSetInterface
-//go:generate mockgen -package mocks -destination mocks/corev1_mock.go k8s.io/client-go/kubernetes/typed/core/v1 CoreV1Interface,NamespaceInterface,PodInterface,ServiceInterface,ConfigMapInterface,PersistentVolumeInterface,PersistentVolumeClaimInterface,SecretInterface
+//go:generate mockgen -package mocks -destination mocks/appv1_mock.go k8s.io/client-go/kubernetes/typed/apps/v1 AppsV1Interface,DeploymentInterface,StatefulSetInterface,ReplicaSetInterface
+//go:generate mockgen -package mocks -destination mocks/corev1_mock.go k8s.io/client-go/kubernetes/typed/core/v1 CoreV1Interface,NamespaceInterface,PodInterface,ServiceInterface,ConfigMapInterface,PersistentVolumeInterface,PersistentVolumeClaimInterface,SecretInterface,EventInterface,NodeInterface,EndpointsInterface
 //go:generate mockgen -package mocks -destination mocks/extenstionsv1_mock.go k8s.io/client-go/kubernetes/typed/extensions/v1beta1 ExtensionsV1beta1Interface,IngressInterface
 //go:generate mockgen -package mocks -destination mocks/storagev1_mock.go k8s.io/client-go/kubernetes/typed/storage/v1 StorageV1Interface,StorageClassInterface
+//go:generate mockgen -package mocks -destination mocks/networkingv1_mock.go k8s.io/client-go/kubernetes/typed/networking/v1 NetworkingV1Interface,NetworkPolicyInterface
 
 // NewK8sClientFunc defines a function which returns a k8s client based on the supplied config.
 type NewK8sClientFunc func(c *rest.Config) (kubernetes.Interface, apiextensionsclientset.Interface, error)
@@ -104,31 +196,150 @@ type NewK8sWatcherFunc func(wi watch.Interface, name string, clock jujuclock.Clo
 func NewK8sBroker(
 	cloudSpec environs.CloudSpec,
 	cfg *config.Config,
+	controllerUUID string,
 	newClient NewK8sClientFunc,
 	newWatcher NewK8sWatcherFunc,
 	clock jujuclock.Clock,
 ) (caas.Broker, error) {
-	k8sConfig, err := newK8sConfig(cloudSpec)
+	newCfg, err := providerInstance.newConfig(cfg)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
-	k8sClient, apiextensionsClient, err := newClient(k8sConfig)
+	k8sConfig, err := newClientConfig(cloudSpec, newCfg)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
-	newCfg, err := providerInstance.newConfig(cfg)
+	k8sClient, watchClient, apiextensionsClient, err := newClients(newClient, k8sConfig)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
-	return &kubernetesClient{
-		clock:               clock,
-		Interface:           k8sClient,
-		apiextensionsClient: apiextensionsClient,
-		namespace:           newCfg.Name(),
-		envCfg:              newCfg,
-		modelUUID:           newCfg.UUID(),
-		newWatcher:          newWatcher,
-	}, nil
+	k := &kubernetesClient{
+		clock:                       clock,
+		clientUnlocked:              k8sClient,
+		apiextensionsClientUnlocked: apiextensionsClient,
+		watchClientUnlocked:         watchClient,
+		namespace:                   newCfg.Name(),
+		envCfg:                      newCfg,
+		modelUUID:                   newCfg.UUID(),
+		controllerUUID:              controllerUUID,
+		storageEndpoint:             cloudSpec.StorageEndpoint,
+		connectionInfo:              connectionInfo(cloudSpec, k8sConfig),
+		newClient:                   newClient,
+		watchers:                    make(map[*kubernetesWatcher]bool),
+	}
+	k.newWatcher = k.trackWatchers(newWatcher)
+	return k, nil
+}
+
+// newClientConfig returns the k8s client config for the
+// cloud spec, with the client limits from the model config.
+func newClientConfig(cloudSpec environs.CloudSpec, cfg *config.Config) (*rest.Config, error) {
+	limits, err := parseClientLimits(cfg.UnknownAttrs())
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	k8sConfig, err := newK8sConfig(cloudSpec)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	k8sConfig.QPS = limits.qps
+	k8sConfig.Burst = limits.burst
+	k8sConfig.Timeout = limits.timeout
+	return k8sConfig, nil
+}
+
+// newClients returns the k8s clients for the client config, along with
+// a client for watches which does not apply the config's request timeout.
+// The timeout would otherwise close every watch when it expires.
+func newClients(newClient NewK8sClientFunc, k8sConfig *rest.Config) (
+	k8sClient, watchClient kubernetes.Interface, apiextensionsClient apiextensionsclientset.Interface, err error,
+) {
+	k8sClient, apiextensionsClient, err = newClient(k8sConfig)
+	if err != nil {
+		return nil, nil, nil, errors.Trace(err)
+	}
+	watchConfig := *k8sConfig
+	watchConfig.Timeout = 0
+	watchClient, _, err = newClient(&watchConfig)
+	if err != nil {
+		return nil, nil, nil, errors.Annotate(err, "creating watch client")
+	}
+	return k8sClient, watchClient, apiextensionsClient, nil
+}
+
+// client returns the k8s client for the current cloud credential.
+func (k *kubernetesClient) client() kubernetes.Interface {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return k.clientUnlocked
+}
+
+// extendedClient returns the k8s apiextensions client for the
+// current cloud credential.
+func (k *kubernetesClient) extendedClient() apiextensionsclientset.Interface {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return k.apiextensionsClientUnlocked
+}
+
+// watchClient returns the k8s client, without a request timeout,
+// used to create watches for the current cloud credential.
+func (k *kubernetesClient) watchClient() kubernetes.Interface {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return k.watchClientUnlocked
+}
+
+// trackWatchers returns a watcher generator which records the
+// watchers it creates until they stop.
+func (k *kubernetesClient) trackWatchers(newWatcher NewK8sWatcherFunc) NewK8sWatcherFunc {
+	return func(wi watch.Interface, name string, clock jujuclock.Clock) (*kubernetesWatcher, error) {
+		w, err := newWatcher(wi, name, clock)
+		if err != nil {
+			return nil, err
+		}
+		k.lock.Lock()
+		k.watchers[w] = true
+		k.lock.Unlock()
+		go func() {
+			_ = w.Wait()
+			k.lock.Lock()
+			delete(k.watchers, w)
+			k.lock.Unlock()
+		}()
+		return w, nil
+	}
+}
+
+// UpdateCredential is part of the Broker interface.
+// The k8s clients are recreated from the cloud spec, and any running
+// watchers are stopped with an error so that they are restarted by
+// their consumers using the new clients. Calls already in progress
+// complete using the old clients.
+func (k *kubernetesClient) UpdateCredential(cloudSpec environs.CloudSpec) error {
+	k8sConfig, err := newClientConfig(cloudSpec, k.Config())
+	if err != nil {
+		return errors.Trace(err)
+	}
+	k8sClient, watchClient, apiextensionsClient, err := newClients(k.newClient, k8sConfig)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	k.lock.Lock()
+	k.clientUnlocked = k8sClient
+	k.apiextensionsClientUnlocked = apiextensionsClient
+	k.watchClientUnlocked = watchClient
+	k.storageEndpoint = cloudSpec.StorageEndpoint
+	k.connectionInfo = connectionInfo(cloudSpec, k8sConfig)
+	watchers := k.watchers
+	k.watchers = make(map[*kubernetesWatcher]bool)
+	k.lock.Unlock()
+
+	for w := range watchers {
+		w.killWithError(errors.Errorf("k8s credential updated, restarting %v watcher", w.name))
+	}
+	return nil
 }
 
 func newK8sConfig(cloudSpec environs.CloudSpec) (*rest.Config, error) {
@@ -151,9 +362,91 @@ func newK8sConfig(cloudSpec environs.CloudSpec) (*rest.Config, error) {
 			KeyData:  []byte(credentialAttrs[CredAttrClientKeyData]),
 			CAData:   CAData,
 		},
+		WrapTransport: proxyTransport,
 	}, nil
 }
 
+// connectionInfo returns the details of the k8s client config made from
+// the cloud spec which are safe to report, omitting all secrets.
+func connectionInfo(cloudSpec environs.CloudSpec, k8sConfig *rest.Config) caas.ConnectionInfo {
+	info := caas.ConnectionInfo{
+		Endpoint:             k8sConfig.Host,
+		Username:             k8sConfig.Username,
+		HasCACertificate:     len(k8sConfig.CAData) > 0 || k8sConfig.CAFile != "",
+		HasPassword:          k8sConfig.Password != "",
+		HasClientCertificate: len(k8sConfig.CertData) > 0 || k8sConfig.CertFile != "",
+		HasToken:             k8sConfig.BearerToken != "",
+	}
+	if cloudSpec.Credential != nil {
+		info.AuthType = string(cloudSpec.Credential.AuthType())
+	}
+	return info
+}
+
+// proxyTransport configures the transport used to talk to the cluster
+// to use the controller's proxy settings. The settings are those
+// detected from the environment or set by the proxy updater, and any
+// no-proxy exclusions (including CIDRs for in-cluster endpoints)
+// are honoured.
+func proxyTransport(rt http.RoundTripper) http.RoundTripper {
+	transport, ok := rt.(*http.Transport)
+	if !ok {
+		return rt
+	}
+	// The transport may be shared with unrelated clients, being either
+	// http.DefaultTransport or one cached by client-go for the TLS
+	// config, so set the proxy on a copy rather than the original.
+	return copyTransport(transport, proxy.DefaultConfig.GetProxy)
+}
+
+// copyTransport returns a new transport with the same settings as t,
+// but using the specified proxy function. A Transport cannot be copied
+// by value as it contains a mutex, and http.Transport.Clone is not
+// available in the Go versions we support.
+func copyTransport(t *http.Transport, proxyFunc func(*http.Request) (*url.URL, error)) *http.Transport {
+	out := &http.Transport{
+		Proxy:                  proxyFunc,
+		DialContext:            t.DialContext,
+		Dial:                   t.Dial,
+		DialTLS:                t.DialTLS,
+		TLSHandshakeTimeout:    t.TLSHandshakeTimeout,
+		DisableKeepAlives:      t.DisableKeepAlives,
+		DisableCompression:     t.DisableCompression,
+		MaxIdleConns:           t.MaxIdleConns,
+		MaxIdleConnsPerHost:    t.MaxIdleConnsPerHost,
+		MaxConnsPerHost:        t.MaxConnsPerHost,
+		IdleConnTimeout:        t.IdleConnTimeout,
+		ResponseHeaderTimeout:  t.ResponseHeaderTimeout,
+		ExpectContinueTimeout:  t.ExpectContinueTimeout,
+		ProxyConnectHeader:     t.ProxyConnectHeader,
+		MaxResponseHeaderBytes: t.MaxResponseHeaderBytes,
+	}
+	if t.TLSClientConfig != nil {
+		out.TLSClientConfig = t.TLSClientConfig.Clone()
+	}
+	if t.TLSNextProto != nil {
+		out.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper, len(t.TLSNextProto))
+		for k, v := range t.TLSNextProto {
+			out.TLSNextProto[k] = v
+		}
+	}
+	return out
+}
+
+// StorageEndpoint is part of the Broker interface.
+func (k *kubernetesClient) StorageEndpoint() string {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return k.storageEndpoint
+}
+
+// ConnectionInfo is part of the Broker interface.
+func (k *kubernetesClient) ConnectionInfo() (caas.ConnectionInfo, error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return k.connectionInfo, nil
+}
+
 // Config returns environ config.
 func (k *kubernetesClient) Config() *config.Config {
 	k.lock.Lock()
@@ -162,6 +455,53 @@ func (k *kubernetesClient) Config() *config.Config {
 	return cfg
 }
 
+// propagationPolicy returns the policy used when deleting the
+// dependents of resources deleted by the broker, as set in the
+// model config.
+func (k *kubernetesClient) propagationPolicy() *v1.DeletionPropagation {
+	policy := defaultPropagationPolicy
+	if cfg := k.Config(); cfg != nil {
+		if configured, err := parseDeletionPropagation(cfg.UnknownAttrs()); err == nil {
+			policy = configured
+		}
+	}
+	return &policy
+}
+
+// fallbackStorageClass returns the storage class configured for the model
+// to use for workload filesystems when no other storage class is found.
+// Invalid config is rejected when it is validated, so is ignored here.
+func (k *kubernetesClient) fallbackStorageClass() string {
+	cfg := k.Config()
+	if cfg == nil {
+		return ""
+	}
+	name, _ := parseFallbackStorageClass(cfg.UnknownAttrs())
+	return name
+}
+
+// namespaceTakeover returns whether the model config allows taking
+// over a namespace owned by another controller.
+func (k *kubernetesClient) namespaceTakeover() bool {
+	cfg := k.Config()
+	if cfg == nil {
+		return false
+	}
+	takeover, _ := parseNamespaceTakeover(cfg.UnknownAttrs())
+	return takeover
+}
+
+// destroyKeepStorage returns whether the model config requires
+// persistent volumes to be kept when the model is destroyed.
+func (k *kubernetesClient) destroyKeepStorage() bool {
+	cfg := k.Config()
+	if cfg == nil {
+		return false
+	}
+	keep, _ := parseDestroyKeepStorage(cfg.UnknownAttrs())
+	return keep
+}
+
 // SetConfig is specified in the Environ interface.
 func (k *kubernetesClient) SetConfig(cfg *config.Config) error {
 	k.lock.Lock()
@@ -252,15 +592,23 @@ func (k *kubernetesClient) Destroy(callbacks context.ProviderCallContext) error
 	}
 	defer watcher.Kill()
 
+	if k.destroyKeepStorage() {
+		if err := k.retainPersistentVolumes(); err != nil {
+			return errors.Annotate(err, "retaining model persistent volumes")
+		}
+	}
 	if err := k.deleteNamespace(); err != nil {
 		return errors.Annotate(err, "deleting model namespace")
 	}
 
 	// Delete any storage classes created as part of this model.
 	// Storage classes live outside the namespace so need to be deleted separately.
-	modelSelector := fmt.Sprintf("%s==%s", labelModel, k.namespace)
-	err = k.StorageV1().StorageClasses().DeleteCollection(&v1.DeleteOptions{
-		PropagationPolicy: &defaultPropagationPolicy,
+	// Only classes labelled with the model UUID were created by Juju; classes
+	// which were only labelled with the model name to be selected for its
+	// storage are left alone.
+	modelSelector := fmt.Sprintf("%s==%s,%s==%s", labelModel, k.namespace, labelModelUUID, k.modelUUID)
+	err = k.client().StorageV1().StorageClasses().DeleteCollection(&v1.DeleteOptions{
+		PropagationPolicy: k.propagationPolicy(),
 	}, v1.ListOptions{
 		LabelSelector: modelSelector,
 	})
@@ -288,7 +636,7 @@ func (k *kubernetesClient) Destroy(callbacks context.ProviderCallContext) error
 
 // Namespaces returns names of the namespaces on the cluster.
 func (k *kubernetesClient) Namespaces() ([]string, error) {
-	namespaces := k.CoreV1().Namespaces()
+	namespaces := k.client().CoreV1().Namespaces()
 	ns, err := namespaces.List(v1.ListOptions{IncludeUninitialized: true})
 	if err != nil {
 		return nil, errors.Annotate(err, "listing namespaces")
@@ -300,12 +648,85 @@ func (k *kubernetesClient) Namespaces() ([]string, error) {
 	return result, nil
 }
 
+// ListManagedNamespaces is part of the Broker interface. Namespaces
+// are cluster scoped, so the cluster must allow the controller to list
+// them; a Forbidden error is returned otherwise.
+func (k *kubernetesClient) ListManagedNamespaces() ([]string, error) {
+	if k.controllerUUID == "" {
+		return nil, errors.New("listing managed namespaces requires a controller UUID")
+	}
+	ns, err := k.client().CoreV1().Namespaces().List(v1.ListOptions{
+		LabelSelector:        fmt.Sprintf("%v==%v", labelControllerUUID, k.controllerUUID),
+		IncludeUninitialized: true,
+	})
+	if k8serrors.IsForbidden(err) {
+		return nil, errors.NewForbidden(err, "listing namespaces requires cluster wide permission to list namespaces")
+	}
+	if err != nil {
+		return nil, errors.Annotate(err, "listing namespaces")
+	}
+	result := make([]string, len(ns.Items))
+	for i, n := range ns.Items {
+		result[i] = n.Name
+	}
+	return result, nil
+}
+
+// ServerVersion is part of the Broker interface.
+func (k *kubernetesClient) ServerVersion() (version.Number, error) {
+	info, err := k.client().Discovery().ServerVersion()
+	if err != nil {
+		return version.Zero, errors.Annotate(err, "getting server version")
+	}
+	return parseServerVersion(info)
+}
+
+// Ping is part of the Broker interface. It gets the namespace, which
+// is a cheap request that, unlike getting the server version, must
+// be authorized.
+func (k *kubernetesClient) Ping() error {
+	_, err := k.client().CoreV1().Namespaces().Get(k.namespace, v1.GetOptions{IncludeUninitialized: true})
+	switch {
+	case err == nil, k8serrors.IsNotFound(err):
+		return nil
+	case k8serrors.IsUnauthorized(err):
+		return errors.NewUnauthorized(err, "cluster rejected credential")
+	case k8serrors.IsForbidden(err):
+		return errors.NewForbidden(err, fmt.Sprintf("credential not permitted to get namespace %q", k.namespace))
+	}
+	return errors.Wrapf(err, caas.ErrUnreachable, "%v", err)
+}
+
+// parseServerVersion returns the version reported by an API server.
+// Vendor builds add suffixes to the git version, eg v1.18.3-gke.1,
+// which are ignored.
+func parseServerVersion(info *k8sversion.Info) (version.Number, error) {
+	gitVersion := strings.TrimPrefix(info.GitVersion, "v")
+	if i := strings.IndexAny(gitVersion, "-+"); i >= 0 {
+		gitVersion = gitVersion[:i]
+	}
+	if n, err := version.Parse(gitVersion); err == nil {
+		return n, nil
+	}
+	// Fall back to the major and minor versions,
+	// which some vendors also suffix, eg 18+.
+	major, err := strconv.Atoi(strings.TrimSuffix(info.Major, "+"))
+	if err != nil {
+		return version.Zero, errors.NotValidf("server version %q", info.GitVersion)
+	}
+	minor, err := strconv.Atoi(strings.TrimSuffix(info.Minor, "+"))
+	if err != nil {
+		return version.Zero, errors.NotValidf("server version %q", info.GitVersion)
+	}
+	return version.Number{Major: major, Minor: minor}, nil
+}
+
 // GetNamespace returns the namespace for the specified name or current namespace.
 func (k *kubernetesClient) GetNamespace(name string) (*core.Namespace, error) {
 	if name == "" {
 		name = k.namespace
 	}
-	ns, err := k.CoreV1().Namespaces().Get(name, v1.GetOptions{IncludeUninitialized: true})
+	ns, err := k.client().CoreV1().Namespaces().Get(name, v1.GetOptions{IncludeUninitialized: true})
 	if k8serrors.IsNotFound(err) {
 		return nil, errors.NotFoundf("namespace %q", name)
 	}
@@ -315,23 +736,103 @@ func (k *kubernetesClient) GetNamespace(name string) (*core.Namespace, error) {
 	return ns, nil
 }
 
-// EnsureNamespace ensures this broker's namespace is created.
+// EnsureNamespace ensures this broker's namespace is created and
+// labelled with the model and controller which own it. Any labels
+// set on an existing namespace by others are preserved. An existing
+// namespace owned by a different controller is only taken over if
+// the model config allows it; otherwise an AlreadyExists error is
+// returned.
 func (k *kubernetesClient) EnsureNamespace() error {
-	ns := &core.Namespace{ObjectMeta: v1.ObjectMeta{Name: k.namespace}}
-	namespaces := k.CoreV1().Namespaces()
-	_, err := namespaces.Update(ns)
+	namespaces := k.client().CoreV1().Namespaces()
+	ns, err := namespaces.Get(k.namespace, v1.GetOptions{IncludeUninitialized: true})
 	if k8serrors.IsNotFound(err) {
+		ns = &core.Namespace{ObjectMeta: v1.ObjectMeta{Name: k.namespace}}
+		k.setNamespaceMetadata(ns)
 		_, err = namespaces.Create(ns)
+		return errors.Trace(err)
+	}
+	if err != nil {
+		return errors.Trace(err)
 	}
+	owner := ns.Labels[labelControllerUUID]
+	if k.controllerUUID != "" && owner != "" && owner != k.controllerUUID {
+		if !k.namespaceTakeover() {
+			return errors.NewAlreadyExists(nil, fmt.Sprintf(
+				"namespace %q is owned by controller %q, set %s to take it over",
+				k.namespace, owner, namespaceTakeoverKey,
+			))
+		}
+		logger.Warningf("taking over namespace %q from controller %q", k.namespace, owner)
+	}
+	if !k.setNamespaceMetadata(ns) {
+		return nil
+	}
+	_, err = namespaces.Update(ns)
 	return errors.Trace(err)
 }
 
+// setNamespaceMetadata merges the labels identifying the owning
+// model and controller into the namespace, returning true if any
+// label changed.
+func (k *kubernetesClient) setNamespaceMetadata(ns *core.Namespace) bool {
+	labels := map[string]string{
+		labelModel:     k.namespace,
+		labelModelUUID: k.modelUUID,
+	}
+	if k.controllerUUID != "" {
+		labels[labelControllerUUID] = k.controllerUUID
+	}
+	if ns.Labels == nil {
+		ns.Labels = make(map[string]string)
+	}
+	changed := false
+	for key, value := range labels {
+		if ns.Labels[key] != value {
+			ns.Labels[key] = value
+			changed = true
+		}
+	}
+	return changed
+}
+
+// retainPersistentVolumes sets the reclaim policy of the persistent
+// volumes bound to claims in the namespace to Retain, so that their
+// data survives the claims being deleted with the namespace.
+func (k *kubernetesClient) retainPersistentVolumes() error {
+	pvcs, err := k.client().CoreV1().PersistentVolumeClaims(k.namespace).List(v1.ListOptions{})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	pvs := k.client().CoreV1().PersistentVolumes()
+	for _, pvc := range pvcs.Items {
+		if pvc.Spec.VolumeName == "" {
+			continue
+		}
+		pv, err := pvs.Get(pvc.Spec.VolumeName, v1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if pv.Spec.PersistentVolumeReclaimPolicy == core.PersistentVolumeReclaimRetain {
+			continue
+		}
+		pv.Spec.PersistentVolumeReclaimPolicy = core.PersistentVolumeReclaimRetain
+		if _, err := pvs.Update(pv); err != nil {
+			return errors.Annotatef(err, "retaining persistent volume %v", pv.Name)
+		}
+		logger.Infof("retaining persistent volume %v bound to claim %v", pv.Name, pvc.Name)
+	}
+	return nil
+}
+
 func (k *kubernetesClient) deleteNamespace() error {
 	// deleteNamespace is used as a means to implement Destroy().
 	// All model resources are provisioned in the namespace;
 	// deleting the namespace will also delete those resources.
-	err := k.CoreV1().Namespaces().Delete(k.namespace, &v1.DeleteOptions{
-		PropagationPolicy: &defaultPropagationPolicy,
+	err := k.client().CoreV1().Namespaces().Delete(k.namespace, &v1.DeleteOptions{
+		PropagationPolicy: k.propagationPolicy(),
 	})
 	if k8serrors.IsNotFound(err) {
 		return nil
@@ -342,7 +843,7 @@ func (k *kubernetesClient) deleteNamespace() error {
 // WatchNamespace returns a watcher which notifies when there
 // are changes to current namespace.
 func (k *kubernetesClient) WatchNamespace() (watcher.NotifyWatcher, error) {
-	w, err := k.CoreV1().Namespaces().Watch(
+	w, err := k.watchClient().CoreV1().Namespaces().Watch(
 		v1.ListOptions{
 			FieldSelector:        fields.OneTermEqualSelector("metadata.name", k.namespace).String(),
 			IncludeUninitialized: true,
@@ -354,39 +855,130 @@ func (k *kubernetesClient) WatchNamespace() (watcher.NotifyWatcher, error) {
 	return k.newWatcher(w, k.namespace, k.clock)
 }
 
-// EnsureSecret ensures a secret exists for use with retrieving images from private registries
-func (k *kubernetesClient) ensureSecret(imageSecretName, appName string, imageDetails *caas.ImageDetails, resourceTags map[string]string) error {
+// EnsureSecret ensures a secret exists for use with retrieving images from private registries,
+// reporting whether it was created.
+func (k *kubernetesClient) ensureSecret(
+	imageSecretName, appName string, imageDetails *caas.ImageDetails, resourceTags map[string]string, ownerRefs []v1.OwnerReference,
+) (created bool, _ error) {
 	if imageDetails.Password == "" {
-		return errors.New("attempting to create a secret with no password")
+		return false, errors.New("attempting to create a secret with no password")
 	}
 	secretData, err := createDockerConfigJSON(imageDetails)
 	if err != nil {
-		return errors.Trace(err)
+		return false, errors.Trace(err)
 	}
-	secrets := k.CoreV1().Secrets(k.namespace)
-
 	newSecret := &core.Secret{
 		ObjectMeta: v1.ObjectMeta{
-			Name:      imageSecretName,
-			Namespace: k.namespace,
-			Labels:    resourceTags},
+			Name:            imageSecretName,
+			Namespace:       k.namespace,
+			Labels:          resourceTags,
+			OwnerReferences: ownerRefs,
+		},
 		Type: core.SecretTypeDockerConfigJson,
 		Data: map[string][]byte{
 			core.DockerConfigJsonKey: secretData,
 		},
 	}
 
+	secrets := k.client().CoreV1().Secrets(k.namespace)
+	existing, err := secrets.Get(imageSecretName, v1.GetOptions{IncludeUninitialized: true})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return false, errors.Trace(err)
+	}
+	if err == nil && !secretChanged(existing, newSecret) {
+		logger.Debugf("secret %s for %s unchanged", imageSecretName, appName)
+		return false, nil
+	}
 	_, err = secrets.Update(newSecret)
 	if k8serrors.IsNotFound(err) {
 		_, err = secrets.Create(newSecret)
+		created = err == nil
 	}
-	return errors.Trace(err)
+	return created, errors.Trace(err)
+}
+
+// secretChanged returns true if updating the existing secret to the
+// spec would change its type, data, owner or the labels Juju sets.
+func secretChanged(existing, spec *core.Secret) bool {
+	return !mapContains(existing.Labels, spec.Labels) ||
+		!ownerReferencesEqual(existing.OwnerReferences, spec.OwnerReferences) ||
+		existing.Type != spec.Type ||
+		!reflect.DeepEqual(existing.Data, spec.Data)
+}
+
+// checkImagePullSecrets returns a NotFound error if any of the
+// referenced image pull secrets do not exist in the namespace.
+func (k *kubernetesClient) checkImagePullSecrets(refs []core.LocalObjectReference) error {
+	secrets := k.client().CoreV1().Secrets(k.namespace)
+	for _, ref := range refs {
+		_, err := secrets.Get(ref.Name, v1.GetOptions{IncludeUninitialized: true})
+		if k8serrors.IsNotFound(err) {
+			return errors.NotFoundf("image pull secret %q", ref.Name)
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// runtimeClassVersions are the node.k8s.io API versions which may
+// serve runtime classes, depending on the cluster's version.
+var runtimeClassVersions = []string{"v1", "v1beta1", "v1alpha1"}
+
+// checkRuntimeClass returns a NotFound error if the named runtime class,
+// if any, does not exist in the cluster. There is no typed client for
+// runtime classes, so each API version is queried directly.
+func (k *kubernetesClient) checkRuntimeClass(name *string) error {
+	if name == nil {
+		return nil
+	}
+	restClient := k.client().Discovery().RESTClient()
+	for _, apiVersion := range runtimeClassVersions {
+		err := restClient.Get().AbsPath("/apis/node.k8s.io", apiVersion, "runtimeclasses", *name).Do().Error()
+		if err == nil {
+			return nil
+		}
+		if !k8serrors.IsNotFound(err) {
+			return errors.Annotatef(err, "getting runtime class %q", *name)
+		}
+	}
+	return errors.NotFoundf("runtime class %q", *name)
+}
+
+// checkEnvFromSources returns a NotFound error if a secret or config map
+// which a container's environment is read from does not exist, unless
+// the reference is optional.
+func (k *kubernetesClient) checkEnvFromSources(containers []core.Container) error {
+	for _, c := range containers {
+		for _, source := range c.EnvFrom {
+			if ref := source.SecretRef; ref != nil && (ref.Optional == nil || !*ref.Optional) {
+				_, err := k.client().CoreV1().Secrets(k.namespace).Get(ref.Name, v1.GetOptions{IncludeUninitialized: true})
+				if k8serrors.IsNotFound(err) {
+					return errors.NotFoundf("secret %q for environment of container %q", ref.Name, c.Name)
+				}
+				if err != nil {
+					return errors.Trace(err)
+				}
+			}
+			if ref := source.ConfigMapRef; ref != nil && (ref.Optional == nil || !*ref.Optional) {
+				_, err := k.client().CoreV1().ConfigMaps(k.namespace).Get(ref.Name, v1.GetOptions{IncludeUninitialized: true})
+				if k8serrors.IsNotFound(err) {
+					return errors.NotFoundf("config map %q for environment of container %q", ref.Name, c.Name)
+				}
+				if err != nil {
+					return errors.Trace(err)
+				}
+			}
+		}
+	}
+	return nil
 }
 
 func (k *kubernetesClient) deleteSecret(imageSecretName string) error {
-	secrets := k.CoreV1().Secrets(k.namespace)
+	secrets := k.client().CoreV1().Secrets(k.namespace)
 	err := secrets.Delete(imageSecretName, &v1.DeleteOptions{
-		PropagationPolicy: &defaultPropagationPolicy,
+		PropagationPolicy: k.propagationPolicy(),
 	})
 	if k8serrors.IsNotFound(err) {
 		return nil
@@ -397,7 +989,7 @@ func (k *kubernetesClient) deleteSecret(imageSecretName string) error {
 // OperatorExists returns true if the operator for the specified
 // application exists.
 func (k *kubernetesClient) OperatorExists(appName string) (bool, error) {
-	statefulsets := k.AppsV1().StatefulSets(k.namespace)
+	statefulsets := k.client().AppsV1().StatefulSets(k.namespace)
 	_, err := statefulsets.Get(operatorName(appName), v1.GetOptions{IncludeUninitialized: true})
 	if k8serrors.IsNotFound(err) {
 		return false, nil
@@ -411,26 +1003,40 @@ func (k *kubernetesClient) OperatorExists(appName string) (bool, error) {
 // EnsureOperator creates or updates an operator pod with the given application
 // name, agent path, and operator config.
 func (k *kubernetesClient) EnsureOperator(appName, agentPath string, config *caas.OperatorConfig) error {
+	_, err := k.ReconcileOperator(appName, agentPath, config)
+	return err
+}
+
+// ReconcileOperator creates or updates an operator pod with the given
+// application name, agent path, and operator config, and reports what
+// was changed.
+func (k *kubernetesClient) ReconcileOperator(appName, agentPath string, config *caas.OperatorConfig) (caas.OperatorChange, error) {
 	logger.Debugf("creating/updating %s operator", appName)
 
 	// TODO(caas) - this is a stop gap until we implement a CAAS model manager worker
 	// First up, ensure the namespace eis there if not already created.
 	if err := k.EnsureNamespace(); err != nil {
-		return errors.Annotatef(err, "ensuring operator namespace %v", k.namespace)
+		return "", errors.Annotatef(err, "ensuring operator namespace %v", k.namespace)
 	}
 
 	// TODO(caas) use secrets for storing agent password?
+	configChanged := false
 	if config.AgentConf == nil {
 		// We expect that the config map already exists,
 		// so make sure it does.
-		configMaps := k.CoreV1().ConfigMaps(k.namespace)
+		configMaps := k.client().CoreV1().ConfigMaps(k.namespace)
 		_, err := configMaps.Get(operatorConfigMapName(appName), v1.GetOptions{IncludeUninitialized: true})
 		if err != nil {
-			return errors.Annotatef(err, "config map for %q should already exist", appName)
+			return "", errors.Annotatef(err, "config map for %q should already exist", appName)
 		}
 	} else {
-		if err := k.ensureConfigMap(operatorConfigMap(appName, config)); err != nil {
-			return errors.Annotate(err, "creating or updating ConfigMap")
+		if err := validateOperatorConfigFiles(config.ConfigFiles); err != nil {
+			return "", errors.Annotatef(err, "configuring %v operator", appName)
+		}
+		var err error
+		configChanged, err = k.ensureConfigMapChanged(operatorConfigMap(appName, config))
+		if err != nil {
+			return "", errors.Annotate(err, "creating or updating ConfigMap")
 		}
 	}
 
@@ -455,7 +1061,7 @@ func (k *kubernetesClient) EnsureOperator(appName, agentPath string, config *caa
 		requestedVolumeSize: fmt.Sprintf("%dMi", config.CharmStorage.Size),
 	}
 	if config.CharmStorage.Provider != K8s_ProviderType {
-		return errors.Errorf("expected charm storage provider %q, got %q", K8s_ProviderType, config.CharmStorage.Provider)
+		return "", errors.Errorf("expected charm storage provider %q, got %q", K8s_ProviderType, config.CharmStorage.Provider)
 	}
 	if storageLabel, ok := config.CharmStorage.Attributes[storageLabel]; ok {
 		params.storageLabels = append([]string{fmt.Sprintf("%v", storageLabel)}, params.storageLabels...)
@@ -463,7 +1069,7 @@ func (k *kubernetesClient) EnsureOperator(appName, agentPath string, config *caa
 	var err error
 	params.storageConfig, err = newStorageConfig(config.CharmStorage.Attributes, defaultOperatorStorageClassName)
 	if err != nil {
-		return errors.Annotatef(err, "invalid storage configuration for %v operator", appName)
+		return "", errors.Annotatef(err, "invalid storage configuration for %v operator", appName)
 	}
 	// We want operator storage to be deleted when the operator goes away.
 	params.storageConfig.reclaimPolicy = core.PersistentVolumeReclaimDelete
@@ -472,7 +1078,7 @@ func (k *kubernetesClient) EnsureOperator(appName, agentPath string, config *caa
 	// Attempt to get a persistent volume to store charm state etc.
 	pvcSpec, err := k.maybeGetVolumeClaimSpec(params)
 	if err != nil {
-		return errors.Annotate(err, "finding operator volume claim")
+		return "", errors.Annotate(err, "finding operator volume claim")
 	}
 	pvc := &core.PersistentVolumeClaim{
 		ObjectMeta: v1.ObjectMeta{
@@ -481,6 +1087,21 @@ func (k *kubernetesClient) EnsureOperator(appName, agentPath string, config *caa
 		Spec: *pvcSpec,
 	}
 	pod := operatorPod(appName, agentPath, config.OperatorImagePath, config.Version.String(), tags)
+	var pullSecrets []core.LocalObjectReference
+	for _, name := range config.ImagePullSecrets {
+		pullSecrets = append(pullSecrets, core.LocalObjectReference{Name: name})
+	}
+	pod.Spec.ImagePullSecrets = mergeImagePullSecrets(pod.Spec.ImagePullSecrets, pullSecrets)
+	if err := k.checkImagePullSecrets(pod.Spec.ImagePullSecrets); err != nil {
+		return "", errors.Annotatef(err, "configuring %v operator", appName)
+	}
+	if err := configureOperatorContainer(&pod.Spec.Containers[0], agentPath, appName, config); err != nil {
+		return "", errors.Annotatef(err, "configuring %v operator", appName)
+	}
+	configureOperatorConfigFiles(pod, appName, config.ConfigFiles)
+	if err := configureOperatorAnnotations(pod, config.PodAnnotations); err != nil {
+		return "", errors.Annotatef(err, "configuring %v operator", appName)
+	}
 	// Take a copy for use with statefulset.
 	podWithoutStorage := pod
 
@@ -497,7 +1118,8 @@ func (k *kubernetesClient) EnsureOperator(appName, agentPath string, config *caa
 			},
 			Template: core.PodTemplateSpec{
 				ObjectMeta: v1.ObjectMeta{
-					Labels: pod.Labels,
+					Labels:      pod.Labels,
+					Annotations: pod.Annotations,
 				},
 			},
 			PodManagementPolicy:  apps.ParallelPodManagement,
@@ -510,8 +1132,35 @@ func (k *kubernetesClient) EnsureOperator(appName, agentPath string, config *caa
 	})
 
 	statefulset.Spec.Template.Spec = pod.Spec
-	err = k.ensureStatefulSet(statefulset, podWithoutStorage.Spec)
-	return errors.Annotatef(err, "creating or updating %v operator StatefulSet", appName)
+	existing, err := k.client().AppsV1().StatefulSets(k.namespace).Get(statefulset.Name, v1.GetOptions{IncludeUninitialized: true})
+	if k8serrors.IsNotFound(err) {
+		existing, err = nil, nil
+	}
+	if err != nil {
+		return "", errors.Annotatef(err, "getting %v operator StatefulSet", appName)
+	}
+	out, created, err := k.ensureStatefulSet(statefulset, podWithoutStorage.Spec)
+	if err != nil {
+		return "", errors.Annotatef(err, "creating or updating %v operator StatefulSet", appName)
+	}
+	return operatorChange(existing, out, created, configChanged), nil
+}
+
+// operatorChange returns what ensuring the operator's stateful set and
+// config changed. The stateful set's generation only increases if its
+// spec was actually changed by the update.
+func operatorChange(existing, updated *apps.StatefulSet, created, configChanged bool) caas.OperatorChange {
+	switch {
+	case created || existing == nil:
+		return caas.OperatorCreated
+	case updated == nil:
+		return caas.OperatorUpdated
+	case containerImagesChanged(existing.Spec.Template.Spec.Containers, updated.Spec.Template.Spec.Containers):
+		return caas.OperatorRecreated
+	case configChanged || updated.Generation != existing.Generation:
+		return caas.OperatorUpdated
+	}
+	return caas.OperatorUnchanged
 }
 
 // maybeGetStorageClass looks for a storage class to use when creating
@@ -524,7 +1173,7 @@ func (k *kubernetesClient) maybeGetStorageClass(labels ...string) (*k8sstorage.S
 	modelSelector := selector + "," + modelTerm
 
 	// Attempt to get a storage class tied to this model.
-	storageClasses, err := k.StorageV1().StorageClasses().List(v1.ListOptions{
+	storageClasses, err := k.client().StorageV1().StorageClasses().List(v1.ListOptions{
 		LabelSelector: modelSelector,
 	})
 	if err != nil {
@@ -534,7 +1183,7 @@ func (k *kubernetesClient) maybeGetStorageClass(labels ...string) (*k8sstorage.S
 	// If no storage classes tied to this model, look for a non-model specific
 	// storage class with the relevant labels.
 	if len(storageClasses.Items) == 0 {
-		storageClasses, err = k.StorageV1().StorageClasses().List(v1.ListOptions{
+		storageClasses, err = k.client().StorageV1().StorageClasses().List(v1.ListOptions{
 			LabelSelector: selector,
 		})
 		if err != nil {
@@ -548,17 +1197,74 @@ func (k *kubernetesClient) maybeGetStorageClass(labels ...string) (*k8sstorage.S
 	}
 
 	// Second look for the cluster default storage class, if defined.
-	storageClasses, err = k.StorageV1().StorageClasses().List(v1.ListOptions{})
+	sc, err := k.defaultStorageClass()
+	if errors.IsNotFound(err) {
+		return nil, errors.NotFoundf("storage class for any %q", labels)
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	logger.Debugf("using default storage class: %v", sc.Name)
+	return sc, nil
+}
+
+// defaultStorageClass returns the cluster default storage class,
+// or a NotFound error if there is none.
+func (k *kubernetesClient) defaultStorageClass() (*k8sstorage.StorageClass, error) {
+	storageClasses, err := k.client().StorageV1().StorageClasses().List(v1.ListOptions{})
 	if err != nil {
 		return nil, errors.Annotate(err, "listing storage classes")
 	}
-	for _, sc := range storageClasses.Items {
-		if v, ok := sc.Annotations["storageclass.kubernetes.io/is-default-class"]; ok && v != "false" {
-			logger.Debugf("using default storage class: %v", sc.Name)
-			return &sc, nil
+	for i, sc := range storageClasses.Items {
+		if isDefaultStorageClass(sc) {
+			return &storageClasses.Items[i], nil
 		}
 	}
-	return nil, errors.NotFoundf("storage class for any %q", labels)
+	return nil, errors.NotFoundf("default storage class")
+}
+
+func isDefaultStorageClass(sc k8sstorage.StorageClass) bool {
+	v, ok := sc.Annotations["storageclass.kubernetes.io/is-default-class"]
+	return ok && v != "false"
+}
+
+func storageClassInfo(sc k8sstorage.StorageClass) caas.StorageClassInfo {
+	info := caas.StorageClassInfo{
+		Name:        sc.Name,
+		Provisioner: sc.Provisioner,
+		Parameters:  sc.Parameters,
+		Default:     isDefaultStorageClass(sc),
+	}
+	if sc.ReclaimPolicy != nil {
+		info.ReclaimPolicy = string(*sc.ReclaimPolicy)
+	}
+	if sc.VolumeBindingMode != nil {
+		info.VolumeBindingMode = string(*sc.VolumeBindingMode)
+	}
+	return info
+}
+
+// DefaultStorageClass is part of the Broker interface.
+func (k *kubernetesClient) DefaultStorageClass() (*caas.StorageClassInfo, error) {
+	sc, err := k.defaultStorageClass()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	info := storageClassInfo(*sc)
+	return &info, nil
+}
+
+// StorageClasses is part of the Broker interface.
+func (k *kubernetesClient) StorageClasses() ([]caas.StorageClassInfo, error) {
+	storageClasses, err := k.client().StorageV1().StorageClasses().List(v1.ListOptions{})
+	if err != nil {
+		return nil, errors.Annotate(err, "listing storage classes")
+	}
+	result := make([]caas.StorageClassInfo, len(storageClasses.Items))
+	for i, sc := range storageClasses.Items {
+		result[i] = storageClassInfo(sc)
+	}
+	return result, nil
 }
 
 func operatorVolumeClaim(appName string) string {
@@ -571,6 +1277,10 @@ type volumeParams struct {
 	pvcName             string
 	requestedVolumeSize string
 	accessMode          core.PersistentVolumeAccessMode
+
+	// fallbackStorageClass, if set, is the name of an existing
+	// storage class used if no other storage class is found.
+	fallbackStorageClass string
 }
 
 // maybeGetVolumeClaimSpec returns a persistent volume claim spec for the given
@@ -603,9 +1313,21 @@ func (k *kubernetesClient) maybeGetVolumeClaimSpec(params volumeParams) (*core.P
 			storageClassName = sc.Name
 		}
 	}
+	// As a last resort, use the configured fallback storage class.
+	if storageClassName == "" && !haveStorageClass && params.fallbackStorageClass != "" {
+		sc, err := k.getStorageClass(params.fallbackStorageClass)
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return nil, errors.Annotatef(err, "looking for fallback storage class %q", params.fallbackStorageClass)
+		}
+		if err == nil {
+			haveStorageClass = true
+			storageClassName = sc.Name
+		}
+	}
 	// If a specific storage class has been requested, make sure it exists.
 	if storageClassName != "" && !haveStorageClass {
 		params.storageConfig.storageClass = storageClassName
+		params.storageConfig.storageLabels = params.storageLabels
 		sc, err := k.ensureStorageClass(params.storageConfig)
 		if err != nil && !errors.IsNotFound(err) {
 			return nil, errors.Trace(err)
@@ -642,7 +1364,7 @@ func (k *kubernetesClient) maybeGetVolumeClaimSpec(params volumeParams) (*core.P
 // getStorageClass returns a named storage class, first looking for
 // one which is qualified by the current namespace if it's available.
 func (k *kubernetesClient) getStorageClass(name string) (*k8sstorage.StorageClass, error) {
-	storageClasses := k.StorageV1().StorageClasses()
+	storageClasses := k.client().StorageV1().StorageClasses()
 	qualifiedName := qualifiedStorageClassName(k.namespace, name)
 	sc, err := storageClasses.Get(qualifiedName, v1.GetOptions{})
 	if err == nil {
@@ -672,35 +1394,77 @@ func (k *kubernetesClient) ensureStorageClass(cfg *storageConfig) (*k8sstorage.S
 	}
 
 	// Create the storage class with the specified provisioner.
-	storageClasses := k.StorageV1().StorageClasses()
+	// The class is labelled so that it can be found again when
+	// looking for storage matching the same labels, and with the
+	// model UUID to record that it was created by this model, so
+	// that it is removed when the model is destroyed.
+	labels := map[string]string{
+		labelModel:     k.namespace,
+		labelModelUUID: k.modelUUID,
+	}
+	if len(cfg.storageLabels) > 0 {
+		labels[labelStorage] = cfg.storageLabels[0]
+	}
+	bindingMode := cfg.volumeBindingMode
+	if bindingMode == nil {
+		bindingMode = k.defaultVolumeBindingMode()
+	}
+	storageClasses := k.client().StorageV1().StorageClasses()
 	sc, err = storageClasses.Create(&k8sstorage.StorageClass{
 		ObjectMeta: v1.ObjectMeta{
 			Name:   qualifiedStorageClassName(k.namespace, cfg.storageClass),
-			Labels: map[string]string{labelModel: k.namespace},
+			Labels: labels,
 		},
-		Provisioner:   cfg.storageProvisioner,
-		ReclaimPolicy: &cfg.reclaimPolicy,
-		Parameters:    cfg.parameters,
+		Provisioner:       cfg.storageProvisioner,
+		ReclaimPolicy:     &cfg.reclaimPolicy,
+		VolumeBindingMode: bindingMode,
+		Parameters:        cfg.parameters,
 	})
 	return sc, errors.Annotatef(err, "creating storage class %q", cfg.storageClass)
 }
 
+// defaultVolumeBindingMode returns the volume binding mode to use for a
+// storage class created without one. When the cluster's nodes span more
+// than one zone, provisioning is delayed until a pod using the volume is
+// scheduled so that the volume is created in the same zone as the pod;
+// an immediately bound volume may otherwise land in a zone the pod can't
+// be scheduled to. Nil, meaning the kubernetes default, is returned for
+// single zone clusters or if the nodes can't be listed.
+func (k *kubernetesClient) defaultVolumeBindingMode() *k8sstorage.VolumeBindingMode {
+	nodes, err := k.client().CoreV1().Nodes().List(v1.ListOptions{})
+	if err != nil {
+		logger.Debugf("cannot list nodes to determine availability zones: %v", err)
+		return nil
+	}
+	zones := set.NewStrings()
+	for _, node := range nodes.Items {
+		if zone := node.Labels[labelZone]; zone != "" {
+			zones.Add(zone)
+		}
+	}
+	if zones.Size() < 2 {
+		return nil
+	}
+	mode := k8sstorage.VolumeBindingWaitForFirstConsumer
+	return &mode
+}
+
 // DeleteOperator deletes the specified operator.
 func (k *kubernetesClient) DeleteOperator(appName string) (err error) {
 	logger.Debugf("deleting %s operator", appName)
 
 	// First delete the config map(s).
-	configMaps := k.CoreV1().ConfigMaps(k.namespace)
+	configMaps := k.client().CoreV1().ConfigMaps(k.namespace)
 	configMapName := operatorConfigMapName(appName)
 	err = configMaps.Delete(configMapName, &v1.DeleteOptions{
-		PropagationPolicy: &defaultPropagationPolicy,
+		PropagationPolicy: k.propagationPolicy(),
 	})
 	if err != nil && !k8serrors.IsNotFound(err) {
 		return nil
 	}
 	configMapName = operatorConfigurationsConfigMapName(appName)
 	err = configMaps.Delete(configMapName, &v1.DeleteOptions{
-		PropagationPolicy: &defaultPropagationPolicy,
+		PropagationPolicy: k.propagationPolicy(),
 	})
 	if err != nil && !k8serrors.IsNotFound(err) {
 		return nil
@@ -711,7 +1475,7 @@ func (k *kubernetesClient) DeleteOperator(appName string) (err error) {
 	if err := k.deleteStatefulSet(operatorName); err != nil {
 		return errors.Trace(err)
 	}
-	pods := k.CoreV1().Pods(k.namespace)
+	pods := k.client().CoreV1().Pods(k.namespace)
 	podsList, err := pods.List(v1.ListOptions{
 		LabelSelector: operatorSelector(appName),
 	})
@@ -719,7 +1483,7 @@ func (k *kubernetesClient) DeleteOperator(appName string) (err error) {
 		return errors.Trace(err)
 	}
 
-	pvs := k.CoreV1().PersistentVolumes()
+	pvs := k.client().CoreV1().PersistentVolumes()
 	for _, p := range podsList.Items {
 		// Delete secrets.
 		for _, c := range p.Spec.Containers {
@@ -737,7 +1501,7 @@ func (k *kubernetesClient) DeleteOperator(appName string) (err error) {
 		// for operators as the volume is an inseparable part of the operator.
 		for _, volName := range volumeNames {
 			err = pvs.Delete(volName, &v1.DeleteOptions{
-				PropagationPolicy: &defaultPropagationPolicy,
+				PropagationPolicy: k.propagationPolicy(),
 			})
 			if err != nil && !k8serrors.IsNotFound(err) {
 				return errors.Annotatef(err, "deleting operator persistent volume %v for %v",
@@ -749,18 +1513,59 @@ func (k *kubernetesClient) DeleteOperator(appName string) (err error) {
 }
 
 // Service returns the service for the specified application.
+// A NotFound error is returned if there is no such service, and a
+// Forbidden error if the cluster denies access to the services.
 func (k *kubernetesClient) Service(appName string) (*caas.Service, error) {
-	services := k.CoreV1().Services(k.namespace)
+	services := k.client().CoreV1().Services(k.namespace)
 	servicesList, err := services.List(v1.ListOptions{
 		LabelSelector: applicationSelector(appName),
 	})
+	if k8serrors.IsForbidden(err) {
+		return nil, errors.NewForbidden(err, fmt.Sprintf("listing services for %q", appName))
+	}
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 	if len(servicesList.Items) == 0 {
 		return nil, errors.NotFoundf("service for %q", appName)
 	}
+	// An application may have a service per container;
+	// prefer the primary service if there is more than one.
 	service := servicesList.Items[0]
+	for _, svc := range servicesList.Items {
+		if svc.Name == deploymentName(appName) {
+			service = svc
+			break
+		}
+	}
+	return caasService(service), nil
+}
+
+// ContainerServices is part of the Broker interface.
+func (k *kubernetesClient) ContainerServices(appName string) (map[string]*caas.Service, error) {
+	services := k.client().CoreV1().Services(k.namespace)
+	servicesList, err := services.List(v1.ListOptions{
+		LabelSelector: applicationSelector(appName),
+	})
+	if k8serrors.IsForbidden(err) {
+		return nil, errors.NewForbidden(err, fmt.Sprintf("listing services for %q", appName))
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	result := make(map[string]*caas.Service)
+	for _, svc := range servicesList.Items {
+		containerName, ok := svc.Labels[labelContainer]
+		if !ok {
+			continue
+		}
+		result[containerName] = caasService(svc)
+	}
+	return result, nil
+}
+
+// caasService returns the Juju representation of the service.
+func caasService(service core.Service) *caas.Service {
 	result := caas.Service{
 		Id: string(service.UID),
 	}
@@ -785,16 +1590,62 @@ func (k *kubernetesClient) Service(appName string) (*caas.Service, error) {
 			Scope: network.ScopePublic,
 		})
 	}
-	return &result, nil
+	return &result
 }
 
 // DeleteService deletes the specified service.
+// The application's resources are owned by a dedicated config map, so
+// deleting it has Kubernetes garbage collect the rest. Persistent volume
+// claims made from a stateful set's claim templates have no owner, and
+// custom config maps made before the application was deployed are not
+// owned, so these are always deleted explicitly.
 func (k *kubernetesClient) DeleteService(appName string) (err error) {
 	logger.Debugf("deleting application %s", appName)
 
+	policy := k.propagationPolicy()
+	ownerName := applicationOwnerName(appName)
+	configMaps := k.client().CoreV1().ConfigMaps(k.namespace)
+	_, err = configMaps.Get(ownerName, v1.GetOptions{IncludeUninitialized: true})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return errors.Trace(err)
+	}
+	// Orphaning the owner's dependents would leave everything running.
+	if k8serrors.IsNotFound(err) || *policy == v1.DeletePropagationOrphan {
+		return errors.Trace(k.deleteUnownedApplication(appName))
+	}
+
+	if err := k.deleteApplicationVolumeClaims(appName); err != nil {
+		return errors.Trace(err)
+	}
+	err = configMaps.Delete(ownerName, &v1.DeleteOptions{
+		PropagationPolicy: policy,
+	})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return errors.Annotatef(err, "deleting owner of %v", appName)
+	}
+	err = configMaps.DeleteCollection(&v1.DeleteOptions{
+		PropagationPolicy: policy,
+	}, v1.ListOptions{
+		LabelSelector: applicationSelector(appName),
+	})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return errors.Annotatef(err, "deleting config maps for %v", appName)
+	}
+	return nil
+}
+
+// deleteUnownedApplication deletes each of the resources of an
+// application deployed before its resources had a dedicated owner.
+func (k *kubernetesClient) deleteUnownedApplication(appName string) error {
 	if err := k.deleteService(appName); err != nil {
 		return errors.Trace(err)
 	}
+	if err := k.deleteServiceEndpoints(appName); err != nil {
+		return errors.Annotatef(err, "deleting endpoints for %v", appName)
+	}
+	if err := k.deleteNetworkPolicy(deploymentName(appName)); err != nil {
+		return errors.Trace(err)
+	}
 	deploymentName := deploymentName(appName)
 	if err := k.deleteStatefulSet(deploymentName); err != nil {
 		return errors.Trace(err)
@@ -802,7 +1653,22 @@ func (k *kubernetesClient) DeleteService(appName string) (err error) {
 	if err := k.deleteDeployment(deploymentName); err != nil {
 		return errors.Trace(err)
 	}
-	pods := k.CoreV1().Pods(k.namespace)
+	// Delete the deployments of any other tracks of the application.
+	deploymentsList, err := k.client().AppsV1().Deployments(k.namespace).List(v1.ListOptions{
+		LabelSelector: applicationSelector(appName),
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, d := range deploymentsList.Items {
+		if d.Name == deploymentName {
+			continue
+		}
+		if err := k.deleteDeployment(d.Name); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	pods := k.client().CoreV1().Pods(k.namespace)
 	podsList, err := pods.List(v1.ListOptions{
 		LabelSelector: applicationSelector(appName),
 	})
@@ -814,7 +1680,16 @@ func (k *kubernetesClient) DeleteService(appName string) (err error) {
 			return errors.Trace(err)
 		}
 	}
-	secrets := k.CoreV1().Secrets(k.namespace)
+	// Delete any custom config maps labelled as belonging to the application.
+	err = k.client().CoreV1().ConfigMaps(k.namespace).DeleteCollection(&v1.DeleteOptions{
+		PropagationPolicy: k.propagationPolicy(),
+	}, v1.ListOptions{
+		LabelSelector: applicationSelector(appName),
+	})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return errors.Annotatef(err, "deleting config maps for %v", appName)
+	}
+	secrets := k.client().CoreV1().Secrets(k.namespace)
 	secretList, err := secrets.List(v1.ListOptions{
 		LabelSelector: applicationSelector(appName),
 	})
@@ -867,7 +1742,7 @@ func (k *kubernetesClient) ensureCustomResourceDefinitionTemplate(t *caas.Custom
 			},
 		},
 	}
-	apiextensionsV1beta1 := k.apiextensionsClient.ApiextensionsV1beta1()
+	apiextensionsV1beta1 := k.extendedClient().ApiextensionsV1beta1()
 	logger.Debugf("creating crd %#v", crdIn)
 	crd, err = apiextensionsV1beta1.CustomResourceDefinitions().Create(crdIn)
 	if k8serrors.IsAlreadyExists(err) {
@@ -896,7 +1771,7 @@ func (k *kubernetesClient) EnsureService(
 		return errors.Errorf("number of units must be >= 0")
 	}
 	if numUnits == 0 {
-		return k.deleteAllPods(appName)
+		return k.ScaleService(appName, 0)
 	}
 	if params == nil || params.PodSpec == nil {
 		return errors.Errorf("missing pod spec")
@@ -905,64 +1780,65 @@ func (k *kubernetesClient) EnsureService(
 		return errors.Errorf("kubernetes service is required when using storage")
 	}
 
-	var cleanups []func()
+	// Resources created below are removed again if a later step fails.
+	var rollback cleanupStack
 	defer func() {
-		if err == nil {
-			return
-		}
-		for _, f := range cleanups {
-			f()
+		if err != nil {
+			rollback.run()
 		}
 	}()
 
-	unitSpec, err := makeUnitSpec(appName, params.PodSpec)
+	unitSpec, err := k.applicationUnitSpec(appName, params, config)
 	if err != nil {
-		return errors.Annotatef(err, "parsing unit spec for %s", appName)
-	}
-	if len(params.Devices) > 0 {
-		if err = k.configureDevices(unitSpec, params.Devices); err != nil {
-			return errors.Annotatef(err, "configuring devices for %s", appName)
-		}
+		return errors.Trace(err)
 	}
-	if mem := params.Constraints.Mem; mem != nil {
-		if err = k.configureConstraint(unitSpec, "memory", fmt.Sprintf("%dMi", *mem)); err != nil {
-			return errors.Annotatef(err, "configuring memory constraint for %s", appName)
+	if k8sPodSpec, ok := params.PodSpec.ProviderPod.(*K8sPodSpec); ok {
+		if err = k.checkImagePullSecrets(k8sPodSpec.ImagePullSecrets); err != nil {
+			return errors.Trace(err)
 		}
-	}
-	if cpu := params.Constraints.CpuPower; cpu != nil {
-		if err = k.configureConstraint(unitSpec, "cpu", fmt.Sprintf("%dm", *cpu)); err != nil {
-			return errors.Annotatef(err, "configuring cpu constraint for %s", appName)
+		if err = k.checkRuntimeClass(k8sPodSpec.RuntimeClassName); err != nil {
+			return errors.Trace(err)
 		}
 	}
-	if params.Placement != "" {
-		affinityLabels, err := keyvalues.Parse(strings.Split(params.Placement, ","), false)
-		if err != nil {
-			return errors.Annotatef(err, "invalid placement directive %q", params.Placement)
-		}
-		unitSpec.Pod.NodeSelector = affinityLabels
+	if err = k.checkEnvFromSources(unitSpec.Pod.Containers); err != nil {
+		return errors.Trace(err)
 	}
+	resourceTags := applicationResourceTags(appName, params)
 
-	resourceTags := make(map[string]string)
-	for k, v := range params.ResourceTags {
-		resourceTags[k] = v
+	// All the application's resources are owned by a dedicated object
+	// so that they are garbage collected by Kubernetes when it is deleted.
+	ownerRefs, err := k.ensureApplicationOwner(appName, resourceTags, &rollback)
+	if err != nil {
+		return errors.Trace(err)
 	}
-	resourceTags[labelApplication] = appName
 	for _, c := range params.PodSpec.Containers {
 		if c.ImageDetails.Password == "" {
 			continue
 		}
 		imageSecretName := appSecretName(appName, c.Name)
-		if err := k.ensureSecret(imageSecretName, appName, &c.ImageDetails, resourceTags); err != nil {
+		created, err := k.ensureSecret(imageSecretName, appName, &c.ImageDetails, resourceTags, ownerRefs)
+		if err != nil {
 			return errors.Annotatef(err, "creating secrets for container: %s", c.Name)
 		}
-		cleanups = append(cleanups, func() { k.deleteSecret(imageSecretName) })
+		if created {
+			rollback.add("secret "+imageSecretName, func() error { return k.deleteSecret(imageSecretName) })
+		}
+	}
+
+	if params.Track != "" {
+		// Tracks run alongside the application's existing workload, which
+		// along with its service and other resources is left untouched.
+		if err := k.configureTrack(appName, params, numUnits, unitSpec, resourceTags, ownerRefs, config, &rollback); err != nil {
+			return errors.Annotatef(err, "creating or updating track %q", params.Track)
+		}
+		return nil
 	}
 
 	// Add a deployment controller or stateful set configured to create the specified number of units/pods.
 	// Defensively check to see if a stateful set is already used.
 	useStatefulSet := len(params.Filesystems) > 0
 	if !useStatefulSet {
-		statefulsets := k.AppsV1().StatefulSets(k.namespace)
+		statefulsets := k.client().AppsV1().StatefulSets(k.namespace)
 		_, err := statefulsets.Get(deploymentName(appName), v1.GetOptions{IncludeUninitialized: true})
 		if err != nil && !k8serrors.IsNotFound(err) {
 			return errors.Trace(err)
@@ -975,225 +1851,1088 @@ func (k *kubernetesClient) EnsureService(
 
 	numPods := int32(numUnits)
 	if useStatefulSet {
-		if err := k.configureStatefulSet(appName, resourceTags, unitSpec, params.PodSpec.Containers, &numPods, params.Filesystems); err != nil {
+		if _, err := k.configureStatefulSet(appName, resourceTags, ownerRefs, unitSpec, params.PodSpec.Containers, &numPods, params.Filesystems, &rollback); err != nil {
 			return errors.Annotate(err, "creating or updating StatefulSet")
 		}
-		cleanups = append(cleanups, func() { k.deleteDeployment(appName) })
 	} else {
-		if err := k.configureDeployment(appName, deploymentName(appName), resourceTags, unitSpec, params.PodSpec.Containers, &numPods); err != nil {
+		if _, err := k.configureDeployment(appName, deploymentName(appName), resourceTags, ownerRefs, unitSpec, params.PodSpec.Containers, &numPods, config, &rollback); err != nil {
 			return errors.Annotate(err, "creating or updating DeploymentController")
 		}
-		cleanups = append(cleanups, func() { k.deleteDeployment(appName) })
 	}
 
-	var ports []core.ContainerPort
-	for _, c := range unitSpec.Pod.Containers {
-		for _, p := range c.Ports {
-			if p.ContainerPort == 0 {
-				continue
-			}
-			ports = append(ports, p)
-		}
+	if err := k.configureNetworkPolicy(appName, resourceTags, ownerRefs, config, &rollback); err != nil {
+		return errors.Annotatef(err, "creating or updating network policy for %v", appName)
 	}
-	if !params.PodSpec.OmitServiceFrontend {
-		if err := k.configureService(appName, ports, resourceTags, config); err != nil {
-			return errors.Annotatef(err, "creating or updating service for %v", appName)
+
+	if params.PodSpec.OmitServiceFrontend {
+		return nil
+	}
+	// Any services left from when each container had its own,
+	// or from containers which no longer have ports, are removed.
+	services := set.NewStrings()
+	for _, svc := range applicationServices(appName, unitSpec, params.PodSpec.Containers, resourceTags, config) {
+		if err := k.configureService(appName, svc.name, svc.ports, svc.tags, ownerRefs, config, &rollback); err != nil {
+			if svc.container == "" {
+				return errors.Annotatef(err, "creating or updating service for %v", appName)
+			}
+			return errors.Annotatef(err, "creating or updating service for %v container %v", appName, svc.container)
 		}
+		services.Add(svc.name)
 	}
-	return nil
+	return errors.Annotatef(k.deleteContainerServices(appName, services), "deleting container services for %v", appName)
 }
 
-func (k *kubernetesClient) deleteAllPods(appName string) error {
-	zero := int32(0)
-	statefulsets := k.AppsV1().StatefulSets(k.namespace)
-	statefulSet, err := statefulsets.Get(deploymentName(appName), v1.GetOptions{IncludeUninitialized: true})
-	if err != nil && !k8serrors.IsNotFound(err) {
-		return errors.Trace(err)
-	}
-	if err == nil {
-		statefulSet.Spec.Replicas = &zero
-		_, err = statefulsets.Update(statefulSet)
-		return errors.Trace(err)
-	}
+// applicationService describes one of the services of an application.
+type applicationService struct {
+	name string
+	// container is the container the service is for,
+	// or "" if the service is for the whole pod.
+	container string
+	tags      map[string]string
+	ports     []core.ContainerPort
+}
 
-	deployments := k.AppsV1().Deployments(k.namespace)
-	deployment, err := deployments.Get(deploymentName(appName), v1.GetOptions{IncludeUninitialized: true})
-	if k8serrors.IsNotFound(err) {
-		return nil
-	}
-	if err != nil {
-		return errors.Trace(err)
+// applicationServices returns the services Juju makes for the
+// application: one for its pods, or when configured, one for each
+// container with ports. The first container with ports then has
+// the application's primary service, used for ingress.
+func applicationServices(
+	appName string, unitSpec *unitSpec, containers []caas.ContainerSpec,
+	tags map[string]string, config application.ConfigAttributes,
+) []applicationService {
+	if !config.GetBool(servicePerContainerKey, defaultServicePerContainer) {
+		return []applicationService{{
+			name:  deploymentName(appName),
+			tags:  tags,
+			ports: podPorts(unitSpec.Pod.Containers, containers),
+		}}
+	}
+	var services []applicationService
+	for i, c := range unitSpec.Pod.Containers {
+		ports := containerPorts(c, containers[i])
+		if len(ports) == 0 {
+			continue
+		}
+		serviceName := deploymentName(appName)
+		if len(services) > 0 {
+			serviceName = containerServiceName(appName, c.Name)
+		}
+		serviceTags := map[string]string{labelContainer: c.Name}
+		for name, value := range tags {
+			serviceTags[name] = value
+		}
+		services = append(services, applicationService{
+			name:      serviceName,
+			container: c.Name,
+			tags:      serviceTags,
+			ports:     ports,
+		})
 	}
-	deployment.Spec.Replicas = &zero
-	_, err = deployments.Update(deployment)
-	return errors.Trace(err)
+	return services
 }
 
-func (k *kubernetesClient) configureStorage(
-	podSpec *core.PodSpec, statefulSet *apps.StatefulSetSpec, appName string, filesystems []storage.KubernetesFilesystemParams,
-) error {
-	baseDir, err := paths.StorageDir("kubernetes")
+// applicationUnitSpec returns the spec of the application's unit pods,
+// with the probes, devices, constraints and placement configured.
+func (k *kubernetesClient) applicationUnitSpec(
+	appName string, params *caas.ServiceParams, config application.ConfigAttributes,
+) (*unitSpec, error) {
+	unitSpec, err := makeUnitSpec(appName, params.PodSpec)
 	if err != nil {
-		return errors.Trace(err)
+		return nil, errors.Annotatef(err, "parsing unit spec for %s", appName)
 	}
-	logger.Debugf("configuring pod filesystems: %+v", filesystems)
-	for i, fs := range filesystems {
-		if fs.Provider != K8s_ProviderType {
-			return errors.Errorf("invalid storage provider type %q for %v", fs.Provider, fs.StorageName)
-		}
-		var mountPath string
-		if fs.Attachment != nil {
-			mountPath = fs.Attachment.Path
-		}
-		if mountPath == "" {
-			mountPath = fmt.Sprintf("%s/fs/%s/%s/%d", baseDir, appName, fs.StorageName, i)
-		}
-		pvcNamePrefix := fmt.Sprintf("juju-%s-%d", fs.StorageName, i)
-		volStorageLabel := fmt.Sprintf("%s-unit-storage", appName)
-		params := volumeParams{
-			storageLabels:       []string{volStorageLabel, k.namespace, "default"},
-			pvcName:             pvcNamePrefix,
-			requestedVolumeSize: fmt.Sprintf("%dMi", fs.Size),
+	if err = configureAutoProbes(unitSpec, params.PodSpec, config); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err = configureTerminationGrace(unitSpec, config); err != nil {
+		return nil, errors.Trace(err)
+	}
+	configureSpreadReplicas(appName, unitSpec, config)
+	if len(params.Devices) > 0 {
+		if err = k.configureDevices(unitSpec, params.Devices); err != nil {
+			return nil, errors.Annotatef(err, "configuring devices for %s", appName)
 		}
-		if storageLabel, ok := fs.Attributes[storageLabel]; ok {
-			params.storageLabels = append([]string{fmt.Sprintf("%v", storageLabel)}, params.storageLabels...)
+	}
+	if mem := params.Constraints.Mem; mem != nil {
+		if err = k.configureConstraint(unitSpec, "memory", fmt.Sprintf("%dMi", *mem)); err != nil {
+			return nil, errors.Annotatef(err, "configuring memory constraint for %s", appName)
 		}
-		params.storageConfig, err = newStorageConfig(fs.Attributes, defaultStorageClass)
-		if err != nil {
-			return errors.Annotatef(err, "invalid storage configuration for %v", fs.StorageName)
+	}
+	if cpu := params.Constraints.CpuPower; cpu != nil {
+		if err = k.configureConstraint(unitSpec, "cpu", fmt.Sprintf("%dm", *cpu)); err != nil {
+			return nil, errors.Annotatef(err, "configuring cpu constraint for %s", appName)
 		}
-
-		pvcSpec, err := k.maybeGetVolumeClaimSpec(params)
+	}
+	if params.Placement != "" {
+		affinityLabels, err := keyvalues.Parse(strings.Split(params.Placement, ","), false)
 		if err != nil {
-			return errors.Annotatef(err, "finding volume for %s", fs.StorageName)
-		}
-		tags := make(map[string]string)
-		for k, v := range fs.ResourceTags {
-			tags[k] = v
-		}
-		tags[labelApplication] = appName
-		pvc := core.PersistentVolumeClaim{
-			ObjectMeta: v1.ObjectMeta{
-				Name:   params.pvcName,
-				Labels: tags},
-			Spec: *pvcSpec,
+			return nil, errors.Annotatef(err, "invalid placement directive %q", params.Placement)
 		}
-		logger.Debugf("using persistent volume claim for %s filesystem %s: %+v", appName, fs.StorageName, pvc)
-		statefulSet.VolumeClaimTemplates = append(statefulSet.VolumeClaimTemplates, pvc)
-		podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, core.VolumeMount{
-			Name:      pvc.Name,
-			MountPath: mountPath,
-		})
+		unitSpec.Pod.NodeSelector = affinityLabels
 	}
-	return nil
+	return unitSpec, nil
 }
 
-func (k *kubernetesClient) configureDevices(unitSpec *unitSpec, devices []devices.KubernetesDeviceParams) error {
-	for i := range unitSpec.Pod.Containers {
-		resources := unitSpec.Pod.Containers[i].Resources
-		for _, dev := range devices {
-			err := mergeDeviceConstraints(dev, &resources)
-			if err != nil {
-				return errors.Annotatef(err, "merging device constraint %+v to %#v", dev, resources)
-			}
-		}
-		unitSpec.Pod.Containers[i].Resources = resources
+// applicationResourceTags returns the labels of the application's resources.
+func applicationResourceTags(appName string, params *caas.ServiceParams) map[string]string {
+	resourceTags := make(map[string]string)
+	for k, v := range params.ResourceTags {
+		resourceTags[k] = v
 	}
-	nodeLabel, err := getNodeSelectorFromDeviceConstraints(devices)
+	resourceTags[labelApplication] = appName
+	return resourceTags
+}
+
+// deleteContainerServices deletes the application's per container
+// services, other than the primary service and those in keep.
+func (k *kubernetesClient) deleteContainerServices(appName string, keep set.Strings) error {
+	servicesList, err := k.client().CoreV1().Services(k.namespace).List(v1.ListOptions{
+		LabelSelector: applicationSelector(appName),
+	})
 	if err != nil {
-		return err
+		return errors.Trace(err)
 	}
-	if nodeLabel != "" {
-		unitSpec.Pod.NodeSelector = buildNodeSelector(nodeLabel)
+	for _, svc := range servicesList.Items {
+		if svc.Name == deploymentName(appName) || keep.Contains(svc.Name) {
+			continue
+		}
+		if err := k.deleteServiceNamed(svc.Name); err != nil {
+			return errors.Trace(err)
+		}
 	}
 	return nil
 }
 
-func (k *kubernetesClient) configureConstraint(unitSpec *unitSpec, constraint, value string) error {
-	for i := range unitSpec.Pod.Containers {
-		resources := unitSpec.Pod.Containers[i].Resources
-		err := mergeConstraint(constraint, value, &resources)
-		if err != nil {
-			return errors.Annotatef(err, "merging constraint %q to %#v", constraint, resources)
+// cleanupStack holds compensating actions which remove resources
+// created while ensuring an application.
+type cleanupStack []func()
+
+// add records a cleanup which removes the described resource.
+// Any error from the cleanup is logged rather than returned,
+// since cleanups are only run when an error is already being
+// reported. It is a no-op on a nil stack.
+func (c *cleanupStack) add(what string, f func() error) {
+	if c == nil {
+		return
+	}
+	*c = append(*c, func() {
+		logger.Debugf("cleaning up %s", what)
+		if err := f(); err != nil {
+			logger.Warningf("cleaning up %s: %v", what, err)
 		}
-		unitSpec.Pod.Containers[i].Resources = resources
-	}
-	return nil
+	})
 }
 
-type configMapNameFunc func(fileSetName string) string
-
-func (k *kubernetesClient) configurePodFiles(podSpec *core.PodSpec, containers []caas.ContainerSpec, cfgMapName configMapNameFunc) error {
-	for i, container := range containers {
-		for _, fileSet := range container.Files {
-			cfgName := cfgMapName(fileSet.Name)
-			vol := core.Volume{Name: cfgName}
-			if err := k.ensureConfigMap(filesetConfigMap(cfgName, &fileSet)); err != nil {
-				return errors.Annotatef(err, "creating or updating ConfigMap for file set %v", cfgName)
-			}
-			vol.ConfigMap = &core.ConfigMapVolumeSource{
-				LocalObjectReference: core.LocalObjectReference{
-					Name: cfgName,
-				},
-			}
-			podSpec.Volumes = append(podSpec.Volumes, vol)
-			podSpec.Containers[i].VolumeMounts = append(podSpec.Containers[i].VolumeMounts, core.VolumeMount{
-				Name:      cfgName,
-				MountPath: fileSet.MountPath,
-			})
-		}
+// run runs the cleanups in the reverse order to which they were added.
+func (c cleanupStack) run() {
+	for i := len(c) - 1; i >= 0; i-- {
+		c[i]()
 	}
-	return nil
 }
 
-func (k *kubernetesClient) configureDeployment(
-	appName, deploymentName string, labels map[string]string, unitSpec *unitSpec, containers []caas.ContainerSpec, replicas *int32,
-) error {
-	logger.Debugf("creating/updating deployment for %s", appName)
+// EnsureServiceOnly is part of the Broker interface.
+func (k *kubernetesClient) EnsureServiceOnly(appName string, ports []caas.ContainerPort, config application.ConfigAttributes) error {
+	logger.Debugf("updating service for %s", appName)
 
-	// Add the specified file to the pod spec.
-	cfgName := func(fileSetName string) string {
-		return applicationConfigMapName(appName, fileSetName)
+	// Without the pod spec, the ports cannot be split by container.
+	if config.GetBool(servicePerContainerKey, defaultServicePerContainer) {
+		return errors.NotSupportedf("updating only the service of %q when using a service per container", appName)
 	}
-	podSpec := unitSpec.Pod
-	if err := k.configurePodFiles(&podSpec, containers, cfgName); err != nil {
+	labels, ownerRefs, err := k.applicationOwner(appName)
+	if err != nil {
 		return errors.Trace(err)
 	}
+	var k8sPorts []core.ContainerPort
+	for _, p := range ports {
+		k8sPorts = append(k8sPorts, core.ContainerPort{
+			Name:          p.Name,
+			ContainerPort: p.ContainerPort,
+			Protocol:      core.Protocol(p.Protocol),
+		})
+	}
+	err = k.configureService(appName, deploymentName(appName), exposedPorts(k8sPorts), labels, ownerRefs, config, nil)
+	return errors.Annotatef(err, "creating or updating service for %v", appName)
+}
 
-	deployment := &apps.Deployment{
-		ObjectMeta: v1.ObjectMeta{
-			Name:   deploymentName,
-			Labels: labels},
-		Spec: apps.DeploymentSpec{
+// applicationOwner returns the labels of the application's resources,
+// and owner references for use by its other resources. Applications
+// deployed before their resources had a dedicated owner have their
+// resources owned by their stateful set or deployment instead.
+func (k *kubernetesClient) applicationOwner(appName string) (map[string]string, []v1.OwnerReference, error) {
+	owner, err := k.client().CoreV1().ConfigMaps(k.namespace).Get(applicationOwnerName(appName), v1.GetOptions{IncludeUninitialized: true})
+	if err == nil {
+		return owner.Labels, ownerReferences(core.SchemeGroupVersion.String(), "ConfigMap", owner.ObjectMeta), nil
+	}
+	if !k8serrors.IsNotFound(err) {
+		return nil, nil, errors.Trace(err)
+	}
+	name := deploymentName(appName)
+	statefulSet, err := k.client().AppsV1().StatefulSets(k.namespace).Get(name, v1.GetOptions{IncludeUninitialized: true})
+	if err == nil {
+		return statefulSet.Labels, ownerReferences(apps.SchemeGroupVersion.String(), "StatefulSet", statefulSet.ObjectMeta), nil
+	}
+	if !k8serrors.IsNotFound(err) {
+		return nil, nil, errors.Trace(err)
+	}
+	deployment, err := k.client().AppsV1().Deployments(k.namespace).Get(name, v1.GetOptions{IncludeUninitialized: true})
+	if k8serrors.IsNotFound(err) {
+		return nil, nil, errors.NotFoundf("deployment for application %q", appName)
+	}
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	return deployment.Labels, ownerReferences(apps.SchemeGroupVersion.String(), "Deployment", deployment.ObjectMeta), nil
+}
+
+// podPorts returns the ports of all the containers
+// which should be exposed by a service.
+// The containers are those of the unit pods made from the specs.
+func podPorts(containers []core.Container, specs []caas.ContainerSpec) []core.ContainerPort {
+	var ports []core.ContainerPort
+	for i, c := range containers {
+		ports = append(ports, containerPorts(c, specs[i])...)
+	}
+	return ports
+}
+
+// containerPorts returns the ports of the container which
+// should be exposed by a service, leaving out any ports
+// declared as internal by the container's spec.
+func containerPorts(c core.Container, spec caas.ContainerSpec) []core.ContainerPort {
+	internal := make(map[int32]bool)
+	for _, p := range spec.Ports {
+		if p.Internal {
+			internal[p.ContainerPort] = true
+		}
+	}
+	var ports []core.ContainerPort
+	for _, p := range exposedPorts(c.Ports) {
+		if !internal[p.ContainerPort] {
+			ports = append(ports, p)
+		}
+	}
+	return ports
+}
+
+// exposedPorts returns the ports which should be exposed
+// by a service, ignoring any without a port number.
+func exposedPorts(ports []core.ContainerPort) []core.ContainerPort {
+	var result []core.ContainerPort
+	for _, p := range ports {
+		if p.ContainerPort == 0 {
+			continue
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+// ScaleService scales the specified application to the given number of units.
+// Only the replica count of the application's stateful set or deployment is
+// changed; the service, ingress and any persistent volume claims are left in
+// place so a scaled-to-zero application retains its data and external address.
+func (k *kubernetesClient) ScaleService(appName string, scale int) error {
+	if scale < 0 {
+		return errors.NotValidf("negative scale %d", scale)
+	}
+	replicas := int32(scale)
+	statefulsets := k.client().AppsV1().StatefulSets(k.namespace)
+	statefulSet, err := statefulsets.Get(deploymentName(appName), v1.GetOptions{IncludeUninitialized: true})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return errors.Trace(err)
+	}
+	if err == nil {
+		statefulSet.Spec.Replicas = &replicas
+		_, err = statefulsets.Update(statefulSet)
+		return errors.Trace(err)
+	}
+
+	deployments := k.client().AppsV1().Deployments(k.namespace)
+	deployment, err := deployments.Get(deploymentName(appName), v1.GetOptions{IncludeUninitialized: true})
+	if k8serrors.IsNotFound(err) {
+		if scale == 0 {
+			return nil
+		}
+		return errors.NotFoundf("application %q", appName)
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	deployment.Spec.Replicas = &replicas
+	_, err = deployments.Update(deployment)
+	return errors.Trace(err)
+}
+
+// StopApplication is part of the Broker interface.
+func (k *kubernetesClient) StopApplication(appName string) error {
+	logger.Debugf("stopping application %s", appName)
+	return errors.Trace(k.setApplicationStopped(appName, true))
+}
+
+// StartApplication is part of the Broker interface.
+func (k *kubernetesClient) StartApplication(appName string) error {
+	logger.Debugf("starting application %s", appName)
+	return errors.Trace(k.setApplicationStopped(appName, false))
+}
+
+// RollbackApplication is part of the Broker interface. Only the
+// pod template is reverted; like kubectl rollout undo, the rollback
+// is itself rolled out as a new revision of the deployment.
+func (k *kubernetesClient) RollbackApplication(appName string, toRevision int64) error {
+	logger.Debugf("rolling back application %s to revision %d", appName, toRevision)
+	if toRevision <= 0 {
+		return errors.NotValidf("revision %d", toRevision)
+	}
+	deployments := k.client().AppsV1().Deployments(k.namespace)
+	deployment, err := deployments.Get(deploymentName(appName), v1.GetOptions{IncludeUninitialized: true})
+	if k8serrors.IsNotFound(err) {
+		return errors.NotFoundf("deployment for application %q", appName)
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	selector, err := v1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	replicaSets, err := k.client().AppsV1().ReplicaSets(k.namespace).List(v1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	var (
+		target    *apps.ReplicaSet
+		revisions []int64
+	)
+	for i, rs := range replicaSets.Items {
+		if !ownedBy(rs.OwnerReferences, deployment.UID) {
+			continue
+		}
+		revision, err := strconv.ParseInt(rs.Annotations[annotationDeploymentRevision], 10, 64)
+		if err != nil {
+			continue
+		}
+		revisions = append(revisions, revision)
+		if revision == toRevision {
+			target = &replicaSets.Items[i]
+		}
+	}
+	if target == nil {
+		sort.Slice(revisions, func(i, j int) bool { return revisions[i] < revisions[j] })
+		return errors.NotFoundf("revision %d of application %q (retained revisions %v)", toRevision, appName, revisions)
+	}
+
+	// The replica set's pod template hash label is added by the
+	// deployment controller, and is set again when rolled out.
+	template := target.Spec.Template.DeepCopy()
+	delete(template.Labels, apps.DefaultDeploymentUniqueLabelKey)
+	deployment.Spec.Template = *template
+	_, err = deployments.Update(deployment)
+	return errors.Annotatef(err, "rolling back application %q to revision %d", appName, toRevision)
+}
+
+// ownedBy returns true if the owner references include the owner with
+// the specified UID.
+func ownedBy(refs []v1.OwnerReference, uid types.UID) bool {
+	for _, ref := range refs {
+		if ref.UID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// setApplicationStopped stops or starts the stateful set
+// or deployment of the specified application.
+func (k *kubernetesClient) setApplicationStopped(appName string, stop bool) error {
+	statefulsets := k.client().AppsV1().StatefulSets(k.namespace)
+	statefulSet, err := statefulsets.Get(deploymentName(appName), v1.GetOptions{IncludeUninitialized: true})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return errors.Trace(err)
+	}
+	if err == nil {
+		changed, err := setStoppedReplicas(&statefulSet.ObjectMeta, &statefulSet.Spec.Replicas, stop)
+		if err != nil || !changed {
+			return errors.Trace(err)
+		}
+		_, err = statefulsets.Update(statefulSet)
+		return errors.Trace(err)
+	}
+
+	deployments := k.client().AppsV1().Deployments(k.namespace)
+	deployment, err := deployments.Get(deploymentName(appName), v1.GetOptions{IncludeUninitialized: true})
+	if k8serrors.IsNotFound(err) {
+		return errors.NotFoundf("application %q", appName)
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	changed, err := setStoppedReplicas(&deployment.ObjectMeta, &deployment.Spec.Replicas, stop)
+	if err != nil || !changed {
+		return errors.Trace(err)
+	}
+	_, err = deployments.Update(deployment)
+	return errors.Trace(err)
+}
+
+// setStoppedReplicas scales the replicas to zero when stopping, recording
+// the previous number in an annotation, and restores them from the
+// annotation when starting. It returns false if the workload is already
+// in the requested state, so that stopping twice does not lose the count.
+func setStoppedReplicas(meta *v1.ObjectMeta, replicas **int32, stop bool) (bool, error) {
+	value, stopped := meta.Annotations[annotationStoppedReplicas]
+	if stop == stopped {
+		return false, nil
+	}
+	if stop {
+		// Kubernetes defaults unset replicas to 1.
+		current := int32(1)
+		if *replicas != nil {
+			current = **replicas
+		}
+		if meta.Annotations == nil {
+			meta.Annotations = make(map[string]string)
+		}
+		meta.Annotations[annotationStoppedReplicas] = strconv.Itoa(int(current))
+		zero := int32(0)
+		*replicas = &zero
+		return true, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return false, errors.NotValidf("%s annotation %q", annotationStoppedReplicas, value)
+	}
+	restored := int32(n)
+	*replicas = &restored
+	delete(meta.Annotations, annotationStoppedReplicas)
+	return true, nil
+}
+
+func (k *kubernetesClient) configureStorage(
+	podSpec *core.PodSpec, statefulSet *apps.StatefulSetSpec, appName string, filesystems []storage.KubernetesFilesystemParams,
+) error {
+	baseDir, err := paths.StorageDir("kubernetes")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	fallbackStorageClass := k.fallbackStorageClass()
+	logger.Debugf("configuring pod filesystems: %+v", filesystems)
+	for i, fs := range filesystems {
+		if fs.Provider != K8s_ProviderType {
+			return errors.Errorf("invalid storage provider type %q for %v", fs.Provider, fs.StorageName)
+		}
+		var mountPath string
+		if fs.Attachment != nil {
+			mountPath = fs.Attachment.Path
+		}
+		if mountPath == "" {
+			mountPath = fmt.Sprintf("%s/fs/%s/%s/%d", baseDir, appName, fs.StorageName, i)
+		}
+		pvcNamePrefix := fmt.Sprintf("juju-%s-%d", fs.StorageName, i)
+		volStorageLabel := fmt.Sprintf("%s-unit-storage", appName)
+		params := volumeParams{
+			storageLabels:        []string{volStorageLabel, k.namespace, "default"},
+			pvcName:              pvcNamePrefix,
+			requestedVolumeSize:  fmt.Sprintf("%dMi", fs.Size),
+			fallbackStorageClass: fallbackStorageClass,
+		}
+		if storageLabel, ok := fs.Attributes[storageLabel]; ok {
+			params.storageLabels = append([]string{fmt.Sprintf("%v", storageLabel)}, params.storageLabels...)
+		}
+		params.storageConfig, err = newStorageConfig(fs.Attributes, defaultStorageClass)
+		if err != nil {
+			return errors.Annotatef(err, "invalid storage configuration for %v", fs.StorageName)
+		}
+
+		pvcSpec, err := k.maybeGetVolumeClaimSpec(params)
+		if err != nil {
+			return errors.Annotatef(err, "finding volume for %s", fs.StorageName)
+		}
+		tags := make(map[string]string)
+		for k, v := range fs.ResourceTags {
+			tags[k] = v
+		}
+		tags[labelApplication] = appName
+		pvc := core.PersistentVolumeClaim{
+			ObjectMeta: v1.ObjectMeta{
+				Name:   params.pvcName,
+				Labels: tags},
+			Spec: *pvcSpec,
+		}
+		logger.Debugf("using persistent volume claim for %s filesystem %s: %+v", appName, fs.StorageName, pvc)
+		statefulSet.VolumeClaimTemplates = append(statefulSet.VolumeClaimTemplates, pvc)
+		podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, core.VolumeMount{
+			Name:      pvc.Name,
+			MountPath: mountPath,
+		})
+	}
+	return nil
+}
+
+func (k *kubernetesClient) configureDevices(unitSpec *unitSpec, devices []devices.KubernetesDeviceParams) error {
+	for i := range unitSpec.Pod.Containers {
+		resources := unitSpec.Pod.Containers[i].Resources
+		for _, dev := range devices {
+			err := mergeDeviceConstraints(dev, &resources)
+			if err != nil {
+				return errors.Annotatef(err, "merging device constraint %+v to %#v", dev, resources)
+			}
+		}
+		unitSpec.Pod.Containers[i].Resources = resources
+	}
+	nodeLabel, err := getNodeSelectorFromDeviceConstraints(devices)
+	if err != nil {
+		return err
+	}
+	if nodeLabel != "" {
+		unitSpec.Pod.NodeSelector = buildNodeSelector(nodeLabel)
+	}
+	return nil
+}
+
+func (k *kubernetesClient) configureConstraint(unitSpec *unitSpec, constraint, value string) error {
+	for i := range unitSpec.Pod.Containers {
+		resources := unitSpec.Pod.Containers[i].Resources
+		err := mergeConstraint(constraint, value, &resources)
+		if err != nil {
+			return errors.Annotatef(err, "merging constraint %q to %#v", constraint, resources)
+		}
+		unitSpec.Pod.Containers[i].Resources = resources
+	}
+	return nil
+}
+
+type configMapNameFunc func(fileSetName string) string
+
+// deploymentConfigMapName returns the names of the config maps holding
+// the file sets of a deployment. Each track of the application has its
+// own config maps.
+func deploymentConfigMapName(deploymentName string) configMapNameFunc {
+	return func(fileSetName string) string {
+		return fmt.Sprintf("%v-%v-config", deploymentName, fileSetName)
+	}
+}
+
+// statefulSetConfigMapName returns the names of the config maps
+// holding the file sets of an application's stateful set.
+func statefulSetConfigMapName(appName string) configMapNameFunc {
+	return func(fileSetName string) string {
+		return applicationConfigMapName(appName, fileSetName)
+	}
+}
+
+// ensurePodFiles creates or updates the config maps holding the
+// containers' file sets.
+func (k *kubernetesClient) ensurePodFiles(
+	containers []caas.ContainerSpec, cfgMapName configMapNameFunc,
+	ownerRefs []v1.OwnerReference, rollback *cleanupStack,
+) error {
+	for _, container := range containers {
+		for _, fileSet := range container.Files {
+			cfgName := cfgMapName(fileSet.Name)
+			configMap := filesetConfigMap(cfgName, &fileSet)
+			configMap.OwnerReferences = ownerRefs
+			created, err := k.createOrUpdateConfigMap(configMap)
+			if err != nil {
+				return errors.Annotatef(err, "creating or updating ConfigMap for file set %v", cfgName)
+			}
+			if created {
+				rollback.add("config map "+cfgName, func() error { return k.deleteConfigMap(cfgName) })
+			}
+		}
+	}
+	return nil
+}
+
+// addPodFiles adds the volumes and mounts for the
+// containers' file sets to the pod spec.
+func addPodFiles(podSpec *core.PodSpec, containers []caas.ContainerSpec, cfgMapName configMapNameFunc) {
+	for i, container := range containers {
+		for _, fileSet := range container.Files {
+			cfgName := cfgMapName(fileSet.Name)
+			vol := core.Volume{Name: cfgName}
+			vol.ConfigMap = &core.ConfigMapVolumeSource{
+				LocalObjectReference: core.LocalObjectReference{
+					Name: cfgName,
+				},
+			}
+			podSpec.Volumes = append(podSpec.Volumes, vol)
+			mount := core.VolumeMount{
+				Name:      cfgName,
+				MountPath: fileSet.MountPath,
+			}
+			if fileSet.MountPropagation != "" {
+				propagation := core.MountPropagationMode(fileSet.MountPropagation)
+				mount.MountPropagation = &propagation
+			}
+			podSpec.Containers[i].VolumeMounts = append(podSpec.Containers[i].VolumeMounts, mount)
+		}
+	}
+}
+
+func (k *kubernetesClient) configureDeployment(
+	appName, deploymentName string, labels map[string]string, ownerRefs []v1.OwnerReference,
+	unitSpec *unitSpec, containers []caas.ContainerSpec, replicas *int32,
+	config application.ConfigAttributes, rollback *cleanupStack,
+) (*apps.Deployment, error) {
+	logger.Debugf("creating/updating deployment for %s", appName)
+
+	deployment, err := deploymentSpec(appName, deploymentName, labels, ownerRefs, unitSpec, containers, replicas, config)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	err = k.ensurePodFiles(containers, deploymentConfigMapName(deploymentName), ownerRefs, rollback)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	existing, err := k.client().AppsV1().Deployments(k.namespace).Get(deploymentName, v1.GetOptions{IncludeUninitialized: true})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, errors.Trace(err)
+	}
+	if err == nil && existing != nil {
+		if err := checkAdoptable("deployment", existing.ObjectMeta, appName, config); err != nil {
+			return nil, errors.Trace(err)
+		}
+		// The deployment is scaled outside of Juju (eg by a horizontal
+		// pod autoscaler), so only use the unit count when creating it.
+		if config.GetBool(deploymentPreserveReplicasKey, defaultPreserveReplicas) {
+			deployment.Spec.Replicas = existing.Spec.Replicas
+		}
+		if !deploymentChanged(existing, deployment) {
+			logger.Debugf("deployment %s for %s unchanged", deploymentName, appName)
+			return existing, nil
+		}
+	}
+	out, created, err := k.ensureDeployment(deployment)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if created {
+		rollback.add("deployment "+deploymentName, func() error { return k.deleteDeployment(deploymentName) })
+	}
+	return out, nil
+}
+
+// deploymentSpec returns the deployment Juju makes for the
+// application, or for one of its tracks, without creating it.
+func deploymentSpec(
+	appName, deploymentName string, labels map[string]string, ownerRefs []v1.OwnerReference,
+	unitSpec *unitSpec, containers []caas.ContainerSpec, replicas *int32,
+	config application.ConfigAttributes,
+) (*apps.Deployment, error) {
+	progressDeadline := config.GetInt(deploymentProgressDeadlineKey, 0)
+	if progressDeadline < 0 {
+		return nil, errors.NotValidf("%s %d", deploymentProgressDeadlineKey, progressDeadline)
+	}
+	// A new pod only counts as available once it has passed its readiness
+	// probe and then stayed ready for the min ready seconds, so a rollout
+	// doesn't advance past pods whose readiness flaps.
+	minReadySeconds := config.GetInt(deploymentMinReadySecondsKey, 0)
+	if minReadySeconds < 0 {
+		return nil, errors.NotValidf("%s %d", deploymentMinReadySecondsKey, minReadySeconds)
+	}
+	// Kubernetes rejects a deadline which could pass before any
+	// pod has been ready for long enough to become available.
+	if progressDeadline > 0 && progressDeadline <= minReadySeconds {
+		return nil, errors.NotValidf("%s %d not greater than %s %d",
+			deploymentProgressDeadlineKey, progressDeadline, deploymentMinReadySecondsKey, minReadySeconds)
+	}
+	// Zero is a valid revision history limit, so only
+	// set it when it has been explicitly configured.
+	var revisionHistoryLimit *int32
+	if _, ok := config[deploymentRevisionHistoryKey]; ok {
+		limit := config.GetInt(deploymentRevisionHistoryKey, 0)
+		if limit < 0 {
+			return nil, errors.NotValidf("%s %d", deploymentRevisionHistoryKey, limit)
+		}
+		limit32 := int32(limit)
+		revisionHistoryLimit = &limit32
+	}
+
+	// Add the specified file to the pod spec.
+	podSpec := unitSpec.Pod
+	addPodFiles(&podSpec, containers, deploymentConfigMapName(deploymentName))
+
+	// The pods of every track, including the main deployment's, are
+	// labelled with their track so that the service can be pointed at
+	// any one of them. The selector of the main deployment is immutable
+	// and predates tracks, so only other tracks' selectors include it.
+	selector := map[string]string{labelApplication: appName}
+	templateLabels := map[string]string{labelTrack: defaultTrack}
+	for name, value := range podTemplateLabels(labels, unitSpec.Labels) {
+		templateLabels[name] = value
+	}
+	if track := labels[labelTrack]; track != "" {
+		selector[labelTrack] = track
+	}
+	deployment := &apps.Deployment{
+		ObjectMeta: v1.ObjectMeta{
+			Name:            deploymentName,
+			Labels:          labels,
+			OwnerReferences: ownerRefs,
+		},
+		Spec: apps.DeploymentSpec{
 			Replicas: replicas,
 			Selector: &v1.LabelSelector{
-				MatchLabels: map[string]string{labelApplication: appName},
+				MatchLabels: selector,
 			},
 			Template: core.PodTemplateSpec{
 				ObjectMeta: v1.ObjectMeta{
 					GenerateName: deploymentName + "-",
-					Labels:       labels,
+					Labels:       templateLabels,
 				},
 				Spec: podSpec,
 			},
+			MinReadySeconds:      int32(minReadySeconds),
+			RevisionHistoryLimit: revisionHistoryLimit,
 		},
 	}
-	return k.ensureDeployment(deployment)
+	if progressDeadline > 0 {
+		deadline := int32(progressDeadline)
+		deployment.Spec.ProgressDeadlineSeconds = &deadline
+	}
+	hash, err := deploymentSpecHash(deployment)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	deployment.Annotations = map[string]string{annotationSpecHash: hash}
+	return deployment, nil
+}
+
+// deploymentSpecHash returns a hash of the labels, owner and spec of
+// the deployment, other than its replicas. Kubernetes fills in defaults
+// for many fields of a pod template, so an existing deployment cannot be
+// compared with the one Juju would make, only with the hash of it.
+func deploymentSpecHash(deployment *apps.Deployment) (string, error) {
+	spec := deployment.Spec
+	spec.Replicas = nil
+	data, err := json.Marshal(struct {
+		Labels          map[string]string
+		OwnerReferences []v1.OwnerReference
+		Spec            apps.DeploymentSpec
+	}{deployment.Labels, deployment.OwnerReferences, spec})
+	if err != nil {
+		return "", errors.Annotatef(err, "hashing deployment %q", deployment.Name)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+// deploymentChanged returns true if updating the existing deployment to
+// the spec would change its replicas or any of the other fields Juju sets.
+func deploymentChanged(existing, spec *apps.Deployment) bool {
+	if existing.Annotations[annotationSpecHash] != spec.Annotations[annotationSpecHash] {
+		return true
+	}
+	if existing.Spec.Replicas == nil || spec.Spec.Replicas == nil {
+		return existing.Spec.Replicas != spec.Spec.Replicas
+	}
+	return *existing.Spec.Replicas != *spec.Spec.Replicas
+}
+
+// podTemplateLabels returns the labels for an application's pod
+// template: any labels from the pod spec, overridden by the labels
+// Juju sets, since the workload's selector depends on them.
+func podTemplateLabels(labels, podLabels map[string]string) map[string]string {
+	if len(podLabels) == 0 {
+		return labels
+	}
+	result := make(map[string]string)
+	for name, value := range podLabels {
+		result[name] = value
+	}
+	for name, value := range labels {
+		result[name] = value
+	}
+	return result
+}
+
+// trackNameRegexp matches valid track names, which are
+// used in the names and labels of kubernetes resources.
+var trackNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// configureTrack creates or updates the deployment running
+// the track of the application given by the params.
+func (k *kubernetesClient) configureTrack(
+	appName string, params *caas.ServiceParams, numUnits int, unitSpec *unitSpec,
+	tags map[string]string, ownerRefs []v1.OwnerReference, config application.ConfigAttributes, rollback *cleanupStack,
+) error {
+	if !trackNameRegexp.MatchString(params.Track) || params.Track == defaultTrack {
+		return errors.NotValidf("track name %q", params.Track)
+	}
+	if len(params.Filesystems) > 0 {
+		return errors.NotSupportedf("tracks of applications with storage")
+	}
+	// Point the application's services at the main deployment's pods
+	// before the track's pods are created, so that they don't start
+	// receiving traffic until the service is switched to the track.
+	existing, err := k.client().AppsV1().Deployments(k.namespace).Get(deploymentName(appName), v1.GetOptions{IncludeUninitialized: true})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return errors.Trace(err)
+	}
+	if err == nil {
+		if _, ok := existing.Spec.Template.Labels[labelTrack]; !ok {
+			return errors.Errorf("the pods of application %q have no track label, update the application before adding a track", appName)
+		}
+		if err := k.switchServices(appName, defaultTrack, true); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	labels := make(map[string]string)
+	for k, v := range tags {
+		labels[k] = v
+	}
+	labels[labelTrack] = params.Track
+	numPods := int32(numUnits)
+	_, err = k.configureDeployment(
+		appName, trackDeploymentName(appName, params.Track), labels, ownerRefs, unitSpec, params.PodSpec.Containers, &numPods, config, rollback)
+	return errors.Trace(err)
+}
+
+// SwitchServiceTrack is part of the Broker interface.
+func (k *kubernetesClient) SwitchServiceTrack(appName, track string) error {
+	logger.Debugf("switching service for %s to track %q", appName, track)
+	if track == "" {
+		track = defaultTrack
+	} else if track != defaultTrack {
+		_, err := k.client().AppsV1().Deployments(k.namespace).Get(trackDeploymentName(appName, track), v1.GetOptions{IncludeUninitialized: true})
+		if k8serrors.IsNotFound(err) {
+			return errors.NotFoundf("track %q of application %q", track, appName)
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return errors.Trace(k.switchServices(appName, track, false))
+}
+
+// switchServices points the selectors of the application's services at
+// the pods of the track. Services which have never been switched select
+// the pods of every track, and are only changed when pinning them to the
+// main deployment's pods before another track is created; an application
+// without other tracks is left selecting all its pods, since the pods of
+// a stateful set or of a deployment made before tracks have no track label.
+func (k *kubernetesClient) switchServices(appName, track string, pin bool) error {
+	services := k.client().CoreV1().Services(k.namespace)
+	servicesList, err := services.List(v1.ListOptions{
+		LabelSelector: applicationSelector(appName),
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(servicesList.Items) == 0 && !pin {
+		return errors.NotFoundf("service for application %q", appName)
+	}
+	for _, service := range servicesList.Items {
+		// Services without a selector front external endpoints.
+		if len(service.Spec.Selector) == 0 {
+			continue
+		}
+		current, switched := service.Spec.Selector[labelTrack]
+		if current == track || (switched && pin) || (!switched && !pin && track == defaultTrack) {
+			continue
+		}
+		service.Spec.Selector[labelTrack] = track
+		if _, err := services.Update(&service); err != nil {
+			return errors.Annotatef(err, "switching service %q to track %q", service.Name, track)
+		}
+	}
+	return nil
+}
+
+// DeleteServiceTrack is part of the Broker interface.
+func (k *kubernetesClient) DeleteServiceTrack(appName, track string) error {
+	logger.Debugf("deleting track %q of %s", track, appName)
+	if track == "" || track == defaultTrack {
+		return errors.NotValidf("deleting the default track")
+	}
+	service, err := k.client().CoreV1().Services(k.namespace).Get(deploymentName(appName), v1.GetOptions{IncludeUninitialized: true})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return errors.Trace(err)
+	}
+	if err == nil && service.Spec.Selector[labelTrack] == track {
+		return errors.Errorf("cannot delete track %q of application %q while its service uses the track", track, appName)
+	}
+	return errors.Trace(k.deleteDeployment(trackDeploymentName(appName, track)))
+}
+
+// deploymentRolloutStatus returns the Juju status of the latest rollout of
+// the specified deployment, as reported by its Progressing and Available
+// conditions. A rollout which has exceeded its progress deadline is reported
+// as an error.
+func deploymentRolloutStatus(deployment *apps.Deployment) (status.Status, string) {
+	var available bool
+	for _, cond := range deployment.Status.Conditions {
+		switch cond.Type {
+		case apps.DeploymentProgressing:
+			if cond.Status == core.ConditionFalse && cond.Reason == "ProgressDeadlineExceeded" {
+				return status.Error, cond.Message
+			}
+		case apps.DeploymentAvailable:
+			available = cond.Status == core.ConditionTrue
+		}
+	}
+	if !available {
+		return status.Waiting, "waiting for deployment to become available"
+	}
+	return status.Active, ""
+}
+
+// ApplicationStatus is part of the Broker interface.
+func (k *kubernetesClient) ApplicationStatus(appName string) (status.StatusInfo, error) {
+	now := k.clock.Now()
+	deployment, err := k.client().AppsV1().Deployments(k.namespace).Get(deploymentName(appName), v1.GetOptions{IncludeUninitialized: true})
+	if err == nil {
+		desired := int32(1)
+		if deployment.Spec.Replicas != nil {
+			desired = *deployment.Spec.Replicas
+		}
+		ready := deployment.Status.ReadyReplicas
+		appStatus, message := deploymentRolloutStatus(deployment)
+		switch {
+		case appStatus == status.Error:
+		case ready >= desired && appStatus == status.Active:
+			message = unitsReadyMessage(ready, desired)
+		default:
+			appStatus = status.Waiting
+			message = unitsReadyMessage(ready, desired)
+		}
+		if appStatus == status.Active {
+			return k.checkServiceSelection(appName, desired, status.StatusInfo{Status: appStatus, Message: message, Since: &now})
+		}
+		return status.StatusInfo{Status: appStatus, Message: message, Since: &now}, nil
+	}
+	if !k8serrors.IsNotFound(err) {
+		return status.StatusInfo{}, errors.Trace(err)
+	}
+
+	statefulset, err := k.client().AppsV1().StatefulSets(k.namespace).Get(deploymentName(appName), v1.GetOptions{IncludeUninitialized: true})
+	if k8serrors.IsNotFound(err) {
+		return status.StatusInfo{}, errors.NotFoundf("application %q", appName)
+	}
+	if err != nil {
+		return status.StatusInfo{}, errors.Trace(err)
+	}
+	desired := int32(1)
+	if statefulset.Spec.Replicas != nil {
+		desired = *statefulset.Spec.Replicas
+	}
+	ready := statefulset.Status.ReadyReplicas
+	if ready < desired {
+		return status.StatusInfo{Status: status.Waiting, Message: unitsReadyMessage(ready, desired), Since: &now}, nil
+	}
+	return k.checkServiceSelection(appName, desired, status.StatusInfo{Status: status.Active, Message: unitsReadyMessage(ready, desired), Since: &now})
+}
+
+// checkServiceSelection returns the active status of the application,
+// unless its service selects none of its pods, in which case the
+// application is reported as blocked until its pods or the
+// kubernetes-service-selector config are fixed. An application with
+// no desired replicas, because it has been scaled to zero or stopped,
+// is expected to have no pods and so is never blocked.
+func (k *kubernetesClient) checkServiceSelection(appName string, desired int32, active status.StatusInfo) (status.StatusInfo, error) {
+	if desired == 0 {
+		return active, nil
+	}
+	message, err := k.serviceSelectionStatus(appName)
+	if err != nil {
+		return status.StatusInfo{}, errors.Trace(err)
+	}
+	if message != "" {
+		active.Status = status.Blocked
+		active.Message = message
+	}
+	return active, nil
+}
+
+func unitsReadyMessage(ready, desired int32) string {
+	return fmt.Sprintf("%d/%d units ready", ready, desired)
+}
+
+// ensureDeployment creates or updates the deployment,
+// reporting whether it was created.
+func (k *kubernetesClient) ensureDeployment(spec *apps.Deployment) (_ *apps.Deployment, created bool, _ error) {
+	deployments := k.client().AppsV1().Deployments(k.namespace)
+	out, err := deployments.Update(spec)
+	if k8serrors.IsNotFound(err) {
+		out, err = deployments.Create(spec)
+		created = err == nil
+	}
+	return out, created, errors.Trace(err)
+}
+
+// checkAdoptable returns an AlreadyExists error if the existing resource
+// is not labelled as belonging to the application, so that Juju does not
+// take over unrelated workloads which happen to share its name, unless
+// the application config allows such resources to be adopted.
+func checkAdoptable(kind string, existing v1.ObjectMeta, appName string, config application.ConfigAttributes) error {
+	if existing.Labels[labelApplication] == appName {
+		return nil
+	}
+	if config.GetBool(adoptExistingResourcesKey, defaultAdoptExisting) {
+		logger.Warningf("adopting existing %s %q for application %q", kind, existing.Name, appName)
+		return nil
+	}
+	return errors.NewAlreadyExists(nil, fmt.Sprintf(
+		"%s %q exists but does not belong to application %q; set %s to adopt it",
+		kind, existing.Name, appName, adoptExistingResourcesKey,
+	))
+}
+
+// ownerReferences returns owner references to the specified object,
+// for use by any resources it owns so that Kubernetes garbage
+// collects them when the owner is deleted.
+func ownerReferences(apiVersion, kind string, owner v1.ObjectMeta) []v1.OwnerReference {
+	if owner.UID == "" {
+		return nil
+	}
+	blockOwnerDeletion := true
+	return []v1.OwnerReference{{
+		APIVersion:         apiVersion,
+		Kind:               kind,
+		Name:               owner.Name,
+		UID:                owner.UID,
+		BlockOwnerDeletion: &blockOwnerDeletion,
+	}}
+}
+
+// applicationOwnerName returns the name of the config map
+// which owns the resources of the application.
+func applicationOwnerName(appName string) string {
+	return deploymentName(appName) + "-owner"
 }
 
-func (k *kubernetesClient) ensureDeployment(spec *apps.Deployment) error {
-	deployments := k.AppsV1().Deployments(k.namespace)
-	_, err := deployments.Update(spec)
+// ensureApplicationOwner creates the config map which owns the resources
+// of the application, if it doesn't exist, and returns owner references to
+// it. Unlike the application's deployment or stateful set, the owner is
+// never replaced while the application exists, so its resources are only
+// garbage collected by Kubernetes when the application is deleted.
+func (k *kubernetesClient) ensureApplicationOwner(
+	appName string, labels map[string]string, rollback *cleanupStack,
+) ([]v1.OwnerReference, error) {
+	name := applicationOwnerName(appName)
+	configMaps := k.client().CoreV1().ConfigMaps(k.namespace)
+	owner, err := configMaps.Get(name, v1.GetOptions{IncludeUninitialized: true})
 	if k8serrors.IsNotFound(err) {
-		_, err = deployments.Create(spec)
+		owner, err = configMaps.Create(&core.ConfigMap{
+			ObjectMeta: v1.ObjectMeta{
+				Name:   name,
+				Labels: labels,
+			},
+		})
+		if err == nil {
+			rollback.add("owner "+name, func() error { return k.deleteConfigMap(name) })
+		}
 	}
-	return errors.Trace(err)
+	if err != nil {
+		return nil, errors.Annotatef(err, "creating owner for application %q", appName)
+	}
+	return ownerReferences(core.SchemeGroupVersion.String(), "ConfigMap", owner.ObjectMeta), nil
 }
 
 func (k *kubernetesClient) deleteDeployment(name string) error {
-	deployments := k.AppsV1().Deployments(k.namespace)
+	deployments := k.client().AppsV1().Deployments(k.namespace)
 	err := deployments.Delete(name, &v1.DeleteOptions{
-		PropagationPolicy: &defaultPropagationPolicy,
+		PropagationPolicy: k.propagationPolicy(),
 	})
 	if k8serrors.IsNotFound(err) {
 		return nil
@@ -1202,19 +2941,53 @@ func (k *kubernetesClient) deleteDeployment(name string) error {
 }
 
 func (k *kubernetesClient) configureStatefulSet(
-	appName string, labels map[string]string, unitSpec *unitSpec,
+	appName string, labels map[string]string, ownerRefs []v1.OwnerReference, unitSpec *unitSpec,
 	containers []caas.ContainerSpec, replicas *int32, filesystems []storage.KubernetesFilesystemParams,
-) error {
+	rollback *cleanupStack,
+) (*apps.StatefulSet, error) {
 	logger.Debugf("creating/updating stateful set for %s", appName)
 
-	// Add the specified file to the pod spec.
-	cfgName := func(fileSetName string) string {
-		return applicationConfigMapName(appName, fileSetName)
+	if err := k.ensurePodFiles(containers, statefulSetConfigMapName(appName), ownerRefs, rollback); err != nil {
+		return nil, errors.Trace(err)
+	}
+	statefulset := statefulSetSpec(appName, labels, ownerRefs, unitSpec, containers, replicas)
+	podSpec := statefulset.Spec.Template.Spec
+	existingPodSpec := podSpec
+
+	// Create a new stateful set with the necessary storage config.
+	if err := k.configureStorage(&podSpec, &statefulset.Spec, appName, filesystems); err != nil {
+		return nil, errors.Annotatef(err, "configuring storage for %s", appName)
+	}
+	statefulset.Spec.Template.Spec = podSpec
+	out, created, err := k.ensureStatefulSet(statefulset, existingPodSpec)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if created {
+		// Claims made from the volume claim templates outlive the
+		// stateful set, so remove them once it has been deleted.
+		rollback.add("persistent volume claims for "+appName, func() error { return k.deleteApplicationVolumeClaims(appName) })
+		rollback.add("stateful set "+statefulset.Name, func() error { return k.deleteStatefulSet(statefulset.Name) })
+		return out, nil
+	}
+	if err := k.resizeVolumeClaims(appName, statefulset); err != nil {
+		return nil, errors.Annotatef(err, "resizing storage for %s", appName)
 	}
+	return out, nil
+}
+
+// statefulSetSpec returns the stateful set Juju makes for the
+// application, without its storage and without creating it.
+func statefulSetSpec(
+	appName string, labels map[string]string, ownerRefs []v1.OwnerReference, unitSpec *unitSpec,
+	containers []caas.ContainerSpec, replicas *int32,
+) *apps.StatefulSet {
 	statefulset := &apps.StatefulSet{
 		ObjectMeta: v1.ObjectMeta{
-			Name:   deploymentName(appName),
-			Labels: labels},
+			Name:            deploymentName(appName),
+			Labels:          labels,
+			OwnerReferences: ownerRefs,
+		},
 		Spec: apps.StatefulSetSpec{
 			Replicas: replicas,
 			Selector: &v1.LabelSelector{
@@ -1222,34 +2995,95 @@ func (k *kubernetesClient) configureStatefulSet(
 			},
 			Template: core.PodTemplateSpec{
 				ObjectMeta: v1.ObjectMeta{
-					Labels: labels,
+					Labels: podTemplateLabels(labels, unitSpec.Labels),
 				},
 			},
 			PodManagementPolicy: apps.ParallelPodManagement,
 		},
 	}
+	// Add the specified file to the pod spec.
 	podSpec := unitSpec.Pod
-	if err := k.configurePodFiles(&podSpec, containers, cfgName); err != nil {
+	addPodFiles(&podSpec, containers, statefulSetConfigMapName(appName))
+	statefulset.Spec.Template.Spec = podSpec
+	return statefulset
+}
+
+// resizeVolumeClaims grows the persistent volume claims made from the
+// stateful set's volume claim templates to the size now requested by
+// the templates. The templates of an existing stateful set cannot be
+// changed, so the claims are updated directly. Volumes are never shrunk.
+func (k *kubernetesClient) resizeVolumeClaims(appName string, statefulset *apps.StatefulSet) error {
+	if len(statefulset.Spec.VolumeClaimTemplates) == 0 {
+		return nil
+	}
+	pvcs := k.client().CoreV1().PersistentVolumeClaims(k.namespace)
+	claims, err := pvcs.List(v1.ListOptions{
+		LabelSelector: applicationSelector(appName),
+	})
+	if err != nil {
 		return errors.Trace(err)
 	}
-	existingPodSpec := podSpec
+	for _, template := range statefulset.Spec.VolumeClaimTemplates {
+		requested, ok := template.Spec.Resources.Requests[core.ResourceStorage]
+		if !ok {
+			continue
+		}
+		// Claims are named after the template, stateful set and pod ordinal.
+		prefix := fmt.Sprintf("%s-%s-", template.Name, statefulset.Name)
+		for _, claim := range claims.Items {
+			if !strings.HasPrefix(claim.Name, prefix) {
+				continue
+			}
+			current := claim.Spec.Resources.Requests[core.ResourceStorage]
+			if requested.Cmp(current) <= 0 {
+				continue
+			}
+			if err := k.checkVolumeExpansion(claim); err != nil {
+				return errors.Annotatef(err, "cannot resize persistent volume claim %q from %v to %v", claim.Name, current.String(), requested.String())
+			}
+			logger.Debugf("resizing persistent volume claim %q from %v to %v", claim.Name, current.String(), requested.String())
+			if claim.Spec.Resources.Requests == nil {
+				claim.Spec.Resources.Requests = core.ResourceList{}
+			}
+			claim.Spec.Resources.Requests[core.ResourceStorage] = requested
+			if _, err := pvcs.Update(&claim); err != nil {
+				return errors.Annotatef(err, "resizing persistent volume claim %q", claim.Name)
+			}
+		}
+	}
+	return nil
+}
 
-	// Create a new stateful set with the necessary storage config.
-	if err := k.configureStorage(&podSpec, &statefulset.Spec, appName, filesystems); err != nil {
-		return errors.Annotatef(err, "configuring storage for %s", appName)
+// checkVolumeExpansion returns an error if the storage class
+// of the claim does not allow its volume to be expanded.
+func (k *kubernetesClient) checkVolumeExpansion(claim core.PersistentVolumeClaim) error {
+	if claim.Spec.StorageClassName == nil || *claim.Spec.StorageClassName == "" {
+		return errors.New("claim has no storage class")
 	}
-	statefulset.Spec.Template.Spec = podSpec
-	return k.ensureStatefulSet(statefulset, existingPodSpec)
+	scName := *claim.Spec.StorageClassName
+	sc, err := k.client().StorageV1().StorageClasses().Get(scName, v1.GetOptions{})
+	if err != nil {
+		return errors.Annotatef(err, "getting storage class %q", scName)
+	}
+	if sc.AllowVolumeExpansion == nil || !*sc.AllowVolumeExpansion {
+		return errors.Errorf("storage class %q does not allow volume expansion", scName)
+	}
+	return nil
 }
 
-func (k *kubernetesClient) ensureStatefulSet(spec *apps.StatefulSet, existingPodSpec core.PodSpec) error {
-	statefulsets := k.AppsV1().StatefulSets(k.namespace)
-	_, err := statefulsets.Update(spec)
+// ensureStatefulSet creates or updates the stateful set,
+// reporting whether it was created.
+func (k *kubernetesClient) ensureStatefulSet(
+	spec *apps.StatefulSet, existingPodSpec core.PodSpec,
+) (_ *apps.StatefulSet, created bool, _ error) {
+	statefulsets := k.client().AppsV1().StatefulSets(k.namespace)
+	out, err := statefulsets.Update(spec)
 	if k8serrors.IsNotFound(err) {
-		_, err = statefulsets.Create(spec)
+		out, err = statefulsets.Create(spec)
+		created = err == nil
 	}
 	if !k8serrors.IsInvalid(err) {
-		return errors.Trace(err)
+		return out, created, errors.Trace(err)
 	}
 
 	// The statefulset already exists so all we are allowed to update is replicas,
@@ -1257,19 +3091,50 @@ func (k *kubernetesClient) ensureStatefulSet(spec *apps.StatefulSet, existingPod
 	// requested volume size due to trying to adapt the unit model to the k8s world.
 	existing, err := statefulsets.Get(spec.Name, v1.GetOptions{IncludeUninitialized: true})
 	if err != nil {
-		return errors.Trace(err)
+		return nil, false, errors.Trace(err)
 	}
 	// TODO(caas) - allow extra storage to be added
+	existing.OwnerReferences = spec.OwnerReferences
 	existing.Spec.Replicas = spec.Spec.Replicas
 	existing.Spec.Template.Spec.Containers = existingPodSpec.Containers
-	_, err = statefulsets.Update(existing)
-	return errors.Trace(err)
+	out, err = statefulsets.Update(existing)
+	return out, false, errors.Trace(err)
+}
+
+// containerImagesChanged returns true if any of the desired containers
+// has an image (including any digest) which differs from the image of
+// the existing container with the same name.
+func containerImagesChanged(existing, desired []core.Container) bool {
+	existingImages := make(map[string]string)
+	for _, c := range existing {
+		existingImages[c.Name] = c.Image
+	}
+	for _, c := range desired {
+		if image, ok := existingImages[c.Name]; !ok || image != c.Image {
+			return true
+		}
+	}
+	return false
 }
 
 func (k *kubernetesClient) deleteStatefulSet(name string) error {
-	deployments := k.AppsV1().StatefulSets(k.namespace)
+	deployments := k.client().AppsV1().StatefulSets(k.namespace)
 	err := deployments.Delete(name, &v1.DeleteOptions{
-		PropagationPolicy: &defaultPropagationPolicy,
+		PropagationPolicy: k.propagationPolicy(),
+	})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	return errors.Trace(err)
+}
+
+// deleteApplicationVolumeClaims deletes all the persistent
+// volume claims labelled as belonging to the application.
+func (k *kubernetesClient) deleteApplicationVolumeClaims(appName string) error {
+	err := k.client().CoreV1().PersistentVolumeClaims(k.namespace).DeleteCollection(&v1.DeleteOptions{
+		PropagationPolicy: k.propagationPolicy(),
+	}, v1.ListOptions{
+		LabelSelector: applicationSelector(appName),
 	})
 	if k8serrors.IsNotFound(err) {
 		return nil
@@ -1300,9 +3165,9 @@ func (k *kubernetesClient) deleteVolumeClaims(appName string, p *core.Pod) ([]st
 			// Ignore volumes which are not Juju managed filesystems.
 			continue
 		}
-		pvClaims := k.CoreV1().PersistentVolumeClaims(k.namespace)
+		pvClaims := k.client().CoreV1().PersistentVolumeClaims(k.namespace)
 		err := pvClaims.Delete(vol.PersistentVolumeClaim.ClaimName, &v1.DeleteOptions{
-			PropagationPolicy: &defaultPropagationPolicy,
+			PropagationPolicy: k.propagationPolicy(),
 		})
 		if err != nil && !k8serrors.IsNotFound(err) {
 			return nil, errors.Annotatef(err, "deleting persistent volume claim %v for %v",
@@ -1314,11 +3179,54 @@ func (k *kubernetesClient) deleteVolumeClaims(appName string, p *core.Pod) ([]st
 }
 
 func (k *kubernetesClient) configureService(
-	appName string, containerPorts []core.ContainerPort,
-	tags map[string]string, config application.ConfigAttributes,
+	appName, serviceName string, containerPorts []core.ContainerPort,
+	tags map[string]string, ownerRefs []v1.OwnerReference, config application.ConfigAttributes,
+	rollback *cleanupStack,
 ) error {
-	logger.Debugf("creating/updating service for %s", appName)
+	logger.Debugf("creating/updating service %s for %s", serviceName, appName)
+
+	service, addresses, err := k.serviceSpec(appName, serviceName, containerPorts, tags, ownerRefs, config)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	created, err := k.ensureService(service, appName, config)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if created {
+		rollback.add("service "+serviceName, func() error { return k.deleteServiceNamed(serviceName) })
+	}
+	if len(addresses) == 0 {
+		return nil
+	}
+	endpoints := &core.Endpoints{
+		ObjectMeta: v1.ObjectMeta{
+			Name:            serviceName,
+			Labels:          tags,
+			OwnerReferences: ownerRefs,
+		},
+		Subsets: []core.EndpointSubset{{
+			Addresses: addresses,
+			Ports:     endpointPorts(service.Spec.Ports),
+		}},
+	}
+	if err := k.ensureEndpoints(endpoints); err != nil {
+		return errors.Annotatef(err, "creating or updating endpoints %s", serviceName)
+	}
+	return nil
+}
 
+// serviceSpec returns the service Juju makes for the application,
+// without creating it, and the addresses of any external backends
+// which the service fronts instead of the application's pods.
+func (k *kubernetesClient) serviceSpec(
+	appName, serviceName string, containerPorts []core.ContainerPort,
+	tags map[string]string, ownerRefs []v1.OwnerReference, config application.ConfigAttributes,
+) (*core.Service, []core.EndpointAddress, error) {
+	configuredTargetPort, err := serviceTargetPort(config, containerPorts)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
 	var ports []core.ServicePort
 	for i, cp := range containerPorts {
 		// We normally expect a single container port for most use cases.
@@ -1327,58 +3235,470 @@ func (k *kubernetesClient) configureService(
 		// TODO(caas) - consider allowing all service ports to be specified
 		var targetPort intstr.IntOrString
 		if i == 0 {
-			targetPort = intstr.FromInt(config.GetInt(serviceTargetPortConfigKey, int(cp.ContainerPort)))
+			targetPort = intstr.FromInt(int(cp.ContainerPort))
+			if configuredTargetPort != nil {
+				targetPort = *configuredTargetPort
+			}
+		}
+		ports = append(ports, core.ServicePort{
+			Name:       cp.Name,
+			Protocol:   cp.Protocol,
+			Port:       cp.ContainerPort,
+			TargetPort: targetPort,
+		})
+	}
+
+	// A service fronting external backends has no selector, and
+	// its endpoints are managed by Juju rather than by Kubernetes.
+	addresses, err := serviceEndpointAddresses(config)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	var selector map[string]string
+	if len(addresses) == 0 {
+		if selector, err = k.serviceSelector(appName, config); err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+	}
+	serviceType := core.ServiceType(config.GetString(serviceTypeConfigKey, defaultServiceType))
+	service := &core.Service{
+		ObjectMeta: v1.ObjectMeta{
+			Name:            serviceName,
+			Labels:          tags,
+			OwnerReferences: ownerRefs,
+		},
+		Spec: core.ServiceSpec{
+			Selector:                 selector,
+			Type:                     serviceType,
+			Ports:                    ports,
+			ExternalIPs:              config.Get(serviceExternalIPsConfigKey, []string(nil)).([]string),
+			LoadBalancerIP:           config.GetString(serviceLoadBalancerIPKey, ""),
+			LoadBalancerSourceRanges: config.Get(serviceLoadBalancerSourceRangesKey, []string(nil)).([]string),
+			ExternalName:             config.GetString(serviceExternalNameKey, ""),
+		},
+	}
+	if config.GetBool(serviceTopologyAwareHintsKey, defaultTopologyAwareHints) {
+		service.Annotations = map[string]string{annotationTopologyAwareHints: "auto"}
+	}
+	return service, addresses, nil
+}
+
+// serviceEndpointAddresses returns the addresses of the external
+// backends configured for the application's service, if any.
+func serviceEndpointAddresses(config application.ConfigAttributes) ([]core.EndpointAddress, error) {
+	value := config.GetString(serviceEndpointsKey, "")
+	if value == "" {
+		return nil, nil
+	}
+	var addresses []core.EndpointAddress
+	for _, addr := range strings.Split(value, ",") {
+		addr = strings.TrimSpace(addr)
+		if net.ParseIP(addr) == nil {
+			return nil, errors.NotValidf("%s address %q", serviceEndpointsKey, addr)
+		}
+		addresses = append(addresses, core.EndpointAddress{IP: addr})
+	}
+	return addresses, nil
+}
+
+// endpointPorts returns the endpoint ports on which the external
+// backends of a service without a selector are reached. Kubernetes
+// ignores the target port of such services, so a numeric target port
+// is used as the endpoint port directly.
+func endpointPorts(ports []core.ServicePort) []core.EndpointPort {
+	var result []core.EndpointPort
+	for _, p := range ports {
+		port := p.Port
+		if p.TargetPort.Type == intstr.Int && p.TargetPort.IntVal != 0 {
+			port = p.TargetPort.IntVal
+		}
+		result = append(result, core.EndpointPort{
+			Name:     p.Name,
+			Port:     port,
+			Protocol: p.Protocol,
+		})
+	}
+	return result
+}
+
+// ensureEndpoints creates or updates the endpoints of
+// a service without a selector.
+func (k *kubernetesClient) ensureEndpoints(endpoints *core.Endpoints) error {
+	api := k.client().CoreV1().Endpoints(k.namespace)
+	_, err := api.Update(endpoints)
+	if k8serrors.IsNotFound(err) {
+		_, err = api.Create(endpoints)
+	}
+	return errors.Trace(err)
+}
+
+// deleteServiceEndpoints deletes the endpoints which Juju
+// manages for the application's services without a selector.
+func (k *kubernetesClient) deleteServiceEndpoints(appName string) error {
+	err := k.client().CoreV1().Endpoints(k.namespace).DeleteCollection(&v1.DeleteOptions{
+		PropagationPolicy: k.propagationPolicy(),
+	}, v1.ListOptions{
+		LabelSelector: applicationSelector(appName),
+	})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	return errors.Trace(err)
+}
+
+// configureNetworkPolicy creates or updates a network policy restricting
+// ingress to the application pods to the rules in the service config.
+// No policy is created if no rules are configured.
+func (k *kubernetesClient) configureNetworkPolicy(
+	appName string, tags map[string]string, ownerRefs []v1.OwnerReference,
+	config application.ConfigAttributes, rollback *cleanupStack,
+) error {
+	rules, err := networkPolicyIngressRules(config)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if rules == nil {
+		return nil
+	}
+	policyName := deploymentName(appName)
+	logger.Debugf("creating/updating network policy %s for %s", policyName, appName)
+	policy := &networking.NetworkPolicy{
+		ObjectMeta: v1.ObjectMeta{
+			Name:            policyName,
+			Labels:          tags,
+			OwnerReferences: ownerRefs,
+		},
+		Spec: networking.NetworkPolicySpec{
+			PodSelector: v1.LabelSelector{
+				MatchLabels: map[string]string{labelApplication: appName},
+			},
+			Ingress:     rules,
+			PolicyTypes: []networking.PolicyType{networking.PolicyTypeIngress},
+		},
+	}
+	created, err := k.ensureNetworkPolicy(policy)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if created {
+		rollback.add("network policy "+policyName, func() error { return k.deleteNetworkPolicy(policyName) })
+	}
+	return nil
+}
+
+// networkPolicyIngressRules parses the network policy ingress rules from
+// the service config. It returns nil if no rules are configured; an empty
+// list of rules is valid and denies all ingress to the application.
+func networkPolicyIngressRules(config application.ConfigAttributes) ([]networking.NetworkPolicyIngressRule, error) {
+	in := config.GetString(networkPolicyIngressKey, "")
+	if strings.TrimSpace(in) == "" {
+		return nil, nil
+	}
+	rules := []networking.NetworkPolicyIngressRule{}
+	decoder := yaml.NewYAMLOrJSONDecoder(strings.NewReader(in), len(in))
+	if err := decoder.Decode(&rules); err != nil {
+		return nil, errors.Annotatef(err, "parsing %s", networkPolicyIngressKey)
+	}
+	for _, rule := range rules {
+		for _, peer := range rule.From {
+			if peer.IPBlock == nil {
+				continue
+			}
+			if _, _, err := net.ParseCIDR(peer.IPBlock.CIDR); err != nil {
+				return nil, errors.NotValidf("%s CIDR %q", networkPolicyIngressKey, peer.IPBlock.CIDR)
+			}
+			for _, except := range peer.IPBlock.Except {
+				if _, _, err := net.ParseCIDR(except); err != nil {
+					return nil, errors.NotValidf("%s CIDR %q", networkPolicyIngressKey, except)
+				}
+			}
+		}
+	}
+	return rules, nil
+}
+
+// ensureNetworkPolicy creates or updates the network policy,
+// reporting whether it was created.
+func (k *kubernetesClient) ensureNetworkPolicy(spec *networking.NetworkPolicy) (created bool, _ error) {
+	policies := k.client().NetworkingV1().NetworkPolicies(k.namespace)
+	_, err := policies.Update(spec)
+	if k8serrors.IsNotFound(err) {
+		_, err = policies.Create(spec)
+		created = err == nil
+	}
+	return created, errors.Trace(err)
+}
+
+// deleteNetworkPolicy deletes the specified network policy.
+func (k *kubernetesClient) deleteNetworkPolicy(name string) error {
+	err := k.client().NetworkingV1().NetworkPolicies(k.namespace).Delete(name, &v1.DeleteOptions{
+		PropagationPolicy: k.propagationPolicy(),
+	})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	return errors.Trace(err)
+}
+
+// serviceSelector returns the selector of the pods targeted by the
+// application's service. By default the service targets all the
+// application's pods, but extra labels may be configured so that it
+// targets only the subset of pods which the workload has labelled,
+// eg with its role.
+func (k *kubernetesClient) serviceSelector(appName string, config application.ConfigAttributes) (map[string]string, error) {
+	selector := map[string]string{labelApplication: appName}
+	value := config.GetString(serviceSelectorKey, "")
+	if value == "" {
+		return selector, nil
+	}
+	extra, err := keyvalues.Parse(strings.Split(value, ","), false)
+	if err != nil {
+		return nil, errors.Annotatef(err, "invalid %s %q", serviceSelectorKey, value)
+	}
+	for key, v := range extra {
+		if key == labelApplication {
+			return nil, errors.NotValidf("%s label %q", serviceSelectorKey, key)
+		}
+		selector[key] = v
+	}
+	// The labels are applied to the pods by the workload rather than by
+	// Juju, so there may be no matching pods yet. The service is created
+	// regardless, and ApplicationStatus reports if it still selects no
+	// pods once the application is otherwise active.
+	return selector, nil
+}
+
+// serviceSelectionStatus returns a message describing why the
+// application's service has no endpoints, if its selector has been
+// narrowed by extra labels which match none of the application's pods.
+// It returns "" if the service selects some pods or has no extra labels.
+func (k *kubernetesClient) serviceSelectionStatus(appName string) (string, error) {
+	service, err := k.client().CoreV1().Services(k.namespace).Get(deploymentName(appName), v1.GetOptions{IncludeUninitialized: true})
+	if k8serrors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	extra := make(map[string]string)
+	for key, value := range service.Spec.Selector {
+		if key != labelApplication {
+			extra[key] = value
+		}
+	}
+	if len(extra) == 0 {
+		return "", nil
+	}
+	pods, err := k.client().CoreV1().Pods(k.namespace).List(v1.ListOptions{
+		LabelSelector: k8slabels.SelectorFromSet(service.Spec.Selector).String(),
+	})
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	if len(pods.Items) > 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("service has no endpoints: no pods are labelled %s", k8slabels.SelectorFromSet(extra)), nil
+}
+
+// serviceTargetPort returns the configured target port of a service, if
+// any. The port may be given as a number, or as the name of one of the
+// container ports so that the service is unaffected if the number changes.
+func serviceTargetPort(config application.ConfigAttributes, containerPorts []core.ContainerPort) (*intstr.IntOrString, error) {
+	var targetPort intstr.IntOrString
+	switch value := config.Get(serviceTargetPortConfigKey, nil).(type) {
+	case nil:
+		return nil, nil
+	case int:
+		targetPort = intstr.FromInt(value)
+	case float64:
+		targetPort = intstr.FromInt(int(value))
+	case string:
+		if value == "" {
+			return nil, nil
+		}
+		if port, err := strconv.Atoi(value); err == nil {
+			targetPort = intstr.FromInt(port)
+			break
+		}
+		found := false
+		for _, cp := range containerPorts {
+			if cp.Name == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.NotValidf("%s %q with no container port of that name", serviceTargetPortConfigKey, value)
+		}
+		targetPort = intstr.FromString(value)
+	default:
+		return nil, errors.NotValidf("%s %v", serviceTargetPortConfigKey, value)
+	}
+	return &targetPort, nil
+}
+
+// ensureService creates or updates the service,
+// reporting whether it was created.
+func (k *kubernetesClient) ensureService(
+	spec *core.Service, appName string, config application.ConfigAttributes,
+) (created bool, _ error) {
+	services := k.client().CoreV1().Services(k.namespace)
+	// Set any immutable fields if the service already exists.
+	existing, err := services.Get(spec.Name, v1.GetOptions{IncludeUninitialized: true})
+	if err == nil {
+		if err := checkAdoptable("service", existing.ObjectMeta, appName, config); err != nil {
+			return false, errors.Trace(err)
+		}
+		spec.Spec.ClusterIP = existing.Spec.ClusterIP
+		spec.ObjectMeta.ResourceVersion = existing.ObjectMeta.ResourceVersion
+		keepServiceTrack(existing, spec)
+		if !serviceChanged(existing, spec) {
+			logger.Debugf("service %s for %s unchanged", spec.Name, appName)
+			return false, nil
+		}
+	}
+	_, err = services.Update(spec)
+	if k8serrors.IsNotFound(err) {
+		_, err = services.Create(spec)
+		created = err == nil
+	}
+	return created, errors.Trace(err)
+}
+
+// keepServiceTrack keeps the track the existing
+// service has been switched to, if any, in the spec.
+func keepServiceTrack(existing, spec *core.Service) {
+	if track, ok := existing.Spec.Selector[labelTrack]; ok && len(spec.Spec.Selector) > 0 {
+		spec.Spec.Selector[labelTrack] = track
+	}
+}
+
+// serviceChanged returns true if updating the existing service to the
+// spec would change any of the fields Juju manages, including removing
+// the topology aware hints annotation. Other labels and annotations
+// added by others, and the defaults and node ports filled in by
+// Kubernetes, are ignored.
+func serviceChanged(existing, spec *core.Service) bool {
+	if !mapContains(existing.Labels, spec.Labels) ||
+		existing.Labels[labelContainer] != spec.Labels[labelContainer] ||
+		!mapContains(existing.Annotations, spec.Annotations) ||
+		existing.Annotations[annotationTopologyAwareHints] != spec.Annotations[annotationTopologyAwareHints] ||
+		!ownerReferencesEqual(existing.OwnerReferences, spec.OwnerReferences) {
+		return true
+	}
+	want, got := spec.Spec, existing.Spec
+	if serviceType(want) != got.Type ||
+		want.LoadBalancerIP != got.LoadBalancerIP ||
+		want.ExternalName != got.ExternalName ||
+		!stringsEqual(want.ExternalIPs, got.ExternalIPs) ||
+		!stringsEqual(want.LoadBalancerSourceRanges, got.LoadBalancerSourceRanges) ||
+		len(want.Selector) != len(got.Selector) || !mapContains(got.Selector, want.Selector) ||
+		len(want.Ports) != len(got.Ports) {
+		return true
+	}
+	for i, port := range want.Ports {
+		if servicePort(port, got.Ports[i]) != got.Ports[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceType returns the type of the service spec,
+// with the default filled in as Kubernetes would.
+func serviceType(spec core.ServiceSpec) core.ServiceType {
+	if spec.Type == "" {
+		return core.ServiceTypeClusterIP
+	}
+	return spec.Type
+}
+
+// servicePort returns the port with the defaults filled in as
+// Kubernetes would, and with the node port allocated to the
+// existing port when none is specified.
+func servicePort(port, existing core.ServicePort) core.ServicePort {
+	if port.Protocol == "" {
+		port.Protocol = core.ProtocolTCP
+	}
+	if port.TargetPort == (intstr.IntOrString{}) {
+		port.TargetPort = intstr.FromInt(int(port.Port))
+	}
+	if port.NodePort == 0 {
+		port.NodePort = existing.NodePort
+	}
+	return port
+}
+
+// mapContains returns true if m has all the keys and values of sub.
+func mapContains(m, sub map[string]string) bool {
+	for key, value := range sub {
+		if v, ok := m[key]; !ok || v != value {
+			return false
 		}
-		ports = append(ports, core.ServicePort{
-			Name:       cp.Name,
-			Protocol:   cp.Protocol,
-			Port:       cp.ContainerPort,
-			TargetPort: targetPort,
-		})
 	}
+	return true
+}
 
-	serviceType := core.ServiceType(config.GetString(serviceTypeConfigKey, defaultServiceType))
-	service := &core.Service{
-		ObjectMeta: v1.ObjectMeta{
-			Name:   deploymentName(appName),
-			Labels: tags},
-		Spec: core.ServiceSpec{
-			Selector:                 map[string]string{labelApplication: appName},
-			Type:                     serviceType,
-			Ports:                    ports,
-			ExternalIPs:              config.Get(serviceExternalIPsConfigKey, []string(nil)).([]string),
-			LoadBalancerIP:           config.GetString(serviceLoadBalancerIPKey, ""),
-			LoadBalancerSourceRanges: config.Get(serviceLoadBalancerSourceRangesKey, []string(nil)).([]string),
-			ExternalName:             config.GetString(serviceExternalNameKey, ""),
-		},
+// stringsEqual returns true if the slices hold the same strings in the
+// same order, treating nil and empty slices as equal.
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
 	}
-	return k.ensureService(service)
+	return true
 }
 
-func (k *kubernetesClient) ensureService(spec *core.Service) error {
-	services := k.CoreV1().Services(k.namespace)
-	// Set any immutable fields if the service already exists.
-	existing, err := services.Get(spec.Name, v1.GetOptions{IncludeUninitialized: true})
-	if err == nil {
-		spec.Spec.ClusterIP = existing.Spec.ClusterIP
-		spec.ObjectMeta.ResourceVersion = existing.ObjectMeta.ResourceVersion
+// ownerReferencesEqual returns true if the owner references are the
+// same, treating nil and empty slices as equal.
+func ownerReferencesEqual(a, b []v1.OwnerReference) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
 	}
-	_, err = services.Update(spec)
+	return reflect.DeepEqual(a, b)
+}
+
+// deleteServiceNamed deletes the specified service.
+func (k *kubernetesClient) deleteServiceNamed(name string) error {
+	err := k.client().CoreV1().Services(k.namespace).Delete(name, &v1.DeleteOptions{
+		PropagationPolicy: k.propagationPolicy(),
+	})
 	if k8serrors.IsNotFound(err) {
-		_, err = services.Create(spec)
+		return nil
 	}
 	return errors.Trace(err)
 }
 
 func (k *kubernetesClient) deleteService(appName string) error {
-	services := k.CoreV1().Services(k.namespace)
+	services := k.client().CoreV1().Services(k.namespace)
 	err := services.Delete(deploymentName(appName), &v1.DeleteOptions{
-		PropagationPolicy: &defaultPropagationPolicy,
+		PropagationPolicy: k.propagationPolicy(),
 	})
-	if k8serrors.IsNotFound(err) {
-		return nil
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return errors.Trace(err)
 	}
-	return errors.Trace(err)
+
+	// Delete any per container services.
+	servicesList, err := services.List(v1.ListOptions{
+		LabelSelector: applicationSelector(appName),
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, svc := range servicesList.Items {
+		err := services.Delete(svc.Name, &v1.DeleteOptions{
+			PropagationPolicy: k.propagationPolicy(),
+		})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return errors.Trace(err)
+		}
+	}
+	return nil
 }
 
 // ExposeService sets up external access to the specified application.
@@ -1393,6 +3713,15 @@ func (k *kubernetesClient) ExposeService(appName string, resourceTags map[string
 	ingressSSLRedirect := config.GetBool(ingressSSLRedirectKey, defaultIngressSSLRedirect)
 	ingressSSLPassthrough := config.GetBool(ingressSSLPassthroughKey, defaultIngressSSLPassthrough)
 	ingressAllowHTTP := config.GetBool(ingressAllowHTTPKey, defaultIngressAllowHTTPKey)
+	ingressBackendProto := config.GetString(ingressBackendProtoKey, defaultIngressBackendProto)
+	if ingressBackendProto != ingressBackendHTTP && ingressBackendProto != ingressBackendHTTPS {
+		return errors.NotValidf("%s %q", ingressBackendProtoKey, ingressBackendProto)
+	}
+	// With passthrough the ingress controller does not terminate TLS,
+	// so it cannot also re-encrypt traffic to an HTTPS backend.
+	if ingressSSLPassthrough && ingressBackendProto == ingressBackendHTTPS {
+		return errors.NotValidf("%s with %s %q", ingressSSLPassthroughKey, ingressBackendProtoKey, ingressBackendProto)
+	}
 	httpPath := config.GetString(caas.JujuApplicationPath, caas.JujuDefaultApplicationPath)
 	if httpPath == "$appname" {
 		httpPath = appName
@@ -1401,7 +3730,7 @@ func (k *kubernetesClient) ExposeService(appName string, resourceTags map[string
 		httpPath = "/" + httpPath
 	}
 
-	svc, err := k.CoreV1().Services(k.namespace).Get(deploymentName(appName), v1.GetOptions{})
+	svc, err := k.client().CoreV1().Services(k.namespace).Get(deploymentName(appName), v1.GetOptions{})
 	if err != nil {
 		return errors.Trace(err)
 	}
@@ -1410,8 +3739,9 @@ func (k *kubernetesClient) ExposeService(appName string, resourceTags map[string
 	}
 	spec := &v1beta1.Ingress{
 		ObjectMeta: v1.ObjectMeta{
-			Name:   deploymentName(appName),
-			Labels: resourceTags,
+			Name:            deploymentName(appName),
+			Labels:          resourceTags,
+			OwnerReferences: ownerReferences(core.SchemeGroupVersion.String(), "Service", svc.ObjectMeta),
 			Annotations: map[string]string{
 				"ingress.kubernetes.io/rewrite-target":  "",
 				"ingress.kubernetes.io/ssl-redirect":    strconv.FormatBool(ingressSSLRedirect),
@@ -1433,17 +3763,382 @@ func (k *kubernetesClient) ExposeService(appName string, resourceTags map[string
 				}}},
 		},
 	}
+	if ingressBackendProto == ingressBackendHTTPS {
+		spec.Annotations["ingress.kubernetes.io/backend-protocol"] = ingressBackendHTTPS
+	}
+	tuning, err := ingressTuningAnnotations(config)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for name, value := range tuning {
+		spec.Annotations[name] = value
+	}
 	return k.ensureIngress(spec)
 }
 
+// proxyBodySizeRegexp matches body sizes understood by
+// the nginx ingress controller, eg 512k or 8m.
+var proxyBodySizeRegexp = regexp.MustCompile(`^[0-9]+[kKmMgG]?$`)
+
+// ingressTuningAnnotations returns the ingress controller annotations
+// for any rate limit, body size and timeouts in the application config.
+func ingressTuningAnnotations(config application.ConfigAttributes) (map[string]string, error) {
+	annotations := make(map[string]string)
+	for _, opt := range []struct {
+		key        string
+		annotation string
+	}{
+		{ingressRateLimitKey, "ingress.kubernetes.io/limit-rps"},
+		{ingressProxyReadTimeoutKey, "ingress.kubernetes.io/proxy-read-timeout"},
+		{ingressProxySendTimeoutKey, "ingress.kubernetes.io/proxy-send-timeout"},
+	} {
+		if _, ok := config[opt.key]; !ok {
+			continue
+		}
+		value := config.GetInt(opt.key, 0)
+		if value <= 0 {
+			return nil, errors.NotValidf("%s %d", opt.key, value)
+		}
+		annotations[opt.annotation] = strconv.Itoa(value)
+	}
+	if bodySize := config.GetString(ingressProxyBodySizeKey, ""); bodySize != "" {
+		if !proxyBodySizeRegexp.MatchString(bodySize) {
+			return nil, errors.NotValidf("%s %q", ingressProxyBodySizeKey, bodySize)
+		}
+		annotations["ingress.kubernetes.io/proxy-body-size"] = bodySize
+	}
+	return annotations, nil
+}
+
 // UnexposeService removes external access to the specified service.
 func (k *kubernetesClient) UnexposeService(appName string) error {
 	logger.Debugf("deleting ingress resource for %s", appName)
 	return k.deleteIngress(appName)
 }
 
+// ApplicationIngress returns details of the ingress which
+// exposes the specified application.
+func (k *kubernetesClient) ApplicationIngress(appName string) (*caas.IngressInfo, error) {
+	ingress, err := k.client().ExtensionsV1beta1().Ingresses(k.namespace).Get(deploymentName(appName), v1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, errors.NotFoundf("ingress for %q", appName)
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var result caas.IngressInfo
+	for _, rule := range ingress.Spec.Rules {
+		ingressRule := caas.IngressRule{Host: rule.Host}
+		if rule.HTTP != nil {
+			for _, p := range rule.HTTP.Paths {
+				ingressRule.Paths = append(ingressRule.Paths, p.Path)
+			}
+		}
+		result.Rules = append(result.Rules, ingressRule)
+	}
+	for _, tls := range ingress.Spec.TLS {
+		result.TLSHosts = append(result.TLSHosts, tls.Hosts...)
+	}
+	for _, lb := range ingress.Status.LoadBalancer.Ingress {
+		addr := lb.IP
+		if addr == "" {
+			addr = lb.Hostname
+		}
+		if addr == "" {
+			continue
+		}
+		result.Addresses = append(result.Addresses, network.Address{
+			Value: addr,
+			Type:  network.DeriveAddressType(addr),
+			Scope: network.ScopePublic,
+		})
+	}
+	return &result, nil
+}
+
+// DetectDrift is part of the Broker interface.
+// The expected resources are built from the parameters just as
+// EnsureService builds them, and compared with those applied. Only
+// fields which Juju derives from the parameters are compared, so
+// defaults filled in by Kubernetes, labels and annotations added by
+// others, and owner references are ignored.
+func (k *kubernetesClient) DetectDrift(
+	appName string, params *caas.ServiceParams, numUnits int, config application.ConfigAttributes,
+) ([]caas.DriftEntry, error) {
+	if params == nil || params.PodSpec == nil {
+		return nil, errors.Errorf("missing pod spec")
+	}
+	if params.Track != "" {
+		return nil, errors.NotSupportedf("detecting drift of track %q", params.Track)
+	}
+	unitSpec, err := k.applicationUnitSpec(appName, params, config)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	resourceTags := applicationResourceTags(appName, params)
+	name := deploymentName(appName)
+	numPods := int32(numUnits)
+	var (
+		drift []caas.DriftEntry
+		found bool
+	)
+
+	if !params.PodSpec.OmitServiceFrontend {
+		for _, svc := range applicationServices(appName, unitSpec, params.PodSpec.Containers, resourceTags, config) {
+			service, err := k.client().CoreV1().Services(k.namespace).Get(svc.name, v1.GetOptions{IncludeUninitialized: true})
+			if k8serrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			found = true
+			expected, _, err := k.serviceSpec(appName, svc.name, svc.ports, svc.tags, nil, config)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			keepServiceTrack(service, expected)
+			drift = append(drift, serviceDrift(expected, service)...)
+		}
+	}
+
+	statefulSet, err := k.client().AppsV1().StatefulSets(k.namespace).Get(name, v1.GetOptions{IncludeUninitialized: true})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, errors.Trace(err)
+	}
+	if err == nil {
+		found = true
+		expected := statefulSetSpec(appName, resourceTags, nil, unitSpec, params.PodSpec.Containers, &numPods)
+		drift = append(drift, workloadDrift(
+			"statefulset/"+name, statefulSetWorkload(expected), statefulSetWorkload(statefulSet))...)
+	} else {
+		deployment, err := k.client().AppsV1().Deployments(k.namespace).Get(name, v1.GetOptions{IncludeUninitialized: true})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return nil, errors.Trace(err)
+		}
+		if err == nil {
+			found = true
+			expected, err := deploymentSpec(appName, name, resourceTags, nil, unitSpec, params.PodSpec.Containers, &numPods, config)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			if config.GetBool(deploymentPreserveReplicasKey, defaultPreserveReplicas) {
+				expected.Spec.Replicas = deployment.Spec.Replicas
+			}
+			drift = append(drift, workloadDrift(
+				"deployment/"+name, deploymentWorkload(expected), deploymentWorkload(deployment))...)
+		}
+	}
+
+	if !found {
+		return nil, errors.NotFoundf("resources for %q", appName)
+	}
+	return drift, nil
+}
+
+// serviceDrift reports the fields of the service which
+// differ from those of the expected service.
+func serviceDrift(expected, actual *core.Service) []caas.DriftEntry {
+	resource := "service/" + actual.Name
+	drift := labelsDrift(resource, "metadata.labels", expected.Labels, actual.Labels)
+	drift = append(drift, mapDrift(resource, "metadata.annotations",
+		userAnnotations(expected.Annotations), userAnnotations(actual.Annotations))...)
+	drift = append(drift, mapDrift(resource, "spec.selector", expected.Spec.Selector, actual.Spec.Selector)...)
+	if wantType := serviceType(expected.Spec); wantType != actual.Spec.Type {
+		drift = append(drift, caas.DriftEntry{
+			Resource: resource,
+			Field:    "spec.type",
+			Expected: string(wantType),
+			Actual:   string(actual.Spec.Type),
+		})
+	}
+	if len(expected.Spec.Ports) != len(actual.Spec.Ports) {
+		return append(drift, caas.DriftEntry{
+			Resource: resource,
+			Field:    "spec.ports",
+			Expected: servicePortsString(expected.Spec.Ports),
+			Actual:   servicePortsString(actual.Spec.Ports),
+		})
+	}
+	for i, port := range expected.Spec.Ports {
+		got := actual.Spec.Ports[i]
+		if want := servicePort(port, got); want != got {
+			drift = append(drift, caas.DriftEntry{
+				Resource: resource,
+				Field:    fmt.Sprintf("spec.ports[%d]", i),
+				Expected: servicePortsString([]core.ServicePort{want}),
+				Actual:   servicePortsString([]core.ServicePort{got}),
+			})
+		}
+	}
+	return drift
+}
+
+// servicePortsString returns the ports formatted for a drift report.
+func servicePortsString(ports []core.ServicePort) string {
+	var result []string
+	for _, port := range ports {
+		result = append(result, fmt.Sprintf("%s:%d/%s->%s", port.Name, port.Port, port.Protocol, port.TargetPort.String()))
+	}
+	return strings.Join(result, ",")
+}
+
+// workload holds the fields compared for drift
+// of a deployment or stateful set.
+type workload struct {
+	meta     v1.ObjectMeta
+	replicas *int32
+	selector *v1.LabelSelector
+	template core.PodTemplateSpec
+}
+
+func deploymentWorkload(deployment *apps.Deployment) workload {
+	return workload{deployment.ObjectMeta, deployment.Spec.Replicas, deployment.Spec.Selector, deployment.Spec.Template}
+}
+
+func statefulSetWorkload(statefulSet *apps.StatefulSet) workload {
+	return workload{statefulSet.ObjectMeta, statefulSet.Spec.Replicas, statefulSet.Spec.Selector, statefulSet.Spec.Template}
+}
+
+// workloadDrift reports the fields of the deployment or stateful set
+// which differ from those of the expected one. The replicas of a
+// stopped application are not compared.
+func workloadDrift(resource string, expected, actual workload) []caas.DriftEntry {
+	drift := labelsDrift(resource, "metadata.labels", expected.meta.Labels, actual.meta.Labels)
+	drift = append(drift, mapDrift(resource, "metadata.annotations",
+		userAnnotations(expected.meta.Annotations), userAnnotations(actual.meta.Annotations))...)
+	if _, stopped := actual.meta.Annotations[annotationStoppedReplicas]; !stopped {
+		want, got := replicasString(expected.replicas), replicasString(actual.replicas)
+		if want != got {
+			drift = append(drift, caas.DriftEntry{
+				Resource: resource,
+				Field:    "spec.replicas",
+				Expected: want,
+				Actual:   got,
+			})
+		}
+	}
+	var wantSelector, gotSelector map[string]string
+	if expected.selector != nil {
+		wantSelector = expected.selector.MatchLabels
+	}
+	if actual.selector != nil {
+		gotSelector = actual.selector.MatchLabels
+	}
+	drift = append(drift, mapDrift(resource, "spec.selector.matchLabels", wantSelector, gotSelector)...)
+	drift = append(drift, labelsDrift(resource, "spec.template.metadata.labels",
+		expected.template.Labels, actual.template.Labels)...)
+
+	want, got := expected.template.Spec.Containers, actual.template.Spec.Containers
+	if len(want) != len(got) {
+		return append(drift, caas.DriftEntry{
+			Resource: resource,
+			Field:    "spec.template.spec.containers",
+			Expected: containerNames(want),
+			Actual:   containerNames(got),
+		})
+	}
+	for i := range want {
+		field := fmt.Sprintf("spec.template.spec.containers[%d]", i)
+		if want[i].Name != got[i].Name {
+			drift = append(drift, caas.DriftEntry{
+				Resource: resource,
+				Field:    field + ".name",
+				Expected: want[i].Name,
+				Actual:   got[i].Name,
+			})
+		}
+		if want[i].Image != got[i].Image {
+			drift = append(drift, caas.DriftEntry{
+				Resource: resource,
+				Field:    field + ".image",
+				Expected: want[i].Image,
+				Actual:   got[i].Image,
+			})
+		}
+	}
+	return drift
+}
+
+func replicasString(replicas *int32) string {
+	if replicas == nil {
+		return ""
+	}
+	return strconv.Itoa(int(*replicas))
+}
+
+func containerNames(containers []core.Container) string {
+	var names []string
+	for _, c := range containers {
+		names = append(names, c.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+// labelsDrift reports each expected label whose value differs.
+// Labels added by others are ignored.
+func labelsDrift(resource, field string, expected, actual map[string]string) []caas.DriftEntry {
+	keys := set.NewStrings()
+	for key := range expected {
+		keys.Add(key)
+	}
+	var drift []caas.DriftEntry
+	for _, key := range keys.SortedValues() {
+		if value, ok := actual[key]; ok && value == expected[key] {
+			continue
+		}
+		drift = append(drift, caas.DriftEntry{
+			Resource: resource,
+			Field:    field + "." + key,
+			Expected: expected[key],
+			Actual:   actual[key],
+		})
+	}
+	return drift
+}
+
+// mapDrift reports each key whose value differs between the maps.
+func mapDrift(resource, field string, expected, actual map[string]string) []caas.DriftEntry {
+	keys := set.NewStrings()
+	for key := range expected {
+		keys.Add(key)
+	}
+	for key := range actual {
+		keys.Add(key)
+	}
+	var drift []caas.DriftEntry
+	for _, key := range keys.SortedValues() {
+		expectedValue, expectedOK := expected[key]
+		actualValue, actualOK := actual[key]
+		if expectedOK == actualOK && expectedValue == actualValue {
+			continue
+		}
+		drift = append(drift, caas.DriftEntry{
+			Resource: resource,
+			Field:    field + "." + key,
+			Expected: expectedValue,
+			Actual:   actualValue,
+		})
+	}
+	return drift
+}
+
+// userAnnotations returns the annotations not managed by Kubernetes
+// itself, nor recorded by Juju for its own use.
+func userAnnotations(annotations map[string]string) map[string]string {
+	result := make(map[string]string)
+	for key, value := range annotations {
+		if strings.Contains(key, "kubernetes.io/") ||
+			key == annotationSpecHash || key == annotationStoppedReplicas {
+			continue
+		}
+		result[key] = value
+	}
+	return result
+}
+
 func (k *kubernetesClient) ensureIngress(spec *v1beta1.Ingress) error {
-	ingress := k.ExtensionsV1beta1().Ingresses(k.namespace)
+	ingress := k.client().ExtensionsV1beta1().Ingresses(k.namespace)
 	_, err := ingress.Update(spec)
 	if k8serrors.IsNotFound(err) {
 		_, err = ingress.Create(spec)
@@ -1452,9 +4147,9 @@ func (k *kubernetesClient) ensureIngress(spec *v1beta1.Ingress) error {
 }
 
 func (k *kubernetesClient) deleteIngress(appName string) error {
-	ingress := k.ExtensionsV1beta1().Ingresses(k.namespace)
+	ingress := k.client().ExtensionsV1beta1().Ingresses(k.namespace)
 	err := ingress.Delete(deploymentName(appName), &v1.DeleteOptions{
-		PropagationPolicy: &defaultPropagationPolicy,
+		PropagationPolicy: k.propagationPolicy(),
 	})
 	if k8serrors.IsNotFound(err) {
 		return nil
@@ -1473,7 +4168,7 @@ func applicationSelector(appName string) string {
 // WatchUnits returns a watcher which notifies when there
 // are changes to units of the specified application.
 func (k *kubernetesClient) WatchUnits(appName string) (watcher.NotifyWatcher, error) {
-	pods := k.CoreV1().Pods(k.namespace)
+	pods := k.watchClient().CoreV1().Pods(k.namespace)
 	w, err := pods.Watch(v1.ListOptions{
 		LabelSelector: applicationSelector(appName),
 		Watch:         true,
@@ -1484,10 +4179,128 @@ func (k *kubernetesClient) WatchUnits(appName string) (watcher.NotifyWatcher, er
 	return k.newWatcher(w, appName, k.clock)
 }
 
+// ResourceNames is part of the Broker interface.
+func (k *kubernetesClient) ResourceNames(appName string) (caas.ResourceNames, error) {
+	if !names.IsValidApplication(appName) {
+		return caas.ResourceNames{}, errors.NotValidf("application name %q", appName)
+	}
+	return caas.ResourceNames{
+		Workload:                        deploymentName(appName),
+		Service:                         deploymentName(appName),
+		Ingress:                         deploymentName(appName),
+		ConfigMapPrefix:                 deploymentName(appName) + "-",
+		Operator:                        operatorName(appName),
+		OperatorPod:                     operatorName(appName) + "-0",
+		OperatorConfigMap:               operatorConfigMapName(appName),
+		OperatorConfigurationsConfigMap: operatorConfigurationsConfigMapName(appName),
+	}, nil
+}
+
+// applicationReadyPollInterval is how often the replicas of an application
+// are checked while waiting for it to be ready. The stateful set or deployment
+// status is updated by its controller after the pod events which are watched,
+// and only once pods have been ready for any minimum ready seconds, so the
+// last pod event may be seen before the application is reported as ready.
+const applicationReadyPollInterval = 5 * time.Second
+
+// WaitForApplicationReady is part of the Broker interface.
+// The application's pods are watched, and each time they change, and
+// periodically while any are not ready, the ready replicas of the
+// application's stateful set or deployment are checked.
+func (k *kubernetesClient) WaitForApplicationReady(appName string, timeout time.Duration) error {
+	w, err := k.WatchUnits(appName)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer w.Kill()
+
+	timeoutCh := k.clock.After(timeout)
+	// pollCh is only set once the initial pod event has been checked.
+	var pollCh <-chan time.Time
+	var desired, ready int32
+	for {
+		select {
+		case <-timeoutCh:
+			return errors.Timeoutf(
+				"waiting for application %q to be ready after %v: %d of %d replicas ready",
+				appName, timeout, ready, desired)
+		case _, ok := <-w.Changes():
+			if !ok {
+				return errors.Annotatef(w.Wait(), "watching application %q", appName)
+			}
+		case <-pollCh:
+			pollCh = nil
+		}
+		desired, ready, err = k.applicationReplicas(appName)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if ready >= desired {
+			return nil
+		}
+		// There's no point waiting out the timeout
+		// if the application's image can't be pulled.
+		failure, err := k.imagePullFailure(appName)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if failure != "" {
+			return errors.Errorf("waiting for application %q to be ready: %s", appName, failure)
+		}
+		if pollCh == nil {
+			pollCh = k.clock.After(applicationReadyPollInterval)
+		}
+	}
+}
+
+// imagePullFailure returns a message describing why a pod of the
+// application is backing off pulling an image, or "" if none are.
+func (k *kubernetesClient) imagePullFailure(appName string) (string, error) {
+	pods, err := k.client().CoreV1().Pods(k.namespace).List(v1.ListOptions{
+		LabelSelector: applicationSelector(appName),
+	})
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	for _, pod := range pods.Items {
+		if message, ok := containerImagePullStatus(pod, true); ok {
+			return message, nil
+		}
+	}
+	return "", nil
+}
+
+// applicationReplicas returns the desired and ready replica
+// counts of the specified application.
+func (k *kubernetesClient) applicationReplicas(appName string) (desired int32, ready int32, _ error) {
+	name := deploymentName(appName)
+	statefulSet, err := k.client().AppsV1().StatefulSets(k.namespace).Get(name, v1.GetOptions{IncludeUninitialized: true})
+	if err == nil {
+		if statefulSet.Spec.Replicas != nil {
+			desired = *statefulSet.Spec.Replicas
+		}
+		return desired, statefulSet.Status.ReadyReplicas, nil
+	}
+	if !k8serrors.IsNotFound(err) {
+		return 0, 0, errors.Trace(err)
+	}
+	deployment, err := k.client().AppsV1().Deployments(k.namespace).Get(name, v1.GetOptions{IncludeUninitialized: true})
+	if k8serrors.IsNotFound(err) {
+		return 0, 0, errors.NotFoundf("application %q", appName)
+	}
+	if err != nil {
+		return 0, 0, errors.Trace(err)
+	}
+	if deployment.Spec.Replicas != nil {
+		desired = *deployment.Spec.Replicas
+	}
+	return desired, deployment.Status.AvailableReplicas, nil
+}
+
 // WatchOperator returns a watcher which notifies when there
 // are changes to the operator of the specified application.
 func (k *kubernetesClient) WatchOperator(appName string) (watcher.NotifyWatcher, error) {
-	pods := k.CoreV1().Pods(k.namespace)
+	pods := k.watchClient().CoreV1().Pods(k.namespace)
 	w, err := pods.Watch(v1.ListOptions{
 		LabelSelector: operatorSelector(appName),
 		Watch:         true,
@@ -1502,20 +4315,109 @@ func (k *kubernetesClient) WatchOperator(appName string) (watcher.NotifyWatcher,
 // The pattern is: juju-<storagename>-<digit>
 var jujuPVNameRegexp = regexp.MustCompile(`^juju-(?P<storageName>\D+)-\d+$`)
 
+// UnitSpec returns the pod spec of the running pod for the specified unit,
+// as accepted by the cluster. This may differ from the spec generated by
+// Juju since Kubernetes fills in defaults. The pod is found by the unit's
+// provider id, since unit numbers don't follow pod names. A NotFound error
+// is returned if there is no pod for the unit.
+func (k *kubernetesClient) UnitSpec(unitName, providerId string) (*core.PodSpec, error) {
+	if !names.IsValidUnit(unitName) {
+		return nil, errors.NotValidf("unit name %q", unitName)
+	}
+	appName, err := names.UnitApplication(unitName)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	podsList, err := k.client().CoreV1().Pods(k.namespace).List(v1.ListOptions{
+		LabelSelector: applicationSelector(appName),
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for _, p := range podsList.Items {
+		if string(p.UID) == providerId {
+			return &p.Spec, nil
+		}
+	}
+	return nil, errors.NotFoundf("pod for unit %q", unitName)
+}
+
+// podQOSClass returns the quality of service class of the pod. This is
+// normally reported in the pod status, but is otherwise derived from the
+// containers' cpu and memory resources as kubernetes does: pods with no
+// requests or limits are BestEffort, pods whose containers all have equal
+// requests and limits are Guaranteed, and other pods are Burstable.
+func podQOSClass(pod core.Pod) core.PodQOSClass {
+	if pod.Status.QOSClass != "" {
+		return pod.Status.QOSClass
+	}
+	anySet, guaranteed := false, true
+	containers := append(append([]core.Container(nil), pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, c := range containers {
+		for _, name := range []core.ResourceName{core.ResourceCPU, core.ResourceMemory} {
+			request, hasRequest := c.Resources.Requests[name]
+			limit, hasLimit := c.Resources.Limits[name]
+			hasRequest = hasRequest && !request.IsZero()
+			hasLimit = hasLimit && !limit.IsZero()
+			if hasRequest || hasLimit {
+				anySet = true
+			}
+			// Kubernetes defaults an unset request to the limit.
+			if !hasLimit || (hasRequest && request.Cmp(limit) != 0) {
+				guaranteed = false
+			}
+		}
+	}
+	switch {
+	case !anySet:
+		return core.PodQOSBestEffort
+	case guaranteed:
+		return core.PodQOSGuaranteed
+	}
+	return core.PodQOSBurstable
+}
+
+// podImage returns the image, and the resolved image ID, that the named
+// container in the pod is actually running. The image ID is empty until
+// the container has been started.
+func podImage(pod core.Pod, containerName string) (image, imageID string) {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name == containerName {
+			return cs.Image, cs.ImageID
+		}
+	}
+	for _, c := range pod.Spec.Containers {
+		if c.Name == containerName {
+			return c.Image, ""
+		}
+	}
+	return "", ""
+}
+
 // Units returns all units and any associated filesystems of the specified application.
-// Filesystems are mounted via volumes bound to the unit.
+// Filesystems are mounted via volumes bound to the unit. A Forbidden error is
+// returned if the cluster denies access to the application's pods.
 func (k *kubernetesClient) Units(appName string) ([]caas.Unit, error) {
-	pods := k.CoreV1().Pods(k.namespace)
+	pods := k.client().CoreV1().Pods(k.namespace)
 	podsList, err := pods.List(v1.ListOptions{
 		LabelSelector: applicationSelector(appName),
 	})
+	if k8serrors.IsForbidden(err) {
+		return nil, errors.NewForbidden(err, fmt.Sprintf("listing units for %q", appName))
+	}
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
-	var units []caas.Unit
+	// An application scaled to zero has no pods, so the result is empty.
+	units := []caas.Unit{}
 	now := time.Now()
 	for _, p := range podsList.Items {
+		// The pods of tracks other than the main deployment
+		// are not units of the application.
+		if track, ok := p.Labels[labelTrack]; ok && track != defaultTrack {
+			continue
+		}
 		var ports []string
 		for _, c := range p.Spec.Containers {
 			for _, p := range c.Ports {
@@ -1537,13 +4439,17 @@ func (k *kubernetesClient) Units(appName string) ([]caas.Unit, error) {
 				Message: statusMessage,
 				Since:   &since,
 			},
+			QOSClass: string(podQOSClass(p)),
+		}
+		if len(p.Spec.Containers) > 0 {
+			unitInfo.Image, unitInfo.ImageID = podImage(p, p.Spec.Containers[0].Name)
 		}
 
 		volumesByName := make(map[string]core.Volume)
 		for _, pv := range p.Spec.Volumes {
 			volumesByName[pv.Name] = pv
 		}
-		pVolumes := k.CoreV1().PersistentVolumes()
+		pVolumes := k.client().CoreV1().PersistentVolumes()
 
 		// Gather info about how filesystems are attached/mounted to the pod.
 		// The mount name represents the filesystem tag name used by Juju.
@@ -1565,7 +4471,7 @@ func (k *kubernetesClient) Units(appName string) ([]caas.Unit, error) {
 				logger.Debugf("Ignoring blank PersistentVolumeClaim or ClaimName")
 				continue
 			}
-			pvClaims := k.CoreV1().PersistentVolumeClaims(k.namespace)
+			pvClaims := k.client().CoreV1().PersistentVolumeClaims(k.namespace)
 			pvc, err := pvClaims.Get(vol.PersistentVolumeClaim.ClaimName, v1.GetOptions{})
 			if k8serrors.IsNotFound(err) {
 				// Ignore claims which don't exist (yet).
@@ -1597,7 +4503,7 @@ func (k *kubernetesClient) Units(appName string) ([]caas.Unit, error) {
 			if statusMessage == "" {
 				// If there are any events for this pvc we can use the
 				// most recent to set the status.
-				events := k.CoreV1().Events(k.namespace)
+				events := k.client().CoreV1().Events(k.namespace)
 				eventList, err := events.List(v1.ListOptions{
 					IncludeUninitialized: true,
 					FieldSelector:        fields.OneTermEqualSelector("involvedObject.name", pvc.Name).String(),
@@ -1611,6 +4517,7 @@ func (k *kubernetesClient) Units(appName string) ([]caas.Unit, error) {
 				}
 			}
 
+			source, handle := persistentVolumeSource(pv)
 			unitInfo.FilesystemInfo = append(unitInfo.FilesystemInfo, caas.FilesystemInfo{
 				StorageName:  storageName,
 				Size:         uint64(vol.PersistentVolumeClaim.Size()),
@@ -1623,9 +4530,12 @@ func (k *kubernetesClient) Units(appName string) ([]caas.Unit, error) {
 					Since:   &since,
 				},
 				Volume: caas.VolumeInfo{
-					VolumeId:   pv.Name,
-					Size:       uint64(pv.Size()),
-					Persistent: pv.Spec.PersistentVolumeReclaimPolicy == core.PersistentVolumeReclaimRetain,
+					VolumeId:      pv.Name,
+					Size:          uint64(pv.Size()),
+					Persistent:    pv.Spec.PersistentVolumeReclaimPolicy == core.PersistentVolumeReclaimRetain,
+					ReclaimPolicy: string(pv.Spec.PersistentVolumeReclaimPolicy),
+					Source:        source,
+					Handle:        handle,
 					Status: status.StatusInfo{
 						Status:  k.jujuVolumeStatus(pv.Status.Phase),
 						Message: pv.Status.Message,
@@ -1639,9 +4549,38 @@ func (k *kubernetesClient) Units(appName string) ([]caas.Unit, error) {
 	return units, nil
 }
 
+// persistentVolumeSource returns the type of the persistent volume's
+// backing storage and the handle identifying it to its provider, so
+// that filesystems can be correlated with the cloud's disks. Empty
+// strings are returned for source types which aren't recognised.
+func persistentVolumeSource(pv *core.PersistentVolume) (string, string) {
+	src := pv.Spec.PersistentVolumeSource
+	switch {
+	case src.CSI != nil:
+		return "csi", src.CSI.VolumeHandle
+	case src.AWSElasticBlockStore != nil:
+		return "awsElasticBlockStore", src.AWSElasticBlockStore.VolumeID
+	case src.GCEPersistentDisk != nil:
+		return "gcePersistentDisk", src.GCEPersistentDisk.PDName
+	case src.AzureDisk != nil:
+		return "azureDisk", src.AzureDisk.DiskURI
+	case src.Cinder != nil:
+		return "cinder", src.Cinder.VolumeID
+	case src.VsphereVolume != nil:
+		return "vsphereVolume", src.VsphereVolume.VolumePath
+	case src.NFS != nil:
+		return "nfs", src.NFS.Server + ":" + src.NFS.Path
+	case src.HostPath != nil:
+		return "hostPath", src.HostPath.Path
+	case src.Local != nil:
+		return "local", src.Local.Path
+	}
+	return "", ""
+}
+
 // Operator returns an Operator with current status and life details.
 func (k *kubernetesClient) Operator(appName string) (*caas.Operator, error) {
-	pods := k.CoreV1().Pods(k.namespace)
+	pods := k.client().CoreV1().Pods(k.namespace)
 	podsList, err := pods.List(v1.ListOptions{
 		LabelSelector: operatorSelector(appName),
 	})
@@ -1656,7 +4595,7 @@ func (k *kubernetesClient) Operator(appName string) (*caas.Operator, error) {
 	terminated := opPod.DeletionTimestamp != nil
 	now := time.Now()
 	statusMessage, opStatus, since, err := k.getPODStatus(opPod, now)
-	return &caas.Operator{
+	operator := &caas.Operator{
 		Id:    string(opPod.UID),
 		Dying: terminated,
 		Status: status.StatusInfo{
@@ -1664,7 +4603,119 @@ func (k *kubernetesClient) Operator(appName string) (*caas.Operator, error) {
 			Message: statusMessage,
 			Since:   &since,
 		},
-	}, nil
+	}
+	// Report restarts so that a persistently crashing operator
+	// can be told apart from one which crashed once.
+	for _, cs := range opPod.Status.ContainerStatuses {
+		if cs.Name != operatorContainerName {
+			continue
+		}
+		operator.RestartCount = int(cs.RestartCount)
+		if last := cs.LastTerminationState.Terminated; last != nil {
+			operator.LastTerminationReason = last.Reason
+			if operator.LastTerminationReason == "" {
+				operator.LastTerminationReason = fmt.Sprintf("exit code %d", last.ExitCode)
+			}
+		}
+	}
+	return operator, nil
+}
+
+// OperatorStorageStatus is part of the Broker interface.
+func (k *kubernetesClient) OperatorStorageStatus(appName string) (caas.StorageInfo, error) {
+	// The claim is made from the operator stateful set's
+	// volume claim template for its one and only pod.
+	claimName := fmt.Sprintf("%s-%s-0", operatorVolumeClaim(appName), operatorName(appName))
+	pvc, err := k.client().CoreV1().PersistentVolumeClaims(k.namespace).Get(claimName, v1.GetOptions{IncludeUninitialized: true})
+	if k8serrors.IsNotFound(err) {
+		return caas.StorageInfo{}, errors.NotFoundf("operator storage for application %q", appName)
+	}
+	if err != nil {
+		return caas.StorageInfo{}, errors.Trace(err)
+	}
+	info := caas.StorageInfo{
+		ClaimName:  pvc.Name,
+		Phase:      string(pvc.Status.Phase),
+		VolumeName: pvc.Spec.VolumeName,
+	}
+	if pvc.Spec.StorageClassName != nil {
+		info.StorageClass = *pvc.Spec.StorageClassName
+	}
+	if pvc.Status.Phase != core.ClaimPending {
+		return info, nil
+	}
+
+	// A claim is usually left pending because there is no persistent
+	// volume available to bind to, which is only reported as an event.
+	if len(pvc.Status.Conditions) > 0 {
+		info.Message = pvc.Status.Conditions[0].Message
+	}
+	if info.Message == "" {
+		eventList, err := k.client().CoreV1().Events(k.namespace).List(v1.ListOptions{
+			IncludeUninitialized: true,
+			FieldSelector:        fields.OneTermEqualSelector("involvedObject.name", pvc.Name).String(),
+		})
+		if err != nil {
+			return caas.StorageInfo{}, errors.Annotate(err, "unable to get events for PVC")
+		}
+		// Take the most recent event.
+		if count := len(eventList.Items); count > 0 {
+			info.Message = eventList.Items[count-1].Message
+		}
+	}
+	return info, nil
+}
+
+// OperatorEvents is part of the Broker interface.
+func (k *kubernetesClient) OperatorEvents(appName string) ([]caas.Event, error) {
+	podsList, err := k.client().CoreV1().Pods(k.namespace).List(v1.ListOptions{
+		LabelSelector: operatorSelector(appName),
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(podsList.Items) == 0 {
+		return nil, errors.NotFoundf("operator pod for application %q", appName)
+	}
+	opPod := podsList.Items[0]
+
+	eventList, err := k.client().CoreV1().Events(k.namespace).List(v1.ListOptions{
+		IncludeUninitialized: true,
+		FieldSelector:        fields.OneTermEqualSelector("involvedObject.name", opPod.Name).String(),
+	})
+	if err != nil {
+		return nil, errors.Annotate(err, "unable to get events for operator pod")
+	}
+	var result []caas.Event
+	for _, e := range eventList.Items {
+		// Ignore events for an earlier pod of the same name.
+		if e.InvolvedObject.UID != "" && e.InvolvedObject.UID != opPod.UID {
+			continue
+		}
+		result = append(result, caas.Event{
+			Type:    e.Type,
+			Reason:  e.Reason,
+			Message: e.Message,
+			Time:    eventTime(e),
+		})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Time.Before(result[j].Time)
+	})
+	return result, nil
+}
+
+// eventTime returns when the event last occurred. Events
+// created by older clients only record timestamps, while newer
+// ones may only record the event time.
+func eventTime(e core.Event) time.Time {
+	if !e.LastTimestamp.IsZero() {
+		return e.LastTimestamp.Time
+	}
+	if !e.EventTime.IsZero() {
+		return e.EventTime.Time
+	}
+	return e.FirstTimestamp.Time
 }
 
 func (k *kubernetesClient) getPODStatus(pod core.Pod, now time.Time) (string, status.Status, time.Time, error) {
@@ -1672,6 +4723,17 @@ func (k *kubernetesClient) getPODStatus(pod core.Pod, now time.Time) (string, st
 	jujuStatus := k.jujuStatus(pod.Status.Phase, terminated)
 	statusMessage := pod.Status.Message
 	since := now
+	if !terminated {
+		if message, lastTerminated, ok := containerCrashStatus(pod, now); ok {
+			return message, status.Error, lastTerminated, nil
+		}
+		if message, ok := containerImagePullStatus(pod, false); ok {
+			return message, status.Error, since, nil
+		}
+		if message, lastTerminated, ok := containerOOMStatus(pod, now); ok && statusMessage == "" {
+			statusMessage, since = message, lastTerminated
+		}
+	}
 	if statusMessage == "" {
 		for _, cond := range pod.Status.Conditions {
 			statusMessage = cond.Message
@@ -1686,7 +4748,7 @@ func (k *kubernetesClient) getPODStatus(pod core.Pod, now time.Time) (string, st
 	if statusMessage == "" {
 		// If there are any events for this pod we can use the
 		// most recent to set the status.
-		events := k.CoreV1().Events(k.namespace)
+		events := k.client().CoreV1().Events(k.namespace)
 		eventList, err := events.List(v1.ListOptions{
 			IncludeUninitialized: true,
 			FieldSelector:        fields.OneTermEqualSelector("involvedObject.name", pod.Name).String(),
@@ -1703,6 +4765,93 @@ func (k *kubernetesClient) getPODStatus(pod core.Pod, now time.Time) (string, st
 	return statusMessage, jujuStatus, since, nil
 }
 
+// containerCrashStatus returns a status message for the first container of
+// the pod which is waiting to be restarted after terminating, eg because it
+// is crash looping, along with the time it last terminated. The message
+// includes how the container terminated, to distinguish between an
+// application error and the container being OOM killed.
+func containerCrashStatus(pod core.Pod, now time.Time) (string, time.Time, bool) {
+	for _, cs := range pod.Status.ContainerStatuses {
+		last := cs.LastTerminationState.Terminated
+		if cs.State.Waiting == nil || last == nil {
+			continue
+		}
+		var cause string
+		switch {
+		case last.Reason == containerReasonOOMKilled:
+			cause = fmt.Sprintf("was OOM killed (exit code %d)", last.ExitCode)
+		case last.Signal != 0:
+			cause = fmt.Sprintf("was killed by signal %d (exit code %d)", last.Signal, last.ExitCode)
+		default:
+			cause = fmt.Sprintf("exited with code %d", last.ExitCode)
+		}
+		message := fmt.Sprintf("container %q %s, restarted %d times, last restarted %v ago",
+			cs.Name, cause, cs.RestartCount, now.Sub(last.FinishedAt.Time).Round(time.Second))
+		if waiting := cs.State.Waiting; waiting.Reason != "" {
+			message += ": " + waiting.Reason
+			if waiting.Message != "" {
+				message += " (" + waiting.Message + ")"
+			}
+		}
+		return message, last.FinishedAt.Time, true
+	}
+	return "", time.Time{}, false
+}
+
+// containerImagePullStatus returns a status message for the first
+// container of the pod whose image can't be pulled, including the image
+// and the pull error. If backingOff is true, only containers which have
+// repeatedly failed to pull their image are considered.
+func containerImagePullStatus(pod core.Pod, backingOff bool) (string, bool) {
+	images := make(map[string]string)
+	for _, c := range append(append([]core.Container(nil), pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		images[c.Name] = c.Image
+	}
+	statuses := append(append([]core.ContainerStatus(nil), pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		waiting := cs.State.Waiting
+		if waiting == nil {
+			continue
+		}
+		switch waiting.Reason {
+		case containerReasonImagePullBackOff:
+		case containerReasonErrImagePull:
+			if backingOff {
+				continue
+			}
+		default:
+			continue
+		}
+		image := cs.Image
+		if image == "" {
+			image = images[cs.Name]
+		}
+		message := fmt.Sprintf("container %q cannot pull image %q: %s", cs.Name, image, waiting.Reason)
+		if waiting.Message != "" {
+			message += " (" + waiting.Message + ")"
+		}
+		return message, true
+	}
+	return "", false
+}
+
+// containerOOMStatus returns a status message for the first container of
+// the pod which was last terminated for exceeding its memory limit, even
+// if it has since been restarted and is running again, along with the
+// time it was killed.
+func containerOOMStatus(pod core.Pod, now time.Time) (string, time.Time, bool) {
+	for _, cs := range pod.Status.ContainerStatuses {
+		last := cs.LastTerminationState.Terminated
+		if last == nil || last.Reason != containerReasonOOMKilled {
+			continue
+		}
+		message := fmt.Sprintf("container %q OOMKilled (exceeded memory limit) %v ago, restarted %d times",
+			cs.Name, now.Sub(last.FinishedAt.Time).Round(time.Second), cs.RestartCount)
+		return message, last.FinishedAt.Time, true
+	}
+	return "", time.Time{}, false
+}
+
 func (k *kubernetesClient) jujuStatus(podPhase core.PodPhase, terminated bool) status.Status {
 	if terminated {
 		return status.Terminated
@@ -1762,11 +4911,90 @@ func filesetConfigMap(configMapName string, files *caas.FileSet) *core.ConfigMap
 	return result
 }
 
+// reservedConfigMapPrefix prefixes the names of the config maps Juju
+// manages itself, such as the application owner, the operator config
+// and the file sets.
+const reservedConfigMapPrefix = "juju-"
+
+// EnsureCustomConfigMap creates or updates a config map with the given name,
+// data and labels. The labels must include the application label so that the
+// config map is removed when the application is deleted, and the name must be
+// prefixed with the application name so that it can't replace the config maps
+// of another application. Names reserved for Juju's own config maps are
+// rejected. Once the application has been deployed, the config map is owned
+// along with its other resources.
+func (k *kubernetesClient) EnsureCustomConfigMap(name string, data map[string]string, labels map[string]string) error {
+	if name == "" {
+		return errors.NotValidf("empty config map name")
+	}
+	appName := labels[labelApplication]
+	if appName == "" {
+		return errors.NotValidf("config map %q without %q label", name, labelApplication)
+	}
+	if strings.HasPrefix(name, reservedConfigMapPrefix) {
+		return errors.NotValidf("config map %q with reserved prefix %q", name, reservedConfigMapPrefix)
+	}
+	if !strings.HasPrefix(name, appName+"-") {
+		return errors.NotValidf("config map %q not prefixed with application name %q", name, appName)
+	}
+	owner, err := k.client().CoreV1().ConfigMaps(k.namespace).Get(applicationOwnerName(appName), v1.GetOptions{IncludeUninitialized: true})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return errors.Trace(err)
+	}
+	var ownerRefs []v1.OwnerReference
+	if err == nil {
+		ownerRefs = ownerReferences(core.SchemeGroupVersion.String(), "ConfigMap", owner.ObjectMeta)
+	}
+	configMap := &core.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{
+			Name:            name,
+			Labels:          labels,
+			OwnerReferences: ownerRefs,
+		},
+		Data: data,
+	}
+	return errors.Annotatef(k.ensureConfigMap(configMap), "creating or updating ConfigMap %q", name)
+}
+
 func (k *kubernetesClient) ensureConfigMap(configMap *core.ConfigMap) error {
-	configMaps := k.CoreV1().ConfigMaps(k.namespace)
+	_, err := k.createOrUpdateConfigMap(configMap)
+	return errors.Trace(err)
+}
+
+// ensureConfigMapChanged creates or updates the config map, reporting
+// whether its data was changed.
+func (k *kubernetesClient) ensureConfigMapChanged(configMap *core.ConfigMap) (bool, error) {
+	existing, err := k.client().CoreV1().ConfigMaps(k.namespace).Get(configMap.Name, v1.GetOptions{IncludeUninitialized: true})
+	if k8serrors.IsNotFound(err) {
+		existing, err = nil, nil
+	}
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	if err := k.ensureConfigMap(configMap); err != nil {
+		return false, errors.Trace(err)
+	}
+	return existing == nil || !reflect.DeepEqual(existing.Data, configMap.Data), nil
+}
+
+// createOrUpdateConfigMap creates or updates the config map,
+// reporting whether it was created.
+func (k *kubernetesClient) createOrUpdateConfigMap(configMap *core.ConfigMap) (created bool, _ error) {
+	configMaps := k.client().CoreV1().ConfigMaps(k.namespace)
 	_, err := configMaps.Update(configMap)
 	if k8serrors.IsNotFound(err) {
 		_, err = configMaps.Create(configMap)
+		created = err == nil
+	}
+	return created, errors.Trace(err)
+}
+
+func (k *kubernetesClient) deleteConfigMap(name string) error {
+	err := k.client().CoreV1().ConfigMaps(k.namespace).Delete(name, &v1.DeleteOptions{
+		PropagationPolicy: k.propagationPolicy(),
+	})
+	if k8serrors.IsNotFound(err) {
+		return nil
 	}
 	return errors.Trace(err)
 }
@@ -1790,8 +5018,12 @@ func operatorPod(appName, agentPath, operatorImagePath, version string, tags map
 			Labels: podLabels,
 		},
 		Spec: core.PodSpec{
+			// Stateful set pods must always be restarted; this is explicit
+			// so that it is clear that kubelet backs off restarting an
+			// operator which repeatedly crashes.
+			RestartPolicy: core.RestartPolicyAlways,
 			Containers: []core.Container{{
-				Name:            "juju-operator",
+				Name:            operatorContainerName,
 				ImagePullPolicy: core.PullIfNotPresent,
 				Image:           operatorImagePath,
 				Env: []core.EnvVar{
@@ -1821,22 +5053,194 @@ func operatorPod(appName, agentPath, operatorImagePath, version string, tags map
 	}
 }
 
+// introspectProbeMinVersion is the first operator version which links
+// juju-introspect to its jujud, as the default liveness probe requires.
+var introspectProbeMinVersion = version.MustParse("2.6-beta1")
+
+// defaultOperatorLivenessProbe returns the probe used to check the health
+// of the operator for the specified application. It queries the operator
+// agent's dependency engine over its introspection socket, which does not
+// respond if the agent is wedged. The operator links juju-introspect to
+// its jujud when it starts, as the image only has jujud.
+func defaultOperatorLivenessProbe(agentPath, appName string) *core.Probe {
+	return &core.Probe{
+		Handler: core.Handler{
+			Exec: &core.ExecAction{
+				Command: []string{
+					path.Join(tools.ToolsDir(agentPath, ""), jujunames.JujuIntrospect),
+					"--agent=" + names.NewApplicationTag(appName).String(),
+					"depengine",
+				},
+			},
+		},
+		InitialDelaySeconds: 30,
+		PeriodSeconds:       30,
+		TimeoutSeconds:      10,
+		FailureThreshold:    3,
+	}
+}
+
+// configureOperatorContainer sets the command and liveness probe
+// of the operator container from the operator config.
+func configureOperatorContainer(container *core.Container, agentPath, appName string, config *caas.OperatorConfig) error {
+	if len(config.Command) > 0 {
+		container.Command = config.Command
+	}
+	if mountPath := config.AgentConfMountPath; mountPath != "" {
+		if !path.IsAbs(mountPath) {
+			return errors.NotValidf("relative agent.conf mount path %q", mountPath)
+		}
+		configVolName := operatorConfigMapName(appName) + "-volume"
+		for i, mount := range container.VolumeMounts {
+			if mount.Name == configVolName {
+				container.VolumeMounts[i].MountPath = mountPath
+			}
+		}
+	}
+	if config.LivenessProbe == nil {
+		// The default probe relies on the standard operator command, and
+		// on a version of it which links juju-introspect; otherwise there
+		// is no probe rather than one which always fails.
+		if len(config.Command) == 0 && config.Version.Compare(introspectProbeMinVersion) >= 0 {
+			container.LivenessProbe = defaultOperatorLivenessProbe(agentPath, appName)
+		}
+		return nil
+	}
+	if err := config.LivenessProbe.Validate(); err != nil {
+		return errors.Annotate(err, "operator liveness probe")
+	}
+	container.LivenessProbe = k8sProbe(config.LivenessProbe)
+	return nil
+}
+
+// k8sProbe returns the kubernetes probe for the substrate
+// independent probe, which must be valid.
+func k8sProbe(probe *caas.Probe) *core.Probe {
+	result := &core.Probe{
+		InitialDelaySeconds: probe.InitialDelaySeconds,
+		PeriodSeconds:       probe.PeriodSeconds,
+		TimeoutSeconds:      probe.TimeoutSeconds,
+		FailureThreshold:    probe.FailureThreshold,
+	}
+	switch {
+	case len(probe.Command) > 0:
+		result.Exec = &core.ExecAction{Command: probe.Command}
+	case probe.HTTPGet != nil:
+		result.HTTPGet = &core.HTTPGetAction{
+			Path:   probe.HTTPGet.Path,
+			Port:   intstr.FromInt(int(probe.HTTPGet.Port)),
+			Scheme: core.URIScheme(probe.HTTPGet.Scheme),
+		}
+	default:
+		result.TCPSocket = &core.TCPSocketAction{Port: intstr.FromInt(int(probe.TCPPort))}
+	}
+	return result
+}
+
+var configFileNameRegexp = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+// validateOperatorConfigFiles returns an error if any of the operator's
+// additional config files can't be stored in its config map, or would
+// clash with the template agent.conf file.
+func validateOperatorConfigFiles(files map[string]string) error {
+	for name := range files {
+		if !configFileNameRegexp.MatchString(name) || name == "." || name == ".." {
+			return errors.NotValidf("config file name %q", name)
+		}
+		if name == "agent.conf" || name == "template-agent.conf" {
+			return errors.NotValidf("config file %q replacing agent.conf", name)
+		}
+	}
+	return nil
+}
+
+// configureOperatorAnnotations adds the specified annotations to the
+// operator pod. Annotations already set by Juju are not overridden.
+func configureOperatorAnnotations(pod *core.Pod, annotations map[string]string) error {
+	if len(annotations) == 0 {
+		return nil
+	}
+	result := make(map[string]string)
+	for name, value := range annotations {
+		if strings.HasPrefix(name, "juju-") {
+			return errors.NotValidf("operator pod annotation %q reserved for Juju", name)
+		}
+		result[name] = value
+	}
+	for name, value := range pod.Annotations {
+		result[name] = value
+	}
+	pod.Annotations = result
+	return nil
+}
+
+// configureOperatorConfigFiles mounts the operator's additional config
+// files alongside the template agent.conf file.
+func configureOperatorConfigFiles(pod *core.Pod, appName string, files map[string]string) {
+	if len(files) == 0 {
+		return
+	}
+	configVolName := operatorConfigMapName(appName) + "-volume"
+	container := &pod.Spec.Containers[0]
+	var agentConfMount *core.VolumeMount
+	for i, mount := range container.VolumeMounts {
+		if mount.Name == configVolName {
+			agentConfMount = &container.VolumeMounts[i]
+		}
+	}
+	var volume *core.Volume
+	for i, vol := range pod.Spec.Volumes {
+		if vol.Name == configVolName {
+			volume = &pod.Spec.Volumes[i]
+		}
+	}
+	if agentConfMount == nil || volume == nil || volume.ConfigMap == nil {
+		return
+	}
+	configDir := path.Dir(agentConfMount.MountPath)
+
+	// Sort the names so that the pod spec is stable.
+	var fileNames []string
+	for name := range files {
+		fileNames = append(fileNames, name)
+	}
+	sort.Strings(fileNames)
+	for _, name := range fileNames {
+		volume.ConfigMap.Items = append(volume.ConfigMap.Items, core.KeyToPath{
+			Key:  appName + "-" + name,
+			Path: name,
+		})
+		container.VolumeMounts = append(container.VolumeMounts, core.VolumeMount{
+			Name:      configVolName,
+			MountPath: path.Join(configDir, name),
+			SubPath:   name,
+		})
+	}
+}
+
 // operatorConfigMap returns a *core.ConfigMap for the operator pod
 // of the specified application, with the specified configuration.
 func operatorConfigMap(appName string, config *caas.OperatorConfig) *core.ConfigMap {
 	configMapName := operatorConfigMapName(appName)
+	data := map[string]string{
+		appName + "-agent.conf": string(config.AgentConf),
+	}
+	for name, content := range config.ConfigFiles {
+		data[appName+"-"+name] = content
+	}
 	return &core.ConfigMap{
 		ObjectMeta: v1.ObjectMeta{
 			Name: configMapName,
 		},
-		Data: map[string]string{
-			appName + "-agent.conf": string(config.AgentConf),
-		},
+		Data: data,
 	}
 }
 
 type unitSpec struct {
 	Pod core.PodSpec `json:"pod"`
+
+	// Labels are extra labels for the pod template.
+	Labels map[string]string `json:"-"`
 }
 
 var defaultPodTemplate = `
@@ -1850,6 +5254,7 @@ pod:
         - containerPort: {{.ContainerPort}}
           {{if .Name}}name: {{.Name}}{{end}}
           {{if .Protocol}}protocol: {{.Protocol}}{{end}}
+          {{if .HostPort}}hostPort: {{.HostPort}}{{end}}
     {{- end}}
     {{end}}
     {{if .Command}}
@@ -1868,9 +5273,88 @@ pod:
           value: {{$v}}
     {{- end}}
     {{end}}
+    {{if .LivenessProbe}}
+    livenessProbe:
+      {{- template "probe" .LivenessProbe}}
+    {{end}}
+    {{if .ReadinessProbe}}
+    readinessProbe:
+      {{- template "probe" .ReadinessProbe}}
+    {{end}}
   {{- end}}
+{{- define "probe"}}
+      {{- if .Command}}
+      exec:
+        command: [{{- range $idx, $c := .Command -}}{{if ne $idx 0}},{{end}}"{{$c}}"{{- end -}}]
+      {{- end}}
+      {{- if .HTTPGet}}
+      httpGet:
+        {{- if .HTTPGet.Path}}
+        path: "{{.HTTPGet.Path}}"
+        {{- end}}
+        port: {{.HTTPGet.Port}}
+        {{- if .HTTPGet.Scheme}}
+        scheme: {{.HTTPGet.Scheme}}
+        {{- end}}
+      {{- end}}
+      {{- if .TCPPort}}
+      tcpSocket:
+        port: {{.TCPPort}}
+      {{- end}}
+      {{- if .InitialDelaySeconds}}
+      initialDelaySeconds: {{.InitialDelaySeconds}}
+      {{- end}}
+      {{- if .PeriodSeconds}}
+      periodSeconds: {{.PeriodSeconds}}
+      {{- end}}
+      {{- if .TimeoutSeconds}}
+      timeoutSeconds: {{.TimeoutSeconds}}
+      {{- end}}
+      {{- if .FailureThreshold}}
+      failureThreshold: {{.FailureThreshold}}
+      {{- end}}
+{{- end}}
 `[1:]
 
+const (
+	defaultAutoProbeInitialDelay = 10
+	defaultAutoProbePeriod       = 10
+)
+
+// autoReadinessProbe returns a readiness probe which checks
+// that the given container port accepts connections.
+func autoReadinessProbe(port caas.ContainerPort) *core.Probe {
+	return &core.Probe{
+		Handler: core.Handler{
+			TCPSocket: &core.TCPSocketAction{Port: intstr.FromInt(int(port.ContainerPort))},
+		},
+		InitialDelaySeconds: defaultAutoProbeInitialDelay,
+		PeriodSeconds:       defaultAutoProbePeriod,
+	}
+}
+
+// configureAutoProbes applies any configured timings to the
+// automatic readiness probes of the unit's containers.
+func configureAutoProbes(unitSpec *unitSpec, podSpec *caas.PodSpec, config application.ConfigAttributes) error {
+	initialDelay := config.GetInt(autoProbeInitialDelayKey, defaultAutoProbeInitialDelay)
+	if initialDelay < 0 {
+		return errors.NotValidf("%s %d", autoProbeInitialDelayKey, initialDelay)
+	}
+	period := config.GetInt(autoProbePeriodKey, defaultAutoProbePeriod)
+	if period <= 0 {
+		return errors.NotValidf("%s %d", autoProbePeriodKey, period)
+	}
+	for i, c := range podSpec.Containers {
+		if !c.AutoReadinessProbe {
+			continue
+		}
+		probe := unitSpec.Pod.Containers[i].ReadinessProbe
+		probe.InitialDelaySeconds = int32(initialDelay)
+		probe.PeriodSeconds = int32(period)
+	}
+	return nil
+}
+
 func makeUnitSpec(appName string, podSpec *caas.PodSpec) (*unitSpec, error) {
 	// Fill out the easy bits using a template.
 	tmpl := template.Must(template.New("").Parse(defaultPodTemplate))
@@ -1899,6 +5383,14 @@ func makeUnitSpec(appName string, podSpec *caas.PodSpec) (*unitSpec, error) {
 		if c.ImageDetails.Password != "" {
 			imageSecretNames = append(imageSecretNames, core.LocalObjectReference{Name: appSecretName(appName, c.Name)})
 		}
+		for _, p := range c.Ports {
+			if p.HostPort != 0 {
+				logger.Warningf(
+					"application %q container %q binds host port %d/%s, so at most one unit can run on each node",
+					appName, c.Name, p.HostPort, p.Protocol,
+				)
+			}
+		}
 
 		if c.ProviderContainer == nil {
 			continue
@@ -1908,17 +5400,189 @@ func makeUnitSpec(appName string, podSpec *caas.PodSpec) (*unitSpec, error) {
 			return nil, errors.Errorf("unexpected kubernetes container spec type %T", c.ProviderContainer)
 		}
 		unitSpec.Pod.Containers[i].ImagePullPolicy = spec.ImagePullPolicy
+		unitSpec.Pod.Containers[i].SecurityContext = spec.securityContext()
+		// Probes may be declared generically or using the kubernetes
+		// types, but not both, since it would be unclear which applies.
 		if spec.LivenessProbe != nil {
+			if c.LivenessProbe != nil {
+				return nil, errors.NotValidf("liveness probe for container %q declared twice", c.Name)
+			}
 			unitSpec.Pod.Containers[i].LivenessProbe = spec.LivenessProbe
 		}
 		if spec.ReadinessProbe != nil {
+			if c.ReadinessProbe != nil {
+				return nil, errors.NotValidf("readiness probe for container %q declared twice", c.Name)
+			}
 			unitSpec.Pod.Containers[i].ReadinessProbe = spec.ReadinessProbe
 		}
+		unitSpec.Pod.Containers[i].VolumeMounts = append(unitSpec.Pod.Containers[i].VolumeMounts, spec.VolumeMounts...)
+		unitSpec.Pod.Containers[i].EnvFrom = spec.EnvFrom
+		unitSpec.Pod.Containers[i].Lifecycle = spec.Lifecycle
+		unitSpec.Pod.Containers[i].Stdin = spec.Stdin
+		unitSpec.Pod.Containers[i].StdinOnce = spec.StdinOnce
+		unitSpec.Pod.Containers[i].TTY = spec.TTY
+		if spec.EphemeralStorage != nil {
+			request, limit, err := spec.EphemeralStorage.parse()
+			if err != nil {
+				return nil, errors.Annotatef(err, "ephemeral storage for container %q", c.Name)
+			}
+			resources := &unitSpec.Pod.Containers[i].Resources
+			if request != nil {
+				if resources.Requests == nil {
+					resources.Requests = core.ResourceList{}
+				}
+				resources.Requests[core.ResourceEphemeralStorage] = *request
+			}
+			if limit != nil {
+				if resources.Limits == nil {
+					resources.Limits = core.ResourceList{}
+				}
+				resources.Limits[core.ResourceEphemeralStorage] = *limit
+			}
+		}
+	}
+	unitSpec.Pod.ImagePullSecrets = mergeImagePullSecrets(imageSecretNames)
+	for i, c := range podSpec.Containers {
+		if !c.AutoReadinessProbe {
+			continue
+		}
+		if unitSpec.Pod.Containers[i].ReadinessProbe != nil {
+			return nil, errors.NotValidf("readiness probe for container %q declared twice", c.Name)
+		}
+		unitSpec.Pod.Containers[i].ReadinessProbe = autoReadinessProbe(c.Ports[0])
+	}
+
+	if podSpec.ProviderPod == nil {
+		return &unitSpec, nil
+	}
+	spec, ok := podSpec.ProviderPod.(*K8sPodSpec)
+	if !ok {
+		return nil, errors.Errorf("unexpected kubernetes pod spec type %T", podSpec.ProviderPod)
+	}
+	if err := configureHostNamespaces(appName, &unitSpec.Pod, spec); err != nil {
+		return nil, errors.Trace(err)
+	}
+	unitSpec.Pod.Volumes = append(unitSpec.Pod.Volumes, spec.Volumes...)
+	unitSpec.Pod.ImagePullSecrets = mergeImagePullSecrets(unitSpec.Pod.ImagePullSecrets, spec.ImagePullSecrets)
+	if spec.ActiveDeadlineSeconds != nil || spec.TerminationGracePeriodSeconds != nil ||
+		len(spec.ReadinessGates) > 0 || len(spec.PodLabels) > 0 || spec.RuntimeClassName != nil {
+		if err := spec.Validate(); err != nil {
+			return nil, errors.Trace(err)
+		}
+		unitSpec.Pod.TerminationGracePeriodSeconds = spec.TerminationGracePeriodSeconds
+		unitSpec.Pod.ReadinessGates = spec.ReadinessGates
+		unitSpec.Pod.RuntimeClassName = spec.RuntimeClassName
+		unitSpec.Labels = spec.PodLabels
 	}
-	unitSpec.Pod.ImagePullSecrets = imageSecretNames
 	return &unitSpec, nil
 }
 
+// configureTerminationGrace applies the application's configured
+// termination grace period to the unit pods, unless their spec
+// sets one.
+func configureTerminationGrace(unitSpec *unitSpec, config application.ConfigAttributes) error {
+	if _, ok := config[terminationGracePeriodKey]; !ok || unitSpec.Pod.TerminationGracePeriodSeconds != nil {
+		return nil
+	}
+	grace := config.GetInt(terminationGracePeriodKey, 0)
+	if grace < 0 {
+		return errors.NotValidf("%s %d", terminationGracePeriodKey, grace)
+	}
+	grace64 := int64(grace)
+	unitSpec.Pod.TerminationGracePeriodSeconds = &grace64
+	return nil
+}
+
+// configureSpreadReplicas adds a pod anti-affinity rule to spread the
+// application's pods across nodes, if configured. The rule is only a
+// preference unless it is configured to be required, since otherwise
+// pods which can't be placed on a node of their own are left pending.
+func configureSpreadReplicas(appName string, unitSpec *unitSpec, config application.ConfigAttributes) {
+	if !config.GetBool(spreadReplicasKey, defaultSpreadReplicas) {
+		return
+	}
+	term := core.PodAffinityTerm{
+		LabelSelector: &v1.LabelSelector{
+			MatchLabels: map[string]string{labelApplication: appName},
+		},
+		TopologyKey: "kubernetes.io/hostname",
+	}
+	pod := &unitSpec.Pod
+	if pod.Affinity == nil {
+		pod.Affinity = &core.Affinity{}
+	}
+	if pod.Affinity.PodAntiAffinity == nil {
+		pod.Affinity.PodAntiAffinity = &core.PodAntiAffinity{}
+	}
+	antiAffinity := pod.Affinity.PodAntiAffinity
+	if config.GetBool(spreadReplicasRequiredKey, false) {
+		antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(
+			antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution, term)
+		return
+	}
+	antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+		antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+		core.WeightedPodAffinityTerm{Weight: 100, PodAffinityTerm: term},
+	)
+}
+
+// mergeImagePullSecrets returns the secrets referenced by any of the
+// lists, without duplicates and sorted by name, so that the pod spec
+// does not change, and roll the pods, merely because the secrets were
+// gathered in a different order.
+func mergeImagePullSecrets(lists ...[]core.LocalObjectReference) []core.LocalObjectReference {
+	names := set.NewStrings()
+	for _, refs := range lists {
+		for _, ref := range refs {
+			names.Add(ref.Name)
+		}
+	}
+	if names.IsEmpty() {
+		return nil
+	}
+	var result []core.LocalObjectReference
+	for _, name := range names.SortedValues() {
+		result = append(result, core.LocalObjectReference{Name: name})
+	}
+	return result
+}
+
+// configureHostNamespaces sets up the pod to share the host's
+// network, PID and IPC namespaces as requested by the spec.
+func configureHostNamespaces(appName string, pod *core.PodSpec, spec *K8sPodSpec) error {
+	if !spec.HostNetwork && !spec.HostPID && !spec.HostIPC {
+		return nil
+	}
+	if err := spec.Validate(); err != nil {
+		return errors.Trace(err)
+	}
+	logger.Warningf(
+		"application %q pods share host namespaces (network=%v, pid=%v, ipc=%v)",
+		appName, spec.HostNetwork, spec.HostPID, spec.HostIPC,
+	)
+	pod.HostNetwork = spec.HostNetwork
+	pod.HostPID = spec.HostPID
+	pod.HostIPC = spec.HostIPC
+	if !spec.HostNetwork {
+		return nil
+	}
+	// Kubernetes requires host ports to match container
+	// ports when using the host's network.
+	for _, c := range pod.Containers {
+		for _, p := range c.Ports {
+			if p.HostPort != 0 && p.HostPort != p.ContainerPort {
+				return errors.NotValidf(
+					"host port %d for container %q port %d with host network", p.HostPort, c.Name, p.ContainerPort)
+			}
+		}
+	}
+	return nil
+}
+
+// operatorContainerName is the name of the
+// container in the operator pod running the agent.
+const operatorContainerName = "juju-operator"
+
 func operatorName(appName string) string {
 	return "juju-operator-" + appName
 }
@@ -1939,6 +5603,14 @@ func deploymentName(appName string) string {
 	return "juju-" + appName
 }
 
+func trackDeploymentName(appName, track string) string {
+	return deploymentName(appName) + "-" + track
+}
+
+func containerServiceName(appName, containerName string) string {
+	return deploymentName(appName) + "-" + containerName
+}
+
 func appSecretName(appName, containerName string) string {
 	// A pod may have multiple containers with different images and thus different secrets
 	return "juju-" + appName + "-" + containerName + "-secret"
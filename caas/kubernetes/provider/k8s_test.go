@@ -4,11 +4,18 @@
 package provider_test
 
 import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"time"
 
 	"github.com/golang/mock/gomock"
 	testclock "github.com/juju/clock/testclock"
+	"github.com/juju/collections/set"
 	"github.com/juju/errors"
+	proxyutils "github.com/juju/proxy"
 	jc "github.com/juju/testing/checkers"
 	"github.com/juju/version"
 	gc "gopkg.in/check.v1"
@@ -16,24 +23,35 @@ import (
 	apps "k8s.io/api/apps/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	core "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
 	storagev1 "k8s.io/api/storage/v1"
 	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	k8sversion "k8s.io/apimachinery/pkg/version"
 	watch "k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 
 	"github.com/juju/juju/caas"
 	"github.com/juju/juju/caas/kubernetes/provider"
+	"github.com/juju/juju/cloud"
 	"github.com/juju/juju/constraints"
 	"github.com/juju/juju/core/application"
 	"github.com/juju/juju/core/devices"
 	"github.com/juju/juju/core/status"
 	"github.com/juju/juju/environs/context"
+	"github.com/juju/juju/network"
 	"github.com/juju/juju/storage"
 	"github.com/juju/juju/testing"
+	"github.com/juju/juju/utils/proxy"
 )
 
 type K8sSuite struct {
@@ -91,6 +109,411 @@ func (s *K8sSuite) TestMakeUnitSpecNoConfigConfig(c *gc.C) {
 	})
 }
 
+func (s *K8sSuite) TestDeploymentRolloutStatus(c *gc.C) {
+	for i, t := range []struct {
+		conditions []appsv1.DeploymentCondition
+		status     status.Status
+		message    string
+	}{{
+		conditions: nil,
+		status:     status.Waiting,
+		message:    "waiting for deployment to become available",
+	}, {
+		conditions: []appsv1.DeploymentCondition{
+			{Type: appsv1.DeploymentProgressing, Status: core.ConditionTrue, Reason: "NewReplicaSetAvailable"},
+			{Type: appsv1.DeploymentAvailable, Status: core.ConditionTrue},
+		},
+		status: status.Active,
+	}, {
+		conditions: []appsv1.DeploymentCondition{
+			{Type: appsv1.DeploymentAvailable, Status: core.ConditionFalse},
+			{Type: appsv1.DeploymentProgressing, Status: core.ConditionFalse,
+				Reason: "ProgressDeadlineExceeded", Message: "rollout stalled"},
+		},
+		status:  status.Error,
+		message: "rollout stalled",
+	}} {
+		c.Logf("test %d", i)
+		deployment := &appsv1.Deployment{Status: appsv1.DeploymentStatus{Conditions: t.conditions}}
+		st, message := provider.DeploymentRolloutStatus(deployment)
+		c.Check(st, gc.Equals, t.status)
+		c.Check(message, gc.Equals, t.message)
+	}
+}
+
+func (s *K8sSuite) TestPodQOSClass(c *gc.C) {
+	small := core.ResourceList{
+		core.ResourceCPU:    resource.MustParse("100m"),
+		core.ResourceMemory: resource.MustParse("64Mi"),
+	}
+	large := core.ResourceList{
+		core.ResourceCPU:    resource.MustParse("1"),
+		core.ResourceMemory: resource.MustParse("1Gi"),
+	}
+	for i, t := range []struct {
+		status    core.PodQOSClass
+		resources core.ResourceRequirements
+		expected  core.PodQOSClass
+	}{{
+		expected: core.PodQOSBestEffort,
+	}, {
+		resources: core.ResourceRequirements{Requests: small, Limits: small},
+		expected:  core.PodQOSGuaranteed,
+	}, {
+		resources: core.ResourceRequirements{Limits: large},
+		expected:  core.PodQOSGuaranteed,
+	}, {
+		resources: core.ResourceRequirements{Requests: small, Limits: large},
+		expected:  core.PodQOSBurstable,
+	}, {
+		resources: core.ResourceRequirements{Requests: small},
+		expected:  core.PodQOSBurstable,
+	}, {
+		status:   core.PodQOSGuaranteed,
+		expected: core.PodQOSGuaranteed,
+	}} {
+		c.Logf("test %d", i)
+		pod := core.Pod{
+			Spec:   core.PodSpec{Containers: []core.Container{{Name: "test", Resources: t.resources}}},
+			Status: core.PodStatus{QOSClass: t.status},
+		}
+		c.Check(provider.PodQOSClass(pod), gc.Equals, t.expected)
+	}
+}
+
+func (s *K8sSuite) TestMakeUnitSpecHostNamespaces(c *gc.C) {
+	podSpec := caas.PodSpec{
+		Containers: []caas.ContainerSpec{{
+			Name:  "test",
+			Ports: []caas.ContainerPort{{ContainerPort: 80, Protocol: "TCP"}},
+			Image: "juju/image",
+		}},
+		ProviderPod: &provider.K8sPodSpec{
+			AllowHostNamespaces: true,
+			HostNetwork:         true,
+			HostIPC:             true,
+		},
+	}
+	spec, err := provider.MakeUnitSpec("app-name", &podSpec)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(provider.PodSpec(spec), jc.DeepEquals, core.PodSpec{
+		HostNetwork: true,
+		HostIPC:     true,
+		Containers: []core.Container{{
+			Name:  "test",
+			Image: "juju/image",
+			Ports: []core.ContainerPort{{ContainerPort: int32(80), Protocol: core.ProtocolTCP}},
+		}},
+	})
+}
+
+func (s *K8sSuite) TestMakeUnitSpecHostNamespacesNotAllowed(c *gc.C) {
+	podSpec := caas.PodSpec{
+		Containers: []caas.ContainerSpec{{
+			Name:  "test",
+			Image: "juju/image",
+		}},
+		ProviderPod: &provider.K8sPodSpec{HostPID: true},
+	}
+	_, err := provider.MakeUnitSpec("app-name", &podSpec)
+	c.Assert(err, gc.ErrorMatches, "using host namespaces without allowHostNamespaces not valid")
+}
+
+func (s *K8sSuite) TestMakeUnitSpecHostPort(c *gc.C) {
+	podSpec := caas.PodSpec{
+		Containers: []caas.ContainerSpec{{
+			Name:  "test",
+			Ports: []caas.ContainerPort{{ContainerPort: 80, Protocol: "TCP", HostPort: 8080}},
+			Image: "juju/image",
+		}},
+	}
+	spec, err := provider.MakeUnitSpec("app-name", &podSpec)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(provider.PodSpec(spec), jc.DeepEquals, core.PodSpec{
+		Containers: []core.Container{{
+			Name:  "test",
+			Image: "juju/image",
+			Ports: []core.ContainerPort{{ContainerPort: int32(80), Protocol: core.ProtocolTCP, HostPort: int32(8080)}},
+		}},
+	})
+}
+
+func (s *K8sSuite) TestMakeUnitSpecProbes(c *gc.C) {
+	podSpec := caas.PodSpec{
+		Containers: []caas.ContainerSpec{{
+			Name:  "test",
+			Image: "juju/image",
+			LivenessProbe: &caas.Probe{
+				HTTPGet:             &caas.HTTPGetProbe{Path: "/ping", Port: 8080},
+				InitialDelaySeconds: 10,
+			},
+			ReadinessProbe: &caas.Probe{
+				Command:       []string{"ready", "--quick"},
+				PeriodSeconds: 5,
+			},
+		}, {
+			Name:           "test2",
+			Image:          "juju/image2",
+			ReadinessProbe: &caas.Probe{TCPPort: 22},
+		}},
+	}
+	spec, err := provider.MakeUnitSpec("app-name", &podSpec)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(provider.PodSpec(spec), jc.DeepEquals, core.PodSpec{
+		Containers: []core.Container{{
+			Name:  "test",
+			Image: "juju/image",
+			LivenessProbe: &core.Probe{
+				Handler: core.Handler{
+					HTTPGet: &core.HTTPGetAction{Path: "/ping", Port: intstr.FromInt(8080)},
+				},
+				InitialDelaySeconds: 10,
+			},
+			ReadinessProbe: &core.Probe{
+				Handler: core.Handler{
+					Exec: &core.ExecAction{Command: []string{"ready", "--quick"}},
+				},
+				PeriodSeconds: 5,
+			},
+		}, {
+			Name:  "test2",
+			Image: "juju/image2",
+			ReadinessProbe: &core.Probe{
+				Handler: core.Handler{
+					TCPSocket: &core.TCPSocketAction{Port: intstr.FromInt(22)},
+				},
+			},
+		}},
+	})
+}
+
+func (s *K8sSuite) TestMakeUnitSpecProbeDeclaredTwice(c *gc.C) {
+	podSpec := caas.PodSpec{
+		Containers: []caas.ContainerSpec{{
+			Name:          "test",
+			Image:         "juju/image",
+			LivenessProbe: &caas.Probe{TCPPort: 80},
+			ProviderContainer: &provider.K8sContainerSpec{
+				LivenessProbe: &core.Probe{
+					Handler: core.Handler{
+						TCPSocket: &core.TCPSocketAction{Port: intstr.FromInt(8080)},
+					},
+				},
+			},
+		}},
+	}
+	_, err := provider.MakeUnitSpec("app-name", &podSpec)
+	c.Assert(err, gc.ErrorMatches, `liveness probe for container "test" declared twice not valid`)
+}
+
+func (s *K8sSuite) TestMakeUnitSpecPodVolumes(c *gc.C) {
+	volume := core.Volume{
+		Name:         "shared",
+		VolumeSource: core.VolumeSource{EmptyDir: &core.EmptyDirVolumeSource{}},
+	}
+	podSpec := caas.PodSpec{
+		Containers: []caas.ContainerSpec{{
+			Name:  "test",
+			Image: "juju/image",
+		}, {
+			Name:  "sidecar",
+			Image: "juju/sidecar",
+			ProviderContainer: &provider.K8sContainerSpec{
+				VolumeMounts: []core.VolumeMount{{Name: "shared", MountPath: "/shared"}},
+			},
+		}},
+		ProviderPod: &provider.K8sPodSpec{
+			Volumes: []core.Volume{volume},
+		},
+	}
+	spec, err := provider.MakeUnitSpec("app-name", &podSpec)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(provider.PodSpec(spec), jc.DeepEquals, core.PodSpec{
+		Containers: []core.Container{{
+			Name:  "test",
+			Image: "juju/image",
+		}, {
+			Name:         "sidecar",
+			Image:        "juju/sidecar",
+			VolumeMounts: []core.VolumeMount{{Name: "shared", MountPath: "/shared"}},
+		}},
+		Volumes: []core.Volume{volume},
+	})
+}
+
+func (s *K8sSuite) TestMakeUnitSpecContainerSecurityContext(c *gc.C) {
+	readOnly, allowEscalation := true, false
+	capabilities := &core.Capabilities{Drop: []core.Capability{"ALL"}}
+	podSpec := caas.PodSpec{
+		Containers: []caas.ContainerSpec{{
+			Name:  "test",
+			Image: "juju/image",
+			ProviderContainer: &provider.K8sContainerSpec{
+				Capabilities:             capabilities,
+				ReadOnlyRootFilesystem:   &readOnly,
+				AllowPrivilegeEscalation: &allowEscalation,
+			},
+		}, {
+			Name:              "sidecar",
+			Image:             "juju/sidecar",
+			ProviderContainer: &provider.K8sContainerSpec{},
+		}},
+	}
+	spec, err := provider.MakeUnitSpec("app-name", &podSpec)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(provider.PodSpec(spec), jc.DeepEquals, core.PodSpec{
+		Containers: []core.Container{{
+			Name:  "test",
+			Image: "juju/image",
+			SecurityContext: &core.SecurityContext{
+				Capabilities:             capabilities,
+				ReadOnlyRootFilesystem:   &readOnly,
+				AllowPrivilegeEscalation: &allowEscalation,
+			},
+		}, {
+			Name:  "sidecar",
+			Image: "juju/sidecar",
+		}},
+	})
+}
+
+func (s *K8sSuite) TestMakeUnitSpecEphemeralStorage(c *gc.C) {
+	podSpec := caas.PodSpec{
+		Containers: []caas.ContainerSpec{{
+			Name:  "test",
+			Image: "juju/image",
+			ProviderContainer: &provider.K8sContainerSpec{
+				EphemeralStorage: &provider.ResourceQuantity{Request: "1Gi", Limit: "2Gi"},
+			},
+		}},
+	}
+	spec, err := provider.MakeUnitSpec("app-name", &podSpec)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(provider.PodSpec(spec).Containers[0].Resources, jc.DeepEquals, core.ResourceRequirements{
+		Requests: core.ResourceList{core.ResourceEphemeralStorage: resource.MustParse("1Gi")},
+		Limits:   core.ResourceList{core.ResourceEphemeralStorage: resource.MustParse("2Gi")},
+	})
+}
+
+func (s *K8sSuite) TestMakeUnitSpecActiveDeadlineNotSupported(c *gc.C) {
+	deadline := int64(300)
+	podSpec := caas.PodSpec{
+		Containers: []caas.ContainerSpec{{
+			Name:  "test",
+			Image: "juju/image",
+		}},
+		ProviderPod: &provider.K8sPodSpec{ActiveDeadlineSeconds: &deadline},
+	}
+	_, err := provider.MakeUnitSpec("app-name", &podSpec)
+	c.Assert(err, jc.Satisfies, errors.IsNotSupported)
+	c.Assert(err, gc.ErrorMatches, "activeDeadlineSeconds for pods managed by a deployment or stateful set not supported")
+}
+
+func (s *K8sSuite) TestServiceTargetPort(c *gc.C) {
+	ports := []core.ContainerPort{{Name: "http", ContainerPort: 8080}}
+	for i, t := range []struct {
+		value  interface{}
+		expect *intstr.IntOrString
+	}{
+		{nil, nil},
+		{"", nil},
+		{8000, &intstr.IntOrString{Type: intstr.Int, IntVal: 8000}},
+		{float64(8000), &intstr.IntOrString{Type: intstr.Int, IntVal: 8000}},
+		{"8000", &intstr.IntOrString{Type: intstr.Int, IntVal: 8000}},
+		{"http", &intstr.IntOrString{Type: intstr.String, StrVal: "http"}},
+	} {
+		c.Logf("test %d: %v", i, t.value)
+		config := application.ConfigAttributes{}
+		if t.value != nil {
+			config["kubernetes-service-target-port"] = t.value
+		}
+		targetPort, err := provider.ServiceTargetPort(config, ports)
+		c.Check(err, jc.ErrorIsNil)
+		c.Check(targetPort, jc.DeepEquals, t.expect)
+	}
+}
+
+func (s *K8sSuite) TestServiceTargetPortUnknownName(c *gc.C) {
+	ports := []core.ContainerPort{{Name: "http", ContainerPort: 8080}}
+	config := application.ConfigAttributes{"kubernetes-service-target-port": "https"}
+	_, err := provider.ServiceTargetPort(config, ports)
+	c.Assert(err, gc.ErrorMatches, `kubernetes-service-target-port "https" with no container port of that name not valid`)
+}
+
+func (s *K8sSuite) TestParseServerVersion(c *gc.C) {
+	for i, t := range []struct {
+		info     k8sversion.Info
+		expected version.Number
+		err      string
+	}{{
+		info:     k8sversion.Info{GitVersion: "v1.11.2", Major: "1", Minor: "11"},
+		expected: version.MustParse("1.11.2"),
+	}, {
+		info:     k8sversion.Info{GitVersion: "v1.18.3-gke.1", Major: "1", Minor: "18+"},
+		expected: version.MustParse("1.18.3"),
+	}, {
+		info:     k8sversion.Info{GitVersion: "v1.17.4+k3s1", Major: "1", Minor: "17"},
+		expected: version.MustParse("1.17.4"),
+	}, {
+		info:     k8sversion.Info{GitVersion: "v1.16", Major: "1", Minor: "16+"},
+		expected: version.Number{Major: 1, Minor: 16},
+	}, {
+		info: k8sversion.Info{GitVersion: "unknown"},
+		err:  `server version "unknown" not valid`,
+	}} {
+		c.Logf("test %d: %v", i, t.info.GitVersion)
+		v, err := provider.ParseServerVersion(&t.info)
+		if t.err != "" {
+			c.Check(err, gc.ErrorMatches, t.err)
+			continue
+		}
+		c.Check(err, jc.ErrorIsNil)
+		c.Check(v, gc.Equals, t.expected)
+	}
+}
+
+func (s *K8sSuite) TestProxyTransport(c *gc.C) {
+	err := proxy.DefaultConfig.Set(proxyutils.Settings{
+		Https:   "https://proxy.example.com:3128",
+		NoProxy: "10.0.0.0/8,.cluster.local",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer proxy.DefaultConfig.Set(proxyutils.Settings{})
+
+	shared := &http.Transport{
+		TLSClientConfig:     &tls.Config{ServerName: "api.example.com"},
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	transport, ok := provider.ProxyTransport(shared).(*http.Transport)
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(transport, gc.Not(gc.Equals), shared)
+	c.Assert(shared.Proxy, gc.IsNil)
+	c.Assert(transport.TLSClientConfig.ServerName, gc.Equals, "api.example.com")
+	c.Assert(transport.TLSHandshakeTimeout, gc.Equals, 10*time.Second)
+
+	for i, t := range []struct {
+		url   string
+		proxy string
+	}{
+		{url: "https://api.example.com:6443", proxy: "https://proxy.example.com:3128"},
+		// In-cluster endpoints excluded by CIDR and domain are not proxied.
+		{url: "https://10.152.183.1:443"},
+		{url: "https://10.1.2.3:6443"},
+		{url: "https://kubernetes.default.svc.cluster.local"},
+	} {
+		c.Logf("test %d: %s", i, t.url)
+		req, err := http.NewRequest("GET", t.url, nil)
+		c.Assert(err, jc.ErrorIsNil)
+		proxyURL, err := transport.Proxy(req)
+		c.Assert(err, jc.ErrorIsNil)
+		if t.proxy == "" {
+			c.Check(proxyURL, gc.IsNil)
+		} else {
+			c.Check(proxyURL.String(), gc.Equals, t.proxy)
+		}
+	}
+}
+
 var basicPodspec = &caas.PodSpec{
 	Containers: []caas.ContainerSpec{{
 		Name:         "test",
@@ -113,6 +536,7 @@ var basicPodspec = &caas.PodSpec{
 }
 
 var operatorPodspec = core.PodSpec{
+	RestartPolicy: core.RestartPolicyAlways,
 	Containers: []core.Container{{
 		Name:            "juju-operator",
 		ImagePullPolicy: core.PullIfNotPresent,
@@ -128,6 +552,17 @@ var operatorPodspec = core.PodSpec{
 			Name:      "test-operator-volume",
 			MountPath: "path/to/agent/agents",
 		}},
+		LivenessProbe: &core.Probe{
+			Handler: core.Handler{
+				Exec: &core.ExecAction{
+					Command: []string{"path/to/agent/tools/juju-introspect", "--agent=application-test", "depengine"},
+				},
+			},
+			InitialDelaySeconds: 30,
+			PeriodSeconds:       30,
+			TimeoutSeconds:      10,
+			FailureThreshold:    3,
+		},
 	}},
 	Volumes: []core.Volume{{
 		Name: "juju-operator-test-config-volume",
@@ -161,6 +596,21 @@ var basicServiceArg = &core.Service{
 	},
 }
 
+// expectNoContainerServices expects the application's services to be
+// listed when checking for per container services to remove.
+func (s *K8sBrokerSuite) expectNoContainerServices(appName string) *gomock.Call {
+	return s.mockServices.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==" + appName}).Times(1).
+		Return(&core.ServiceList{}, nil)
+}
+
+// withSpecHash sets the annotation recording the hash of
+// the deployment's spec, as EnsureService does.
+func withSpecHash(c *gc.C, deployment *appsv1.Deployment) {
+	hash, err := provider.DeploymentSpecHash(deployment)
+	c.Assert(err, jc.ErrorIsNil)
+	deployment.Annotations = map[string]string{"juju-spec-hash": hash}
+}
+
 func (s *K8sBrokerSuite) secretArg(c *gc.C, labels map[string]string) *core.Secret {
 	secretData, err := provider.CreateDockerConfigJSON(&basicPodspec.Containers[0].ImageDetails)
 	c.Assert(err, jc.ErrorIsNil)
@@ -180,505 +630,4783 @@ func (s *K8sBrokerSuite) secretArg(c *gc.C, labels map[string]string) *core.Secr
 	return secret
 }
 
-func (s *K8sSuite) TestMakeUnitSpecConfigPairs(c *gc.C) {
-	spec, err := provider.MakeUnitSpec("app-name", basicPodspec)
-	c.Assert(err, jc.ErrorIsNil)
-	c.Assert(provider.PodSpec(spec), jc.DeepEquals, core.PodSpec{
-		ImagePullSecrets: []core.LocalObjectReference{{Name: "juju-app-name-test-secret"}},
-		Containers: []core.Container{
-			{
-				Name:       "test",
-				Image:      "juju/image",
-				Ports:      []core.ContainerPort{{ContainerPort: int32(80), Protocol: core.ProtocolTCP}},
-				Command:    []string{"sh", "-c"},
-				Args:       []string{"doIt", "--debug"},
-				WorkingDir: "/path/to/here",
-				Env: []core.EnvVar{
-					{Name: "bar", Value: "true"},
-					{Name: "foo", Value: "bar"},
-					{Name: "restricted", Value: "yes"},
-					{Name: "switch", Value: "true"},
-				},
-			}, {
-				Name:  "test2",
-				Image: "juju/image2",
-				Ports: []core.ContainerPort{{ContainerPort: int32(8080), Protocol: core.ProtocolTCP, Name: "fred"}},
+func (s *K8sSuite) TestMakeUnitSpecImagePullSecrets(c *gc.C) {
+	podSpec := caas.PodSpec{
+		Containers: []caas.ContainerSpec{{
+			Name:         "test",
+			ImageDetails: caas.ImageDetails{ImagePath: "juju/image", Username: "fred", Password: "secret"},
+		}, {
+			Name:         "test2",
+			ImageDetails: caas.ImageDetails{ImagePath: "juju/image2", Username: "fred", Password: "secret"},
+		}},
+		ProviderPod: &provider.K8sPodSpec{
+			ImagePullSecrets: []core.LocalObjectReference{
+				{Name: "registry"},
+				{Name: "juju-app-name-test2-secret"},
+				{Name: "another-registry"},
+				{Name: "registry"},
 			},
 		},
-	})
+	}
+	for i := 0; i < 2; i++ {
+		spec, err := provider.MakeUnitSpec("app-name", &podSpec)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(provider.PodSpec(spec).ImagePullSecrets, jc.DeepEquals, []core.LocalObjectReference{
+			{Name: "another-registry"},
+			{Name: "juju-app-name-test-secret"},
+			{Name: "juju-app-name-test2-secret"},
+			{Name: "registry"},
+		})
+	}
 }
 
-func (s *K8sSuite) TestOperatorPodConfig(c *gc.C) {
-	tags := map[string]string{
-		"juju-operator": "gitlab",
+func (s *K8sSuite) TestMakeUnitSpecAutoReadinessProbe(c *gc.C) {
+	podSpec := caas.PodSpec{
+		Containers: []caas.ContainerSpec{{
+			Name:               "test",
+			ImageDetails:       caas.ImageDetails{ImagePath: "juju/image"},
+			Ports:              []caas.ContainerPort{{ContainerPort: 8080, Protocol: "TCP"}, {ContainerPort: 9090, Protocol: "TCP"}},
+			AutoReadinessProbe: true,
+		}},
 	}
-	pod := provider.OperatorPod("gitlab", "/var/lib/juju", "jujusolutions/caas-jujud-operator", "2.99.0", tags)
-	c.Assert(pod.Name, gc.Equals, "juju-operator-gitlab")
-	c.Assert(pod.Labels, jc.DeepEquals, map[string]string{
-		"juju-operator": "gitlab",
-		"juju-version":  "2.99.0",
+	spec, err := provider.MakeUnitSpec("app-name", &podSpec)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(provider.PodSpec(spec).Containers[0].ReadinessProbe, jc.DeepEquals, &core.Probe{
+		Handler: core.Handler{
+			TCPSocket: &core.TCPSocketAction{Port: intstr.FromInt(8080)},
+		},
+		InitialDelaySeconds: 10,
+		PeriodSeconds:       10,
 	})
-	c.Assert(pod.Spec.Containers, gc.HasLen, 1)
-	c.Assert(pod.Spec.Containers[0].Image, gc.Equals, "jujusolutions/caas-jujud-operator")
-	c.Assert(pod.Spec.Containers[0].VolumeMounts, gc.HasLen, 1)
-	c.Assert(pod.Spec.Containers[0].VolumeMounts[0].MountPath, gc.Equals, "/var/lib/juju/agents/application-gitlab/template-agent.conf")
-}
 
-type K8sBrokerSuite struct {
-	BaseSuite
+	err = provider.ConfigureAutoProbes(spec, &podSpec, application.ConfigAttributes{
+		"kubernetes-auto-probe-initial-delay": 30,
+		"kubernetes-auto-probe-period":        5,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	probe := provider.PodSpec(spec).Containers[0].ReadinessProbe
+	c.Assert(probe.InitialDelaySeconds, gc.Equals, int32(30))
+	c.Assert(probe.PeriodSeconds, gc.Equals, int32(5))
 }
 
-var _ = gc.Suite(&K8sBrokerSuite{})
-
-func (s *K8sBrokerSuite) TestConfig(c *gc.C) {
-	ctrl := s.setupBroker(c)
-	defer ctrl.Finish()
-	c.Assert(s.broker.Config(), jc.DeepEquals, s.cfg)
+func (s *K8sSuite) TestMakeUnitSpecAutoReadinessProbeDeclaredTwice(c *gc.C) {
+	podSpec := caas.PodSpec{
+		Containers: []caas.ContainerSpec{{
+			Name:               "test",
+			ImageDetails:       caas.ImageDetails{ImagePath: "juju/image"},
+			Ports:              []caas.ContainerPort{{ContainerPort: 8080, Protocol: "TCP"}},
+			AutoReadinessProbe: true,
+			ProviderContainer: &provider.K8sContainerSpec{
+				ReadinessProbe: &core.Probe{
+					Handler: core.Handler{Exec: &core.ExecAction{Command: []string{"true"}}},
+				},
+			},
+		}},
+	}
+	_, err := provider.MakeUnitSpec("app-name", &podSpec)
+	c.Assert(err, gc.ErrorMatches, `readiness probe for container "test" declared twice not valid`)
 }
 
-func (s *K8sBrokerSuite) TestSetConfig(c *gc.C) {
-	ctrl := s.setupBroker(c)
-	defer ctrl.Finish()
-	err := s.broker.SetConfig(s.cfg)
+func (s *K8sSuite) TestConfigureTerminationGrace(c *gc.C) {
+	podSpec := caas.PodSpec{
+		Containers: []caas.ContainerSpec{{
+			Name:         "test",
+			ImageDetails: caas.ImageDetails{ImagePath: "juju/image"},
+		}},
+	}
+	spec, err := provider.MakeUnitSpec("app-name", &podSpec)
+	c.Assert(err, jc.ErrorIsNil)
+	err = provider.ConfigureTerminationGrace(spec, application.ConfigAttributes{
+		"kubernetes-termination-grace-period": 90,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(*provider.PodSpec(spec).TerminationGracePeriodSeconds, gc.Equals, int64(90))
+
+	// The pod spec's own grace period takes precedence.
+	grace := int64(10)
+	podSpec.ProviderPod = &provider.K8sPodSpec{TerminationGracePeriodSeconds: &grace}
+	spec, err = provider.MakeUnitSpec("app-name", &podSpec)
+	c.Assert(err, jc.ErrorIsNil)
+	err = provider.ConfigureTerminationGrace(spec, application.ConfigAttributes{
+		"kubernetes-termination-grace-period": 90,
+	})
 	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(*provider.PodSpec(spec).TerminationGracePeriodSeconds, gc.Equals, int64(10))
 }
 
-func (s *K8sBrokerSuite) TestEnsureNamespace(c *gc.C) {
-	ctrl := s.setupBroker(c)
-	defer ctrl.Finish()
+func (s *K8sSuite) TestMakeUnitSpecReadinessGates(c *gc.C) {
+	podSpec := caas.PodSpec{
+		Containers: []caas.ContainerSpec{{
+			Name:         "test",
+			ImageDetails: caas.ImageDetails{ImagePath: "juju/image"},
+		}},
+		ProviderPod: &provider.K8sPodSpec{
+			ReadinessGates: []core.PodReadinessGate{
+				{ConditionType: "target-health.alb.ingress.k8s.aws/load-balancer"},
+			},
+		},
+	}
+	spec, err := provider.MakeUnitSpec("app-name", &podSpec)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(provider.PodSpec(spec).ReadinessGates, jc.DeepEquals, []core.PodReadinessGate{
+		{ConditionType: "target-health.alb.ingress.k8s.aws/load-balancer"},
+	})
 
-	ns := &core.Namespace{ObjectMeta: v1.ObjectMeta{Name: "test"}}
-	gomock.InOrder(
-		s.mockNamespaces.EXPECT().Update(ns).Times(1).
-			Return(nil, s.k8sNotFoundError()),
-		s.mockNamespaces.EXPECT().Create(ns).Times(1),
-		// Idempotent check.
-		s.mockNamespaces.EXPECT().Update(ns).Times(1),
-	)
+	podSpec.ProviderPod = &provider.K8sPodSpec{
+		ReadinessGates: []core.PodReadinessGate{{ConditionType: " "}},
+	}
+	_, err = provider.MakeUnitSpec("app-name", &podSpec)
+	c.Assert(err, gc.ErrorMatches, "readiness gate with empty condition type not valid")
+}
 
-	err := s.broker.EnsureNamespace()
+func (s *K8sSuite) TestMakeUnitSpecPodLabels(c *gc.C) {
+	podSpec := caas.PodSpec{
+		Containers: []caas.ContainerSpec{{
+			Name:         "test",
+			ImageDetails: caas.ImageDetails{ImagePath: "juju/image"},
+		}},
+		ProviderPod: &provider.K8sPodSpec{
+			PodLabels: map[string]string{"team": "storage", "tier": "backend"},
+		},
+	}
+	spec, err := provider.MakeUnitSpec("app-name", &podSpec)
 	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(provider.UnitSpecLabels(spec), jc.DeepEquals, map[string]string{"team": "storage", "tier": "backend"})
 
-	// Check idempotent.
-	err = s.broker.EnsureNamespace()
+	podSpec.ProviderPod = &provider.K8sPodSpec{
+		PodLabels: map[string]string{"juju-application": "other"},
+	}
+	_, err = provider.MakeUnitSpec("app-name", &podSpec)
+	c.Assert(err, gc.ErrorMatches, `pod label "juju-application" used by the selector not valid`)
+}
+
+func (s *K8sSuite) TestMakeUnitSpecRuntimeClassName(c *gc.C) {
+	runtimeClass := "gvisor"
+	podSpec := caas.PodSpec{
+		Containers: []caas.ContainerSpec{{
+			Name:         "test",
+			ImageDetails: caas.ImageDetails{ImagePath: "juju/image"},
+		}},
+		ProviderPod: &provider.K8sPodSpec{RuntimeClassName: &runtimeClass},
+	}
+	spec, err := provider.MakeUnitSpec("app-name", &podSpec)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(provider.PodSpec(spec).RuntimeClassName, gc.NotNil)
+	c.Assert(*provider.PodSpec(spec).RuntimeClassName, gc.Equals, "gvisor")
+
+	invalid := "Kata_Containers"
+	podSpec.ProviderPod = &provider.K8sPodSpec{RuntimeClassName: &invalid}
+	_, err = provider.MakeUnitSpec("app-name", &podSpec)
+	c.Assert(err, gc.ErrorMatches, `runtimeClassName "Kata_Containers" not valid`)
+
+	// The cluster's default runtime is used if none is specified.
+	podSpec.ProviderPod = &provider.K8sPodSpec{}
+	spec, err = provider.MakeUnitSpec("app-name", &podSpec)
 	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(provider.PodSpec(spec).RuntimeClassName, gc.IsNil)
 }
 
-func (s *K8sBrokerSuite) TestGetNamespace(c *gc.C) {
+func (s *K8sSuite) TestPodTemplateLabels(c *gc.C) {
+	labels := map[string]string{"juju-application": "app-name", "fred": "mary"}
+	c.Assert(provider.PodTemplateLabels(labels, nil), jc.DeepEquals, labels)
+	c.Assert(provider.PodTemplateLabels(labels, map[string]string{"team": "storage", "fred": "jane"}), jc.DeepEquals,
+		map[string]string{"juju-application": "app-name", "fred": "mary", "team": "storage"})
+	// The labels passed in are not modified.
+	c.Assert(labels, jc.DeepEquals, map[string]string{"juju-application": "app-name", "fred": "mary"})
+}
+
+func (s *K8sSuite) TestConfigureSpreadReplicas(c *gc.C) {
+	podSpec := caas.PodSpec{
+		Containers: []caas.ContainerSpec{{
+			Name:         "test",
+			ImageDetails: caas.ImageDetails{ImagePath: "juju/image"},
+		}},
+	}
+	term := core.PodAffinityTerm{
+		LabelSelector: &v1.LabelSelector{
+			MatchLabels: map[string]string{"juju-application": "app-name"},
+		},
+		TopologyKey: "kubernetes.io/hostname",
+	}
+
+	spec, err := provider.MakeUnitSpec("app-name", &podSpec)
+	c.Assert(err, jc.ErrorIsNil)
+	provider.ConfigureSpreadReplicas("app-name", spec, application.ConfigAttributes{})
+	c.Assert(provider.PodSpec(spec).Affinity, gc.IsNil)
+
+	provider.ConfigureSpreadReplicas("app-name", spec, application.ConfigAttributes{
+		"kubernetes-spread-replicas": true,
+	})
+	c.Assert(provider.PodSpec(spec).Affinity, jc.DeepEquals, &core.Affinity{
+		PodAntiAffinity: &core.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []core.WeightedPodAffinityTerm{
+				{Weight: 100, PodAffinityTerm: term},
+			},
+		},
+	})
+
+	spec, err = provider.MakeUnitSpec("app-name", &podSpec)
+	c.Assert(err, jc.ErrorIsNil)
+	provider.ConfigureSpreadReplicas("app-name", spec, application.ConfigAttributes{
+		"kubernetes-spread-replicas":          true,
+		"kubernetes-spread-replicas-required": true,
+	})
+	c.Assert(provider.PodSpec(spec).Affinity, jc.DeepEquals, &core.Affinity{
+		PodAntiAffinity: &core.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []core.PodAffinityTerm{term},
+		},
+	})
+}
+
+func (s *K8sSuite) TestPodPortsInternal(c *gc.C) {
+	podSpec := caas.PodSpec{
+		Containers: []caas.ContainerSpec{{
+			Name:         "test",
+			ImageDetails: caas.ImageDetails{ImagePath: "juju/image"},
+			Ports: []caas.ContainerPort{
+				{ContainerPort: 80, Protocol: "TCP"},
+				{ContainerPort: 6060, Protocol: "TCP", Name: "debug", Internal: true},
+			},
+		}, {
+			Name:         "metrics",
+			ImageDetails: caas.ImageDetails{ImagePath: "juju/metrics"},
+			Ports: []caas.ContainerPort{
+				{ContainerPort: 9100, Protocol: "TCP", Internal: true},
+			},
+		}},
+	}
+	spec, err := provider.MakeUnitSpec("app-name", &podSpec)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(provider.PodPorts(provider.PodSpec(spec).Containers, podSpec.Containers), jc.DeepEquals, []core.ContainerPort{
+		{ContainerPort: 80, Protocol: "TCP"},
+	})
+	// Internal ports are still exposed by the containers.
+	c.Assert(provider.PodSpec(spec).Containers[0].Ports, gc.HasLen, 2)
+	c.Assert(provider.PodSpec(spec).Containers[1].Ports, gc.HasLen, 1)
+}
+
+func (s *K8sSuite) TestMakeUnitSpecConfigPairs(c *gc.C) {
+	spec, err := provider.MakeUnitSpec("app-name", basicPodspec)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(provider.PodSpec(spec), jc.DeepEquals, core.PodSpec{
+		ImagePullSecrets: []core.LocalObjectReference{{Name: "juju-app-name-test-secret"}},
+		Containers: []core.Container{
+			{
+				Name:       "test",
+				Image:      "juju/image",
+				Ports:      []core.ContainerPort{{ContainerPort: int32(80), Protocol: core.ProtocolTCP}},
+				Command:    []string{"sh", "-c"},
+				Args:       []string{"doIt", "--debug"},
+				WorkingDir: "/path/to/here",
+				Env: []core.EnvVar{
+					{Name: "bar", Value: "true"},
+					{Name: "foo", Value: "bar"},
+					{Name: "restricted", Value: "yes"},
+					{Name: "switch", Value: "true"},
+				},
+			}, {
+				Name:  "test2",
+				Image: "juju/image2",
+				Ports: []core.ContainerPort{{ContainerPort: int32(8080), Protocol: core.ProtocolTCP, Name: "fred"}},
+			},
+		},
+	})
+}
+
+func (s *K8sSuite) TestOperatorPodConfig(c *gc.C) {
+	tags := map[string]string{
+		"juju-operator": "gitlab",
+	}
+	pod := provider.OperatorPod("gitlab", "/var/lib/juju", "jujusolutions/caas-jujud-operator", "2.99.0", tags)
+	c.Assert(pod.Name, gc.Equals, "juju-operator-gitlab")
+	c.Assert(pod.Labels, jc.DeepEquals, map[string]string{
+		"juju-operator": "gitlab",
+		"juju-version":  "2.99.0",
+	})
+	c.Assert(pod.Spec.RestartPolicy, gc.Equals, core.RestartPolicyAlways)
+	c.Assert(pod.Spec.Containers, gc.HasLen, 1)
+	c.Assert(pod.Spec.Containers[0].Image, gc.Equals, "jujusolutions/caas-jujud-operator")
+	c.Assert(pod.Spec.Containers[0].VolumeMounts, gc.HasLen, 1)
+	c.Assert(pod.Spec.Containers[0].VolumeMounts[0].MountPath, gc.Equals, "/var/lib/juju/agents/application-gitlab/template-agent.conf")
+}
+
+func (s *K8sSuite) TestOperatorContainerDefaultLivenessProbe(c *gc.C) {
+	pod := provider.OperatorPod("gitlab", "/var/lib/juju", "jujusolutions/caas-jujud-operator", "2.99.0", nil)
+	err := provider.ConfigureOperatorContainer(&pod.Spec.Containers[0], "/var/lib/juju", "gitlab", &caas.OperatorConfig{
+		Version: version.MustParse("2.99.0"),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	probe := pod.Spec.Containers[0].LivenessProbe
+	c.Assert(probe, gc.NotNil)
+	c.Assert(probe.Exec, gc.NotNil)
+	c.Assert(probe.Exec.Command, jc.DeepEquals, []string{
+		"/var/lib/juju/tools/juju-introspect", "--agent=application-gitlab", "depengine",
+	})
+}
+
+func (s *K8sSuite) TestOperatorContainerNoDefaultLivenessProbe(c *gc.C) {
+	for i, config := range []caas.OperatorConfig{{
+		// The operator is too old to link juju-introspect.
+		Version: version.MustParse("2.5.4"),
+	}, {
+		// The version of the operator isn't known.
+	}, {
+		// A custom image doesn't run jujud.
+		Version: version.MustParse("2.99.0"),
+		Command: []string{"/opt/operator"},
+	}} {
+		c.Logf("test %d", i)
+		pod := provider.OperatorPod("gitlab", "/var/lib/juju", "jujusolutions/caas-jujud-operator", "2.99.0", nil)
+		err := provider.ConfigureOperatorContainer(&pod.Spec.Containers[0], "/var/lib/juju", "gitlab", &config)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(pod.Spec.Containers[0].LivenessProbe, gc.IsNil)
+	}
+}
+
+func (s *K8sSuite) TestConfigureOperatorAnnotations(c *gc.C) {
+	pod := provider.OperatorPod("gitlab", "/var/lib/juju", "jujusolutions/caas-jujud-operator", "2.99.0", nil)
+	err := provider.ConfigureOperatorAnnotations(pod, map[string]string{
+		"sidecar.istio.io/inject": "false",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(pod.Annotations, jc.DeepEquals, map[string]string{
+		"sidecar.istio.io/inject": "false",
+	})
+	c.Assert(pod.Labels, jc.DeepEquals, map[string]string{
+		"juju-version": "2.99.0",
+	})
+}
+
+func (s *K8sSuite) TestConfigureOperatorAnnotationsReserved(c *gc.C) {
+	pod := provider.OperatorPod("gitlab", "/var/lib/juju", "jujusolutions/caas-jujud-operator", "2.99.0", nil)
+	err := provider.ConfigureOperatorAnnotations(pod, map[string]string{
+		"juju-stopped-replicas": "3",
+	})
+	c.Assert(err, gc.ErrorMatches, `operator pod annotation "juju-stopped-replicas" reserved for Juju not valid`)
+	c.Assert(pod.Annotations, gc.HasLen, 0)
+}
+
+func (s *K8sSuite) TestPersistentVolumeSource(c *gc.C) {
+	for i, t := range []struct {
+		source core.PersistentVolumeSource
+		kind   string
+		handle string
+	}{{
+		source: core.PersistentVolumeSource{
+			CSI: &core.CSIPersistentVolumeSource{Driver: "ebs.csi.aws.com", VolumeHandle: "vol-0123"},
+		},
+		kind:   "csi",
+		handle: "vol-0123",
+	}, {
+		source: core.PersistentVolumeSource{
+			GCEPersistentDisk: &core.GCEPersistentDiskVolumeSource{PDName: "disk-1"},
+		},
+		kind:   "gcePersistentDisk",
+		handle: "disk-1",
+	}, {
+		source: core.PersistentVolumeSource{
+			NFS: &core.NFSVolumeSource{Server: "10.0.0.1", Path: "/exports/data"},
+		},
+		kind:   "nfs",
+		handle: "10.0.0.1:/exports/data",
+	}, {
+		source: core.PersistentVolumeSource{
+			FC: &core.FCVolumeSource{WWIDs: []string{"3600508b400105e210000900000490000"}},
+		},
+	}} {
+		c.Logf("test %d", i)
+		pv := &core.PersistentVolume{Spec: core.PersistentVolumeSpec{PersistentVolumeSource: t.source}}
+		kind, handle := provider.PersistentVolumeSource(pv)
+		c.Check(kind, gc.Equals, t.kind)
+		c.Check(handle, gc.Equals, t.handle)
+	}
+}
+
+type K8sBrokerSuite struct {
+	BaseSuite
+}
+
+var _ = gc.Suite(&K8sBrokerSuite{})
+
+func (s *K8sBrokerSuite) TestConfig(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+	c.Assert(s.broker.Config(), jc.DeepEquals, s.cfg)
+}
+
+func (s *K8sBrokerSuite) TestSetConfig(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+	err := s.broker.SetConfig(s.cfg)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestDefaultStorageClass(c *gc.C) {
 	ctrl := s.setupBroker(c)
 	defer ctrl.Finish()
 
-	ns := &core.Namespace{ObjectMeta: v1.ObjectMeta{Name: "test"}}
 	gomock.InOrder(
-		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
-			Return(ns, nil),
+		s.mockStorageClass.EXPECT().List(v1.ListOptions{}).Times(1).
+			Return(&storagev1.StorageClassList{Items: []storagev1.StorageClass{{
+				ObjectMeta: v1.ObjectMeta{
+					Name:        "slow",
+					Annotations: map[string]string{"storageclass.kubernetes.io/is-default-class": "false"},
+				},
+			}, {
+				ObjectMeta: v1.ObjectMeta{
+					Name:        "fast",
+					Annotations: map[string]string{"storageclass.kubernetes.io/is-default-class": "true"},
+				},
+				Provisioner: "kubernetes.io/gce-pd",
+				Parameters:  map[string]string{"type": "pd-ssd"},
+			}}}, nil),
 	)
 
-	out, err := s.broker.GetNamespace("test")
+	info, err := s.broker.DefaultStorageClass()
 	c.Assert(err, jc.ErrorIsNil)
-	c.Assert(out, jc.DeepEquals, ns)
+	c.Assert(info, jc.DeepEquals, &caas.StorageClassInfo{
+		Name:        "fast",
+		Provisioner: "kubernetes.io/gce-pd",
+		Parameters:  map[string]string{"type": "pd-ssd"},
+		Default:     true,
+	})
 }
 
-func (s *K8sBrokerSuite) TestGetNamespaceNotFound(c *gc.C) {
+func (s *K8sBrokerSuite) TestDefaultStorageClassNotFound(c *gc.C) {
 	ctrl := s.setupBroker(c)
 	defer ctrl.Finish()
 
 	gomock.InOrder(
-		s.mockNamespaces.EXPECT().Get("unknown-namespace", v1.GetOptions{IncludeUninitialized: true}).Times(1).
-			Return(nil, s.k8sNotFoundError()),
+		s.mockStorageClass.EXPECT().List(v1.ListOptions{}).Times(1).
+			Return(&storagev1.StorageClassList{}, nil),
 	)
 
-	out, err := s.broker.GetNamespace("unknown-namespace")
+	_, err := s.broker.DefaultStorageClass()
 	c.Assert(err, jc.Satisfies, errors.IsNotFound)
-	c.Assert(out, gc.IsNil)
 }
 
-func (s *K8sBrokerSuite) TestNamespaces(c *gc.C) {
+func (s *K8sBrokerSuite) TestStorageClasses(c *gc.C) {
 	ctrl := s.setupBroker(c)
 	defer ctrl.Finish()
 
-	ns1 := core.Namespace{ObjectMeta: v1.ObjectMeta{Name: "test"}}
-	ns2 := core.Namespace{ObjectMeta: v1.ObjectMeta{Name: "test2"}}
+	reclaimPolicy := core.PersistentVolumeReclaimRetain
+	bindingMode := storagev1.VolumeBindingWaitForFirstConsumer
 	gomock.InOrder(
-		s.mockNamespaces.EXPECT().List(v1.ListOptions{IncludeUninitialized: true}).Times(1).
-			Return(&core.NamespaceList{Items: []core.Namespace{ns1, ns2}}, nil),
+		s.mockStorageClass.EXPECT().List(v1.ListOptions{}).Times(1).
+			Return(&storagev1.StorageClassList{Items: []storagev1.StorageClass{{
+				ObjectMeta: v1.ObjectMeta{
+					Name:        "slow",
+					Annotations: map[string]string{"storageclass.kubernetes.io/is-default-class": "false"},
+				},
+				Provisioner: "kubernetes.io/gce-pd",
+			}, {
+				ObjectMeta: v1.ObjectMeta{
+					Name:        "fast",
+					Annotations: map[string]string{"storageclass.kubernetes.io/is-default-class": "true"},
+				},
+				Provisioner:       "kubernetes.io/gce-pd",
+				Parameters:        map[string]string{"type": "pd-ssd"},
+				ReclaimPolicy:     &reclaimPolicy,
+				VolumeBindingMode: &bindingMode,
+			}}}, nil),
 	)
 
-	result, err := s.broker.Namespaces()
+	info, err := s.broker.StorageClasses()
 	c.Assert(err, jc.ErrorIsNil)
-	c.Assert(result, jc.SameContents, []string{"test", "test2"})
+	c.Assert(info, jc.DeepEquals, []caas.StorageClassInfo{{
+		Name:        "slow",
+		Provisioner: "kubernetes.io/gce-pd",
+	}, {
+		Name:              "fast",
+		Provisioner:       "kubernetes.io/gce-pd",
+		Parameters:        map[string]string{"type": "pd-ssd"},
+		ReclaimPolicy:     "Retain",
+		VolumeBindingMode: "WaitForFirstConsumer",
+		Default:           true,
+	}})
 }
 
-func (s *K8sBrokerSuite) TestDestroy(c *gc.C) {
+func (s *K8sBrokerSuite) TestDefaultVolumeBindingModeMultiZone(c *gc.C) {
 	ctrl := s.setupBroker(c)
 	defer ctrl.Finish()
 
-	ns := &core.Namespace{ObjectMeta: v1.ObjectMeta{Name: "test"}}
-	namespaceWatcher := s.k8sNewFakeWatcher()
-
+	zoneNode := func(name, zone string) core.Node {
+		return core.Node{ObjectMeta: v1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"failure-domain.beta.kubernetes.io/zone": zone},
+		}}
+	}
 	gomock.InOrder(
-		s.mockNamespaces.EXPECT().Watch(
-			v1.ListOptions{
-				FieldSelector:        fields.OneTermEqualSelector("metadata.name", "test").String(),
-				IncludeUninitialized: true,
-			},
-		).
-			Return(namespaceWatcher, nil),
-		s.mockNamespaces.EXPECT().Delete("test", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
-			Return(nil),
-		s.mockStorageClass.EXPECT().DeleteCollection(
-			s.deleteOptions(v1.DeletePropagationForeground),
-			v1.ListOptions{LabelSelector: "juju-model==test"},
-		).Times(1).
-			Return(s.k8sNotFoundError()),
-		// still terminating.
-		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
-			Return(ns, nil),
-		// terminated, not found returned.
-		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
-			Return(nil, s.k8sNotFoundError()),
+		s.mockNodes.EXPECT().List(v1.ListOptions{}).Times(1).
+			Return(&core.NodeList{Items: []core.Node{
+				zoneNode("node1", "us-east1-a"),
+				zoneNode("node2", "us-east1-b"),
+			}}, nil),
 	)
 
-	go func(w *watch.RaceFreeFakeWatcher, clk *testclock.Clock) {
-		for _, f := range []func(runtime.Object){w.Add, w.Modify, w.Delete} {
-			if !w.IsStopped() {
-				clk.WaitAdvance(time.Second, testing.LongWait, 1)
-				f(ns)
-			}
-		}
-	}(namespaceWatcher, s.clock)
-
-	err := s.broker.Destroy(context.NewCloudCallContext())
-	c.Assert(err, jc.ErrorIsNil)
-	c.Assert(workertest.CheckKilled(c, s.watcher), jc.ErrorIsNil)
-	c.Assert(namespaceWatcher.IsStopped(), jc.IsTrue)
+	mode := provider.DefaultVolumeBindingMode(s.broker)
+	c.Assert(mode, gc.NotNil)
+	c.Assert(*mode, gc.Equals, storagev1.VolumeBindingWaitForFirstConsumer)
 }
 
-func (s *K8sBrokerSuite) TestDeleteOperator(c *gc.C) {
+func (s *K8sBrokerSuite) TestDefaultVolumeBindingModeSingleZone(c *gc.C) {
 	ctrl := s.setupBroker(c)
 	defer ctrl.Finish()
 
-	// Delete operations below return a not found to ensure it's treated as a no-op.
 	gomock.InOrder(
-		s.mockConfigMaps.EXPECT().Delete("juju-operator-test-config", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
-			Return(s.k8sNotFoundError()),
-		s.mockConfigMaps.EXPECT().Delete("juju-test-configurations-config", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
-			Return(s.k8sNotFoundError()),
-		s.mockStatefulSets.EXPECT().Delete("juju-operator-test", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
-			Return(s.k8sNotFoundError()),
-		s.mockPods.EXPECT().List(v1.ListOptions{LabelSelector: "juju-operator==test"}).
-			Return(&core.PodList{Items: []core.Pod{{
-				Spec: core.PodSpec{
-					Containers: []core.Container{{
-						Name:         "jujud",
-						VolumeMounts: []core.VolumeMount{{Name: "test-operator-volume"}},
-					}},
-					Volumes: []core.Volume{{
-						Name: "test-operator-volume", VolumeSource: core.VolumeSource{
-							PersistentVolumeClaim: &core.PersistentVolumeClaimVolumeSource{
-								ClaimName: "test-operator-volume"}},
-					}},
+		s.mockNodes.EXPECT().List(v1.ListOptions{}).Times(1).
+			Return(&core.NodeList{Items: []core.Node{{
+				ObjectMeta: v1.ObjectMeta{
+					Name:   "node1",
+					Labels: map[string]string{"failure-domain.beta.kubernetes.io/zone": "us-east1-a"},
 				},
+			}, {
+				ObjectMeta: v1.ObjectMeta{Name: "node2"},
 			}}}, nil),
-		s.mockSecrets.EXPECT().Delete("juju-test-jujud-secret", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
-			Return(s.k8sNotFoundError()),
-		s.mockPersistentVolumeClaims.EXPECT().Delete("test-operator-volume", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
-			Return(s.k8sNotFoundError()),
-		s.mockPersistentVolumes.EXPECT().Delete("test-operator-volume", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
-			Return(s.k8sNotFoundError()),
-		s.mockDeployments.EXPECT().Delete("juju-operator-test", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
-			Return(s.k8sNotFoundError()),
 	)
 
-	err := s.broker.DeleteOperator("test")
+	c.Assert(provider.DefaultVolumeBindingMode(s.broker), gc.IsNil)
+}
+
+func (s *K8sBrokerSuite) TestDefaultVolumeBindingModeListNodesError(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockNodes.EXPECT().List(v1.ListOptions{}).Times(1).
+			Return(nil, errors.New("nodes is forbidden")),
+	)
+
+	c.Assert(provider.DefaultVolumeBindingMode(s.broker), gc.IsNil)
+}
+
+func (s *K8sBrokerSuite) TestStorageEndpoint(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+	c.Assert(s.broker.StorageEndpoint(), gc.Equals, "https://storage.example.com")
+}
+
+func (s *K8sBrokerSuite) TestConnectionInfo(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	info, err := s.broker.ConnectionInfo()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(info, jc.DeepEquals, caas.ConnectionInfo{
+		Endpoint:             "some-host",
+		AuthType:             "userpass",
+		Username:             "fred",
+		HasCACertificate:     true,
+		HasPassword:          true,
+		HasClientCertificate: true,
+	})
+
+	cred := cloud.NewCredential(cloud.CertificateAuthType, map[string]string{
+		"ClientCertificateData": "cert-data",
+		"ClientKeyData":         "cert-key",
+	})
+	spec := s.cloudSpec
+	spec.Endpoint = "https://10.0.0.1"
+	spec.Credential = &cred
+	spec.CACertificates = nil
+	err = s.broker.UpdateCredential(spec)
+	c.Assert(err, jc.ErrorIsNil)
+	info, err = s.broker.ConnectionInfo()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(info, jc.DeepEquals, caas.ConnectionInfo{
+		Endpoint:             "https://10.0.0.1",
+		AuthType:             "certificate",
+		HasClientCertificate: true,
+	})
+}
+
+func (s *K8sBrokerSuite) TestUpdateCredential(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	podWatcher := s.k8sNewFakeWatcher()
+	s.mockPods.EXPECT().Watch(v1.ListOptions{LabelSelector: "juju-application==app-name", Watch: true}).Times(1).
+		Return(podWatcher, nil)
+	w, err := s.broker.WatchUnits("app-name")
+	c.Assert(err, jc.ErrorIsNil)
+
+	spec := s.cloudSpec
+	spec.StorageEndpoint = "https://new-storage.example.com"
+	err = s.broker.UpdateCredential(spec)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.broker.StorageEndpoint(), gc.Equals, "https://new-storage.example.com")
+
+	// Running watchers are stopped so they're restarted with the new client.
+	err = workertest.CheckKilled(c, w)
+	c.Assert(err, gc.ErrorMatches, "k8s credential updated, restarting app-name watcher")
+	c.Assert(podWatcher.IsStopped(), jc.IsTrue)
+}
+
+func labelledNamespace() *core.Namespace {
+	return &core.Namespace{ObjectMeta: v1.ObjectMeta{
+		Name: "test",
+		Labels: map[string]string{
+			"juju-model":           "test",
+			"juju-model-uuid":      testing.ModelTag.Id(),
+			"juju-controller-uuid": testing.ControllerTag.Id(),
+		},
+	}}
+}
+
+func (s *K8sBrokerSuite) TestEnsureNamespace(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	ns := labelledNamespace()
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockNamespaces.EXPECT().Create(ns).Times(1),
+		// Idempotent check.
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(ns, nil),
+	)
+
+	err := s.broker.EnsureNamespace()
+	c.Assert(err, jc.ErrorIsNil)
+
+	// Check idempotent.
+	err = s.broker.EnsureNamespace()
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestEnsureNamespaceMergesLabels(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	existing := &core.Namespace{ObjectMeta: v1.ObjectMeta{
+		Name:   "test",
+		Labels: map[string]string{"team": "ops", "juju-model": "other"},
+	}}
+	ns := labelledNamespace()
+	ns.Labels["team"] = "ops"
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(existing, nil),
+		s.mockNamespaces.EXPECT().Update(ns).Times(1),
+	)
+
+	err := s.broker.EnsureNamespace()
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestEnsureNamespaceOwnedByOtherController(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	existing := labelledNamespace()
+	existing.Labels["juju-controller-uuid"] = "deadbeef-0bad-400d-8000-4b1d0d06f00d"
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(existing, nil),
+	)
+
+	err := s.broker.EnsureNamespace()
+	c.Assert(err, jc.Satisfies, errors.IsAlreadyExists)
+	c.Assert(err, gc.ErrorMatches, `namespace "test" is owned by controller "deadbeef-0bad-400d-8000-4b1d0d06f00d", set kubernetes-namespace-takeover to take it over`)
+}
+
+func (s *K8sBrokerSuite) TestEnsureNamespaceTakeover(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	cfg, err := s.cfg.Apply(map[string]interface{}{
+		"kubernetes-namespace-takeover": "true",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	err = s.broker.SetConfig(cfg)
+	c.Assert(err, jc.ErrorIsNil)
+
+	existing := labelledNamespace()
+	existing.Labels["juju-controller-uuid"] = "deadbeef-0bad-400d-8000-4b1d0d06f00d"
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(existing, nil),
+		s.mockNamespaces.EXPECT().Update(labelledNamespace()).Times(1),
+	)
+
+	err = s.broker.EnsureNamespace()
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestGetNamespace(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	ns := &core.Namespace{ObjectMeta: v1.ObjectMeta{Name: "test"}}
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(ns, nil),
+	)
+
+	out, err := s.broker.GetNamespace("test")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(out, jc.DeepEquals, ns)
+}
+
+func (s *K8sBrokerSuite) TestGetNamespaceNotFound(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().Get("unknown-namespace", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+	)
+
+	out, err := s.broker.GetNamespace("unknown-namespace")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	c.Assert(out, gc.IsNil)
+}
+
+func (s *K8sBrokerSuite) TestNamespaces(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	ns1 := core.Namespace{ObjectMeta: v1.ObjectMeta{Name: "test"}}
+	ns2 := core.Namespace{ObjectMeta: v1.ObjectMeta{Name: "test2"}}
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().List(v1.ListOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.NamespaceList{Items: []core.Namespace{ns1, ns2}}, nil),
+	)
+
+	result, err := s.broker.Namespaces()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(result, jc.SameContents, []string{"test", "test2"})
+}
+
+func (s *K8sBrokerSuite) TestListManagedNamespaces(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	ns1 := core.Namespace{ObjectMeta: v1.ObjectMeta{Name: "test"}}
+	ns2 := core.Namespace{ObjectMeta: v1.ObjectMeta{Name: "test2"}}
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().List(v1.ListOptions{
+			LabelSelector:        "juju-controller-uuid==" + testing.ControllerTag.Id(),
+			IncludeUninitialized: true,
+		}).Times(1).
+			Return(&core.NamespaceList{Items: []core.Namespace{ns1, ns2}}, nil),
+	)
+
+	result, err := s.broker.ListManagedNamespaces()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(result, jc.SameContents, []string{"test", "test2"})
+}
+
+func (s *K8sBrokerSuite) TestListManagedNamespacesForbidden(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().List(gomock.Any()).Times(1).
+			Return(nil, s.k8sForbiddenError()),
+	)
+
+	_, err := s.broker.ListManagedNamespaces()
+	c.Assert(err, jc.Satisfies, errors.IsForbidden)
+	c.Assert(err, gc.ErrorMatches, "listing namespaces requires cluster wide permission to list namespaces")
+}
+
+type fakeDiscovery struct {
+	discovery.DiscoveryInterface
+	info       *k8sversion.Info
+	restClient rest.Interface
+}
+
+func (f fakeDiscovery) ServerVersion() (*k8sversion.Info, error) {
+	return f.info, nil
+}
+
+func (f fakeDiscovery) RESTClient() rest.Interface {
+	return f.restClient
+}
+
+// runtimeClassServer returns a server which serves the named runtime
+// classes at the specified API path, and a REST client for it.
+func runtimeClassServer(c *gc.C, apiPath string, names ...string) (*httptest.Server, rest.Interface) {
+	found := set.NewStrings(names...)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		prefix := apiPath + "/runtimeclasses/"
+		if !strings.HasPrefix(req.URL.Path, prefix) || !found.Contains(strings.TrimPrefix(req.URL.Path, prefix)) {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, "{}")
+	}))
+	restClient, err := rest.RESTClientFor(&rest.Config{
+		Host: server.URL,
+		ContentConfig: rest.ContentConfig{
+			GroupVersion:         &schema.GroupVersion{},
+			NegotiatedSerializer: scheme.Codecs,
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return server, restClient
+}
+
+func (s *K8sBrokerSuite) TestServerVersion(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.k8sClient.EXPECT().Discovery().Times(1).
+			Return(fakeDiscovery{info: &k8sversion.Info{GitVersion: "v1.18.3-gke.1", Major: "1", Minor: "18+"}}),
+	)
+
+	v, err := s.broker.ServerVersion()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(v, gc.Equals, version.MustParse("1.18.3"))
+}
+
+func (s *K8sBrokerSuite) TestCheckRuntimeClass(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	// The runtime class is served by an older API version.
+	server, restClient := runtimeClassServer(c, "/apis/node.k8s.io/v1beta1", "gvisor")
+	defer server.Close()
+	s.k8sClient.EXPECT().Discovery().AnyTimes().Return(fakeDiscovery{restClient: restClient})
+
+	err := provider.CheckRuntimeClass(s.broker, "gvisor")
+	c.Assert(err, jc.ErrorIsNil)
+
+	err = provider.CheckRuntimeClass(s.broker, "kata")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	c.Assert(err, gc.ErrorMatches, `runtime class "kata" not found`)
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceRuntimeClassNotFound(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	server, restClient := runtimeClassServer(c, "/apis/node.k8s.io/v1beta1")
+	defer server.Close()
+	s.k8sClient.EXPECT().Discovery().AnyTimes().Return(fakeDiscovery{restClient: restClient})
+
+	runtimeClass := "gvisor"
+	podSpec := *basicPodspec
+	podSpec.ProviderPod = &provider.K8sPodSpec{RuntimeClassName: &runtimeClass}
+	params := &caas.ServiceParams{
+		PodSpec: &podSpec,
+	}
+	statusCallback := func(appName string, settableStatus status.Status, info string, data map[string]interface{}) error {
+		return nil
+	}
+	err := s.broker.EnsureService("app-name", statusCallback, params, 2, nil)
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	c.Assert(err, gc.ErrorMatches, `runtime class "gvisor" not found`)
+}
+
+func (s *K8sBrokerSuite) TestPing(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.Namespace{ObjectMeta: v1.ObjectMeta{Name: "test"}}, nil),
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+	)
+
+	err := s.broker.Ping()
+	c.Assert(err, jc.ErrorIsNil)
+	// A namespace which doesn't exist yet is still a successful ping.
+	err = s.broker.Ping()
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestPingErrors(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sUnauthorizedError()),
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sForbiddenError()),
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, errors.New("dial tcp: connection refused")),
+	)
+
+	err := s.broker.Ping()
+	c.Assert(err, jc.Satisfies, errors.IsUnauthorized)
+	err = s.broker.Ping()
+	c.Assert(err, jc.Satisfies, errors.IsForbidden)
+	err = s.broker.Ping()
+	c.Assert(errors.Cause(err), gc.Equals, caas.ErrUnreachable)
+	c.Assert(err, gc.ErrorMatches, "dial tcp: connection refused: cluster unreachable")
+}
+
+func (s *K8sBrokerSuite) TestDestroy(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	ns := &core.Namespace{ObjectMeta: v1.ObjectMeta{Name: "test"}}
+	namespaceWatcher := s.k8sNewFakeWatcher()
+
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().Watch(
+			v1.ListOptions{
+				FieldSelector:        fields.OneTermEqualSelector("metadata.name", "test").String(),
+				IncludeUninitialized: true,
+			},
+		).
+			Return(namespaceWatcher, nil),
+		s.mockNamespaces.EXPECT().Delete("test", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(nil),
+		s.mockStorageClass.EXPECT().DeleteCollection(
+			s.deleteOptions(v1.DeletePropagationForeground),
+			v1.ListOptions{LabelSelector: "juju-model==test,juju-model-uuid==" + testing.ModelTag.Id()},
+		).Times(1).
+			Return(s.k8sNotFoundError()),
+		// still terminating.
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(ns, nil),
+		// terminated, not found returned.
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+	)
+
+	go func(w *watch.RaceFreeFakeWatcher, clk *testclock.Clock) {
+		for _, f := range []func(runtime.Object){w.Add, w.Modify, w.Delete} {
+			if !w.IsStopped() {
+				clk.WaitAdvance(time.Second, testing.LongWait, 1)
+				f(ns)
+			}
+		}
+	}(namespaceWatcher, s.clock)
+
+	err := s.broker.Destroy(context.NewCloudCallContext())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(workertest.CheckKilled(c, s.watcher), jc.ErrorIsNil)
+	c.Assert(namespaceWatcher.IsStopped(), jc.IsTrue)
+}
+
+func (s *K8sBrokerSuite) TestDestroyKeepStorage(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	cfg, err := s.cfg.Apply(map[string]interface{}{
+		"kubernetes-destroy-keep-storage": "true",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	err = s.broker.SetConfig(cfg)
+	c.Assert(err, jc.ErrorIsNil)
+
+	ns := &core.Namespace{ObjectMeta: v1.ObjectMeta{Name: "test"}}
+	namespaceWatcher := s.k8sNewFakeWatcher()
+
+	pv := &core.PersistentVolume{
+		ObjectMeta: v1.ObjectMeta{Name: "pv-1"},
+		Spec: core.PersistentVolumeSpec{
+			PersistentVolumeReclaimPolicy: core.PersistentVolumeReclaimDelete,
+		},
+	}
+	retained := &core.PersistentVolume{
+		ObjectMeta: v1.ObjectMeta{Name: "pv-1"},
+		Spec: core.PersistentVolumeSpec{
+			PersistentVolumeReclaimPolicy: core.PersistentVolumeReclaimRetain,
+		},
+	}
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().Watch(
+			v1.ListOptions{
+				FieldSelector:        fields.OneTermEqualSelector("metadata.name", "test").String(),
+				IncludeUninitialized: true,
+			},
+		).
+			Return(namespaceWatcher, nil),
+		s.mockPersistentVolumeClaims.EXPECT().List(v1.ListOptions{}).Times(1).
+			Return(&core.PersistentVolumeClaimList{Items: []core.PersistentVolumeClaim{{
+				ObjectMeta: v1.ObjectMeta{Name: "database-0"},
+				Spec:       core.PersistentVolumeClaimSpec{VolumeName: "pv-1"},
+			}, {
+				ObjectMeta: v1.ObjectMeta{Name: "pending-0"},
+			}}}, nil),
+		s.mockPersistentVolumes.EXPECT().Get("pv-1", v1.GetOptions{}).Times(1).
+			Return(pv, nil),
+		s.mockPersistentVolumes.EXPECT().Update(retained).Times(1).
+			Return(retained, nil),
+		s.mockNamespaces.EXPECT().Delete("test", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(nil),
+		s.mockStorageClass.EXPECT().DeleteCollection(
+			s.deleteOptions(v1.DeletePropagationForeground),
+			v1.ListOptions{LabelSelector: "juju-model==test,juju-model-uuid==" + testing.ModelTag.Id()},
+		).Times(1).
+			Return(s.k8sNotFoundError()),
+		// still terminating.
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(ns, nil),
+		// terminated, not found returned.
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+	)
+
+	go func(w *watch.RaceFreeFakeWatcher, clk *testclock.Clock) {
+		for _, f := range []func(runtime.Object){w.Add, w.Modify, w.Delete} {
+			if !w.IsStopped() {
+				clk.WaitAdvance(time.Second, testing.LongWait, 1)
+				f(ns)
+			}
+		}
+	}(namespaceWatcher, s.clock)
+
+	err = s.broker.Destroy(context.NewCloudCallContext())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(namespaceWatcher.IsStopped(), jc.IsTrue)
+}
+
+func (s *K8sBrokerSuite) TestDeleteOperator(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	// Delete operations below return a not found to ensure it's treated as a no-op.
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Delete("juju-operator-test-config", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(s.k8sNotFoundError()),
+		s.mockConfigMaps.EXPECT().Delete("juju-test-configurations-config", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(s.k8sNotFoundError()),
+		s.mockStatefulSets.EXPECT().Delete("juju-operator-test", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(s.k8sNotFoundError()),
+		s.mockPods.EXPECT().List(v1.ListOptions{LabelSelector: "juju-operator==test"}).
+			Return(&core.PodList{Items: []core.Pod{{
+				Spec: core.PodSpec{
+					Containers: []core.Container{{
+						Name:         "jujud",
+						VolumeMounts: []core.VolumeMount{{Name: "test-operator-volume"}},
+					}},
+					Volumes: []core.Volume{{
+						Name: "test-operator-volume", VolumeSource: core.VolumeSource{
+							PersistentVolumeClaim: &core.PersistentVolumeClaimVolumeSource{
+								ClaimName: "test-operator-volume"}},
+					}},
+				},
+			}}}, nil),
+		s.mockSecrets.EXPECT().Delete("juju-test-jujud-secret", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(s.k8sNotFoundError()),
+		s.mockPersistentVolumeClaims.EXPECT().Delete("test-operator-volume", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(s.k8sNotFoundError()),
+		s.mockPersistentVolumes.EXPECT().Delete("test-operator-volume", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Delete("juju-operator-test", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(s.k8sNotFoundError()),
+	)
+
+	err := s.broker.DeleteOperator("test")
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func operatorStatefulSetArg(numUnits int32, scName string) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: v1.ObjectMeta{
+			Name: "juju-operator-test",
+			Labels: map[string]string{
+				"juju-operator": "test",
+				"juju-version":  "2.99.0",
+				"fred":          "mary",
+			}},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &numUnits,
+			Selector: &v1.LabelSelector{
+				MatchLabels: map[string]string{"juju-operator": "test"},
+			},
+			Template: core.PodTemplateSpec{
+				ObjectMeta: v1.ObjectMeta{
+					Labels: map[string]string{
+						"juju-operator": "test",
+						"fred":          "mary",
+						"juju-version":  "2.99.0",
+					},
+				},
+				Spec: operatorPodspec,
+			},
+			VolumeClaimTemplates: []core.PersistentVolumeClaim{{
+				ObjectMeta: v1.ObjectMeta{
+					Name: "test-operator-volume",
+					Labels: map[string]string{
+						"juju-operator": "test",
+						"foo":           "bar",
+					}},
+				Spec: core.PersistentVolumeClaimSpec{
+					StorageClassName: &scName,
+					AccessModes:      []core.PersistentVolumeAccessMode{core.ReadWriteOnce},
+					Resources: core.ResourceRequirements{
+						Requests: core.ResourceList{
+							core.ResourceStorage: resource.MustParse("10Mi"),
+						},
+					},
+				},
+			}},
+			PodManagementPolicy: apps.ParallelPodManagement,
+		},
+	}
+}
+
+// defaultTrackLabels returns the labels of the pods
+// of an application's main deployment.
+func defaultTrackLabels(labels map[string]string) map[string]string {
+	result := map[string]string{"juju-track": "default"}
+	for k, v := range labels {
+		result[k] = v
+	}
+	return result
+}
+
+func unitStatefulSetArg(numUnits int32, scName string, podSpec core.PodSpec) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "juju-app-name",
+			Labels: map[string]string{"juju-application": "app-name"}},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &numUnits,
+			Selector: &v1.LabelSelector{
+				MatchLabels: map[string]string{"juju-application": "app-name"},
+			},
+			Template: core.PodTemplateSpec{
+				ObjectMeta: v1.ObjectMeta{
+					Labels: map[string]string{"juju-application": "app-name"},
+				},
+				Spec: podSpec,
+			},
+			VolumeClaimTemplates: []core.PersistentVolumeClaim{{
+				ObjectMeta: v1.ObjectMeta{
+					Name: "juju-database-0",
+					Labels: map[string]string{
+						"juju-application": "app-name",
+						"foo":              "bar",
+					}},
+				Spec: core.PersistentVolumeClaimSpec{
+					StorageClassName: &scName,
+					AccessModes:      []core.PersistentVolumeAccessMode{core.ReadWriteOnce},
+					Resources: core.ResourceRequirements{
+						Requests: core.ResourceList{
+							core.ResourceStorage: resource.MustParse("100Mi"),
+						},
+					},
+				},
+			}},
+			PodManagementPolicy: apps.ParallelPodManagement,
+		},
+	}
+}
+
+func (s *K8sBrokerSuite) TestEnsureOperator(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	configMapArg := &core.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{
+			Name: "juju-operator-test-config",
+		},
+		Data: map[string]string{
+			"test-agent.conf": "agent-conf-data",
+		},
+	}
+	statefulSetArg := operatorStatefulSetArg(1, "test-juju-operator-storage")
+
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(labelledNamespace(), nil),
+		s.mockConfigMaps.EXPECT().Get("juju-operator-test-config", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockConfigMaps.EXPECT().Update(configMapArg).Times(1),
+		s.mockStorageClass.EXPECT().Get("test-juju-operator-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
+			Return(&storagev1.StorageClass{ObjectMeta: v1.ObjectMeta{Name: "test-juju-operator-storage"}}, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-operator-test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockStatefulSets.EXPECT().Update(statefulSetArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockStatefulSets.EXPECT().Create(statefulSetArg).Times(1).
+			Return(nil, nil),
+	)
+
+	change, err := s.broker.ReconcileOperator("test", "path/to/agent", &caas.OperatorConfig{
+		OperatorImagePath: "/path/to/image",
+		Version:           version.MustParse("2.99.0"),
+		AgentConf:         []byte("agent-conf-data"),
+		ResourceTags:      map[string]string{"fred": "mary"},
+		CharmStorage: caas.CharmStorageParams{
+			Size:         uint64(10),
+			Provider:     "kubernetes",
+			ResourceTags: map[string]string{"foo": "bar"},
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(change, gc.Equals, caas.OperatorCreated)
+}
+
+func setOperatorImage(statefulSet *appsv1.StatefulSet, image string) {
+	containers := make([]core.Container, len(statefulSet.Spec.Template.Spec.Containers))
+	copy(containers, statefulSet.Spec.Template.Spec.Containers)
+	containers[0].Image = image
+	statefulSet.Spec.Template.Spec.Containers = containers
+}
+
+func (s *K8sBrokerSuite) TestEnsureOperatorImageDigestChanged(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	configMapArg := &core.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{
+			Name: "juju-operator-test-config",
+		},
+		Data: map[string]string{
+			"test-agent.conf": "agent-conf-data",
+		},
+	}
+	statefulSetArg := operatorStatefulSetArg(1, "test-juju-operator-storage")
+	setOperatorImage(statefulSetArg, "/path/to/image@sha256:new")
+
+	// The existing operator has the same version label but an older image digest.
+	existing := operatorStatefulSetArg(1, "test-juju-operator-storage")
+	setOperatorImage(existing, "/path/to/image@sha256:old")
+	current := operatorStatefulSetArg(1, "test-juju-operator-storage")
+	setOperatorImage(current, "/path/to/image@sha256:old")
+	updated := operatorStatefulSetArg(1, "test-juju-operator-storage")
+	setOperatorImage(updated, "/path/to/image@sha256:new")
+
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(labelledNamespace(), nil),
+		s.mockConfigMaps.EXPECT().Get("juju-operator-test-config", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockConfigMaps.EXPECT().Update(configMapArg).Times(1),
+		s.mockStorageClass.EXPECT().Get("test-juju-operator-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
+			Return(&storagev1.StorageClass{ObjectMeta: v1.ObjectMeta{Name: "test-juju-operator-storage"}}, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-operator-test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(existing, nil),
+		s.mockStatefulSets.EXPECT().Update(statefulSetArg).Times(1).
+			Return(nil, s.k8sInvalidError()),
+		s.mockStatefulSets.EXPECT().Get("juju-operator-test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(current, nil),
+		s.mockStatefulSets.EXPECT().Update(updated).Times(1).
+			Return(updated, nil),
+	)
+
+	change, err := s.broker.ReconcileOperator("test", "path/to/agent", &caas.OperatorConfig{
+		OperatorImagePath: "/path/to/image@sha256:new",
+		Version:           version.MustParse("2.99.0"),
+		AgentConf:         []byte("agent-conf-data"),
+		ResourceTags:      map[string]string{"fred": "mary"},
+		CharmStorage: caas.CharmStorageParams{
+			Size:         uint64(10),
+			Provider:     "kubernetes",
+			ResourceTags: map[string]string{"foo": "bar"},
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(change, gc.Equals, caas.OperatorRecreated)
+}
+
+func (s *K8sBrokerSuite) TestReconcileOperatorImageDigestChanged(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	configMapArg := &core.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{
+			Name: "juju-operator-test-config",
+		},
+		Data: map[string]string{
+			"test-agent.conf": "agent-conf-data",
+		},
+	}
+	statefulSetArg := operatorStatefulSetArg(1, "test-juju-operator-storage")
+	setOperatorImage(statefulSetArg, "/path/to/image@sha256:new")
+
+	// The existing operator has the same version label but an older
+	// image digest, and its spec can be updated in place.
+	existing := operatorStatefulSetArg(1, "test-juju-operator-storage")
+	setOperatorImage(existing, "/path/to/image@sha256:old")
+	c.Assert(existing.Labels["juju-version"], gc.Equals, statefulSetArg.Labels["juju-version"])
+
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(labelledNamespace(), nil),
+		s.mockConfigMaps.EXPECT().Get("juju-operator-test-config", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockConfigMaps.EXPECT().Update(configMapArg).Times(1),
+		s.mockStorageClass.EXPECT().Get("test-juju-operator-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
+			Return(&storagev1.StorageClass{ObjectMeta: v1.ObjectMeta{Name: "test-juju-operator-storage"}}, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-operator-test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(existing, nil),
+		s.mockStatefulSets.EXPECT().Update(statefulSetArg).Times(1).
+			Return(statefulSetArg, nil),
+	)
+
+	change, err := s.broker.ReconcileOperator("test", "path/to/agent", &caas.OperatorConfig{
+		OperatorImagePath: "/path/to/image@sha256:new",
+		Version:           version.MustParse("2.99.0"),
+		AgentConf:         []byte("agent-conf-data"),
+		ResourceTags:      map[string]string{"fred": "mary"},
+		CharmStorage: caas.CharmStorageParams{
+			Size:         uint64(10),
+			Provider:     "kubernetes",
+			ResourceTags: map[string]string{"foo": "bar"},
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(change, gc.Equals, caas.OperatorRecreated)
+}
+
+func (s *K8sBrokerSuite) TestReconcileOperatorUnchanged(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	configMapArg := &core.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{
+			Name: "juju-operator-test-config",
+		},
+		Data: map[string]string{
+			"test-agent.conf": "agent-conf-data",
+		},
+	}
+	statefulSetArg := operatorStatefulSetArg(1, "test-juju-operator-storage")
+	existing := operatorStatefulSetArg(1, "test-juju-operator-storage")
+	existing.Generation = 2
+
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(labelledNamespace(), nil),
+		s.mockConfigMaps.EXPECT().Get("juju-operator-test-config", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(configMapArg, nil),
+		s.mockConfigMaps.EXPECT().Update(configMapArg).Times(1),
+		s.mockStorageClass.EXPECT().Get("test-juju-operator-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
+			Return(&storagev1.StorageClass{ObjectMeta: v1.ObjectMeta{Name: "test-juju-operator-storage"}}, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-operator-test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(existing, nil),
+		s.mockStatefulSets.EXPECT().Update(statefulSetArg).Times(1).
+			Return(existing, nil),
+	)
+
+	change, err := s.broker.ReconcileOperator("test", "path/to/agent", &caas.OperatorConfig{
+		OperatorImagePath: "/path/to/image",
+		Version:           version.MustParse("2.99.0"),
+		AgentConf:         []byte("agent-conf-data"),
+		ResourceTags:      map[string]string{"fred": "mary"},
+		CharmStorage: caas.CharmStorageParams{
+			Size:         uint64(10),
+			Provider:     "kubernetes",
+			ResourceTags: map[string]string{"foo": "bar"},
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(change, gc.Equals, caas.OperatorUnchanged)
+}
+
+func (s *K8sBrokerSuite) TestReconcileOperatorConfigUpdated(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	configMapArg := &core.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{
+			Name: "juju-operator-test-config",
+		},
+		Data: map[string]string{
+			"test-agent.conf": "agent-conf-data",
+		},
+	}
+	existingConfigMap := &core.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{
+			Name: "juju-operator-test-config",
+		},
+		Data: map[string]string{
+			"test-agent.conf": "old-agent-conf-data",
+		},
+	}
+	statefulSetArg := operatorStatefulSetArg(1, "test-juju-operator-storage")
+	existing := operatorStatefulSetArg(1, "test-juju-operator-storage")
+
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(labelledNamespace(), nil),
+		s.mockConfigMaps.EXPECT().Get("juju-operator-test-config", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(existingConfigMap, nil),
+		s.mockConfigMaps.EXPECT().Update(configMapArg).Times(1),
+		s.mockStorageClass.EXPECT().Get("test-juju-operator-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
+			Return(&storagev1.StorageClass{ObjectMeta: v1.ObjectMeta{Name: "test-juju-operator-storage"}}, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-operator-test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(existing, nil),
+		s.mockStatefulSets.EXPECT().Update(statefulSetArg).Times(1).
+			Return(existing, nil),
+	)
+
+	change, err := s.broker.ReconcileOperator("test", "path/to/agent", &caas.OperatorConfig{
+		OperatorImagePath: "/path/to/image",
+		Version:           version.MustParse("2.99.0"),
+		AgentConf:         []byte("agent-conf-data"),
+		ResourceTags:      map[string]string{"fred": "mary"},
+		CharmStorage: caas.CharmStorageParams{
+			Size:         uint64(10),
+			Provider:     "kubernetes",
+			ResourceTags: map[string]string{"foo": "bar"},
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(change, gc.Equals, caas.OperatorUpdated)
+}
+
+func (s *K8sBrokerSuite) TestEnsureOperatorCustomLivenessProbe(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	probe := &caas.Probe{
+		HTTPGet:       &caas.HTTPGetProbe{Path: "/healthz", Port: 8080},
+		PeriodSeconds: 20,
+	}
+	statefulSetArg := operatorStatefulSetArg(1, "test-juju-operator-storage")
+	containers := make([]core.Container, len(statefulSetArg.Spec.Template.Spec.Containers))
+	copy(containers, statefulSetArg.Spec.Template.Spec.Containers)
+	containers[0].Command = []string{"/opt/jujud", "caasoperator"}
+	containers[0].LivenessProbe = &core.Probe{
+		Handler: core.Handler{
+			HTTPGet: &core.HTTPGetAction{Path: "/healthz", Port: intstr.FromInt(8080)},
+		},
+		PeriodSeconds: 20,
+	}
+	statefulSetArg.Spec.Template.Spec.Containers = containers
+
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(labelledNamespace(), nil),
+		s.mockConfigMaps.EXPECT().Get("juju-operator-test-config", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, nil),
+		s.mockStorageClass.EXPECT().Get("test-juju-operator-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
+			Return(&storagev1.StorageClass{ObjectMeta: v1.ObjectMeta{Name: "test-juju-operator-storage"}}, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-operator-test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockStatefulSets.EXPECT().Update(statefulSetArg).Times(1).
+			Return(nil, nil),
+	)
+
+	err := s.broker.EnsureOperator("test", "path/to/agent", &caas.OperatorConfig{
+		OperatorImagePath: "/path/to/image",
+		Version:           version.MustParse("2.99.0"),
+		ResourceTags:      map[string]string{"fred": "mary"},
+		CharmStorage: caas.CharmStorageParams{
+			Size:         uint64(10),
+			Provider:     "kubernetes",
+			ResourceTags: map[string]string{"foo": "bar"},
+		},
+		Command:       []string{"/opt/jujud", "caasoperator"},
+		LivenessProbe: probe,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestEnsureOperatorAgentConfMountPath(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	statefulSetArg := operatorStatefulSetArg(1, "test-juju-operator-storage")
+	containers := make([]core.Container, len(statefulSetArg.Spec.Template.Spec.Containers))
+	copy(containers, statefulSetArg.Spec.Template.Spec.Containers)
+	mounts := make([]core.VolumeMount, len(containers[0].VolumeMounts))
+	copy(mounts, containers[0].VolumeMounts)
+	mounts[0].MountPath = "/etc/operator/template-agent.conf"
+	containers[0].VolumeMounts = mounts
+	statefulSetArg.Spec.Template.Spec.Containers = containers
+
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(labelledNamespace(), nil),
+		s.mockConfigMaps.EXPECT().Get("juju-operator-test-config", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, nil),
+		s.mockStorageClass.EXPECT().Get("test-juju-operator-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
+			Return(&storagev1.StorageClass{ObjectMeta: v1.ObjectMeta{Name: "test-juju-operator-storage"}}, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-operator-test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockStatefulSets.EXPECT().Update(statefulSetArg).Times(1).
+			Return(nil, nil),
+	)
+
+	err := s.broker.EnsureOperator("test", "path/to/agent", &caas.OperatorConfig{
+		OperatorImagePath: "/path/to/image",
+		Version:           version.MustParse("2.99.0"),
+		ResourceTags:      map[string]string{"fred": "mary"},
+		CharmStorage: caas.CharmStorageParams{
+			Size:         uint64(10),
+			Provider:     "kubernetes",
+			ResourceTags: map[string]string{"foo": "bar"},
+		},
+		AgentConfMountPath: "/etc/operator/template-agent.conf",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestEnsureOperatorConfigFiles(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	configMapArg := &core.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{
+			Name: "juju-operator-test-config",
+		},
+		Data: map[string]string{
+			"test-agent.conf":    "agent-conf-data",
+			"test-logging.yaml":  "level: debug",
+			"test-operator.json": "{}",
+		},
+	}
+	statefulSetArg := operatorStatefulSetArg(1, "test-juju-operator-storage")
+	podSpec := &statefulSetArg.Spec.Template.Spec
+	containers := make([]core.Container, len(podSpec.Containers))
+	copy(containers, podSpec.Containers)
+	// The config files are mounted next to the template agent.conf,
+	// before the charm storage.
+	mounts := containers[0].VolumeMounts
+	containers[0].VolumeMounts = append([]core.VolumeMount{
+		mounts[0], {
+			Name:      "juju-operator-test-config-volume",
+			MountPath: "path/to/agent/agents/application-test/logging.yaml",
+			SubPath:   "logging.yaml",
+		}, {
+			Name:      "juju-operator-test-config-volume",
+			MountPath: "path/to/agent/agents/application-test/operator.json",
+			SubPath:   "operator.json",
+		}}, mounts[1:]...)
+	podSpec.Containers = containers
+	volumes := make([]core.Volume, len(podSpec.Volumes))
+	copy(volumes, podSpec.Volumes)
+	configMapSource := *volumes[0].ConfigMap
+	configMapSource.Items = append(append([]core.KeyToPath(nil), configMapSource.Items...),
+		core.KeyToPath{Key: "test-logging.yaml", Path: "logging.yaml"},
+		core.KeyToPath{Key: "test-operator.json", Path: "operator.json"},
+	)
+	volumes[0].ConfigMap = &configMapSource
+	podSpec.Volumes = volumes
+
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(labelledNamespace(), nil),
+		s.mockConfigMaps.EXPECT().Get("juju-operator-test-config", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockConfigMaps.EXPECT().Update(configMapArg).Times(1),
+		s.mockStorageClass.EXPECT().Get("test-juju-operator-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
+			Return(&storagev1.StorageClass{ObjectMeta: v1.ObjectMeta{Name: "test-juju-operator-storage"}}, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-operator-test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockStatefulSets.EXPECT().Update(statefulSetArg).Times(1).
+			Return(nil, nil),
+	)
+
+	err := s.broker.EnsureOperator("test", "path/to/agent", &caas.OperatorConfig{
+		OperatorImagePath: "/path/to/image",
+		Version:           version.MustParse("2.99.0"),
+		AgentConf:         []byte("agent-conf-data"),
+		ResourceTags:      map[string]string{"fred": "mary"},
+		CharmStorage: caas.CharmStorageParams{
+			Size:         uint64(10),
+			Provider:     "kubernetes",
+			ResourceTags: map[string]string{"foo": "bar"},
+		},
+		ConfigFiles: map[string]string{
+			"operator.json": "{}",
+			"logging.yaml":  "level: debug",
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestEnsureOperatorConfigFileReplacingAgentConf(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(labelledNamespace(), nil),
+	)
+
+	err := s.broker.EnsureOperator("test", "path/to/agent", &caas.OperatorConfig{
+		OperatorImagePath: "/path/to/image",
+		Version:           version.MustParse("2.99.0"),
+		AgentConf:         []byte("agent-conf-data"),
+		CharmStorage: caas.CharmStorageParams{
+			Size:     uint64(10),
+			Provider: "kubernetes",
+		},
+		ConfigFiles: map[string]string{"agent.conf": "other"},
+	})
+	c.Assert(err, gc.ErrorMatches, `configuring test operator: config file "agent.conf" replacing agent.conf not valid`)
+}
+
+func (s *K8sBrokerSuite) TestEnsureOperatorInvalidLivenessProbe(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(labelledNamespace(), nil),
+		s.mockConfigMaps.EXPECT().Get("juju-operator-test-config", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, nil),
+		s.mockStorageClass.EXPECT().Get("test-juju-operator-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
+			Return(&storagev1.StorageClass{ObjectMeta: v1.ObjectMeta{Name: "test-juju-operator-storage"}}, nil),
+	)
+
+	err := s.broker.EnsureOperator("test", "path/to/agent", &caas.OperatorConfig{
+		OperatorImagePath: "/path/to/image",
+		Version:           version.MustParse("2.99.0"),
+		CharmStorage: caas.CharmStorageParams{
+			Size:     uint64(10),
+			Provider: "kubernetes",
+		},
+		LivenessProbe: &caas.Probe{
+			Command: []string{"true"},
+			TCPPort: 8080,
+		},
+	})
+	c.Assert(err, gc.ErrorMatches, `configuring test operator: operator liveness probe: probe with 2 handlers not valid`)
+}
+
+func (s *K8sBrokerSuite) TestEnsureOperatorImagePullSecrets(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	statefulSetArg := operatorStatefulSetArg(1, "test-juju-operator-storage")
+	statefulSetArg.Spec.Template.Spec.ImagePullSecrets = []core.LocalObjectReference{{Name: "registry"}}
+
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(labelledNamespace(), nil),
+		s.mockConfigMaps.EXPECT().Get("juju-operator-test-config", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, nil),
+		s.mockStorageClass.EXPECT().Get("test-juju-operator-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
+			Return(&storagev1.StorageClass{ObjectMeta: v1.ObjectMeta{Name: "test-juju-operator-storage"}}, nil),
+		s.mockSecrets.EXPECT().Get("registry", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.Secret{}, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-operator-test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockStatefulSets.EXPECT().Update(statefulSetArg).Times(1).
+			Return(nil, nil),
+	)
+
+	err := s.broker.EnsureOperator("test", "path/to/agent", &caas.OperatorConfig{
+		OperatorImagePath: "/path/to/image",
+		Version:           version.MustParse("2.99.0"),
+		ResourceTags:      map[string]string{"fred": "mary"},
+		CharmStorage: caas.CharmStorageParams{
+			Size:         uint64(10),
+			Provider:     "kubernetes",
+			ResourceTags: map[string]string{"foo": "bar"},
+		},
+		ImagePullSecrets: []string{"registry"},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestEnsureOperatorNoAgentConfig(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	statefulSetArg := operatorStatefulSetArg(1, "test-juju-operator-storage")
+
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(labelledNamespace(), nil),
+		s.mockConfigMaps.EXPECT().Get("juju-operator-test-config", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, nil),
+		s.mockStorageClass.EXPECT().Get("test-juju-operator-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
+			Return(&storagev1.StorageClass{ObjectMeta: v1.ObjectMeta{Name: "test-juju-operator-storage"}}, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-operator-test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockStatefulSets.EXPECT().Update(statefulSetArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockStatefulSets.EXPECT().Create(statefulSetArg).Times(1).
+			Return(nil, nil),
+	)
+
+	err := s.broker.EnsureOperator("test", "path/to/agent", &caas.OperatorConfig{
+		OperatorImagePath: "/path/to/image",
+		Version:           version.MustParse("2.99.0"),
+		ResourceTags:      map[string]string{"fred": "mary"},
+		CharmStorage: caas.CharmStorageParams{
+			Size:         uint64(10),
+			Provider:     "kubernetes",
+			ResourceTags: map[string]string{"foo": "bar"},
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestEnsureOperatorNoAgentConfigMissingConfigMap(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockNamespaces.EXPECT().Get("test", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(labelledNamespace(), nil),
+		s.mockConfigMaps.EXPECT().Get("juju-operator-test-config", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+	)
+
+	err := s.broker.EnsureOperator("test", "path/to/agent", &caas.OperatorConfig{
+		OperatorImagePath: "/path/to/image",
+		Version:           version.MustParse("2.99.0"),
+		CharmStorage: caas.CharmStorageParams{
+			Size:     uint64(10),
+			Provider: "kubernetes",
+		},
+	})
+	c.Assert(err, gc.ErrorMatches, `config map for "test" should already exist:  "test" not found`)
+}
+
+func (s *K8sBrokerSuite) TestDeleteService(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-test-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-test-owner"}}, nil),
+		s.mockPersistentVolumeClaims.EXPECT().DeleteCollection(s.deleteOptions(v1.DeletePropagationForeground),
+			v1.ListOptions{LabelSelector: "juju-application==test"}).Times(1).
+			Return(nil),
+		s.mockConfigMaps.EXPECT().Delete("juju-test-owner", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(nil),
+		s.mockConfigMaps.EXPECT().DeleteCollection(s.deleteOptions(v1.DeletePropagationForeground),
+			v1.ListOptions{LabelSelector: "juju-application==test"}).Times(1).
+			Return(s.k8sNotFoundError()),
+	)
+
+	err := s.broker.DeleteService("test")
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestDeleteServiceUnowned(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	// Delete operations below return a not found to ensure it's treated as a no-op.
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-test-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Delete("juju-test", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(s.k8sNotFoundError()),
+		s.mockServices.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==test"}).Times(1).
+			Return(&core.ServiceList{Items: []core.Service{{
+				ObjectMeta: v1.ObjectMeta{Name: "juju-test-admin"},
+			}}}, nil),
+		s.mockServices.EXPECT().Delete("juju-test-admin", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(nil),
+		s.mockEndpoints.EXPECT().DeleteCollection(s.deleteOptions(v1.DeletePropagationForeground),
+			v1.ListOptions{LabelSelector: "juju-application==test"}).Times(1).
+			Return(s.k8sNotFoundError()),
+		s.mockNetworkPolicies.EXPECT().Delete("juju-test", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(s.k8sNotFoundError()),
+		s.mockStatefulSets.EXPECT().Delete("juju-test", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Delete("juju-test", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==test"}).Times(1).
+			Return(&appsv1.DeploymentList{Items: []appsv1.Deployment{{
+				ObjectMeta: v1.ObjectMeta{Name: "juju-test-green"},
+			}}}, nil),
+		s.mockDeployments.EXPECT().Delete("juju-test-green", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(nil),
+		s.mockPods.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==test"}).
+			Return(&core.PodList{Items: []core.Pod{}}, nil),
+		s.mockConfigMaps.EXPECT().DeleteCollection(s.deleteOptions(v1.DeletePropagationForeground),
+			v1.ListOptions{LabelSelector: "juju-application==test"}).Times(1).
+			Return(s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==test"}).Times(1).
+			Return(&core.SecretList{Items: []core.Secret{{
+				ObjectMeta: v1.ObjectMeta{Name: "secret"},
+			}}}, nil),
+		s.mockSecrets.EXPECT().Delete("secret", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(s.k8sNotFoundError()),
+	)
+
+	err := s.broker.DeleteService("test")
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestEnsureCustomConfigMap(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	configMapArg := &core.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "test-shared-config",
+			Labels: map[string]string{"juju-application": "test"},
+		},
+		Data: map[string]string{"foo": "bar"},
+	}
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-test-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockConfigMaps.EXPECT().Update(configMapArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockConfigMaps.EXPECT().Create(configMapArg).Times(1).
+			Return(configMapArg, nil),
+	)
+
+	err := s.broker.EnsureCustomConfigMap("test-shared-config",
+		map[string]string{"foo": "bar"}, map[string]string{"juju-application": "test"})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestEnsureCustomConfigMapOwned(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	blockOwnerDeletion := true
+	configMapArg := &core.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "test-shared-config",
+			Labels: map[string]string{"juju-application": "test"},
+			OwnerReferences: []v1.OwnerReference{{
+				APIVersion:         "v1",
+				Kind:               "ConfigMap",
+				Name:               "juju-test-owner",
+				UID:                "owner-uid",
+				BlockOwnerDeletion: &blockOwnerDeletion,
+			}},
+		},
+		Data: map[string]string{"foo": "bar"},
+	}
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-test-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-test-owner", UID: "owner-uid"}}, nil),
+		s.mockConfigMaps.EXPECT().Update(configMapArg).Times(1).
+			Return(configMapArg, nil),
+	)
+
+	err := s.broker.EnsureCustomConfigMap("test-shared-config",
+		map[string]string{"foo": "bar"}, map[string]string{"juju-application": "test"})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestEnsureCustomConfigMapMissingApplicationLabel(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	err := s.broker.EnsureCustomConfigMap("test-shared-config", map[string]string{"foo": "bar"}, nil)
+	c.Assert(err, gc.ErrorMatches, `config map "test-shared-config" without "juju-application" label not valid`)
+}
+
+func (s *K8sBrokerSuite) TestEnsureCustomConfigMapReservedName(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	for _, name := range []string{
+		"juju-test-owner",
+		"juju-operator-test-config",
+		"juju-test-configurations-config",
+		"juju-test-myfiles-config",
+	} {
+		err := s.broker.EnsureCustomConfigMap(name,
+			map[string]string{"foo": "bar"}, map[string]string{"juju-application": "test"})
+		c.Check(err, gc.ErrorMatches, fmt.Sprintf(`config map %q with reserved prefix "juju-" not valid`, name))
+	}
+}
+
+func (s *K8sBrokerSuite) TestEnsureCustomConfigMapNotApplicationScoped(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	for _, name := range []string{"shared-config", "other-shared-config", "test"} {
+		err := s.broker.EnsureCustomConfigMap(name,
+			map[string]string{"foo": "bar"}, map[string]string{"juju-application": "test"})
+		c.Check(err, gc.ErrorMatches, fmt.Sprintf(`config map %q not prefixed with application name "test" not valid`, name))
+	}
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceNoUnits(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	two := int32(2)
+	dc := &apps.Deployment{ObjectMeta: v1.ObjectMeta{Name: "juju-unit-storage"}, Spec: apps.DeploymentSpec{Replicas: &two}}
+	zero := int32(0)
+	emptyDc := dc
+	emptyDc.Spec.Replicas = &zero
+	gomock.InOrder(
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(dc, nil),
+		s.mockDeployments.EXPECT().Update(emptyDc).Times(1).
+			Return(nil, nil),
+	)
+
+	params := &caas.ServiceParams{}
+	err := s.broker.EnsureService("app-name", nil, params, 0, nil)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestScaleServiceToZeroStatefulSet(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	two := int32(2)
+	ss := &apps.StatefulSet{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name"}, Spec: apps.StatefulSetSpec{Replicas: &two}}
+	zero := int32(0)
+	emptySs := *ss
+	emptySs.Spec.Replicas = &zero
+	gomock.InOrder(
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(ss, nil),
+		s.mockStatefulSets.EXPECT().Update(&emptySs).Times(1).
+			Return(nil, nil),
+	)
+
+	err := s.broker.ScaleService("app-name", 0)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestScaleServiceNotFound(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+	)
+
+	err := s.broker.ScaleService("app-name", 2)
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *K8sBrokerSuite) TestScaleServiceNegative(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	err := s.broker.ScaleService("app-name", -1)
+	c.Assert(err, gc.ErrorMatches, "negative scale -1 not valid")
+}
+
+func (s *K8sBrokerSuite) TestStopApplicationDeployment(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	three := int32(3)
+	zero := int32(0)
+	gomock.InOrder(
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&apps.Deployment{
+				ObjectMeta: v1.ObjectMeta{Name: "juju-app-name"},
+				Spec:       apps.DeploymentSpec{Replicas: &three},
+			}, nil),
+		s.mockDeployments.EXPECT().Update(&apps.Deployment{
+			ObjectMeta: v1.ObjectMeta{
+				Name:        "juju-app-name",
+				Annotations: map[string]string{"juju-stopped-replicas": "3"},
+			},
+			Spec: apps.DeploymentSpec{Replicas: &zero},
+		}).Times(1).
+			Return(nil, nil),
+	)
+
+	err := s.broker.StopApplication("app-name")
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestStopApplicationAlreadyStopped(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	zero := int32(0)
+	gomock.InOrder(
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&apps.StatefulSet{
+				ObjectMeta: v1.ObjectMeta{
+					Name:        "juju-app-name",
+					Annotations: map[string]string{"juju-stopped-replicas": "2"},
+				},
+				Spec: apps.StatefulSetSpec{Replicas: &zero},
+			}, nil),
+	)
+
+	err := s.broker.StopApplication("app-name")
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestStartApplicationStatefulSet(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	zero := int32(0)
+	two := int32(2)
+	gomock.InOrder(
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&apps.StatefulSet{
+				ObjectMeta: v1.ObjectMeta{
+					Name:        "juju-app-name",
+					Annotations: map[string]string{"juju-stopped-replicas": "2", "foo": "bar"},
+				},
+				Spec: apps.StatefulSetSpec{Replicas: &zero},
+			}, nil),
+		s.mockStatefulSets.EXPECT().Update(&apps.StatefulSet{
+			ObjectMeta: v1.ObjectMeta{
+				Name:        "juju-app-name",
+				Annotations: map[string]string{"foo": "bar"},
+			},
+			Spec: apps.StatefulSetSpec{Replicas: &two},
+		}).Times(1).
+			Return(nil, nil),
+	)
+
+	err := s.broker.StartApplication("app-name")
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestStartApplicationNotFound(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+	)
+
+	err := s.broker.StartApplication("app-name")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func rollbackDeployment() *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name", UID: "deployment-uid"},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &v1.LabelSelector{
+				MatchLabels: map[string]string{"juju-application": "app-name"},
+			},
+			Template: core.PodTemplateSpec{
+				ObjectMeta: v1.ObjectMeta{Labels: map[string]string{"juju-application": "app-name"}},
+				Spec: core.PodSpec{
+					Containers: []core.Container{{Name: "test", Image: "juju/image:2"}},
+				},
+			},
+		},
+	}
+}
+
+func rollbackReplicaSet(revision, image, owner string) appsv1.ReplicaSet {
+	return appsv1.ReplicaSet{
+		ObjectMeta: v1.ObjectMeta{
+			Name:            "juju-app-name-" + revision,
+			Annotations:     map[string]string{"deployment.kubernetes.io/revision": revision},
+			OwnerReferences: []v1.OwnerReference{{UID: types.UID(owner)}},
+		},
+		Spec: appsv1.ReplicaSetSpec{
+			Template: core.PodTemplateSpec{
+				ObjectMeta: v1.ObjectMeta{Labels: map[string]string{
+					"juju-application":  "app-name",
+					"pod-template-hash": "hash-" + revision,
+				}},
+				Spec: core.PodSpec{
+					Containers: []core.Container{{Name: "test", Image: image}},
+				},
+			},
+		},
+	}
+}
+
+func (s *K8sBrokerSuite) TestRollbackApplication(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	rolledBack := rollbackDeployment()
+	rolledBack.Spec.Template.Spec.Containers[0].Image = "juju/image:1"
+	gomock.InOrder(
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(rollbackDeployment(), nil),
+		s.mockReplicaSets.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application=app-name"}).Times(1).
+			Return(&appsv1.ReplicaSetList{Items: []appsv1.ReplicaSet{
+				rollbackReplicaSet("1", "juju/image:1", "deployment-uid"),
+				rollbackReplicaSet("2", "juju/image:2", "deployment-uid"),
+				rollbackReplicaSet("1", "juju/other", "other-uid"),
+			}}, nil),
+		s.mockDeployments.EXPECT().Update(rolledBack).Times(1).
+			Return(rolledBack, nil),
+	)
+
+	err := s.broker.RollbackApplication("app-name", 1)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestRollbackApplicationRevisionNotRetained(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(rollbackDeployment(), nil),
+		s.mockReplicaSets.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application=app-name"}).Times(1).
+			Return(&appsv1.ReplicaSetList{Items: []appsv1.ReplicaSet{
+				rollbackReplicaSet("4", "juju/image:2", "deployment-uid"),
+				rollbackReplicaSet("3", "juju/image:1", "deployment-uid"),
+			}}, nil),
+	)
+
+	err := s.broker.RollbackApplication("app-name", 1)
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	c.Assert(err, gc.ErrorMatches, `revision 1 of application "app-name" \(retained revisions \[3 4\]\) not found`)
+}
+
+func (s *K8sBrokerSuite) TestRollbackApplicationNotFound(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+	)
+
+	err := s.broker.RollbackApplication("app-name", 1)
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	c.Assert(err, gc.ErrorMatches, `deployment for application "app-name" not found`)
+}
+
+func (s *K8sBrokerSuite) TestUnitsScaledToZero(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockPods.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(&core.PodList{}, nil),
+	)
+
+	units, err := s.broker.Units("app-name")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(units, gc.HasLen, 0)
+}
+
+func (s *K8sBrokerSuite) TestUnitsRunningImage(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	pod := core.Pod{
+		ObjectMeta: v1.ObjectMeta{Name: "app-name-0", UID: "uuid"},
+		Spec: core.PodSpec{
+			Containers: []core.Container{
+				{Name: "test", Image: "juju/image:latest"},
+				{Name: "sidecar", Image: "juju/sidecar"},
+			},
+		},
+		Status: core.PodStatus{
+			Phase: core.PodRunning,
+			ContainerStatuses: []core.ContainerStatus{{
+				Name:    "sidecar",
+				Image:   "juju/sidecar:latest",
+				ImageID: "docker-pullable://juju/sidecar@sha256:0123",
+			}, {
+				Name:    "test",
+				Image:   "juju/image:latest",
+				ImageID: "docker-pullable://juju/image@sha256:4567",
+			}},
+		},
+	}
+	pending := core.Pod{
+		ObjectMeta: v1.ObjectMeta{Name: "app-name-1", UID: "uuid2"},
+		Spec: core.PodSpec{
+			Containers: []core.Container{{Name: "test", Image: "juju/image:latest"}},
+		},
+		Status: core.PodStatus{Phase: core.PodPending},
+	}
+	gomock.InOrder(
+		s.mockPods.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(&core.PodList{Items: []core.Pod{pod, pending}}, nil),
+	)
+
+	units, err := s.broker.Units("app-name")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(units, gc.HasLen, 2)
+	c.Assert(units[0].Image, gc.Equals, "juju/image:latest")
+	c.Assert(units[0].ImageID, gc.Equals, "docker-pullable://juju/image@sha256:4567")
+	c.Assert(units[1].Image, gc.Equals, "juju/image:latest")
+	c.Assert(units[1].ImageID, gc.Equals, "")
+}
+
+func (s *K8sBrokerSuite) TestUnitsIgnoresTrackPods(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	unit := core.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "app-name-0",
+			UID:    "uuid",
+			Labels: map[string]string{"juju-application": "app-name", "juju-track": "default"},
+		},
+		Spec: core.PodSpec{
+			Containers: []core.Container{{Name: "test", Image: "juju/image:latest"}},
+		},
+		Status: core.PodStatus{Phase: core.PodRunning},
+	}
+	track := core.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "app-name-green-0",
+			UID:    "uuid2",
+			Labels: map[string]string{"juju-application": "app-name", "juju-track": "green"},
+		},
+		Spec: core.PodSpec{
+			Containers: []core.Container{{Name: "test", Image: "juju/image:latest"}},
+		},
+		Status: core.PodStatus{Phase: core.PodRunning},
+	}
+	gomock.InOrder(
+		s.mockPods.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(&core.PodList{Items: []core.Pod{unit, track}}, nil),
+	)
+
+	units, err := s.broker.Units("app-name")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(units, gc.HasLen, 1)
+	c.Assert(units[0].Id, gc.Equals, "uuid")
+}
+
+func (s *K8sBrokerSuite) TestUnitsImagePullError(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	pod := core.Pod{
+		ObjectMeta: v1.ObjectMeta{Name: "app-name-0", UID: "uuid"},
+		Spec: core.PodSpec{
+			Containers: []core.Container{{Name: "test", Image: "juju/image:missing"}},
+		},
+		Status: core.PodStatus{
+			Phase: core.PodPending,
+			ContainerStatuses: []core.ContainerStatus{{
+				Name: "test",
+				State: core.ContainerState{
+					Waiting: &core.ContainerStateWaiting{
+						Reason:  "ErrImagePull",
+						Message: "manifest for juju/image:missing not found",
+					},
+				},
+			}},
+		},
+	}
+	gomock.InOrder(
+		s.mockPods.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(&core.PodList{Items: []core.Pod{pod}}, nil),
+	)
+
+	units, err := s.broker.Units("app-name")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(units, gc.HasLen, 1)
+	c.Assert(units[0].Status.Status, gc.Equals, status.Error)
+	c.Assert(units[0].Status.Message, gc.Equals,
+		`container "test" cannot pull image "juju/image:missing": ErrImagePull (manifest for juju/image:missing not found)`)
+}
+
+func (s *K8sBrokerSuite) TestUnitsCrashLoop(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	finished := time.Now().Add(-time.Minute)
+	pod := core.Pod{
+		ObjectMeta: v1.ObjectMeta{Name: "app-name-0", UID: "uuid"},
+		Spec: core.PodSpec{
+			Containers: []core.Container{{Name: "test"}},
+		},
+		Status: core.PodStatus{
+			Phase: core.PodRunning,
+			ContainerStatuses: []core.ContainerStatus{{
+				Name:         "test",
+				RestartCount: 3,
+				State: core.ContainerState{
+					Waiting: &core.ContainerStateWaiting{
+						Reason:  "CrashLoopBackOff",
+						Message: "Back-off 40s restarting failed container",
+					},
+				},
+				LastTerminationState: core.ContainerState{
+					Terminated: &core.ContainerStateTerminated{
+						ExitCode:   137,
+						Reason:     "OOMKilled",
+						FinishedAt: v1.NewTime(finished),
+					},
+				},
+			}},
+		},
+	}
+	gomock.InOrder(
+		s.mockPods.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(&core.PodList{Items: []core.Pod{pod}}, nil),
+	)
+
+	units, err := s.broker.Units("app-name")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(units, gc.HasLen, 1)
+	c.Assert(units[0].Status.Status, gc.Equals, status.Error)
+	c.Assert(units[0].Status.Message, gc.Matches,
+		`container "test" was OOM killed \(exit code 137\), restarted 3 times, last restarted .* ago: `+
+			`CrashLoopBackOff \(Back-off 40s restarting failed container\)`)
+	c.Assert(units[0].Status.Since.Unix(), gc.Equals, finished.Unix())
+}
+
+func (s *K8sBrokerSuite) TestUnitsRunningAfterOOMKilled(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	finished := time.Now().Add(-time.Minute)
+	pod := core.Pod{
+		ObjectMeta: v1.ObjectMeta{Name: "app-name-0", UID: "uuid"},
+		Spec: core.PodSpec{
+			Containers: []core.Container{{Name: "test"}},
+		},
+		Status: core.PodStatus{
+			Phase: core.PodRunning,
+			ContainerStatuses: []core.ContainerStatus{{
+				Name:         "test",
+				RestartCount: 1,
+				State: core.ContainerState{
+					Running: &core.ContainerStateRunning{},
+				},
+				LastTerminationState: core.ContainerState{
+					Terminated: &core.ContainerStateTerminated{
+						ExitCode:   137,
+						Reason:     "OOMKilled",
+						FinishedAt: v1.NewTime(finished),
+					},
+				},
+			}},
+		},
+	}
+	gomock.InOrder(
+		s.mockPods.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(&core.PodList{Items: []core.Pod{pod}}, nil),
+	)
+
+	units, err := s.broker.Units("app-name")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(units, gc.HasLen, 1)
+	c.Assert(units[0].Status.Status, gc.Equals, status.Running)
+	c.Assert(units[0].Status.Message, gc.Matches,
+		`container "test" OOMKilled \(exceeded memory limit\) .* ago, restarted 1 times`)
+	c.Assert(units[0].Status.Since.Unix(), gc.Equals, finished.Unix())
+}
+
+type unitSpecGetter interface {
+	UnitSpec(unitName, providerId string) (*core.PodSpec, error)
+}
+
+func (s *K8sBrokerSuite) TestUnitSpec(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	// The unit's pod is found by its provider id rather than its name.
+	pods := []core.Pod{{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-1", UID: "uuid-0"},
+	}, {
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-7f9c4b8d5-x2x7l", UID: "uuid-1"},
+		Spec: core.PodSpec{
+			Containers: []core.Container{{Name: "test", Image: "juju/image"}},
+		},
+	}}
+	gomock.InOrder(
+		s.mockPods.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(&core.PodList{Items: pods}, nil),
+	)
+
+	spec, err := s.broker.(unitSpecGetter).UnitSpec("app-name/1", "uuid-1")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(spec, jc.DeepEquals, &pods[1].Spec)
+}
+
+func (s *K8sBrokerSuite) TestUnitSpecNotFound(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockPods.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(&core.PodList{Items: []core.Pod{{
+				ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-1", UID: "uuid-0"},
+			}}}, nil),
+	)
+
+	_, err := s.broker.(unitSpecGetter).UnitSpec("app-name/1", "uuid-1")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	c.Assert(err, gc.ErrorMatches, `pod for unit "app-name/1" not found`)
+}
+
+func (s *K8sBrokerSuite) TestUnitSpecInvalidUnitName(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	_, err := s.broker.(unitSpecGetter).UnitSpec("app-name", "uuid-1")
+	c.Assert(err, gc.ErrorMatches, `unit name "app-name" not valid`)
+}
+
+// appliedService returns the service as applied by EnsureService for
+// basicPodspec, with the defaults filled in by Kubernetes.
+func appliedService() *core.Service {
+	return &core.Service{
+		ObjectMeta: v1.ObjectMeta{
+			Name: "juju-app-name",
+			Labels: map[string]string{
+				"juju-application": "app-name",
+				"fred":             "mary",
+			}},
+		Spec: core.ServiceSpec{
+			Selector:  map[string]string{"juju-application": "app-name"},
+			Type:      core.ServiceTypeClusterIP,
+			ClusterIP: "10.1.1.1",
+			Ports: []core.ServicePort{
+				{Port: 80, TargetPort: intstr.FromInt(80), Protocol: "TCP"},
+				{Port: 8080, TargetPort: intstr.FromInt(8080), Protocol: "TCP", Name: "fred"},
+			},
+		},
+	}
+}
+
+// appliedDeployment returns the deployment as applied by
+// EnsureService for basicPodspec.
+func appliedDeployment(c *gc.C, numUnits int32) *appsv1.Deployment {
+	unitSpec, err := provider.MakeUnitSpec("app-name", basicPodspec)
+	c.Assert(err, jc.ErrorIsNil)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: v1.ObjectMeta{
+			Name: "juju-app-name",
+			Labels: map[string]string{
+				"juju-application": "app-name",
+				"fred":             "mary",
+			}},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &numUnits,
+			Selector: &v1.LabelSelector{
+				MatchLabels: map[string]string{"juju-application": "app-name"},
+			},
+			Template: core.PodTemplateSpec{
+				ObjectMeta: v1.ObjectMeta{
+					GenerateName: "juju-app-name-",
+					Labels: map[string]string{
+						"juju-application": "app-name",
+						"juju-track":       "default",
+						"fred":             "mary",
+					},
+				},
+				Spec: provider.PodSpec(unitSpec),
+			},
+		},
+	}
+	withSpecHash(c, deployment)
+	deployment.Annotations["deployment.kubernetes.io/revision"] = "2"
+	return deployment
+}
+
+func (s *K8sBrokerSuite) TestDetectDrift(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	// The service has been switched to another track, and selects
+	// the configured extra labels, neither of which is drift.
+	service := appliedService()
+	service.Labels["team"] = "ops"
+	service.Annotations = map[string]string{"team": "ops"}
+	service.Spec.Selector = map[string]string{"juju-application": "app-name", "juju-track": "blue", "tier": "web"}
+	deployment := appliedDeployment(c, 2)
+	deployment.Spec.Template.Labels["juju-application"] = "other"
+	gomock.InOrder(
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(service, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(deployment, nil),
+	)
+
+	params := &caas.ServiceParams{
+		PodSpec:      basicPodspec,
+		ResourceTags: map[string]string{"fred": "mary"},
+	}
+	drift, err := s.broker.DetectDrift("app-name", params, 2, application.ConfigAttributes{
+		"kubernetes-service-selector": "tier=web",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(drift, jc.DeepEquals, []caas.DriftEntry{{
+		Resource: "service/juju-app-name",
+		Field:    "metadata.annotations.team",
+		Actual:   "ops",
+	}, {
+		Resource: "deployment/juju-app-name",
+		Field:    "spec.template.metadata.labels.juju-application",
+		Expected: "app-name",
+		Actual:   "other",
+	}})
+}
+
+func (s *K8sBrokerSuite) TestDetectDriftGeneratedFields(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	service := appliedService()
+	service.Spec.Type = core.ServiceTypeNodePort
+	service.Spec.Ports[0].TargetPort = intstr.FromInt(8000)
+	service.Spec.Ports[0].NodePort = 30080
+	deployment := appliedDeployment(c, 3)
+	deployment.Spec.Template.Spec.Containers[1].Image = "juju/image2:debug"
+	gomock.InOrder(
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(service, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(deployment, nil),
+	)
+
+	params := &caas.ServiceParams{
+		PodSpec:      basicPodspec,
+		ResourceTags: map[string]string{"fred": "mary"},
+	}
+	drift, err := s.broker.DetectDrift("app-name", params, 2, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(drift, jc.DeepEquals, []caas.DriftEntry{{
+		Resource: "service/juju-app-name",
+		Field:    "spec.type",
+		Expected: "ClusterIP",
+		Actual:   "NodePort",
+	}, {
+		Resource: "service/juju-app-name",
+		Field:    "spec.ports[0]",
+		Expected: ":80/TCP->80",
+		Actual:   ":80/TCP->8000",
+	}, {
+		Resource: "deployment/juju-app-name",
+		Field:    "spec.replicas",
+		Expected: "2",
+		Actual:   "3",
+	}, {
+		Resource: "deployment/juju-app-name",
+		Field:    "spec.template.spec.containers[1].image",
+		Expected: "juju/image2",
+		Actual:   "juju/image2:debug",
+	}})
+}
+
+func (s *K8sBrokerSuite) TestDetectDriftNotFound(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+	)
+
+	params := &caas.ServiceParams{PodSpec: basicPodspec}
+	_, err := s.broker.DetectDrift("app-name", params, 2, nil)
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *K8sBrokerSuite) TestResourceNames(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	resourceNames, err := s.broker.ResourceNames("app-name")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resourceNames, jc.DeepEquals, caas.ResourceNames{
+		Workload:                        "juju-app-name",
+		Service:                         "juju-app-name",
+		Ingress:                         "juju-app-name",
+		ConfigMapPrefix:                 "juju-app-name-",
+		Operator:                        "juju-operator-app-name",
+		OperatorPod:                     "juju-operator-app-name-0",
+		OperatorConfigMap:               "juju-operator-app-name-config",
+		OperatorConfigurationsConfigMap: "juju-app-name-configurations-config",
+	})
+
+	_, err = s.broker.ResourceNames("Bad_Name")
+	c.Assert(err, gc.ErrorMatches, `application name "Bad_Name" not valid`)
+}
+
+func (s *K8sBrokerSuite) TestWaitForApplicationReady(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	two := int32(2)
+	pod := &core.Pod{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-0"}}
+	podWatcher := s.k8sNewFakeWatcher()
+	deploying := &appsv1.Deployment{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &two},
+		Status:     appsv1.DeploymentStatus{AvailableReplicas: 1},
+	}
+	deployed := &appsv1.Deployment{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &two},
+		Status:     appsv1.DeploymentStatus{AvailableReplicas: 2},
+	}
+
+	gomock.InOrder(
+		s.mockPods.EXPECT().Watch(v1.ListOptions{LabelSelector: "juju-application==app-name", Watch: true}).Times(1).
+			Return(podWatcher, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(deploying, nil),
+		s.mockPods.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(&core.PodList{}, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(deployed, nil),
+	)
+
+	go func(w *watch.RaceFreeFakeWatcher, clk *testclock.Clock) {
+		// The initial event, then a pod becoming ready
+		// before the replicas are next polled.
+		clk.WaitAdvance(time.Second, testing.LongWait, 2)
+		w.Modify(pod)
+		clk.WaitAdvance(time.Second, testing.LongWait, 3)
+	}(podWatcher, s.clock)
+
+	err := s.broker.WaitForApplicationReady("app-name", time.Minute)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(workertest.CheckKilled(c, s.watcher), jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestWaitForApplicationReadyTimeout(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	two := int32(2)
+	podWatcher := s.k8sNewFakeWatcher()
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name"},
+		Spec:       appsv1.StatefulSetSpec{Replicas: &two},
+		Status:     appsv1.StatefulSetStatus{ReadyReplicas: 1},
+	}
+
+	checked := make(chan struct{})
+	gomock.InOrder(
+		s.mockPods.EXPECT().Watch(v1.ListOptions{LabelSelector: "juju-application==app-name", Watch: true}).Times(1).
+			Return(podWatcher, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Do(func(string, v1.GetOptions) { close(checked) }).
+			Return(statefulSet, nil),
+		s.mockPods.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(&core.PodList{}, nil),
+	)
+
+	go func(clk *testclock.Clock) {
+		clk.WaitAdvance(time.Second, testing.LongWait, 2)
+		select {
+		case <-checked:
+		case <-time.After(testing.LongWait):
+			c.Errorf("timed out waiting for replicas to be checked")
+			return
+		}
+		// The timeout fires before the replicas are next polled.
+		clk.WaitAdvance(time.Second, testing.LongWait, 2)
+	}(s.clock)
+
+	err := s.broker.WaitForApplicationReady("app-name", 2*time.Second)
+	c.Assert(err, jc.Satisfies, errors.IsTimeout)
+	c.Assert(err, gc.ErrorMatches, `waiting for application "app-name" to be ready after 2s: 1 of 2 replicas ready`)
+	c.Assert(workertest.CheckKilled(c, s.watcher), jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestWaitForApplicationReadyStatusAfterPodEvents(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	two := int32(2)
+	pod := &core.Pod{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-1"}}
+	podWatcher := s.k8sNewFakeWatcher()
+	deploying := &appsv1.Deployment{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &two},
+		Status:     appsv1.DeploymentStatus{AvailableReplicas: 1},
+	}
+	deployed := &appsv1.Deployment{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &two},
+		Status:     appsv1.DeploymentStatus{AvailableReplicas: 2},
+	}
+
+	gomock.InOrder(
+		s.mockPods.EXPECT().Watch(v1.ListOptions{LabelSelector: "juju-application==app-name", Watch: true}).Times(1).
+			Return(podWatcher, nil),
+		// The initial event.
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(deploying, nil),
+		s.mockPods.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(&core.PodList{}, nil),
+		// The last pod becomes ready before the deployment status is updated.
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(deploying, nil),
+		s.mockPods.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(&core.PodList{}, nil),
+		// The deployment status is seen when next polled.
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(deployed, nil),
+	)
+
+	go func(w *watch.RaceFreeFakeWatcher, clk *testclock.Clock) {
+		clk.WaitAdvance(time.Second, testing.LongWait, 2)
+		w.Modify(pod)
+		clk.WaitAdvance(time.Second, testing.LongWait, 3)
+		clk.WaitAdvance(5*time.Second, testing.LongWait, 2)
+	}(podWatcher, s.clock)
+
+	err := s.broker.WaitForApplicationReady("app-name", time.Minute)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(workertest.CheckKilled(c, s.watcher), jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestWaitForApplicationReadyImagePullBackOff(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	two := int32(2)
+	podWatcher := s.k8sNewFakeWatcher()
+	deploying := &appsv1.Deployment{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &two},
+	}
+	pod := core.Pod{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-0"},
+		Spec: core.PodSpec{
+			Containers: []core.Container{{Name: "test", Image: "juju/image:missing"}},
+		},
+		Status: core.PodStatus{
+			Phase: core.PodPending,
+			ContainerStatuses: []core.ContainerStatus{{
+				Name: "test",
+				State: core.ContainerState{
+					Waiting: &core.ContainerStateWaiting{
+						Reason:  "ImagePullBackOff",
+						Message: `Back-off pulling image "juju/image:missing"`,
+					},
+				},
+			}},
+		},
+	}
+
+	gomock.InOrder(
+		s.mockPods.EXPECT().Watch(v1.ListOptions{LabelSelector: "juju-application==app-name", Watch: true}).Times(1).
+			Return(podWatcher, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(deploying, nil),
+		s.mockPods.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(&core.PodList{Items: []core.Pod{pod}}, nil),
+	)
+
+	go func(clk *testclock.Clock) {
+		clk.WaitAdvance(time.Second, testing.LongWait, 2)
+	}(s.clock)
+
+	err := s.broker.WaitForApplicationReady("app-name", time.Minute)
+	c.Assert(err, gc.ErrorMatches, `waiting for application "app-name" to be ready: `+
+		`container "test" cannot pull image "juju/image:missing": ImagePullBackOff \(Back-off pulling image "juju/image:missing"\)`)
+	c.Assert(workertest.CheckKilled(c, s.watcher), jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestOperatorStorageStatus(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	storageClass := "test-juju-operator-storage"
+	pvc := &core.PersistentVolumeClaim{
+		ObjectMeta: v1.ObjectMeta{Name: "test-operator-volume-juju-operator-test-0"},
+		Spec: core.PersistentVolumeClaimSpec{
+			StorageClassName: &storageClass,
+			VolumeName:       "pv-1",
+		},
+		Status: core.PersistentVolumeClaimStatus{Phase: core.ClaimBound},
+	}
+	gomock.InOrder(
+		s.mockPersistentVolumeClaims.EXPECT().Get("test-operator-volume-juju-operator-test-0", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(pvc, nil),
+	)
+
+	info, err := s.broker.OperatorStorageStatus("test")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(info, jc.DeepEquals, caas.StorageInfo{
+		ClaimName:    "test-operator-volume-juju-operator-test-0",
+		Phase:        "Bound",
+		VolumeName:   "pv-1",
+		StorageClass: "test-juju-operator-storage",
+	})
+}
+
+func (s *K8sBrokerSuite) TestOperatorStorageStatusPending(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	pvc := &core.PersistentVolumeClaim{
+		ObjectMeta: v1.ObjectMeta{Name: "test-operator-volume-juju-operator-test-0"},
+		Status: core.PersistentVolumeClaimStatus{
+			Phase: core.ClaimPending,
+			Conditions: []core.PersistentVolumeClaimCondition{{
+				Message: "no persistent volumes available for this claim",
+			}},
+		},
+	}
+	gomock.InOrder(
+		s.mockPersistentVolumeClaims.EXPECT().Get("test-operator-volume-juju-operator-test-0", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(pvc, nil),
+	)
+
+	info, err := s.broker.OperatorStorageStatus("test")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(info, jc.DeepEquals, caas.StorageInfo{
+		ClaimName: "test-operator-volume-juju-operator-test-0",
+		Phase:     "Pending",
+		Message:   "no persistent volumes available for this claim",
+	})
+}
+
+func (s *K8sBrokerSuite) TestOperatorStorageStatusNotFound(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockPersistentVolumeClaims.EXPECT().Get("test-operator-volume-juju-operator-test-0", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+	)
+
+	_, err := s.broker.OperatorStorageStatus("test")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *K8sBrokerSuite) TestOperatorEvents(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	now := time.Now()
+	pod := core.Pod{ObjectMeta: v1.ObjectMeta{Name: "juju-operator-test-0", UID: "pod-uid"}}
+	events := []core.Event{{
+		InvolvedObject: core.ObjectReference{Name: "juju-operator-test-0", UID: "pod-uid"},
+		Type:           "Warning",
+		Reason:         "Failed",
+		Message:        "image pull backoff",
+		LastTimestamp:  v1.NewTime(now),
+	}, {
+		InvolvedObject: core.ObjectReference{Name: "juju-operator-test-0", UID: "old-pod-uid"},
+		Type:           "Normal",
+		Reason:         "Killing",
+		Message:        "stopping container",
+		LastTimestamp:  v1.NewTime(now.Add(-2 * time.Minute)),
+	}, {
+		InvolvedObject: core.ObjectReference{Name: "juju-operator-test-0", UID: "pod-uid"},
+		Type:           "Normal",
+		Reason:         "Scheduled",
+		Message:        "assigned to node",
+		FirstTimestamp: v1.NewTime(now.Add(-time.Minute)),
+	}}
+	gomock.InOrder(
+		s.mockPods.EXPECT().List(v1.ListOptions{LabelSelector: "juju-operator==test"}).Times(1).
+			Return(&core.PodList{Items: []core.Pod{pod}}, nil),
+		s.mockEvents.EXPECT().List(v1.ListOptions{
+			IncludeUninitialized: true,
+			FieldSelector:        "involvedObject.name=juju-operator-test-0",
+		}).Times(1).
+			Return(&core.EventList{Items: events}, nil),
+	)
+
+	result, err := s.broker.OperatorEvents("test")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(result, gc.HasLen, 2)
+	c.Assert(result[0].Reason, gc.Equals, "Scheduled")
+	c.Assert(result[0].Time.Equal(now.Add(-time.Minute)), jc.IsTrue)
+	c.Assert(result[1], jc.DeepEquals, caas.Event{
+		Type:    "Warning",
+		Reason:  "Failed",
+		Message: "image pull backoff",
+		Time:    result[1].Time,
+	})
+	c.Assert(result[1].Time.Equal(now), jc.IsTrue)
+}
+
+func (s *K8sBrokerSuite) TestOperatorEventsNoPod(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockPods.EXPECT().List(v1.ListOptions{LabelSelector: "juju-operator==test"}).Times(1).
+			Return(&core.PodList{}, nil),
+	)
+
+	_, err := s.broker.OperatorEvents("test")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *K8sBrokerSuite) TestUnitsForbidden(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockPods.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(nil, s.k8sForbiddenError()),
+	)
+
+	_, err := s.broker.Units("app-name")
+	c.Assert(err, jc.Satisfies, errors.IsForbidden)
+}
+
+func (s *K8sBrokerSuite) TestServiceForbidden(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockServices.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(nil, s.k8sForbiddenError()),
+	)
+
+	_, err := s.broker.Service("app-name")
+	c.Assert(err, jc.Satisfies, errors.IsForbidden)
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceNoStorage(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	numUnits := int32(2)
+	unitSpec, err := provider.MakeUnitSpec("app-name", basicPodspec)
+	c.Assert(err, jc.ErrorIsNil)
+	podSpec := provider.PodSpec(unitSpec)
+
+	deploymentArg := &appsv1.Deployment{
+		ObjectMeta: v1.ObjectMeta{
+			Name: "juju-app-name",
+			Labels: map[string]string{
+				"juju-application": "app-name",
+				"fred":             "mary",
+			}},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &numUnits,
+			Selector: &v1.LabelSelector{
+				MatchLabels: map[string]string{"juju-application": "app-name"},
+			},
+			Template: core.PodTemplateSpec{
+				ObjectMeta: v1.ObjectMeta{
+					GenerateName: "juju-app-name-",
+					Labels: map[string]string{
+						"juju-application": "app-name",
+						"juju-track":       "default",
+						"fred":             "mary",
+					},
+				},
+				Spec: podSpec,
+			},
+		},
+	}
+	withSpecHash(c, deploymentArg)
+	serviceArg := &core.Service{
+		ObjectMeta: v1.ObjectMeta{
+			Name: "juju-app-name",
+			Labels: map[string]string{
+				"juju-application": "app-name",
+				"fred":             "mary",
+			}},
+		Spec: core.ServiceSpec{
+			Selector: map[string]string{"juju-application": "app-name"},
+			Type:     "nodeIP",
+			Ports: []core.ServicePort{
+				{Port: 80, TargetPort: intstr.FromInt(80), Protocol: "TCP"},
+				{Port: 8080, Protocol: "TCP", Name: "fred"},
+			},
+			LoadBalancerIP: "10.0.0.1",
+			ExternalName:   "ext-name",
+		},
+	}
+
+	secretArg := s.secretArg(c, map[string]string{"fred": "mary"})
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(secretArg).Times(1).
+			Return(nil, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Update(deploymentArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Create(deploymentArg).Times(1).
+			Return(nil, nil),
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Update(serviceArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Create(serviceArg).Times(1).
+			Return(nil, nil),
+		s.expectNoContainerServices("app-name"),
+	)
+
+	params := &caas.ServiceParams{
+		PodSpec:      basicPodspec,
+		ResourceTags: map[string]string{"fred": "mary"},
+	}
+	err = s.broker.EnsureService("app-name", nil, params, 2, application.ConfigAttributes{
+		"kubernetes-service-type":            "nodeIP",
+		"kubernetes-service-loadbalancer-ip": "10.0.0.1",
+		"kubernetes-service-externalname":    "ext-name",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestApplicationStatusDeployment(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	replicas := int32(5)
+	for i, t := range []struct {
+		ready      int32
+		conditions []appsv1.DeploymentCondition
+		status     status.Status
+		message    string
+	}{{
+		ready: 5,
+		conditions: []appsv1.DeploymentCondition{
+			{Type: appsv1.DeploymentAvailable, Status: core.ConditionTrue},
+		},
+		status:  status.Active,
+		message: "5/5 units ready",
+	}, {
+		ready: 3,
+		conditions: []appsv1.DeploymentCondition{
+			{Type: appsv1.DeploymentAvailable, Status: core.ConditionTrue},
+			{Type: appsv1.DeploymentProgressing, Status: core.ConditionTrue, Reason: "ReplicaSetUpdated"},
+		},
+		status:  status.Waiting,
+		message: "3/5 units ready",
+	}, {
+		ready: 3,
+		conditions: []appsv1.DeploymentCondition{
+			{Type: appsv1.DeploymentProgressing, Status: core.ConditionFalse,
+				Reason: "ProgressDeadlineExceeded", Message: "rollout stalled"},
+		},
+		status:  status.Error,
+		message: "rollout stalled",
+	}} {
+		c.Logf("test %d", i)
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&appsv1.Deployment{
+				Spec: appsv1.DeploymentSpec{Replicas: &replicas},
+				Status: appsv1.DeploymentStatus{
+					ReadyReplicas: t.ready,
+					Conditions:    t.conditions,
+				},
+			}, nil)
+		if t.status == status.Active {
+			s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+				Return(&core.Service{Spec: core.ServiceSpec{
+					Selector: map[string]string{"juju-application": "app-name"},
+				}}, nil)
+		}
+		info, err := s.broker.ApplicationStatus("app-name")
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(info.Status, gc.Equals, t.status)
+		c.Check(info.Message, gc.Equals, t.message)
+	}
+}
+
+func (s *K8sBrokerSuite) TestApplicationStatusServiceSelectsNoPods(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	replicas := int32(2)
+	gomock.InOrder(
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&appsv1.Deployment{
+				Spec: appsv1.DeploymentSpec{Replicas: &replicas},
+				Status: appsv1.DeploymentStatus{
+					ReadyReplicas: 2,
+					Conditions: []appsv1.DeploymentCondition{
+						{Type: appsv1.DeploymentAvailable, Status: core.ConditionTrue},
+					},
+				},
+			}, nil),
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.Service{Spec: core.ServiceSpec{
+				Selector: map[string]string{"juju-application": "app-name", "role": "primary"},
+			}}, nil),
+		s.mockPods.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application=app-name,role=primary"}).Times(1).
+			Return(&core.PodList{}, nil),
+	)
+
+	info, err := s.broker.ApplicationStatus("app-name")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(info.Status, gc.Equals, status.Blocked)
+	c.Assert(info.Message, gc.Equals, "service has no endpoints: no pods are labelled role=primary")
+}
+
+func (s *K8sBrokerSuite) TestApplicationStatusScaledToZero(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	// The service's selector would match no pods, but it isn't checked.
+	zero := int32(0)
+	s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+		Return(&appsv1.Deployment{
+			Spec: appsv1.DeploymentSpec{Replicas: &zero},
+			Status: appsv1.DeploymentStatus{
+				Conditions: []appsv1.DeploymentCondition{
+					{Type: appsv1.DeploymentAvailable, Status: core.ConditionTrue},
+				},
+			},
+		}, nil)
+
+	info, err := s.broker.ApplicationStatus("app-name")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(info.Status, gc.Equals, status.Active)
+	c.Assert(info.Message, gc.Equals, "0/0 units ready")
+}
+
+func (s *K8sBrokerSuite) TestApplicationStatusStopped(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	zero := int32(0)
+	gomock.InOrder(
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&appsv1.StatefulSet{
+				ObjectMeta: v1.ObjectMeta{
+					Name:        "juju-app-name",
+					Annotations: map[string]string{"juju-stopped-replicas": "2"},
+				},
+				Spec: appsv1.StatefulSetSpec{Replicas: &zero},
+			}, nil),
+	)
+
+	info, err := s.broker.ApplicationStatus("app-name")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(info.Status, gc.Equals, status.Active)
+	c.Assert(info.Message, gc.Equals, "0/0 units ready")
+}
+
+func (s *K8sBrokerSuite) TestApplicationStatusStatefulSet(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	replicas := int32(2)
+	gomock.InOrder(
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&appsv1.StatefulSet{
+				Spec:   appsv1.StatefulSetSpec{Replicas: &replicas},
+				Status: appsv1.StatefulSetStatus{ReadyReplicas: 1},
+			}, nil),
+	)
+
+	info, err := s.broker.ApplicationStatus("app-name")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(info.Status, gc.Equals, status.Waiting)
+	c.Assert(info.Message, gc.Equals, "1/2 units ready")
+}
+
+func (s *K8sBrokerSuite) TestApplicationStatusNotFound(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+	)
+
+	_, err := s.broker.ApplicationStatus("app-name")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceIdempotent(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	numUnits := int32(2)
+	unitSpec, err := provider.MakeUnitSpec("app-name", basicPodspec)
+	c.Assert(err, jc.ErrorIsNil)
+	podSpec := provider.PodSpec(unitSpec)
+
+	deploymentArg := &appsv1.Deployment{
+		ObjectMeta: v1.ObjectMeta{
+			Name: "juju-app-name",
+			Labels: map[string]string{
+				"juju-application": "app-name",
+				"fred":             "mary",
+			}},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &numUnits,
+			Selector: &v1.LabelSelector{
+				MatchLabels: map[string]string{"juju-application": "app-name"},
+			},
+			Template: core.PodTemplateSpec{
+				ObjectMeta: v1.ObjectMeta{
+					GenerateName: "juju-app-name-",
+					Labels: map[string]string{
+						"juju-application": "app-name",
+						"juju-track":       "default",
+						"fred":             "mary",
+					},
+				},
+				Spec: podSpec,
+			},
+		},
+	}
+	withSpecHash(c, deploymentArg)
+	existingService := &core.Service{
+		ObjectMeta: v1.ObjectMeta{
+			Name:            "juju-app-name",
+			ResourceVersion: "42",
+			Labels:          map[string]string{"juju-application": "app-name"},
+		},
+		Spec: core.ServiceSpec{ClusterIP: "10.1.1.1"},
+	}
+	serviceArg := &core.Service{
+		ObjectMeta: v1.ObjectMeta{
+			Name:            "juju-app-name",
+			ResourceVersion: "42",
+			Labels: map[string]string{
+				"juju-application": "app-name",
+				"fred":             "mary",
+			}},
+		Spec: core.ServiceSpec{
+			Selector: map[string]string{"juju-application": "app-name"},
+			Type:     "nodeIP",
+			Ports: []core.ServicePort{
+				{Port: 80, TargetPort: intstr.FromInt(80), Protocol: "TCP"},
+				{Port: 8080, Protocol: "TCP", Name: "fred"},
+			},
+			ClusterIP: "10.1.1.1",
+		},
+	}
+
+	// The resources as stored by Kubernetes, with defaults filled in.
+	storedService := *serviceArg
+	storedService.Spec.Ports = []core.ServicePort{
+		{Port: 80, TargetPort: intstr.FromInt(80), Protocol: "TCP"},
+		{Port: 8080, TargetPort: intstr.FromInt(8080), Protocol: "TCP", Name: "fred"},
+	}
+
+	// Reconciling the same application a second time
+	// must not create, update or delete any resources.
+	secretArg := s.secretArg(c, map[string]string{"fred": "mary"})
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(secretArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Create(secretArg).Times(1).
+			Return(secretArg, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&appsv1.Deployment{ObjectMeta: v1.ObjectMeta{Labels: map[string]string{"juju-application": "app-name"}}}, nil),
+		s.mockDeployments.EXPECT().Update(deploymentArg).Times(1).
+			Return(deploymentArg, nil),
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(existingService, nil),
+		s.mockServices.EXPECT().Update(serviceArg).Times(1).
+			Return(serviceArg, nil),
+		s.expectNoContainerServices("app-name"),
+
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(secretArg, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(deploymentArg, nil),
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&storedService, nil),
+		s.expectNoContainerServices("app-name"),
+	)
+
+	params := &caas.ServiceParams{
+		PodSpec:      basicPodspec,
+		ResourceTags: map[string]string{"fred": "mary"},
+	}
+	for i := 0; i < 2; i++ {
+		err = s.broker.EnsureService("app-name", nil, params, 2, application.ConfigAttributes{
+			"kubernetes-service-type": "nodeIP",
+		})
+		c.Assert(err, jc.ErrorIsNil)
+	}
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceUnchanged(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	// The existing service matches the desired one once the defaults
+	// and node ports filled in by Kubernetes, and the annotations
+	// added by another controller, are ignored.
+	existingService := &core.Service{
+		ObjectMeta: v1.ObjectMeta{
+			Name:            "juju-app-name",
+			ResourceVersion: "42",
+			Labels:          map[string]string{"juju-application": "app-name"},
+			Annotations:     map[string]string{"cloud.example.com/lb-id": "lb-1"},
+		},
+		Spec: core.ServiceSpec{
+			Selector: map[string]string{"juju-application": "app-name"},
+			Type:     "NodePort",
+			Ports: []core.ServicePort{
+				{Port: 80, TargetPort: intstr.FromInt(80), Protocol: "TCP", NodePort: 30080},
+				{Port: 8080, TargetPort: intstr.FromInt(8080), Protocol: "TCP", Name: "fred", NodePort: 30081},
+			},
+			ClusterIP: "10.1.1.1",
+		},
+	}
+
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(s.secretArg(c, nil)).Times(1).
+			Return(nil, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&appsv1.Deployment{ObjectMeta: v1.ObjectMeta{Labels: map[string]string{"juju-application": "app-name"}}}, nil),
+		s.mockDeployments.EXPECT().Update(gomock.Any()).Times(1).
+			Return(nil, nil),
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(existingService, nil),
+		s.expectNoContainerServices("app-name"),
+	)
+
+	params := &caas.ServiceParams{
+		PodSpec: basicPodspec,
+	}
+	err := s.broker.EnsureService("app-name", nil, params, 2, application.ConfigAttributes{
+		"kubernetes-service-type": "NodePort",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceTopologyAwareHints(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	serviceArg := *basicServiceArg
+	serviceArg.Annotations = map[string]string{"service.kubernetes.io/topology-aware-hints": "auto"}
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(s.secretArg(c, nil)).Times(1).
+			Return(nil, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&appsv1.Deployment{ObjectMeta: v1.ObjectMeta{Labels: map[string]string{"juju-application": "app-name"}}}, nil),
+		s.mockDeployments.EXPECT().Update(gomock.Any()).Times(1).
+			Return(nil, nil),
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Update(&serviceArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Create(&serviceArg).Times(1).
+			Return(nil, nil),
+		s.expectNoContainerServices("app-name"),
+	)
+
+	params := &caas.ServiceParams{
+		PodSpec: basicPodspec,
+	}
+	err := s.broker.EnsureService("app-name", nil, params, 2, application.ConfigAttributes{
+		"kubernetes-service-type":                 "nodeIP",
+		"kubernetes-service-loadbalancer-ip":      "10.0.0.1",
+		"kubernetes-service-externalname":         "ext-name",
+		"kubernetes-service-topology-aware-hints": true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceTrack(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	numUnits := int32(2)
+	unitSpec, err := provider.MakeUnitSpec("app-name", basicPodspec)
+	c.Assert(err, jc.ErrorIsNil)
+	podSpec := provider.PodSpec(unitSpec)
+
+	deploymentArg := &appsv1.Deployment{
+		ObjectMeta: v1.ObjectMeta{
+			Name: "juju-app-name-green",
+			Labels: map[string]string{
+				"juju-application": "app-name",
+				"juju-track":       "green",
+				"fred":             "mary",
+			}},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &numUnits,
+			Selector: &v1.LabelSelector{
+				MatchLabels: map[string]string{"juju-application": "app-name", "juju-track": "green"},
+			},
+			Template: core.PodTemplateSpec{
+				ObjectMeta: v1.ObjectMeta{
+					GenerateName: "juju-app-name-green-",
+					Labels: map[string]string{
+						"juju-application": "app-name",
+						"juju-track":       "green",
+						"fred":             "mary",
+					},
+				},
+				Spec: podSpec,
+			},
+		},
+	}
+	withSpecHash(c, deploymentArg)
+
+	mainDeployment := &appsv1.Deployment{
+		Spec: appsv1.DeploymentSpec{
+			Template: core.PodTemplateSpec{
+				ObjectMeta: v1.ObjectMeta{
+					Labels: map[string]string{"juju-application": "app-name", "juju-track": "default"},
+				},
+			},
+		},
+	}
+	service := core.Service{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name"},
+		Spec: core.ServiceSpec{
+			Selector: map[string]string{"juju-application": "app-name"},
+		},
+	}
+	pinned := &core.Service{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name"},
+		Spec: core.ServiceSpec{
+			Selector: map[string]string{"juju-application": "app-name", "juju-track": "default"},
+		},
+	}
+	secretArg := s.secretArg(c, map[string]string{"fred": "mary"})
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(secretArg).Times(1).
+			Return(nil, nil),
+		// The service is pinned to the main deployment's pods first.
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(mainDeployment, nil),
+		s.mockServices.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(&core.ServiceList{Items: []core.Service{service}}, nil),
+		s.mockServices.EXPECT().Update(pinned).Times(1).
+			Return(pinned, nil),
+		s.mockDeployments.EXPECT().Get("juju-app-name-green", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Update(deploymentArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Create(deploymentArg).Times(1).
+			Return(nil, nil),
+	)
+
+	params := &caas.ServiceParams{
+		PodSpec:      basicPodspec,
+		ResourceTags: map[string]string{"fred": "mary"},
+		Track:        "green",
+	}
+	err = s.broker.EnsureService("app-name", nil, params, 2, application.ConfigAttributes{
+		"kubernetes-service-type": "nodeIP",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceTrackInvalidName(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	params := &caas.ServiceParams{
+		PodSpec: basicPodspec,
+		Track:   "Green!",
+	}
+	statusCallback := func(appName string, settableStatus status.Status, info string, data map[string]interface{}) error {
+		return nil
+	}
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(s.secretArg(c, nil)).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Create(s.secretArg(c, nil)).Times(1).
+			Return(nil, nil),
+		s.mockSecrets.EXPECT().Delete("juju-app-name-test-secret", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(nil),
+	)
+	err := s.broker.EnsureService("app-name", statusCallback, params, 2, nil)
+	c.Assert(err, gc.ErrorMatches, `creating or updating track "Green!": track name "Green!" not valid`)
+}
+
+func (s *K8sBrokerSuite) TestSwitchServiceTrack(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	service := core.Service{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name"},
+		Spec: core.ServiceSpec{
+			Selector: map[string]string{"juju-application": "app-name", "juju-track": "default"},
+		},
+	}
+	endpointsService := core.Service{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-db"},
+	}
+	updated := &core.Service{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name"},
+		Spec: core.ServiceSpec{
+			Selector: map[string]string{"juju-application": "app-name", "juju-track": "green"},
+		},
+	}
+	gomock.InOrder(
+		s.mockDeployments.EXPECT().Get("juju-app-name-green", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&appsv1.Deployment{}, nil),
+		s.mockServices.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(&core.ServiceList{Items: []core.Service{service, endpointsService}}, nil),
+		s.mockServices.EXPECT().Update(updated).Times(1).
+			Return(nil, nil),
+	)
+
+	err := s.broker.SwitchServiceTrack("app-name", "green")
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestSwitchServiceTrackDefault(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	switched := core.Service{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name"},
+		Spec: core.ServiceSpec{
+			Selector: map[string]string{"juju-application": "app-name", "juju-track": "green"},
+		},
+	}
+	// A service which was never switched already selects the main deployment.
+	unswitched := core.Service{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-other"},
+		Spec: core.ServiceSpec{
+			Selector: map[string]string{"juju-application": "app-name"},
+		},
+	}
+	updated := &core.Service{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name"},
+		Spec: core.ServiceSpec{
+			Selector: map[string]string{"juju-application": "app-name", "juju-track": "default"},
+		},
+	}
+	gomock.InOrder(
+		s.mockServices.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(&core.ServiceList{Items: []core.Service{switched, unswitched}}, nil),
+		s.mockServices.EXPECT().Update(updated).Times(1).
+			Return(nil, nil),
+	)
+
+	err := s.broker.SwitchServiceTrack("app-name", "")
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceTrackUnlabelledPods(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	params := &caas.ServiceParams{
+		PodSpec: basicPodspec,
+		Track:   "green",
+	}
+	statusCallback := func(appName string, settableStatus status.Status, info string, data map[string]interface{}) error {
+		return nil
+	}
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(s.secretArg(c, nil)).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Create(s.secretArg(c, nil)).Times(1).
+			Return(nil, nil),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&appsv1.Deployment{}, nil),
+		s.mockSecrets.EXPECT().Delete("juju-app-name-test-secret", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(nil),
+	)
+	err := s.broker.EnsureService("app-name", statusCallback, params, 2, nil)
+	c.Assert(err, gc.ErrorMatches, `creating or updating track "green": the pods of application "app-name" have no track label, update the application before adding a track`)
+}
+
+func (s *K8sBrokerSuite) TestSwitchServiceTrackNotFound(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockDeployments.EXPECT().Get("juju-app-name-green", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+	)
+
+	err := s.broker.SwitchServiceTrack("app-name", "green")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *K8sBrokerSuite) TestDeleteServiceTrack(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	service := &core.Service{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name"},
+		Spec: core.ServiceSpec{
+			Selector: map[string]string{"juju-application": "app-name", "juju-track": "green"},
+		},
+	}
+	gomock.InOrder(
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(service, nil),
+		s.mockDeployments.EXPECT().Delete("juju-app-name-blue", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(nil),
+	)
+
+	err := s.broker.DeleteServiceTrack("app-name", "blue")
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestDeleteWithConfiguredPropagation(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	cfg, err := s.cfg.Apply(map[string]interface{}{
+		"kubernetes-deletion-propagation": "Background",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	err = s.broker.SetConfig(cfg)
+	c.Assert(err, jc.ErrorIsNil)
+
+	gomock.InOrder(
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Delete("juju-app-name-blue", s.deleteOptions(v1.DeletePropagationBackground)).Times(1).
+			Return(nil),
+	)
+
+	err = s.broker.DeleteServiceTrack("app-name", "blue")
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestDeleteServiceTrackInUse(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	service := &core.Service{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name"},
+		Spec: core.ServiceSpec{
+			Selector: map[string]string{"juju-application": "app-name", "juju-track": "green"},
+		},
+	}
+	gomock.InOrder(
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(service, nil),
+	)
+
+	err := s.broker.DeleteServiceTrack("app-name", "green")
+	c.Assert(err, gc.ErrorMatches, `cannot delete track "green" of application "app-name" while its service uses the track`)
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceMissingImagePullSecret(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockSecrets.EXPECT().Get("registry", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+	)
+
+	podSpec := *basicPodspec
+	podSpec.ProviderPod = &provider.K8sPodSpec{
+		ImagePullSecrets: []core.LocalObjectReference{{Name: "registry"}},
+	}
+	params := &caas.ServiceParams{
+		PodSpec: &podSpec,
+	}
+	statusCallback := func(appName string, settableStatus status.Status, info string, data map[string]interface{}) error {
+		return nil
+	}
+	err := s.broker.EnsureService("app-name", statusCallback, params, 2, nil)
+	c.Assert(err, gc.ErrorMatches, `image pull secret "registry" not found`)
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceMissingEnvFromSecret(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockSecrets.EXPECT().Get("gitlab-secrets", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+	)
+
+	podSpec := *basicPodspec
+	podSpec.Containers = []caas.ContainerSpec{basicPodspec.Containers[0]}
+	podSpec.Containers[0].ProviderContainer = &provider.K8sContainerSpec{
+		EnvFrom: []core.EnvFromSource{{
+			SecretRef: &core.SecretEnvSource{LocalObjectReference: core.LocalObjectReference{Name: "gitlab-secrets"}},
+		}},
+	}
+	params := &caas.ServiceParams{
+		PodSpec: &podSpec,
+	}
+	statusCallback := func(appName string, settableStatus status.Status, info string, data map[string]interface{}) error {
+		return nil
+	}
+	err := s.broker.EnsureService("app-name", statusCallback, params, 2, nil)
+	c.Assert(err, gc.ErrorMatches, `secret "gitlab-secrets" for environment of container "test" not found`)
+}
+
+func (s *K8sBrokerSuite) TestEnsureServicePreserveReplicas(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	scaled := int32(5)
+	unitSpec, err := provider.MakeUnitSpec("app-name", basicPodspec)
+	c.Assert(err, jc.ErrorIsNil)
+	podSpec := provider.PodSpec(unitSpec)
+
+	labels := map[string]string{"juju-application": "app-name"}
+	deploymentArg := &appsv1.Deployment{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "juju-app-name",
+			Labels: labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &scaled,
+			Selector: &v1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: core.PodTemplateSpec{
+				ObjectMeta: v1.ObjectMeta{
+					GenerateName: "juju-app-name-",
+					Labels:       defaultTrackLabels(labels),
+				},
+				Spec: podSpec,
+			},
+		},
+	}
+	withSpecHash(c, deploymentArg)
+	existing := &appsv1.Deployment{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "juju-app-name",
+			Labels: map[string]string{"juju-application": "app-name"},
+		},
+		Spec: appsv1.DeploymentSpec{Replicas: &scaled},
+	}
+	serviceArg := &core.Service{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "juju-app-name",
+			Labels: labels,
+		},
+		Spec: core.ServiceSpec{
+			Selector: labels,
+			Type:     "ClusterIP",
+			Ports: []core.ServicePort{
+				{Port: 80, TargetPort: intstr.FromInt(80), Protocol: "TCP"},
+				{Port: 8080, Protocol: "TCP", Name: "fred"},
+			},
+		},
+	}
+
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(s.secretArg(c, nil)).Times(1).
+			Return(nil, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(existing, nil),
+		s.mockDeployments.EXPECT().Update(deploymentArg).Times(1).
+			Return(nil, nil),
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Update(serviceArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Create(serviceArg).Times(1).
+			Return(nil, nil),
+		s.expectNoContainerServices("app-name"),
+	)
+
+	params := &caas.ServiceParams{
+		PodSpec: basicPodspec,
+	}
+	err = s.broker.EnsureService("app-name", nil, params, 2, application.ConfigAttributes{
+		"kubernetes-service-type":                 "ClusterIP",
+		"kubernetes-deployment-preserve-replicas": true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceForeignDeployment(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	existing := &appsv1.Deployment{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "juju-app-name",
+			Labels: map[string]string{"app": "something-else"},
+		},
+	}
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(s.secretArg(c, nil)).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Create(s.secretArg(c, nil)).Times(1).
+			Return(nil, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(existing, nil),
+		s.mockSecrets.EXPECT().Delete("juju-app-name-test-secret", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(nil),
+	)
+
+	params := &caas.ServiceParams{
+		PodSpec: basicPodspec,
+	}
+	statusCallback := func(appName string, settableStatus status.Status, info string, data map[string]interface{}) error {
+		return nil
+	}
+	err := s.broker.EnsureService("app-name", statusCallback, params, 2, nil)
+	c.Assert(err, jc.Satisfies, errors.IsAlreadyExists)
+	c.Assert(err, gc.ErrorMatches, `creating or updating DeploymentController: deployment "juju-app-name" exists but does not belong to application "app-name"; set kubernetes-adopt-existing-resources to adopt it`)
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceAdoptForeignService(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	existing := &core.Service{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name"},
+		Spec:       core.ServiceSpec{ClusterIP: "10.1.1.1"},
+	}
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(s.secretArg(c, nil)).Times(1).
+			Return(nil, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Update(gomock.Any()).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Create(gomock.Any()).Times(1).
+			Return(nil, nil),
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(existing, nil),
+		s.mockServices.EXPECT().Update(gomock.Any()).Times(1).
+			Return(nil, nil),
+		s.expectNoContainerServices("app-name"),
+	)
+
+	params := &caas.ServiceParams{
+		PodSpec: basicPodspec,
+	}
+	err := s.broker.EnsureService("app-name", nil, params, 2, application.ConfigAttributes{
+		"kubernetes-adopt-existing-resources": true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(c.GetTestLog(), jc.Contains, `adopting existing service "juju-app-name" for application "app-name"`)
+}
+
+func (s *K8sBrokerSuite) TestEnsureServicePerContainer(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	numUnits := int32(2)
+	unitSpec, err := provider.MakeUnitSpec("app-name", basicPodspec)
+	c.Assert(err, jc.ErrorIsNil)
+	podSpec := provider.PodSpec(unitSpec)
+
+	labels := map[string]string{"juju-application": "app-name"}
+	deploymentArg := &appsv1.Deployment{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "juju-app-name",
+			Labels: labels},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &numUnits,
+			Selector: &v1.LabelSelector{
+				MatchLabels: map[string]string{"juju-application": "app-name"},
+			},
+			Template: core.PodTemplateSpec{
+				ObjectMeta: v1.ObjectMeta{
+					GenerateName: "juju-app-name-",
+					Labels:       defaultTrackLabels(labels),
+				},
+				Spec: podSpec,
+			},
+		},
+	}
+	withSpecHash(c, deploymentArg)
+	primaryServiceArg := &core.Service{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "juju-app-name",
+			Labels: map[string]string{"juju-application": "app-name", "juju-container": "test"}},
+		Spec: core.ServiceSpec{
+			Selector: map[string]string{"juju-application": "app-name"},
+			Type:     "ClusterIP",
+			Ports: []core.ServicePort{
+				{Port: 80, TargetPort: intstr.FromInt(80), Protocol: "TCP"},
+			},
+		},
+	}
+	secondServiceArg := &core.Service{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "juju-app-name-test2",
+			Labels: map[string]string{"juju-application": "app-name", "juju-container": "test2"}},
+		Spec: core.ServiceSpec{
+			Selector: map[string]string{"juju-application": "app-name"},
+			Type:     "ClusterIP",
+			Ports: []core.ServicePort{
+				{Port: 8080, TargetPort: intstr.FromInt(8080), Protocol: "TCP", Name: "fred"},
+			},
+		},
+	}
+
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(s.secretArg(c, nil)).Times(1).
+			Return(nil, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&appsv1.Deployment{ObjectMeta: v1.ObjectMeta{Labels: map[string]string{"juju-application": "app-name"}}}, nil),
+		s.mockDeployments.EXPECT().Update(deploymentArg).Times(1).
+			Return(nil, nil),
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Update(primaryServiceArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Create(primaryServiceArg).Times(1).
+			Return(nil, nil),
+		s.mockServices.EXPECT().Get("juju-app-name-test2", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Update(secondServiceArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Create(secondServiceArg).Times(1).
+			Return(nil, nil),
+		// The service of a container which no longer exists is removed.
+		s.mockServices.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(&core.ServiceList{Items: []core.Service{
+				*primaryServiceArg, *secondServiceArg,
+				{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-old", Labels: labels}},
+			}}, nil),
+		s.mockServices.EXPECT().Delete("juju-app-name-old", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(nil),
+	)
+
+	params := &caas.ServiceParams{
+		PodSpec: basicPodspec,
+	}
+	err = s.broker.EnsureService("app-name", nil, params, 2, application.ConfigAttributes{
+		"kubernetes-service-per-container": true,
+	})
 	c.Assert(err, jc.ErrorIsNil)
 }
 
-func operatorStatefulSetArg(numUnits int32, scName string) *appsv1.StatefulSet {
-	return &appsv1.StatefulSet{
+func (s *K8sBrokerSuite) assertEnsureServiceContainerServices(
+	c *gc.C, podSpec *caas.PodSpec, config application.ConfigAttributes,
+	serviceArg *core.Service, existing []core.Service, deleted ...string,
+) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	numUnits := int32(1)
+	unitSpec, err := provider.MakeUnitSpec("app-name", podSpec)
+	c.Assert(err, jc.ErrorIsNil)
+
+	labels := map[string]string{"juju-application": "app-name"}
+	deploymentArg := &appsv1.Deployment{
 		ObjectMeta: v1.ObjectMeta{
-			Name: "juju-operator-test",
-			Labels: map[string]string{
-				"juju-operator": "test",
-				"juju-version":  "2.99.0",
-				"fred":          "mary",
-			}},
-		Spec: appsv1.StatefulSetSpec{
+			Name:   "juju-app-name",
+			Labels: labels},
+		Spec: appsv1.DeploymentSpec{
 			Replicas: &numUnits,
 			Selector: &v1.LabelSelector{
-				MatchLabels: map[string]string{"juju-operator": "test"},
+				MatchLabels: map[string]string{"juju-application": "app-name"},
 			},
 			Template: core.PodTemplateSpec{
 				ObjectMeta: v1.ObjectMeta{
-					Labels: map[string]string{
-						"juju-operator": "test",
-						"fred":          "mary",
-						"juju-version":  "2.99.0",
-					},
+					GenerateName: "juju-app-name-",
+					Labels:       defaultTrackLabels(labels),
 				},
-				Spec: operatorPodspec,
+				Spec: provider.PodSpec(unitSpec),
+			},
+		},
+	}
+	withSpecHash(c, deploymentArg)
+
+	calls := []*gomock.Call{
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Update(deploymentArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Create(deploymentArg).Times(1).
+			Return(nil, nil),
+		s.mockServices.EXPECT().Get(serviceArg.Name, v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Update(serviceArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Create(serviceArg).Times(1).
+			Return(nil, nil),
+		s.mockServices.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(&core.ServiceList{Items: existing}, nil),
+	}
+	for _, name := range deleted {
+		calls = append(calls,
+			s.mockServices.EXPECT().Delete(name, s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+				Return(nil),
+		)
+	}
+	gomock.InOrder(calls...)
+
+	params := &caas.ServiceParams{
+		PodSpec: podSpec,
+	}
+	err = s.broker.EnsureService("app-name", nil, params, 1, config)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestEnsureServicePerContainerPrimaryFallback(c *gc.C) {
+	// The first container has no ports, so the primary
+	// service is used for the next container with ports.
+	podSpec := &caas.PodSpec{
+		Containers: []caas.ContainerSpec{{
+			Name:  "sidecar",
+			Image: "juju/sidecar",
+		}, {
+			Name:  "test",
+			Ports: []caas.ContainerPort{{ContainerPort: 80, Protocol: "TCP"}},
+			Image: "juju/image",
+		}},
+	}
+	serviceArg := &core.Service{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "juju-app-name",
+			Labels: map[string]string{"juju-application": "app-name", "juju-container": "test"}},
+		Spec: core.ServiceSpec{
+			Selector: map[string]string{"juju-application": "app-name"},
+			Type:     "ClusterIP",
+			Ports: []core.ServicePort{
+				{Port: 80, TargetPort: intstr.FromInt(80), Protocol: "TCP"},
 			},
-			VolumeClaimTemplates: []core.PersistentVolumeClaim{{
-				ObjectMeta: v1.ObjectMeta{
-					Name: "test-operator-volume",
-					Labels: map[string]string{
-						"juju-operator": "test",
-						"foo":           "bar",
-					}},
-				Spec: core.PersistentVolumeClaimSpec{
-					StorageClassName: &scName,
-					AccessModes:      []core.PersistentVolumeAccessMode{core.ReadWriteOnce},
-					Resources: core.ResourceRequirements{
-						Requests: core.ResourceList{
-							core.ResourceStorage: resource.MustParse("10Mi"),
-						},
-					},
-				},
-			}},
-			PodManagementPolicy: apps.ParallelPodManagement,
 		},
 	}
+	s.assertEnsureServiceContainerServices(c, podSpec, application.ConfigAttributes{
+		"kubernetes-service-per-container": true,
+	}, serviceArg, []core.Service{*serviceArg})
 }
 
-func unitStatefulSetArg(numUnits int32, scName string, podSpec core.PodSpec) *appsv1.StatefulSet {
-	return &appsv1.StatefulSet{
+func (s *K8sBrokerSuite) TestEnsureServicePerContainerDisabled(c *gc.C) {
+	podSpec := &caas.PodSpec{
+		Containers: []caas.ContainerSpec{{
+			Name:  "test",
+			Ports: []caas.ContainerPort{{ContainerPort: 80, Protocol: "TCP"}},
+			Image: "juju/image",
+		}},
+	}
+	serviceArg := &core.Service{
 		ObjectMeta: v1.ObjectMeta{
 			Name:   "juju-app-name",
 			Labels: map[string]string{"juju-application": "app-name"}},
-		Spec: appsv1.StatefulSetSpec{
+		Spec: core.ServiceSpec{
+			Selector: map[string]string{"juju-application": "app-name"},
+			Type:     "ClusterIP",
+			Ports: []core.ServicePort{
+				{Port: 80, TargetPort: intstr.FromInt(80), Protocol: "TCP"},
+			},
+		},
+	}
+	// The services created while each container had
+	// its own service are removed.
+	existing := []core.Service{
+		*serviceArg,
+		{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-admin"}},
+	}
+	s.assertEnsureServiceContainerServices(c, podSpec, nil, serviceArg, existing, "juju-app-name-admin")
+}
+
+func (s *K8sBrokerSuite) TestContainerServices(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockServices.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(&core.ServiceList{Items: []core.Service{{
+				ObjectMeta: v1.ObjectMeta{
+					Name:   "juju-app-name",
+					UID:    "uuid",
+					Labels: map[string]string{"juju-application": "app-name", "juju-container": "test"},
+				},
+				Spec: core.ServiceSpec{ClusterIP: "10.0.0.1"},
+			}, {
+				ObjectMeta: v1.ObjectMeta{
+					Name:   "juju-app-name-test2",
+					UID:    "uuid2",
+					Labels: map[string]string{"juju-application": "app-name", "juju-container": "test2"},
+				},
+				Spec: core.ServiceSpec{ClusterIP: "10.0.0.2"},
+			}, {
+				ObjectMeta: v1.ObjectMeta{
+					Name:   "juju-app-name-other",
+					UID:    "uuid3",
+					Labels: map[string]string{"juju-application": "app-name"},
+				},
+			}}}, nil),
+	)
+
+	services, err := s.broker.ContainerServices("app-name")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(services, jc.DeepEquals, map[string]*caas.Service{
+		"test": {
+			Id: "uuid",
+			Addresses: []network.Address{{
+				Value: "10.0.0.1",
+				Type:  network.IPv4Address,
+				Scope: network.ScopeCloudLocal,
+			}},
+		},
+		"test2": {
+			Id: "uuid2",
+			Addresses: []network.Address{{
+				Value: "10.0.0.2",
+				Type:  network.IPv4Address,
+				Scope: network.ScopeCloudLocal,
+			}},
+		},
+	})
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceSetsOwnerReferences(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	podSpec := &caas.PodSpec{
+		Containers: []caas.ContainerSpec{{
+			Name:  "test",
+			Ports: []caas.ContainerPort{{ContainerPort: 80, Protocol: "TCP"}},
+			Image: "juju/image",
+		}},
+	}
+	numUnits := int32(1)
+	unitSpec, err := provider.MakeUnitSpec("app-name", podSpec)
+	c.Assert(err, jc.ErrorIsNil)
+
+	labels := map[string]string{"juju-application": "app-name"}
+	ownerArg := &core.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "juju-app-name-owner",
+			Labels: labels,
+		},
+	}
+	owner := *ownerArg
+	owner.UID = "owner-uid"
+	blockOwnerDeletion := true
+	ownerRefs := []v1.OwnerReference{{
+		APIVersion:         "v1",
+		Kind:               "ConfigMap",
+		Name:               "juju-app-name-owner",
+		UID:                "owner-uid",
+		BlockOwnerDeletion: &blockOwnerDeletion,
+	}}
+	deploymentArg := &appsv1.Deployment{
+		ObjectMeta: v1.ObjectMeta{
+			Name:            "juju-app-name",
+			Labels:          labels,
+			OwnerReferences: ownerRefs,
+		},
+		Spec: appsv1.DeploymentSpec{
 			Replicas: &numUnits,
 			Selector: &v1.LabelSelector{
 				MatchLabels: map[string]string{"juju-application": "app-name"},
 			},
 			Template: core.PodTemplateSpec{
 				ObjectMeta: v1.ObjectMeta{
-					Labels: map[string]string{"juju-application": "app-name"},
+					GenerateName: "juju-app-name-",
+					Labels:       defaultTrackLabels(labels),
 				},
-				Spec: podSpec,
+				Spec: provider.PodSpec(unitSpec),
 			},
-			VolumeClaimTemplates: []core.PersistentVolumeClaim{{
-				ObjectMeta: v1.ObjectMeta{
-					Name: "juju-database-0",
-					Labels: map[string]string{
-						"juju-application": "app-name",
-						"foo":              "bar",
-					}},
-				Spec: core.PersistentVolumeClaimSpec{
-					StorageClassName: &scName,
-					AccessModes:      []core.PersistentVolumeAccessMode{core.ReadWriteOnce},
-					Resources: core.ResourceRequirements{
-						Requests: core.ResourceList{
-							core.ResourceStorage: resource.MustParse("100Mi"),
-						},
-					},
-				},
-			}},
-			PodManagementPolicy: apps.ParallelPodManagement,
 		},
 	}
+	withSpecHash(c, deploymentArg)
+	serviceArg := &core.Service{
+		ObjectMeta: v1.ObjectMeta{
+			Name:            "juju-app-name",
+			Labels:          labels,
+			OwnerReferences: ownerRefs,
+		},
+		Spec: core.ServiceSpec{
+			Selector: map[string]string{"juju-application": "app-name"},
+			Type:     "ClusterIP",
+			Ports: []core.ServicePort{
+				{Port: 80, TargetPort: intstr.FromInt(80), Protocol: "TCP"},
+			},
+		},
+	}
+
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockConfigMaps.EXPECT().Create(ownerArg).Times(1).
+			Return(&owner, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Update(deploymentArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Create(deploymentArg).Times(1).
+			Return(deploymentArg, nil),
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Update(serviceArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Create(serviceArg).Times(1).
+			Return(nil, nil),
+		s.expectNoContainerServices("app-name"),
+	)
+
+	params := &caas.ServiceParams{
+		PodSpec: podSpec,
+	}
+	err = s.broker.EnsureService("app-name", nil, params, 1, nil)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestServicePrefersPrimary(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockServices.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(&core.ServiceList{Items: []core.Service{{
+				ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-admin", UID: "uid-admin"},
+				Spec:       core.ServiceSpec{ClusterIP: "10.0.0.2"},
+			}, {
+				ObjectMeta: v1.ObjectMeta{Name: "juju-app-name", UID: "uid-primary"},
+				Spec:       core.ServiceSpec{ClusterIP: "10.0.0.1"},
+			}}}, nil),
+	)
+
+	svc, err := s.broker.Service("app-name")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(svc.Id, gc.Equals, "uid-primary")
+	c.Assert(svc.Addresses, gc.HasLen, 1)
+	c.Assert(svc.Addresses[0].Value, gc.Equals, "10.0.0.1")
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceInvalidMinReadySeconds(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	secretArg := s.secretArg(c, map[string]string{"fred": "mary"})
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(secretArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Create(secretArg).Times(1).
+			Return(nil, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Delete("juju-app-name-test-secret", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(nil),
+	)
+
+	params := &caas.ServiceParams{
+		PodSpec:      basicPodspec,
+		ResourceTags: map[string]string{"fred": "mary"},
+	}
+	statusCallback := func(appName string, settableStatus status.Status, info string, data map[string]interface{}) error {
+		return nil
+	}
+	err := s.broker.EnsureService("app-name", statusCallback, params, 2, application.ConfigAttributes{
+		"kubernetes-deployment-min-ready-seconds": -1,
+	})
+	c.Assert(err, gc.ErrorMatches, "creating or updating DeploymentController: kubernetes-deployment-min-ready-seconds -1 not valid")
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceProgressDeadlineNotAfterMinReady(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	secretArg := s.secretArg(c, map[string]string{"fred": "mary"})
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(secretArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Create(secretArg).Times(1).
+			Return(nil, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Delete("juju-app-name-test-secret", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(nil),
+	)
+
+	params := &caas.ServiceParams{
+		PodSpec:      basicPodspec,
+		ResourceTags: map[string]string{"fred": "mary"},
+	}
+	statusCallback := func(appName string, settableStatus status.Status, info string, data map[string]interface{}) error {
+		return nil
+	}
+	err := s.broker.EnsureService("app-name", statusCallback, params, 2, application.ConfigAttributes{
+		"kubernetes-deployment-progress-deadline": 30,
+		"kubernetes-deployment-min-ready-seconds": 30,
+	})
+	c.Assert(err, gc.ErrorMatches, "creating or updating DeploymentController: "+
+		"kubernetes-deployment-progress-deadline 30 not greater than kubernetes-deployment-min-ready-seconds 30 not valid")
 }
 
-func (s *K8sBrokerSuite) TestEnsureOperator(c *gc.C) {
+func (s *K8sBrokerSuite) TestEnsureServiceRevisionHistoryLimit(c *gc.C) {
 	ctrl := s.setupBroker(c)
 	defer ctrl.Finish()
 
-	configMapArg := &core.ConfigMap{
+	numUnits := int32(2)
+	historyLimit := int32(0)
+	unitSpec, err := provider.MakeUnitSpec("app-name", basicPodspec)
+	c.Assert(err, jc.ErrorIsNil)
+	podSpec := provider.PodSpec(unitSpec)
+
+	labels := map[string]string{"juju-application": "app-name"}
+	deploymentArg := &appsv1.Deployment{
 		ObjectMeta: v1.ObjectMeta{
-			Name: "juju-operator-test-config",
+			Name:   "juju-app-name",
+			Labels: labels,
 		},
-		Data: map[string]string{
-			"test-agent.conf": "agent-conf-data",
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &numUnits,
+			Selector: &v1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: core.PodTemplateSpec{
+				ObjectMeta: v1.ObjectMeta{
+					GenerateName: "juju-app-name-",
+					Labels:       defaultTrackLabels(labels),
+				},
+				Spec: podSpec,
+			},
+			RevisionHistoryLimit: &historyLimit,
+		},
+	}
+	withSpecHash(c, deploymentArg)
+	serviceArg := &core.Service{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "juju-app-name",
+			Labels: labels,
+		},
+		Spec: core.ServiceSpec{
+			Selector: labels,
+			Type:     "ClusterIP",
+			Ports: []core.ServicePort{
+				{Port: 80, TargetPort: intstr.FromInt(80), Protocol: "TCP"},
+				{Port: 8080, Protocol: "TCP", Name: "fred"},
+			},
 		},
 	}
-	statefulSetArg := operatorStatefulSetArg(1, "test-juju-operator-storage")
 
 	gomock.InOrder(
-		s.mockNamespaces.EXPECT().Update(&core.Namespace{ObjectMeta: v1.ObjectMeta{Name: "test"}}).Times(1),
-		s.mockConfigMaps.EXPECT().Update(configMapArg).Times(1),
-		s.mockStorageClass.EXPECT().Get("test-juju-operator-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
-			Return(&storagev1.StorageClass{ObjectMeta: v1.ObjectMeta{Name: "test-juju-operator-storage"}}, nil),
-		s.mockStatefulSets.EXPECT().Update(statefulSetArg).Times(1).
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
 			Return(nil, s.k8sNotFoundError()),
-		s.mockStatefulSets.EXPECT().Create(statefulSetArg).Times(1).
+		s.mockSecrets.EXPECT().Update(s.secretArg(c, nil)).Times(1).
+			Return(nil, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&appsv1.Deployment{ObjectMeta: v1.ObjectMeta{Labels: map[string]string{"juju-application": "app-name"}}}, nil),
+		s.mockDeployments.EXPECT().Update(deploymentArg).Times(1).
+			Return(nil, nil),
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Update(serviceArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Create(serviceArg).Times(1).
 			Return(nil, nil),
+		s.expectNoContainerServices("app-name"),
 	)
 
-	err := s.broker.EnsureOperator("test", "path/to/agent", &caas.OperatorConfig{
-		OperatorImagePath: "/path/to/image",
-		Version:           version.MustParse("2.99.0"),
-		AgentConf:         []byte("agent-conf-data"),
-		ResourceTags:      map[string]string{"fred": "mary"},
-		CharmStorage: caas.CharmStorageParams{
-			Size:         uint64(10),
-			Provider:     "kubernetes",
-			ResourceTags: map[string]string{"foo": "bar"},
-		},
+	params := &caas.ServiceParams{
+		PodSpec: basicPodspec,
+	}
+	err = s.broker.EnsureService("app-name", nil, params, 2, application.ConfigAttributes{
+		"kubernetes-service-type":                      "ClusterIP",
+		"kubernetes-deployment-revision-history-limit": 0,
 	})
 	c.Assert(err, jc.ErrorIsNil)
 }
 
-func (s *K8sBrokerSuite) TestEnsureOperatorNoAgentConfig(c *gc.C) {
+func (s *K8sBrokerSuite) TestEnsureServiceRollsBackCreatedResources(c *gc.C) {
 	ctrl := s.setupBroker(c)
 	defer ctrl.Finish()
 
-	statefulSetArg := operatorStatefulSetArg(1, "test-juju-operator-storage")
-
 	gomock.InOrder(
-		s.mockNamespaces.EXPECT().Update(&core.Namespace{ObjectMeta: v1.ObjectMeta{Name: "test"}}).Times(1),
-		s.mockConfigMaps.EXPECT().Get("juju-operator-test-config", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockConfigMaps.EXPECT().Create(gomock.Any()).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(gomock.Any()).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Create(gomock.Any()).Times(1).
 			Return(nil, nil),
-		s.mockStorageClass.EXPECT().Get("test-juju-operator-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
-			Return(&storagev1.StorageClass{ObjectMeta: v1.ObjectMeta{Name: "test-juju-operator-storage"}}, nil),
-		s.mockStatefulSets.EXPECT().Update(statefulSetArg).Times(1).
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
 			Return(nil, s.k8sNotFoundError()),
-		s.mockStatefulSets.EXPECT().Create(statefulSetArg).Times(1).
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Update(gomock.Any()).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Create(gomock.Any()).Times(1).
 			Return(nil, nil),
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Update(gomock.Any()).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Create(gomock.Any()).Times(1).
+			Return(nil, errors.New("boom")),
+		// Cleanups run in reverse order, and carry on past failures.
+		s.mockDeployments.EXPECT().Delete("juju-app-name", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(errors.New("delete failed")),
+		s.mockSecrets.EXPECT().Delete("juju-app-name-test-secret", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(nil),
+		s.mockConfigMaps.EXPECT().Delete("juju-app-name-owner", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(nil),
 	)
 
-	err := s.broker.EnsureOperator("test", "path/to/agent", &caas.OperatorConfig{
-		OperatorImagePath: "/path/to/image",
-		Version:           version.MustParse("2.99.0"),
-		ResourceTags:      map[string]string{"fred": "mary"},
-		CharmStorage: caas.CharmStorageParams{
-			Size:         uint64(10),
-			Provider:     "kubernetes",
-			ResourceTags: map[string]string{"foo": "bar"},
-		},
-	})
-	c.Assert(err, jc.ErrorIsNil)
+	params := &caas.ServiceParams{
+		PodSpec: basicPodspec,
+	}
+	statusCallback := func(appName string, settableStatus status.Status, info string, data map[string]interface{}) error {
+		return nil
+	}
+	err := s.broker.EnsureService("app-name", statusCallback, params, 2, nil)
+	c.Assert(err, gc.ErrorMatches, "creating or updating service for app-name: boom")
 }
 
-func (s *K8sBrokerSuite) TestEnsureOperatorNoAgentConfigMissingConfigMap(c *gc.C) {
+func (s *K8sBrokerSuite) TestEnsureServiceKeepsUpdatedSecretOnRollback(c *gc.C) {
 	ctrl := s.setupBroker(c)
 	defer ctrl.Finish()
 
+	// The secret already exists, so it is left alone when rolling back.
 	gomock.InOrder(
-		s.mockNamespaces.EXPECT().Update(&core.Namespace{ObjectMeta: v1.ObjectMeta{Name: "test"}}).Times(1),
-		s.mockConfigMaps.EXPECT().Get("juju-operator-test-config", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.Secret{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-test-secret"}}, nil),
+		s.mockSecrets.EXPECT().Update(gomock.Any()).Times(1).
+			Return(nil, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Update(gomock.Any()).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Create(gomock.Any()).Times(1).
+			Return(nil, nil),
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
 			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Update(gomock.Any()).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Create(gomock.Any()).Times(1).
+			Return(nil, errors.New("boom")),
+		s.mockDeployments.EXPECT().Delete("juju-app-name", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(nil),
 	)
 
-	err := s.broker.EnsureOperator("test", "path/to/agent", &caas.OperatorConfig{
-		OperatorImagePath: "/path/to/image",
-		Version:           version.MustParse("2.99.0"),
-		CharmStorage: caas.CharmStorageParams{
-			Size:     uint64(10),
-			Provider: "kubernetes",
-		},
-	})
-	c.Assert(err, gc.ErrorMatches, `config map for "test" should already exist:  "test" not found`)
+	params := &caas.ServiceParams{
+		PodSpec: basicPodspec,
+	}
+	statusCallback := func(appName string, settableStatus status.Status, info string, data map[string]interface{}) error {
+		return nil
+	}
+	err := s.broker.EnsureService("app-name", statusCallback, params, 2, nil)
+	c.Assert(err, gc.ErrorMatches, "creating or updating service for app-name: boom")
 }
 
-func (s *K8sBrokerSuite) TestDeleteService(c *gc.C) {
+func (s *K8sBrokerSuite) TestEnsureServiceInvalidRevisionHistoryLimit(c *gc.C) {
 	ctrl := s.setupBroker(c)
 	defer ctrl.Finish()
 
-	// Delete operations below return a not found to ensure it's treated as a no-op.
+	secretArg := s.secretArg(c, map[string]string{"fred": "mary"})
 	gomock.InOrder(
-		s.mockServices.EXPECT().Delete("juju-test", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
-			Return(s.k8sNotFoundError()),
-		s.mockStatefulSets.EXPECT().Delete("juju-test", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
-			Return(s.k8sNotFoundError()),
-		s.mockDeployments.EXPECT().Delete("juju-test", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
-			Return(s.k8sNotFoundError()),
-		s.mockPods.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==test"}).
-			Return(&core.PodList{Items: []core.Pod{}}, nil),
-		s.mockSecrets.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==test"}).Times(1).
-			Return(&core.SecretList{Items: []core.Secret{{
-				ObjectMeta: v1.ObjectMeta{Name: "secret"},
-			}}}, nil),
-		s.mockSecrets.EXPECT().Delete("secret", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
-			Return(s.k8sNotFoundError()),
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(secretArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Create(secretArg).Times(1).
+			Return(nil, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Delete("juju-app-name-test-secret", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(nil),
 	)
 
-	err := s.broker.DeleteService("test")
-	c.Assert(err, jc.ErrorIsNil)
+	params := &caas.ServiceParams{
+		PodSpec:      basicPodspec,
+		ResourceTags: map[string]string{"fred": "mary"},
+	}
+	statusCallback := func(appName string, settableStatus status.Status, info string, data map[string]interface{}) error {
+		return nil
+	}
+	err := s.broker.EnsureService("app-name", statusCallback, params, 2, application.ConfigAttributes{
+		"kubernetes-deployment-revision-history-limit": -1,
+	})
+	c.Assert(err, gc.ErrorMatches, "creating or updating DeploymentController: kubernetes-deployment-revision-history-limit -1 not valid")
 }
 
-func (s *K8sBrokerSuite) TestEnsureServiceNoUnits(c *gc.C) {
+func (s *K8sBrokerSuite) TestEnsureServiceNetworkPolicy(c *gc.C) {
 	ctrl := s.setupBroker(c)
 	defer ctrl.Finish()
 
-	two := int32(2)
-	dc := &apps.Deployment{ObjectMeta: v1.ObjectMeta{Name: "juju-unit-storage"}, Spec: apps.DeploymentSpec{Replicas: &two}}
-	zero := int32(0)
-	emptyDc := dc
-	emptyDc.Spec.Replicas = &zero
+	port := intstr.FromInt(80)
+	protocol := core.ProtocolTCP
+	labels := map[string]string{"juju-application": "app-name"}
+	policyArg := &networkingv1.NetworkPolicy{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "juju-app-name",
+			Labels: labels,
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: v1.LabelSelector{MatchLabels: labels},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				Ports: []networkingv1.NetworkPolicyPort{{Protocol: &protocol, Port: &port}},
+				From: []networkingv1.NetworkPolicyPeer{{
+					PodSelector: &v1.LabelSelector{MatchLabels: map[string]string{"role": "frontend"}},
+				}, {
+					NamespaceSelector: &v1.LabelSelector{MatchLabels: map[string]string{"project": "web"}},
+				}, {
+					IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/8", Except: []string{"10.1.0.0/16"}},
+				}},
+			}},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		},
+	}
+
 	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(gomock.Any()).Times(1).
+			Return(nil, nil),
 		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
 			Return(nil, s.k8sNotFoundError()),
 		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
-			Return(dc, nil),
-		s.mockDeployments.EXPECT().Update(emptyDc).Times(1).
+			Return(&appsv1.Deployment{ObjectMeta: v1.ObjectMeta{Labels: map[string]string{"juju-application": "app-name"}}}, nil),
+		s.mockDeployments.EXPECT().Update(gomock.Any()).Times(1).
+			Return(nil, nil),
+		s.mockNetworkPolicies.EXPECT().Update(policyArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockNetworkPolicies.EXPECT().Create(policyArg).Times(1).
+			Return(nil, nil),
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Update(gomock.Any()).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Create(gomock.Any()).Times(1).
 			Return(nil, nil),
+		s.expectNoContainerServices("app-name"),
 	)
 
-	params := &caas.ServiceParams{}
-	err := s.broker.EnsureService("app-name", nil, params, 0, nil)
+	params := &caas.ServiceParams{
+		PodSpec: basicPodspec,
+	}
+	err := s.broker.EnsureService("app-name", nil, params, 2, application.ConfigAttributes{
+		"kubernetes-network-policy-ingress": `
+- ports:
+  - protocol: TCP
+    port: 80
+  from:
+  - podSelector:
+      matchLabels:
+        role: frontend
+  - namespaceSelector:
+      matchLabels:
+        project: web
+  - ipBlock:
+      cidr: 10.0.0.0/8
+      except:
+      - 10.1.0.0/16
+`[1:],
+	})
 	c.Assert(err, jc.ErrorIsNil)
 }
 
-func (s *K8sBrokerSuite) TestEnsureServiceNoStorage(c *gc.C) {
+func (s *K8sBrokerSuite) TestEnsureServiceSelector(c *gc.C) {
 	ctrl := s.setupBroker(c)
 	defer ctrl.Finish()
 
-	numUnits := int32(2)
-	unitSpec, err := provider.MakeUnitSpec("app-name", basicPodspec)
-	c.Assert(err, jc.ErrorIsNil)
-	podSpec := provider.PodSpec(unitSpec)
-
-	deploymentArg := &appsv1.Deployment{
+	serviceArg := &core.Service{
 		ObjectMeta: v1.ObjectMeta{
-			Name: "juju-app-name",
-			Labels: map[string]string{
-				"juju-application": "app-name",
-				"fred":             "mary",
-			}},
-		Spec: appsv1.DeploymentSpec{
-			Replicas: &numUnits,
-			Selector: &v1.LabelSelector{
-				MatchLabels: map[string]string{"juju-application": "app-name"},
-			},
-			Template: core.PodTemplateSpec{
-				ObjectMeta: v1.ObjectMeta{
-					GenerateName: "juju-app-name-",
-					Labels: map[string]string{
-						"juju-application": "app-name",
-						"fred":             "mary",
-					},
-				},
-				Spec: podSpec,
+			Name:   "juju-app-name",
+			Labels: map[string]string{"juju-application": "app-name"},
+		},
+		Spec: core.ServiceSpec{
+			Selector: map[string]string{"juju-application": "app-name", "role": "primary"},
+			Type:     "ClusterIP",
+			Ports: []core.ServicePort{
+				{Port: 80, TargetPort: intstr.FromInt(80), Protocol: "TCP"},
+				{Port: 8080, Protocol: "TCP", Name: "fred"},
 			},
 		},
 	}
+
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(gomock.Any()).Times(1).
+			Return(nil, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&appsv1.Deployment{ObjectMeta: v1.ObjectMeta{Labels: map[string]string{"juju-application": "app-name"}}}, nil),
+		s.mockDeployments.EXPECT().Update(gomock.Any()).Times(1).
+			Return(nil, nil),
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Update(serviceArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Create(serviceArg).Times(1).
+			Return(nil, nil),
+		s.expectNoContainerServices("app-name"),
+	)
+
+	params := &caas.ServiceParams{
+		PodSpec: basicPodspec,
+	}
+	err := s.broker.EnsureService("app-name", nil, params, 2, application.ConfigAttributes{
+		"kubernetes-service-selector": "role=primary",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceSelectorApplicationLabel(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(gomock.Any()).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Create(gomock.Any()).Times(1).
+			Return(nil, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&appsv1.Deployment{ObjectMeta: v1.ObjectMeta{Labels: map[string]string{"juju-application": "app-name"}}}, nil),
+		s.mockDeployments.EXPECT().Update(gomock.Any()).Times(1).
+			Return(nil, nil),
+		s.mockSecrets.EXPECT().Delete("juju-app-name-test-secret", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(nil),
+	)
+
+	params := &caas.ServiceParams{
+		PodSpec: basicPodspec,
+	}
+	statusCallback := func(appName string, settableStatus status.Status, info string, data map[string]interface{}) error {
+		return nil
+	}
+	err := s.broker.EnsureService("app-name", statusCallback, params, 2, application.ConfigAttributes{
+		"kubernetes-service-selector": "juju-application=other",
+	})
+	c.Assert(err, gc.ErrorMatches, `creating or updating service for app-name: kubernetes-service-selector label "juju-application" not valid`)
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceExternalEndpoints(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
 	serviceArg := &core.Service{
 		ObjectMeta: v1.ObjectMeta{
-			Name: "juju-app-name",
-			Labels: map[string]string{
-				"juju-application": "app-name",
-				"fred":             "mary",
-			}},
+			Name:   "juju-app-name",
+			Labels: map[string]string{"juju-application": "app-name"},
+		},
 		Spec: core.ServiceSpec{
-			Selector: map[string]string{"juju-application": "app-name"},
-			Type:     "nodeIP",
+			Type: "ClusterIP",
 			Ports: []core.ServicePort{
 				{Port: 80, TargetPort: intstr.FromInt(80), Protocol: "TCP"},
 				{Port: 8080, Protocol: "TCP", Name: "fred"},
 			},
-			LoadBalancerIP: "10.0.0.1",
-			ExternalName:   "ext-name",
 		},
 	}
+	endpointsArg := &core.Endpoints{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "juju-app-name",
+			Labels: map[string]string{"juju-application": "app-name"},
+		},
+		Subsets: []core.EndpointSubset{{
+			Addresses: []core.EndpointAddress{{IP: "10.1.2.3"}, {IP: "10.1.2.4"}},
+			Ports: []core.EndpointPort{
+				{Port: 80, Protocol: "TCP"},
+				{Port: 8080, Protocol: "TCP", Name: "fred"},
+			},
+		}},
+	}
 
-	secretArg := s.secretArg(c, map[string]string{"fred": "mary"})
 	gomock.InOrder(
-		s.mockSecrets.EXPECT().Update(secretArg).Times(1).
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(gomock.Any()).Times(1).
 			Return(nil, nil),
 		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
 			Return(nil, s.k8sNotFoundError()),
-		s.mockDeployments.EXPECT().Update(deploymentArg).Times(1).
-			Return(nil, s.k8sNotFoundError()),
-		s.mockDeployments.EXPECT().Create(deploymentArg).Times(1).
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&appsv1.Deployment{ObjectMeta: v1.ObjectMeta{Labels: map[string]string{"juju-application": "app-name"}}}, nil),
+		s.mockDeployments.EXPECT().Update(gomock.Any()).Times(1).
 			Return(nil, nil),
 		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
 			Return(nil, s.k8sNotFoundError()),
@@ -686,20 +5414,92 @@ func (s *K8sBrokerSuite) TestEnsureServiceNoStorage(c *gc.C) {
 			Return(nil, s.k8sNotFoundError()),
 		s.mockServices.EXPECT().Create(serviceArg).Times(1).
 			Return(nil, nil),
+		s.mockEndpoints.EXPECT().Update(endpointsArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockEndpoints.EXPECT().Create(endpointsArg).Times(1).
+			Return(nil, nil),
+		s.expectNoContainerServices("app-name"),
 	)
 
 	params := &caas.ServiceParams{
-		PodSpec:      basicPodspec,
-		ResourceTags: map[string]string{"fred": "mary"},
+		PodSpec: basicPodspec,
 	}
-	err = s.broker.EnsureService("app-name", nil, params, 2, application.ConfigAttributes{
-		"kubernetes-service-type":            "nodeIP",
-		"kubernetes-service-loadbalancer-ip": "10.0.0.1",
-		"kubernetes-service-externalname":    "ext-name",
+	err := s.broker.EnsureService("app-name", nil, params, 2, application.ConfigAttributes{
+		"kubernetes-service-endpoints": "10.1.2.3, 10.1.2.4",
 	})
 	c.Assert(err, jc.ErrorIsNil)
 }
 
+func (s *K8sBrokerSuite) TestEnsureServiceInvalidExternalEndpoint(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(gomock.Any()).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Create(gomock.Any()).Times(1).
+			Return(nil, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&appsv1.Deployment{ObjectMeta: v1.ObjectMeta{Labels: map[string]string{"juju-application": "app-name"}}}, nil),
+		s.mockDeployments.EXPECT().Update(gomock.Any()).Times(1).
+			Return(nil, nil),
+		s.mockSecrets.EXPECT().Delete("juju-app-name-test-secret", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(nil),
+	)
+
+	params := &caas.ServiceParams{
+		PodSpec: basicPodspec,
+	}
+	statusCallback := func(appName string, settableStatus status.Status, info string, data map[string]interface{}) error {
+		return nil
+	}
+	err := s.broker.EnsureService("app-name", statusCallback, params, 2, application.ConfigAttributes{
+		"kubernetes-service-endpoints": "10.1.2.3,db.example.com",
+	})
+	c.Assert(err, gc.ErrorMatches, `creating or updating service for app-name: kubernetes-service-endpoints address "db.example.com" not valid`)
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceInvalidNetworkPolicy(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(gomock.Any()).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Create(gomock.Any()).Times(1).
+			Return(nil, nil),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&appsv1.Deployment{ObjectMeta: v1.ObjectMeta{Labels: map[string]string{"juju-application": "app-name"}}}, nil),
+		s.mockDeployments.EXPECT().Update(gomock.Any()).Times(1).
+			Return(nil, nil),
+		s.mockSecrets.EXPECT().Delete("juju-app-name-test-secret", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+			Return(nil),
+	)
+
+	params := &caas.ServiceParams{
+		PodSpec: basicPodspec,
+	}
+	statusCallback := func(appName string, settableStatus status.Status, info string, data map[string]interface{}) error {
+		return nil
+	}
+	err := s.broker.EnsureService("app-name", statusCallback, params, 2, application.ConfigAttributes{
+		"kubernetes-network-policy-ingress": `[{"from": [{"ipBlock": {"cidr": "10.0.0.0"}}]}]`,
+	})
+	c.Assert(err, gc.ErrorMatches, `creating or updating network policy for app-name: kubernetes-network-policy-ingress CIDR "10.0.0.0" not valid`)
+}
+
 func (s *K8sBrokerSuite) TestEnsureCustomResourceDefinitionCreate(c *gc.C) {
 	ctrl := s.setupBroker(c)
 	defer ctrl.Finish()
@@ -901,15 +5701,338 @@ func (s *K8sBrokerSuite) TestEnsureCustomResourceDefinitionUpdate(c *gc.C) {
 		},
 	}
 	gomock.InOrder(
-		s.mockCustomResourceDefinition.EXPECT().Create(crd).Times(1).Return(crd, s.k8sAlreadyExists()),
-		s.mockCustomResourceDefinition.EXPECT().Get("tfjobs.kubeflow.org", v1.GetOptions{}).Times(1).Return(crd, nil),
-		s.mockCustomResourceDefinition.EXPECT().Update(crd).Times(1).Return(crd, nil),
+		s.mockCustomResourceDefinition.EXPECT().Create(crd).Times(1).Return(crd, s.k8sAlreadyExists()),
+		s.mockCustomResourceDefinition.EXPECT().Get("tfjobs.kubeflow.org", v1.GetOptions{}).Times(1).Return(crd, nil),
+		s.mockCustomResourceDefinition.EXPECT().Update(crd).Times(1).Return(crd, nil),
+	)
+	err := s.broker.EnsureCustomResourceDefinition("test", podSpec)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceWithStorage(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	unitSpec, err := provider.MakeUnitSpec("app-name", basicPodspec)
+	c.Assert(err, jc.ErrorIsNil)
+	podSpec := provider.PodSpec(unitSpec)
+	podSpec.Containers[0].VolumeMounts = []core.VolumeMount{{
+		Name:      "juju-database-0",
+		MountPath: "path/to/here",
+	}}
+	statefulSetArg := unitStatefulSetArg(2, "juju-unit-storage", podSpec)
+
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(s.secretArg(c, nil)).Times(1).
+			Return(nil, nil),
+		s.mockStorageClass.EXPECT().Get("test-juju-unit-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockStorageClass.EXPECT().Get("juju-unit-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
+			Return(&storagev1.StorageClass{ObjectMeta: v1.ObjectMeta{Name: "juju-unit-storage"}}, nil),
+		s.mockStatefulSets.EXPECT().Update(statefulSetArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockStatefulSets.EXPECT().Create(statefulSetArg).Times(1).
+			Return(nil, nil),
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Update(basicServiceArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Create(basicServiceArg).Times(1).
+			Return(nil, nil),
+		s.expectNoContainerServices("app-name"),
+	)
+
+	params := &caas.ServiceParams{
+		PodSpec: basicPodspec,
+		Filesystems: []storage.KubernetesFilesystemParams{{
+			StorageName: "database",
+			Size:        100,
+			Provider:    "kubernetes",
+			Attachment: &storage.KubernetesFilesystemAttachmentParams{
+				Path: "path/to/here",
+			},
+			ResourceTags: map[string]string{"foo": "bar"},
+		}},
+	}
+	err = s.broker.EnsureService("app-name", nil, params, 2, application.ConfigAttributes{
+		"kubernetes-service-type":            "nodeIP",
+		"kubernetes-service-loadbalancer-ip": "10.0.0.1",
+		"kubernetes-service-externalname":    "ext-name",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceWithFallbackStorageClass(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	cfg, err := s.cfg.Apply(map[string]interface{}{
+		"kubernetes-fallback-storage-class": "fast",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	err = s.broker.SetConfig(cfg)
+	c.Assert(err, jc.ErrorIsNil)
+
+	unitSpec, err := provider.MakeUnitSpec("app-name", basicPodspec)
+	c.Assert(err, jc.ErrorIsNil)
+	podSpec := provider.PodSpec(unitSpec)
+	podSpec.Containers[0].VolumeMounts = []core.VolumeMount{{
+		Name:      "juju-database-0",
+		MountPath: "path/to/here",
+	}}
+	statefulSetArg := unitStatefulSetArg(2, "fast", podSpec)
+
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(s.secretArg(c, nil)).Times(1).
+			Return(nil, nil),
+		s.mockStorageClass.EXPECT().Get("test-juju-unit-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockStorageClass.EXPECT().Get("juju-unit-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockStorageClass.EXPECT().List(v1.ListOptions{
+			LabelSelector: "juju-storage in (app-name-unit-storage, test, default),juju-model==test",
+		}).Times(1).
+			Return(&storagev1.StorageClassList{}, nil),
+		s.mockStorageClass.EXPECT().List(v1.ListOptions{
+			LabelSelector: "juju-storage in (app-name-unit-storage, test, default)",
+		}).Times(1).
+			Return(&storagev1.StorageClassList{}, nil),
+		s.mockStorageClass.EXPECT().List(v1.ListOptions{}).Times(1).
+			Return(&storagev1.StorageClassList{}, nil),
+		s.mockStorageClass.EXPECT().Get("test-fast", v1.GetOptions{IncludeUninitialized: false}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockStorageClass.EXPECT().Get("fast", v1.GetOptions{IncludeUninitialized: false}).Times(1).
+			Return(&storagev1.StorageClass{ObjectMeta: v1.ObjectMeta{Name: "fast"}}, nil),
+		s.mockStatefulSets.EXPECT().Update(statefulSetArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockStatefulSets.EXPECT().Create(statefulSetArg).Times(1).
+			Return(nil, nil),
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Update(basicServiceArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Create(basicServiceArg).Times(1).
+			Return(nil, nil),
+		s.expectNoContainerServices("app-name"),
+	)
+
+	params := &caas.ServiceParams{
+		PodSpec: basicPodspec,
+		Filesystems: []storage.KubernetesFilesystemParams{{
+			StorageName: "database",
+			Size:        100,
+			Provider:    "kubernetes",
+			Attachment: &storage.KubernetesFilesystemAttachmentParams{
+				Path: "path/to/here",
+			},
+			ResourceTags: map[string]string{"foo": "bar"},
+		}},
+	}
+	err = s.broker.EnsureService("app-name", nil, params, 2, application.ConfigAttributes{
+		"kubernetes-service-type":            "nodeIP",
+		"kubernetes-service-loadbalancer-ip": "10.0.0.1",
+		"kubernetes-service-externalname":    "ext-name",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) assertEnsureServiceResizesStorage(c *gc.C, allowExpansion bool) error {
+	unitSpec, err := provider.MakeUnitSpec("app-name", basicPodspec)
+	c.Assert(err, jc.ErrorIsNil)
+	podSpec := provider.PodSpec(unitSpec)
+	podSpec.Containers[0].VolumeMounts = []core.VolumeMount{{
+		Name:      "juju-database-0",
+		MountPath: "path/to/here",
+	}}
+	statefulSetArg := unitStatefulSetArg(2, "juju-unit-storage", podSpec)
+
+	scName := "juju-unit-storage"
+	claim := core.PersistentVolumeClaim{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-database-0-juju-app-name-0"},
+		Spec: core.PersistentVolumeClaimSpec{
+			StorageClassName: &scName,
+			Resources: core.ResourceRequirements{
+				Requests: core.ResourceList{
+					core.ResourceStorage: resource.MustParse("50Mi"),
+				},
+			},
+		},
+	}
+	otherClaim := core.PersistentVolumeClaim{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-logs-1-juju-app-name-0"},
+	}
+	resized := claim
+	resized.Spec.Resources.Requests = core.ResourceList{
+		core.ResourceStorage: resource.MustParse("100Mi"),
+	}
+
+	calls := []*gomock.Call{
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(s.secretArg(c, nil)).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Create(s.secretArg(c, nil)).Times(1).
+			Return(nil, nil),
+		s.mockStorageClass.EXPECT().Get("test-juju-unit-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockStorageClass.EXPECT().Get("juju-unit-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
+			Return(&storagev1.StorageClass{ObjectMeta: v1.ObjectMeta{Name: "juju-unit-storage"}}, nil),
+		s.mockStatefulSets.EXPECT().Update(statefulSetArg).Times(1).
+			Return(nil, nil),
+		s.mockPersistentVolumeClaims.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(&core.PersistentVolumeClaimList{Items: []core.PersistentVolumeClaim{otherClaim, claim}}, nil),
+		s.mockStorageClass.EXPECT().Get("juju-unit-storage", v1.GetOptions{}).Times(1).
+			Return(&storagev1.StorageClass{
+				ObjectMeta:           v1.ObjectMeta{Name: "juju-unit-storage"},
+				AllowVolumeExpansion: &allowExpansion,
+			}, nil),
+	}
+	if allowExpansion {
+		calls = append(calls,
+			s.mockPersistentVolumeClaims.EXPECT().Update(&resized).Times(1).
+				Return(&resized, nil),
+			s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+				Return(nil, s.k8sNotFoundError()),
+			s.mockServices.EXPECT().Update(basicServiceArg).Times(1).
+				Return(nil, s.k8sNotFoundError()),
+			s.mockServices.EXPECT().Create(basicServiceArg).Times(1).
+				Return(nil, nil),
+			s.expectNoContainerServices("app-name"),
+		)
+	} else {
+		calls = append(calls,
+			s.mockSecrets.EXPECT().Delete("juju-app-name-test-secret", s.deleteOptions(v1.DeletePropagationForeground)).Times(1).
+				Return(nil),
+		)
+	}
+	gomock.InOrder(calls...)
+
+	params := &caas.ServiceParams{
+		PodSpec: basicPodspec,
+		Filesystems: []storage.KubernetesFilesystemParams{{
+			StorageName: "database",
+			Size:        100,
+			Provider:    "kubernetes",
+			Attachment: &storage.KubernetesFilesystemAttachmentParams{
+				Path: "path/to/here",
+			},
+			ResourceTags: map[string]string{"foo": "bar"},
+		}},
+	}
+	statusCallback := func(appName string, settableStatus status.Status, info string, data map[string]interface{}) error {
+		return nil
+	}
+	return s.broker.EnsureService("app-name", statusCallback, params, 2, application.ConfigAttributes{
+		"kubernetes-service-type":            "nodeIP",
+		"kubernetes-service-loadbalancer-ip": "10.0.0.1",
+		"kubernetes-service-externalname":    "ext-name",
+	})
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceResizesStorage(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	err := s.assertEnsureServiceResizesStorage(c, true)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceResizeStorageNotAllowed(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	err := s.assertEnsureServiceResizesStorage(c, false)
+	c.Assert(err, gc.ErrorMatches, `creating or updating StatefulSet: resizing storage for app-name: `+
+		`cannot resize persistent volume claim "juju-database-0-juju-app-name-0" from 50Mi to 100Mi: `+
+		`storage class "juju-unit-storage" does not allow volume expansion`)
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceStatefulSetImageDigestChanged(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	podSpec := *basicPodspec
+	podSpec.Containers = append([]caas.ContainerSpec(nil), basicPodspec.Containers...)
+	podSpec.Containers[1].Image = "juju/image2@sha256:new"
+	unitSpec, err := provider.MakeUnitSpec("app-name", &podSpec)
+	c.Assert(err, jc.ErrorIsNil)
+	k8sPodSpec := provider.PodSpec(unitSpec)
+	k8sPodSpec.Containers[0].VolumeMounts = []core.VolumeMount{{
+		Name:      "juju-database-0",
+		MountPath: "path/to/here",
+	}}
+	statefulSetArg := unitStatefulSetArg(2, "juju-unit-storage", k8sPodSpec)
+
+	// The existing stateful set has the same labels but an older image
+	// digest, and its volume claim templates can't be updated.
+	existingPodSpec := k8sPodSpec
+	existingPodSpec.Containers = append([]core.Container(nil), k8sPodSpec.Containers...)
+	existingPodSpec.Containers[1].Image = "juju/image2@sha256:old"
+	existing := unitStatefulSetArg(2, "juju-unit-storage", existingPodSpec)
+	// Only the pod template is updated, with the new image digest.
+	updated := unitStatefulSetArg(2, "juju-unit-storage", k8sPodSpec)
+
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Update(s.secretArg(c, nil)).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockSecrets.EXPECT().Create(s.secretArg(c, nil)).Times(1).
+			Return(nil, nil),
+		s.mockStorageClass.EXPECT().Get("test-juju-unit-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockStorageClass.EXPECT().Get("juju-unit-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
+			Return(&storagev1.StorageClass{ObjectMeta: v1.ObjectMeta{Name: "juju-unit-storage"}}, nil),
+		s.mockStatefulSets.EXPECT().Update(statefulSetArg).Times(1).
+			Return(nil, s.k8sInvalidError()),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(existing, nil),
+		s.mockStatefulSets.EXPECT().Update(updated).Times(1).
+			Return(updated, nil),
+		s.mockPersistentVolumeClaims.EXPECT().List(v1.ListOptions{LabelSelector: "juju-application==app-name"}).Times(1).
+			Return(&core.PersistentVolumeClaimList{}, nil),
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Update(basicServiceArg).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Create(basicServiceArg).Times(1).
+			Return(nil, nil),
+		s.expectNoContainerServices("app-name"),
 	)
-	err := s.broker.EnsureCustomResourceDefinition("test", podSpec)
+
+	params := &caas.ServiceParams{
+		PodSpec: &podSpec,
+		Filesystems: []storage.KubernetesFilesystemParams{{
+			StorageName: "database",
+			Size:        100,
+			Provider:    "kubernetes",
+			Attachment: &storage.KubernetesFilesystemAttachmentParams{
+				Path: "path/to/here",
+			},
+			ResourceTags: map[string]string{"foo": "bar"},
+		}},
+	}
+	err = s.broker.EnsureService("app-name", nil, params, 2, application.ConfigAttributes{
+		"kubernetes-service-type":            "nodeIP",
+		"kubernetes-service-loadbalancer-ip": "10.0.0.1",
+		"kubernetes-service-externalname":    "ext-name",
+	})
 	c.Assert(err, jc.ErrorIsNil)
 }
 
-func (s *K8sBrokerSuite) TestEnsureServiceWithStorage(c *gc.C) {
+func (s *K8sBrokerSuite) TestEnsureServiceWithStorageCreatesStorageClass(c *gc.C) {
 	ctrl := s.setupBroker(c)
 	defer ctrl.Finish()
 
@@ -920,15 +6043,38 @@ func (s *K8sBrokerSuite) TestEnsureServiceWithStorage(c *gc.C) {
 		Name:      "juju-database-0",
 		MountPath: "path/to/here",
 	}}
-	statefulSetArg := unitStatefulSetArg(2, "juju-unit-storage", podSpec)
+	statefulSetArg := unitStatefulSetArg(2, "test-my-storage", podSpec)
+
+	reclaimPolicy := core.PersistentVolumeReclaimDelete
+	bindingMode := storagev1.VolumeBindingWaitForFirstConsumer
+	storageClassArg := &storagev1.StorageClass{
+		ObjectMeta: v1.ObjectMeta{
+			Name: "test-my-storage",
+			Labels: map[string]string{
+				"juju-model":      "test",
+				"juju-model-uuid": testing.ModelTag.Id(),
+				"juju-storage":    "app-name-unit-storage",
+			},
+		},
+		Provisioner:       "aws-storage",
+		ReclaimPolicy:     &reclaimPolicy,
+		VolumeBindingMode: &bindingMode,
+		Parameters:        map[string]string{"type": "gp2"},
+	}
 
 	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
 		s.mockSecrets.EXPECT().Update(s.secretArg(c, nil)).Times(1).
 			Return(nil, nil),
-		s.mockStorageClass.EXPECT().Get("test-juju-unit-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
+		s.mockStorageClass.EXPECT().Get("test-my-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
 			Return(nil, s.k8sNotFoundError()),
-		s.mockStorageClass.EXPECT().Get("juju-unit-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
-			Return(&storagev1.StorageClass{ObjectMeta: v1.ObjectMeta{Name: "juju-unit-storage"}}, nil),
+		s.mockStorageClass.EXPECT().Get("my-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockStorageClass.EXPECT().Create(storageClassArg).Times(1).
+			Return(storageClassArg, nil),
 		s.mockStatefulSets.EXPECT().Update(statefulSetArg).Times(1).
 			Return(nil, s.k8sNotFoundError()),
 		s.mockStatefulSets.EXPECT().Create(statefulSetArg).Times(1).
@@ -939,6 +6085,7 @@ func (s *K8sBrokerSuite) TestEnsureServiceWithStorage(c *gc.C) {
 			Return(nil, s.k8sNotFoundError()),
 		s.mockServices.EXPECT().Create(basicServiceArg).Times(1).
 			Return(nil, nil),
+		s.expectNoContainerServices("app-name"),
 	)
 
 	params := &caas.ServiceParams{
@@ -947,6 +6094,13 @@ func (s *K8sBrokerSuite) TestEnsureServiceWithStorage(c *gc.C) {
 			StorageName: "database",
 			Size:        100,
 			Provider:    "kubernetes",
+			Attributes: map[string]interface{}{
+				"storage-class":          "my-storage",
+				"storage-provisioner":    "aws-storage",
+				"storage-reclaim-policy": "Delete",
+				"storage-binding-mode":   "WaitForFirstConsumer",
+				"parameters.type":        "gp2",
+			},
 			Attachment: &storage.KubernetesFilesystemAttachmentParams{
 				Path: "path/to/here",
 			},
@@ -993,18 +6147,25 @@ func (s *K8sBrokerSuite) TestEnsureServiceForDeploymentWithDevices(c *gc.C) {
 			Template: core.PodTemplateSpec{
 				ObjectMeta: v1.ObjectMeta{
 					GenerateName: "juju-app-name-",
-					Labels:       map[string]string{"juju-application": "app-name"},
+					Labels:       map[string]string{"juju-application": "app-name", "juju-track": "default"},
 				},
 				Spec: podSpec,
 			},
 		},
 	}
+	withSpecHash(c, deploymentArg)
 
 	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
 		s.mockSecrets.EXPECT().Update(s.secretArg(c, nil)).Times(1).
 			Return(nil, nil),
 		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
 			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
 		s.mockDeployments.EXPECT().Update(deploymentArg).Times(1).
 			Return(nil, s.k8sNotFoundError()),
 		s.mockDeployments.EXPECT().Create(deploymentArg).Times(1).
@@ -1015,6 +6176,7 @@ func (s *K8sBrokerSuite) TestEnsureServiceForDeploymentWithDevices(c *gc.C) {
 			Return(nil, s.k8sNotFoundError()),
 		s.mockServices.EXPECT().Create(basicServiceArg).Times(1).
 			Return(nil, nil),
+		s.expectNoContainerServices("app-name"),
 	)
 
 	params := &caas.ServiceParams{
@@ -1060,6 +6222,10 @@ func (s *K8sBrokerSuite) TestEnsureServiceForStatefulSetWithDevices(c *gc.C) {
 	statefulSetArg := unitStatefulSetArg(2, "juju-unit-storage", podSpec)
 
 	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
 		s.mockSecrets.EXPECT().Update(s.secretArg(c, nil)).Times(1).
 			Return(nil, nil),
 		s.mockStorageClass.EXPECT().Get("test-juju-unit-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
@@ -1076,6 +6242,7 @@ func (s *K8sBrokerSuite) TestEnsureServiceForStatefulSetWithDevices(c *gc.C) {
 			Return(nil, s.k8sNotFoundError()),
 		s.mockServices.EXPECT().Create(basicServiceArg).Times(1).
 			Return(nil, nil),
+		s.expectNoContainerServices("app-name"),
 	)
 
 	params := &caas.ServiceParams{
@@ -1127,6 +6294,10 @@ func (s *K8sBrokerSuite) TestEnsureServiceWithConstraints(c *gc.C) {
 	statefulSetArg := unitStatefulSetArg(2, "juju-unit-storage", podSpec)
 
 	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
 		s.mockSecrets.EXPECT().Update(s.secretArg(c, nil)).Times(1).
 			Return(nil, nil),
 		s.mockStorageClass.EXPECT().Get("test-juju-unit-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
@@ -1143,6 +6314,7 @@ func (s *K8sBrokerSuite) TestEnsureServiceWithConstraints(c *gc.C) {
 			Return(nil, s.k8sNotFoundError()),
 		s.mockServices.EXPECT().Create(basicServiceArg).Times(1).
 			Return(nil, nil),
+		s.expectNoContainerServices("app-name"),
 	)
 
 	params := &caas.ServiceParams{
@@ -1181,6 +6353,10 @@ func (s *K8sBrokerSuite) TestEnsureServiceWithPlacement(c *gc.C) {
 	statefulSetArg := unitStatefulSetArg(2, "juju-unit-storage", podSpec)
 
 	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(&core.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner"}}, nil),
+		s.mockSecrets.EXPECT().Get("juju-app-name-test-secret", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
 		s.mockSecrets.EXPECT().Update(s.secretArg(c, nil)).Times(1).
 			Return(nil, nil),
 		s.mockStorageClass.EXPECT().Get("test-juju-unit-storage", v1.GetOptions{IncludeUninitialized: false}).Times(1).
@@ -1197,6 +6373,7 @@ func (s *K8sBrokerSuite) TestEnsureServiceWithPlacement(c *gc.C) {
 			Return(nil, s.k8sNotFoundError()),
 		s.mockServices.EXPECT().Create(basicServiceArg).Times(1).
 			Return(nil, nil),
+		s.expectNoContainerServices("app-name"),
 	)
 
 	params := &caas.ServiceParams{
@@ -1245,6 +6422,41 @@ func (s *K8sBrokerSuite) TestOperator(c *gc.C) {
 	c.Assert(operator.Status.Message, gc.Equals, "test message.")
 }
 
+func (s *K8sBrokerSuite) TestOperatorRestarts(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	opPod := core.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name: "juju-operator-test",
+		},
+		Status: core.PodStatus{
+			Phase: core.PodRunning,
+			ContainerStatuses: []core.ContainerStatus{{
+				Name:         "juju-operator",
+				RestartCount: 3,
+				State: core.ContainerState{
+					Running: &core.ContainerStateRunning{},
+				},
+				LastTerminationState: core.ContainerState{
+					Terminated: &core.ContainerStateTerminated{ExitCode: 2},
+				},
+			}},
+		},
+	}
+	gomock.InOrder(
+		s.mockPods.EXPECT().List(v1.ListOptions{LabelSelector: "juju-operator==test"}).Times(1).
+			Return(&core.PodList{Items: []core.Pod{opPod}}, nil),
+		s.mockEvents.EXPECT().List(gomock.Any()).Times(1).
+			Return(&core.EventList{}, nil),
+	)
+
+	operator, err := s.broker.Operator("test")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(operator.RestartCount, gc.Equals, 3)
+	c.Assert(operator.LastTerminationReason, gc.Equals, "exit code 2")
+}
+
 func (s *K8sBrokerSuite) TestOperatorNoPodFound(c *gc.C) {
 	ctrl := s.setupBroker(c)
 	defer ctrl.Finish()
@@ -1257,3 +6469,321 @@ func (s *K8sBrokerSuite) TestOperatorNoPodFound(c *gc.C) {
 	_, err := s.broker.Operator("test")
 	c.Assert(err, gc.ErrorMatches, "operator pod for application \"test\" not found")
 }
+
+func (s *K8sBrokerSuite) TestEnsureServiceOnly(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	labels := map[string]string{"juju-application": "app-name", "fred": "mary"}
+	owner := &core.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name-owner", UID: "owner-uid", Labels: labels},
+	}
+	blockOwnerDeletion := true
+	serviceArg := &core.Service{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "juju-app-name",
+			Labels: labels,
+			OwnerReferences: []v1.OwnerReference{{
+				APIVersion:         "v1",
+				Kind:               "ConfigMap",
+				Name:               "juju-app-name-owner",
+				UID:                "owner-uid",
+				BlockOwnerDeletion: &blockOwnerDeletion,
+			}},
+		},
+		Spec: core.ServiceSpec{
+			Selector: map[string]string{"juju-application": "app-name"},
+			Type:     "LoadBalancer",
+			Ports: []core.ServicePort{
+				{Port: 80, TargetPort: intstr.FromInt(80), Protocol: "TCP", Name: "http"},
+				{Port: 443, Protocol: "TCP"},
+			},
+		},
+	}
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(owner, nil),
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Update(serviceArg).Times(1).
+			Return(nil, nil),
+	)
+
+	ports := []caas.ContainerPort{
+		{Name: "http", ContainerPort: 80, Protocol: "TCP"},
+		{ContainerPort: 443, Protocol: "TCP"},
+		{Name: "unexposed", Protocol: "TCP"},
+	}
+	err := s.broker.EnsureServiceOnly("app-name", ports, application.ConfigAttributes{
+		"kubernetes-service-type": "LoadBalancer",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceOnlyUnowned(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	labels := map[string]string{"juju-application": "app-name", "fred": "mary"}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name", UID: "deployment-uid", Labels: labels},
+	}
+	blockOwnerDeletion := true
+	serviceArg := &core.Service{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "juju-app-name",
+			Labels: labels,
+			OwnerReferences: []v1.OwnerReference{{
+				APIVersion:         "apps/v1",
+				Kind:               "Deployment",
+				Name:               "juju-app-name",
+				UID:                "deployment-uid",
+				BlockOwnerDeletion: &blockOwnerDeletion,
+			}},
+		},
+		Spec: core.ServiceSpec{
+			Selector: map[string]string{"juju-application": "app-name"},
+			Type:     "LoadBalancer",
+			Ports: []core.ServicePort{
+				{Port: 80, TargetPort: intstr.FromInt(80), Protocol: "TCP", Name: "http"},
+				{Port: 443, Protocol: "TCP"},
+			},
+		},
+	}
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(deployment, nil),
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockServices.EXPECT().Update(serviceArg).Times(1).
+			Return(nil, nil),
+	)
+
+	ports := []caas.ContainerPort{
+		{Name: "http", ContainerPort: 80, Protocol: "TCP"},
+		{ContainerPort: 443, Protocol: "TCP"},
+		{Name: "unexposed", Protocol: "TCP"},
+	}
+	err := s.broker.EnsureServiceOnly("app-name", ports, application.ConfigAttributes{
+		"kubernetes-service-type": "LoadBalancer",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestEnsureServiceOnlyNoDeployment(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockConfigMaps.EXPECT().Get("juju-app-name-owner", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockStatefulSets.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+		s.mockDeployments.EXPECT().Get("juju-app-name", v1.GetOptions{IncludeUninitialized: true}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+	)
+
+	err := s.broker.EnsureServiceOnly("app-name", []caas.ContainerPort{{ContainerPort: 80}}, nil)
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *K8sBrokerSuite) TestExposeServiceHTTPSBackend(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	svc := &core.Service{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name"},
+		Spec: core.ServiceSpec{
+			Ports: []core.ServicePort{{Port: 443, TargetPort: intstr.FromInt(8443)}},
+		},
+	}
+	ingressArg := &extensionsv1beta1.Ingress{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "juju-app-name",
+			Labels: map[string]string{"juju-application": "app-name"},
+			Annotations: map[string]string{
+				"ingress.kubernetes.io/rewrite-target":   "",
+				"ingress.kubernetes.io/ssl-redirect":     "false",
+				"kubernetes.io/ingress.class":            "nginx",
+				"kubernetes.io/ingress.allow-http":       "false",
+				"ingress.kubernetes.io/ssl-passthrough":  "false",
+				"ingress.kubernetes.io/backend-protocol": "HTTPS",
+			},
+		},
+		Spec: extensionsv1beta1.IngressSpec{
+			Rules: []extensionsv1beta1.IngressRule{{
+				Host: "example.com",
+				IngressRuleValue: extensionsv1beta1.IngressRuleValue{
+					HTTP: &extensionsv1beta1.HTTPIngressRuleValue{
+						Paths: []extensionsv1beta1.HTTPIngressPath{{
+							Path: "/",
+							Backend: extensionsv1beta1.IngressBackend{
+								ServiceName: "juju-app-name", ServicePort: intstr.FromInt(8443)},
+						}}},
+				}}},
+		},
+	}
+	gomock.InOrder(
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{}).Times(1).
+			Return(svc, nil),
+		s.mockIngressInterface.EXPECT().Update(ingressArg).Times(1).
+			Return(nil, nil),
+	)
+
+	err := s.broker.ExposeService("app-name", map[string]string{"juju-application": "app-name"}, application.ConfigAttributes{
+		"juju-external-hostname":              "example.com",
+		"kubernetes-ingress-backend-protocol": "HTTPS",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestExposeServicePassthroughHTTPSBackend(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	err := s.broker.ExposeService("app-name", nil, application.ConfigAttributes{
+		"juju-external-hostname":              "example.com",
+		"kubernetes-ingress-ssl-passthrough":  true,
+		"kubernetes-ingress-backend-protocol": "HTTPS",
+	})
+	c.Assert(err, gc.ErrorMatches, `kubernetes-ingress-ssl-passthrough with kubernetes-ingress-backend-protocol "HTTPS" not valid`)
+}
+
+func (s *K8sBrokerSuite) TestExposeServiceTuning(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	svc := &core.Service{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name"},
+		Spec: core.ServiceSpec{
+			Ports: []core.ServicePort{{Port: 80, TargetPort: intstr.FromInt(8080)}},
+		},
+	}
+	ingressArg := &extensionsv1beta1.Ingress{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "juju-app-name",
+			Labels: map[string]string{"juju-application": "app-name"},
+			Annotations: map[string]string{
+				"ingress.kubernetes.io/rewrite-target":     "",
+				"ingress.kubernetes.io/ssl-redirect":       "false",
+				"kubernetes.io/ingress.class":              "nginx",
+				"kubernetes.io/ingress.allow-http":         "false",
+				"ingress.kubernetes.io/ssl-passthrough":    "false",
+				"ingress.kubernetes.io/limit-rps":          "10",
+				"ingress.kubernetes.io/proxy-body-size":    "8m",
+				"ingress.kubernetes.io/proxy-read-timeout": "120",
+				"ingress.kubernetes.io/proxy-send-timeout": "60",
+			},
+		},
+		Spec: extensionsv1beta1.IngressSpec{
+			Rules: []extensionsv1beta1.IngressRule{{
+				Host: "example.com",
+				IngressRuleValue: extensionsv1beta1.IngressRuleValue{
+					HTTP: &extensionsv1beta1.HTTPIngressRuleValue{
+						Paths: []extensionsv1beta1.HTTPIngressPath{{
+							Path: "/",
+							Backend: extensionsv1beta1.IngressBackend{
+								ServiceName: "juju-app-name", ServicePort: intstr.FromInt(8080)},
+						}}},
+				}}},
+		},
+	}
+	gomock.InOrder(
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{}).Times(1).
+			Return(svc, nil),
+		s.mockIngressInterface.EXPECT().Update(ingressArg).Times(1).
+			Return(nil, nil),
+	)
+
+	err := s.broker.ExposeService("app-name", map[string]string{"juju-application": "app-name"}, application.ConfigAttributes{
+		"juju-external-hostname":                "example.com",
+		"kubernetes-ingress-rate-limit":         10,
+		"kubernetes-ingress-proxy-body-size":    "8m",
+		"kubernetes-ingress-proxy-read-timeout": 120,
+		"kubernetes-ingress-proxy-send-timeout": 60,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *K8sBrokerSuite) TestExposeServiceInvalidBodySize(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	svc := &core.Service{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-app-name"},
+		Spec: core.ServiceSpec{
+			Ports: []core.ServicePort{{Port: 80, TargetPort: intstr.FromInt(8080)}},
+		},
+	}
+	gomock.InOrder(
+		s.mockServices.EXPECT().Get("juju-app-name", v1.GetOptions{}).Times(1).
+			Return(svc, nil),
+	)
+
+	err := s.broker.ExposeService("app-name", nil, application.ConfigAttributes{
+		"juju-external-hostname":             "example.com",
+		"kubernetes-ingress-proxy-body-size": "8 megabytes",
+	})
+	c.Assert(err, gc.ErrorMatches, `kubernetes-ingress-proxy-body-size "8 megabytes" not valid`)
+}
+
+func (s *K8sBrokerSuite) TestApplicationIngress(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	ingress := &extensionsv1beta1.Ingress{
+		ObjectMeta: v1.ObjectMeta{Name: "juju-test"},
+		Spec: extensionsv1beta1.IngressSpec{
+			TLS: []extensionsv1beta1.IngressTLS{{Hosts: []string{"test.example.com"}}},
+			Rules: []extensionsv1beta1.IngressRule{{
+				Host: "test.example.com",
+				IngressRuleValue: extensionsv1beta1.IngressRuleValue{
+					HTTP: &extensionsv1beta1.HTTPIngressRuleValue{
+						Paths: []extensionsv1beta1.HTTPIngressPath{{Path: "/test"}},
+					}},
+			}},
+		},
+		Status: extensionsv1beta1.IngressStatus{
+			LoadBalancer: core.LoadBalancerStatus{
+				Ingress: []core.LoadBalancerIngress{{IP: "10.0.0.1"}, {Hostname: "lb.example.com"}},
+			},
+		},
+	}
+	gomock.InOrder(
+		s.mockIngressInterface.EXPECT().Get("juju-test", v1.GetOptions{}).Times(1).
+			Return(ingress, nil),
+	)
+
+	info, err := s.broker.ApplicationIngress("test")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(info, jc.DeepEquals, &caas.IngressInfo{
+		Rules:    []caas.IngressRule{{Host: "test.example.com", Paths: []string{"/test"}}},
+		TLSHosts: []string{"test.example.com"},
+		Addresses: []network.Address{{
+			Value: "10.0.0.1",
+			Type:  network.IPv4Address,
+			Scope: network.ScopePublic,
+		}, {
+			Value: "lb.example.com",
+			Type:  network.HostName,
+			Scope: network.ScopePublic,
+		}},
+	})
+}
+
+func (s *K8sBrokerSuite) TestApplicationIngressNotExposed(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		s.mockIngressInterface.EXPECT().Get("juju-test", v1.GetOptions{}).Times(1).
+			Return(nil, s.k8sNotFoundError()),
+	)
+
+	_, err := s.broker.ApplicationIngress("test")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
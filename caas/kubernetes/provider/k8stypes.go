@@ -4,13 +4,16 @@
 package provider
 
 import (
+	"encoding/json"
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/juju/collections/set"
 	"github.com/juju/errors"
 	"gopkg.in/yaml.v2"
 	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
 
 	"github.com/juju/juju/caas"
@@ -21,10 +24,48 @@ type caasContainerSpec caas.ContainerSpec
 type k8sContainer struct {
 	caasContainerSpec `json:",inline"`
 	*K8sContainerSpec `json:",inline"`
+
+	// Probes may be declared generically or using the kubernetes
+	// types, under the same keys. These fields take precedence
+	// over those of the embedded specs, and are told apart by
+	// their handlers.
+	LivenessProbe  *probeSpec `json:"livenessProbe,omitempty"`
+	ReadinessProbe *probeSpec `json:"readinessProbe,omitempty"`
+
+	// StartupProbe is not supported by the kubernetes API
+	// used by Juju, and is only parsed to report as much.
+	StartupProbe json.RawMessage `json:"startupProbe,omitempty"`
+}
+
+// probeSpec holds a probe declared either generically, with a command
+// or tcpPort handler, or otherwise using the kubernetes type. A probe
+// with an httpGet handler is the same either way, and is parsed using
+// the kubernetes type so that its port may be named.
+type probeSpec struct {
+	generic *caas.Probe
+	k8s     *core.Probe
+}
+
+// UnmarshalJSON is part of the json.Unmarshaler interface.
+func (p *probeSpec) UnmarshalJSON(data []byte) error {
+	var handlers struct {
+		Command json.RawMessage `json:"command"`
+		TCPPort json.RawMessage `json:"tcpPort"`
+	}
+	if err := json.Unmarshal(data, &handlers); err != nil {
+		return errors.Trace(err)
+	}
+	if handlers.Command != nil || handlers.TCPPort != nil {
+		p.generic = &caas.Probe{}
+		return errors.Trace(json.Unmarshal(data, p.generic))
+	}
+	p.k8s = &core.Probe{}
+	return errors.Trace(json.Unmarshal(data, p.k8s))
 }
 
-type k8sContainers struct {
-	Containers []k8sContainer `json:"containers"`
+type k8sPod struct {
+	*K8sPodSpec `json:",inline"`
+	Containers  []k8sContainer `json:"containers"`
 }
 
 // K8sContainerSpec is a subset of v1.Container which defines
@@ -33,10 +74,309 @@ type K8sContainerSpec struct {
 	LivenessProbe   *core.Probe     `json:"livenessProbe,omitempty"`
 	ReadinessProbe  *core.Probe     `json:"readinessProbe,omitempty"`
 	ImagePullPolicy core.PullPolicy `json:"imagePullPolicy,omitempty"`
+	Privileged      bool            `json:"privileged,omitempty"`
+
+	// VolumeMounts mount volumes declared on the pod into the container.
+	VolumeMounts []core.VolumeMount `json:"volumeMounts,omitempty"`
+
+	// Capabilities, ReadOnlyRootFilesystem and AllowPrivilegeEscalation
+	// are set on the container's security context; when unset the
+	// container runtime defaults apply.
+	Capabilities             *core.Capabilities `json:"capabilities,omitempty"`
+	ReadOnlyRootFilesystem   *bool              `json:"readOnlyRootFilesystem,omitempty"`
+	AllowPrivilegeEscalation *bool              `json:"allowPrivilegeEscalation,omitempty"`
+
+	// EphemeralStorage is the node ephemeral storage used by the
+	// container's writable layer, logs and emptyDir volumes.
+	EphemeralStorage *ResourceQuantity `json:"ephemeralStorage,omitempty"`
+
+	// EnvFrom exposes every key of the referenced secrets
+	// and config maps as container environment variables.
+	EnvFrom []core.EnvFromSource `json:"envFrom,omitempty"`
+
+	// Lifecycle holds hooks run by kubernetes when the container
+	// starts and before it is stopped. If a postStart hook fails,
+	// the container is killed and restarted according to the pod's
+	// restart policy.
+	Lifecycle *core.Lifecycle `json:"lifecycle,omitempty"`
+
+	// Stdin, StdinOnce and TTY allocate a stdin buffer and a terminal
+	// for the container, for interactive workloads attached to with
+	// Exec. Kubernetes requires stdin for a terminal.
+	Stdin     bool `json:"stdin,omitempty"`
+	StdinOnce bool `json:"stdinOnce,omitempty"`
+	TTY       bool `json:"tty,omitempty"`
+}
+
+// validateLifecycleHandler returns an error if the lifecycle
+// hook does not have exactly one handler.
+func validateLifecycleHandler(hook string, h *core.Handler) error {
+	if h == nil {
+		return nil
+	}
+	count := 0
+	if h.Exec != nil {
+		count++
+	}
+	if h.HTTPGet != nil {
+		count++
+	}
+	if h.TCPSocket != nil {
+		count++
+	}
+	if count != 1 {
+		return errors.NotValidf("%s hook without exactly one of exec, httpGet or tcpSocket", hook)
+	}
+	return nil
+}
+
+// ResourceQuantity is the amount of a resource requested for
+// a container, and the limit on how much it may use, eg 1Gi.
+type ResourceQuantity struct {
+	Request string `json:"request,omitempty"`
+	Limit   string `json:"limit,omitempty"`
+}
+
+// parse returns the parsed request and limit quantities, which
+// are nil if not specified.
+func (q ResourceQuantity) parse() (request, limit *resource.Quantity, _ error) {
+	if q.Request != "" {
+		value, err := resource.ParseQuantity(q.Request)
+		if err != nil {
+			return nil, nil, errors.NotValidf("request %q", q.Request)
+		}
+		request = &value
+	}
+	if q.Limit != "" {
+		value, err := resource.ParseQuantity(q.Limit)
+		if err != nil {
+			return nil, nil, errors.NotValidf("limit %q", q.Limit)
+		}
+		limit = &value
+	}
+	if request != nil && limit != nil && request.Cmp(*limit) > 0 {
+		return nil, nil, errors.NotValidf("request %q greater than limit %q", q.Request, q.Limit)
+	}
+	return request, limit, nil
 }
 
+// capabilityNameRegexp matches Linux capability names as
+// understood by kubernetes, eg NET_ADMIN.
+var capabilityNameRegexp = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
 // Validate is defined on ProviderContainer.
-func (*K8sContainerSpec) Validate() error {
+func (spec *K8sContainerSpec) Validate() error {
+	if spec == nil {
+		return nil
+	}
+	if spec.EphemeralStorage != nil {
+		if _, _, err := spec.EphemeralStorage.parse(); err != nil {
+			return errors.Annotate(err, "ephemeral storage")
+		}
+	}
+	if spec.Lifecycle != nil {
+		if err := validateLifecycleHandler("postStart", spec.Lifecycle.PostStart); err != nil {
+			return errors.Trace(err)
+		}
+		if err := validateLifecycleHandler("preStop", spec.Lifecycle.PreStop); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	for _, source := range spec.EnvFrom {
+		if (source.SecretRef == nil) == (source.ConfigMapRef == nil) {
+			return errors.NotValidf("envFrom without exactly one of secretRef or configMapRef")
+		}
+		if source.SecretRef != nil && source.SecretRef.Name == "" {
+			return errors.New("envFrom secret name is missing")
+		}
+		if source.ConfigMapRef != nil && source.ConfigMapRef.Name == "" {
+			return errors.New("envFrom config map name is missing")
+		}
+	}
+	if spec.TTY && !spec.Stdin {
+		return errors.NotValidf("tty without stdin")
+	}
+	if spec.StdinOnce && !spec.Stdin {
+		return errors.NotValidf("stdinOnce without stdin")
+	}
+	// Kubernetes rejects privileged containers which
+	// disallow privilege escalation.
+	if spec.Privileged && spec.AllowPrivilegeEscalation != nil && !*spec.AllowPrivilegeEscalation {
+		return errors.NotValidf("privileged container with allowPrivilegeEscalation false")
+	}
+	if spec.Capabilities == nil {
+		return nil
+	}
+	for _, caps := range [][]core.Capability{spec.Capabilities.Add, spec.Capabilities.Drop} {
+		for _, c := range caps {
+			if !capabilityNameRegexp.MatchString(string(c)) {
+				return errors.NotValidf("capability %q", c)
+			}
+		}
+	}
+	return nil
+}
+
+// securityContext returns the container security context
+// described by the spec, or nil if none is required.
+func (spec *K8sContainerSpec) securityContext() *core.SecurityContext {
+	if !spec.Privileged && spec.Capabilities == nil &&
+		spec.ReadOnlyRootFilesystem == nil && spec.AllowPrivilegeEscalation == nil {
+		return nil
+	}
+	sc := &core.SecurityContext{
+		Capabilities:             spec.Capabilities,
+		ReadOnlyRootFilesystem:   spec.ReadOnlyRootFilesystem,
+		AllowPrivilegeEscalation: spec.AllowPrivilegeEscalation,
+	}
+	if spec.Privileged {
+		privileged := true
+		sc.Privileged = &privileged
+	}
+	return sc
+}
+
+// validateMountPropagation returns an error if any of the container's
+// file sets use bidirectional mount propagation, which is only allowed
+// for privileged containers.
+func validateMountPropagation(c k8sContainer) error {
+	privileged := c.K8sContainerSpec != nil && c.Privileged
+	for _, fs := range c.Files {
+		if fs.MountPropagation == caas.MountPropagationBidirectional && !privileged {
+			return errors.NotValidf("bidirectional mount propagation for file set %q in unprivileged container %q", fs.Name, c.Name)
+		}
+	}
+	return nil
+}
+
+// K8sPodSpec is a subset of v1.PodSpec which defines
+// attributes we expose for charms to set.
+type K8sPodSpec struct {
+	// AllowHostNamespaces must be set to explicitly opt in
+	// to sharing any of the host's namespaces, since doing so
+	// gives the pod privileged access to the node.
+	AllowHostNamespaces bool `json:"allowHostNamespaces,omitempty"`
+	HostNetwork         bool `json:"hostNetwork,omitempty"`
+	HostPID             bool `json:"hostPID,omitempty"`
+	HostIPC             bool `json:"hostIPC,omitempty"`
+
+	// Volumes are declared once for the pod and may be
+	// mounted into any of its containers.
+	Volumes []core.Volume `json:"volumes,omitempty"`
+
+	// ActiveDeadlineSeconds is rejected by Validate. The pods are
+	// managed by a deployment or stateful set, whose pod templates
+	// can't set a deadline, so the field is only parsed to report a
+	// clear error.
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+
+	// ImagePullSecrets refer to existing secrets in the namespace
+	// used to pull images, in addition to any created by Juju.
+	ImagePullSecrets []core.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// TerminationGracePeriodSeconds is how long the pod's containers,
+	// including any preStop hooks, have to shut down before they are
+	// killed. If not set, any application config default applies.
+	TerminationGracePeriodSeconds *int64 `json:"terminationGracePeriodSeconds,omitempty"`
+
+	// ReadinessGates are extra pod conditions, eg set by a load
+	// balancer controller once the pod is registered as a target,
+	// which must be true before the pod is considered ready.
+	ReadinessGates []core.PodReadinessGate `json:"readinessGates,omitempty"`
+
+	// PodLabels are added to the labels of the application's pods,
+	// eg for monitoring to select them by. They can't replace the
+	// labels used by the workload's selector.
+	PodLabels map[string]string `json:"podLabels,omitempty"`
+
+	// RuntimeClassName selects the container runtime class, eg a gVisor
+	// or Kata Containers sandbox, used to run the application's pods.
+	// If not set, the cluster's default runtime is used.
+	RuntimeClassName *string `json:"runtimeClassName,omitempty"`
+}
+
+// runtimeClassNameRegexp matches the DNS subdomain names which
+// runtime classes must have.
+var runtimeClassNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+// Validate is defined on ProviderPod.
+func (p *K8sPodSpec) Validate() error {
+	if (p.HostNetwork || p.HostPID || p.HostIPC) && !p.AllowHostNamespaces {
+		return errors.NotValidf("using host namespaces without allowHostNamespaces")
+	}
+	if p.ActiveDeadlineSeconds != nil {
+		return errors.NotSupportedf("activeDeadlineSeconds for pods managed by a deployment or stateful set")
+	}
+	if p.TerminationGracePeriodSeconds != nil && *p.TerminationGracePeriodSeconds < 0 {
+		return errors.NotValidf("terminationGracePeriodSeconds %d", *p.TerminationGracePeriodSeconds)
+	}
+	for _, gate := range p.ReadinessGates {
+		if strings.TrimSpace(string(gate.ConditionType)) == "" {
+			return errors.NotValidf("readiness gate with empty condition type")
+		}
+	}
+	for name := range p.PodLabels {
+		if name == labelApplication || name == labelTrack {
+			return errors.NotValidf("pod label %q used by the selector", name)
+		}
+	}
+	if name := p.RuntimeClassName; name != nil {
+		if len(*name) > 253 || !runtimeClassNameRegexp.MatchString(*name) {
+			return errors.NotValidf("runtimeClassName %q", *name)
+		}
+	}
+	return nil
+}
+
+// validateVolumeMounts returns an error if any container mounts a
+// volume which is not declared on the pod, or if a pod volume is
+// invalid.
+func validateVolumeMounts(pod k8sPod) error {
+	volumes := set.NewStrings()
+	if pod.K8sPodSpec != nil {
+		for _, v := range pod.Volumes {
+			if v.Name == "" {
+				return errors.New("volume name is missing")
+			}
+			if volumes.Contains(v.Name) {
+				return errors.NotValidf("duplicate volume %q", v.Name)
+			}
+			if err := validateEmptyDir(v); err != nil {
+				return errors.Trace(err)
+			}
+			volumes.Add(v.Name)
+		}
+	}
+	for _, c := range pod.Containers {
+		if c.K8sContainerSpec == nil {
+			continue
+		}
+		for _, m := range c.VolumeMounts {
+			if !volumes.Contains(m.Name) {
+				return errors.NotValidf("container %q mount of undeclared volume %q", c.Name, m.Name)
+			}
+			if m.MountPath == "" {
+				return errors.Errorf("mount path is missing for volume %q in container %q", m.Name, c.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// validateEmptyDir returns an error if the volume is a memory backed
+// empty dir without a size limit, since an unbounded tmpfs can exhaust
+// the node's memory.
+func validateEmptyDir(v core.Volume) error {
+	if v.EmptyDir == nil {
+		return nil
+	}
+	limit := v.EmptyDir.SizeLimit
+	if limit != nil && limit.Sign() <= 0 {
+		return errors.NotValidf("size limit %v for volume %q", limit, v.Name)
+	}
+	if v.EmptyDir.Medium == core.StorageMediumMemory && limit == nil {
+		return errors.NotValidf("memory backed volume %q without a size limit", v.Name)
+	}
 	return nil
 }
 
@@ -53,16 +393,22 @@ func parseK8sPodSpec(in string) (*caas.PodSpec, error) {
 		return nil, errors.Trace(err)
 	}
 
-	// Do the k8s containers.
-	var containers k8sContainers
+	// Do the k8s pod and containers.
+	var containers k8sPod
 	decoder := k8syaml.NewYAMLOrJSONDecoder(strings.NewReader(in), len(in))
 	if err := decoder.Decode(&containers); err != nil {
 		return nil, errors.Trace(err)
 	}
+	if containers.K8sPodSpec != nil {
+		spec.ProviderPod = containers.K8sPodSpec
+	}
 
 	if len(containers.Containers) == 0 {
 		return nil, errors.New("require at least one container spec")
 	}
+	if err := validateVolumeMounts(containers); err != nil {
+		return nil, errors.Trace(err)
+	}
 
 	// Any string config values that could be interpreted as bools need to be quoted.
 	for _, container := range containers.Containers {
@@ -83,6 +429,12 @@ func parseK8sPodSpec(in string) (*caas.PodSpec, error) {
 		if err := c.Validate(); err != nil {
 			return nil, errors.Trace(err)
 		}
+		if err := validateMountPropagation(c); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if c.StartupProbe != nil {
+			return nil, errors.NotSupportedf("startup probe for container %q", c.Name)
+		}
 		spec.Containers[i] = caas.ContainerSpec{
 			ImageDetails: c.ImageDetails,
 			Name:         c.Name,
@@ -93,9 +445,23 @@ func parseK8sPodSpec(in string) (*caas.PodSpec, error) {
 			WorkingDir:   c.WorkingDir,
 			Config:       c.Config,
 			Files:        c.Files,
+
+			AutoReadinessProbe: c.AutoReadinessProbe,
+		}
+		k8sSpec := c.K8sContainerSpec
+		if k8sSpec == nil {
+			k8sSpec = &K8sContainerSpec{}
+		}
+		if c.LivenessProbe != nil {
+			spec.Containers[i].LivenessProbe = c.LivenessProbe.generic
+			k8sSpec.LivenessProbe = c.LivenessProbe.k8s
+		}
+		if c.ReadinessProbe != nil {
+			spec.Containers[i].ReadinessProbe = c.ReadinessProbe.generic
+			k8sSpec.ReadinessProbe = c.ReadinessProbe.k8s
 		}
-		if c.K8sContainerSpec != nil {
-			spec.Containers[i].ProviderContainer = c.K8sContainerSpec
+		if c.K8sContainerSpec != nil || k8sSpec.LivenessProbe != nil || k8sSpec.ReadinessProbe != nil {
+			spec.Containers[i].ProviderContainer = k8sSpec
 		}
 	}
 	return &spec, nil
@@ -4,10 +4,12 @@
 package provider_test
 
 import (
+	"github.com/juju/errors"
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
 	core "k8s.io/api/core/v1"
 	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"github.com/juju/juju/caas"
@@ -295,3 +297,588 @@ containers:
 	err = spec.Validate()
 	c.Assert(err, gc.ErrorMatches, `mount path is missing for file set "configuration"`)
 }
+
+func (s *ContainersSuite) TestParseHostNamespaces(c *gc.C) {
+
+	specStr := `
+allowHostNamespaces: true
+hostNetwork: true
+hostPID: true
+containers:
+  - name: gitlab
+    image: gitlab/latest
+`[1:]
+
+	spec, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(spec.ProviderPod, jc.DeepEquals, &provider.K8sPodSpec{
+		AllowHostNamespaces: true,
+		HostNetwork:         true,
+		HostPID:             true,
+	})
+	c.Assert(spec.Validate(), jc.ErrorIsNil)
+}
+
+func (s *ContainersSuite) TestValidateHostNamespacesNotAllowed(c *gc.C) {
+
+	specStr := `
+hostNetwork: true
+containers:
+  - name: gitlab
+    image: gitlab/latest
+`[1:]
+
+	spec, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, jc.ErrorIsNil)
+	err = spec.Validate()
+	c.Assert(err, gc.ErrorMatches, `using host namespaces without allowHostNamespaces not valid`)
+}
+
+func (s *ContainersSuite) TestParseMountPropagation(c *gc.C) {
+
+	specStr := `
+containers:
+  - name: csi-plugin
+    image: csi/latest
+    privileged: true
+    files:
+      - name: plugin
+        mountPath: /var/lib/kubelet/plugins
+        mountPropagation: Bidirectional
+        files:
+          file1: foo
+`[1:]
+
+	spec, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(spec.Containers[0].Files, jc.DeepEquals, []caas.FileSet{{
+		Name:             "plugin",
+		MountPath:        "/var/lib/kubelet/plugins",
+		MountPropagation: "Bidirectional",
+		Files:            map[string]string{"file1": "foo"},
+	}})
+	c.Assert(spec.Validate(), jc.ErrorIsNil)
+}
+
+func (s *ContainersSuite) TestValidateMountPropagation(c *gc.C) {
+
+	specStr := `
+containers:
+  - name: gitlab
+    image: gitlab/latest
+    files:
+      - name: configuration
+        mountPath: /var/lib/foo
+        mountPropagation: Sideways
+        files:
+          file1: foo
+`[1:]
+
+	spec, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, jc.ErrorIsNil)
+	err = spec.Validate()
+	c.Assert(err, gc.ErrorMatches, `mount propagation "Sideways" for file set "configuration" not valid`)
+}
+
+func (s *ContainersSuite) TestValidateHostPortProtocol(c *gc.C) {
+
+	specStr := `
+containers:
+  - name: gitlab
+    image: gitlab/latest
+    ports:
+    - containerPort: 80
+      hostPort: 8080
+`[1:]
+
+	_, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, gc.ErrorMatches, `host port 8080 with protocol "" for container "gitlab" not valid`)
+}
+
+func (s *ContainersSuite) TestValidateDuplicateHostPort(c *gc.C) {
+
+	specStr := `
+containers:
+  - name: gitlab
+    image: gitlab/latest
+    ports:
+    - containerPort: 80
+      hostPort: 8080
+      protocol: TCP
+  - name: sidecar
+    image: sidecar/latest
+    ports:
+    - containerPort: 8000
+      hostPort: 8080
+      protocol: TCP
+`[1:]
+
+	spec, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, jc.ErrorIsNil)
+	err = spec.Validate()
+	c.Assert(err, gc.ErrorMatches, `host port 8080/TCP for both containers "gitlab" and "sidecar" not valid`)
+}
+
+func (s *ContainersSuite) TestParseBidirectionalMountPropagationUnprivileged(c *gc.C) {
+
+	specStr := `
+containers:
+  - name: gitlab
+    image: gitlab/latest
+    files:
+      - name: configuration
+        mountPath: /var/lib/foo
+        mountPropagation: Bidirectional
+        files:
+          file1: foo
+`[1:]
+
+	_, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, gc.ErrorMatches, `bidirectional mount propagation for file set "configuration" in unprivileged container "gitlab" not valid`)
+}
+
+func (s *ContainersSuite) TestParsePodVolumes(c *gc.C) {
+
+	specStr := `
+volumes:
+  - name: shared
+    emptyDir: {}
+containers:
+  - name: gitlab
+    image: gitlab/latest
+  - name: helper
+    image: helper/latest
+    volumeMounts:
+      - name: shared
+        mountPath: /shared
+`[1:]
+
+	spec, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(spec.ProviderPod, jc.DeepEquals, &provider.K8sPodSpec{
+		Volumes: []core.Volume{{
+			Name:         "shared",
+			VolumeSource: core.VolumeSource{EmptyDir: &core.EmptyDirVolumeSource{}},
+		}},
+	})
+	c.Assert(spec.Containers[1].ProviderContainer, jc.DeepEquals, &provider.K8sContainerSpec{
+		VolumeMounts: []core.VolumeMount{{Name: "shared", MountPath: "/shared"}},
+	})
+}
+
+func (s *ContainersSuite) TestParseContainerSecurityContext(c *gc.C) {
+
+	specStr := `
+containers:
+  - name: gitlab
+    image: gitlab/latest
+    readOnlyRootFilesystem: true
+    allowPrivilegeEscalation: false
+    capabilities:
+      add: [NET_BIND_SERVICE]
+      drop: [ALL]
+`[1:]
+
+	spec, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, jc.ErrorIsNil)
+	readOnly, allowEscalation := true, false
+	c.Assert(spec.Containers[0].ProviderContainer, jc.DeepEquals, &provider.K8sContainerSpec{
+		ReadOnlyRootFilesystem:   &readOnly,
+		AllowPrivilegeEscalation: &allowEscalation,
+		Capabilities: &core.Capabilities{
+			Add:  []core.Capability{"NET_BIND_SERVICE"},
+			Drop: []core.Capability{"ALL"},
+		},
+	})
+}
+
+func (s *ContainersSuite) TestParseEphemeralStorage(c *gc.C) {
+
+	specStr := `
+containers:
+  - name: gitlab
+    image: gitlab/latest
+    ephemeralStorage:
+      request: 1Gi
+      limit: 2Gi
+`[1:]
+
+	spec, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(spec.Containers[0].ProviderContainer, jc.DeepEquals, &provider.K8sContainerSpec{
+		EphemeralStorage: &provider.ResourceQuantity{Request: "1Gi", Limit: "2Gi"},
+	})
+}
+
+func (s *ContainersSuite) TestParseInvalidEphemeralStorage(c *gc.C) {
+
+	specStr := `
+containers:
+  - name: gitlab
+    image: gitlab/latest
+    ephemeralStorage:
+      limit: lots
+`[1:]
+
+	_, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, gc.ErrorMatches, `ephemeral storage: limit "lots" not valid`)
+
+	specStr = `
+containers:
+  - name: gitlab
+    image: gitlab/latest
+    ephemeralStorage:
+      request: 2Gi
+      limit: 1Gi
+`[1:]
+
+	_, err = provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, gc.ErrorMatches, `ephemeral storage: request "2Gi" greater than limit "1Gi" not valid`)
+}
+
+func (s *ContainersSuite) TestParseInvalidCapability(c *gc.C) {
+
+	specStr := `
+containers:
+  - name: gitlab
+    image: gitlab/latest
+    capabilities:
+      drop: [net_raw]
+`[1:]
+
+	_, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, gc.ErrorMatches, `capability "net_raw" not valid`)
+}
+
+func (s *ContainersSuite) TestParsePrivilegedNoEscalation(c *gc.C) {
+
+	specStr := `
+containers:
+  - name: gitlab
+    image: gitlab/latest
+    privileged: true
+    allowPrivilegeEscalation: false
+`[1:]
+
+	_, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, gc.ErrorMatches, `privileged container with allowPrivilegeEscalation false not valid`)
+}
+
+func (s *ContainersSuite) TestParseUndeclaredVolume(c *gc.C) {
+
+	specStr := `
+containers:
+  - name: gitlab
+    image: gitlab/latest
+    volumeMounts:
+      - name: shared
+        mountPath: /shared
+`[1:]
+
+	_, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, gc.ErrorMatches, `container "gitlab" mount of undeclared volume "shared" not valid`)
+}
+
+func (s *ContainersSuite) TestParseImagePullSecrets(c *gc.C) {
+
+	specStr := `
+imagePullSecrets:
+  - name: registry
+containers:
+  - name: gitlab
+    image: gitlab/latest
+`[1:]
+
+	spec, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(spec.ProviderPod, jc.DeepEquals, &provider.K8sPodSpec{
+		ImagePullSecrets: []core.LocalObjectReference{{Name: "registry"}},
+	})
+}
+
+func (s *ContainersSuite) TestParseRuntimeClassName(c *gc.C) {
+
+	specStr := `
+runtimeClassName: gvisor
+containers:
+  - name: gitlab
+    image: gitlab/latest
+`[1:]
+
+	spec, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, jc.ErrorIsNil)
+	runtimeClass := "gvisor"
+	c.Assert(spec.ProviderPod, jc.DeepEquals, &provider.K8sPodSpec{
+		RuntimeClassName: &runtimeClass,
+	})
+
+	c.Assert(spec.Validate(), jc.ErrorIsNil)
+
+	*spec.ProviderPod.(*provider.K8sPodSpec).RuntimeClassName = "g_visor"
+	err = spec.Validate()
+	c.Assert(err, gc.ErrorMatches, `runtimeClassName "g_visor" not valid`)
+}
+
+func (s *ContainersSuite) TestParseMemoryVolume(c *gc.C) {
+
+	specStr := `
+volumes:
+  - name: cache
+    emptyDir:
+      medium: Memory
+      sizeLimit: 64Mi
+containers:
+  - name: gitlab
+    image: gitlab/latest
+    volumeMounts:
+      - name: cache
+        mountPath: /cache
+`[1:]
+
+	spec, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, jc.ErrorIsNil)
+	limit := resource.MustParse("64Mi")
+	c.Assert(spec.ProviderPod, jc.DeepEquals, &provider.K8sPodSpec{
+		Volumes: []core.Volume{{
+			Name: "cache",
+			VolumeSource: core.VolumeSource{EmptyDir: &core.EmptyDirVolumeSource{
+				Medium:    core.StorageMediumMemory,
+				SizeLimit: &limit,
+			}},
+		}},
+	})
+}
+
+func (s *ContainersSuite) TestParseMemoryVolumeMissingSizeLimit(c *gc.C) {
+
+	specStr := `
+volumes:
+  - name: cache
+    emptyDir:
+      medium: Memory
+containers:
+  - name: gitlab
+    image: gitlab/latest
+`[1:]
+
+	_, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, gc.ErrorMatches, `memory backed volume "cache" without a size limit not valid`)
+}
+
+func (s *ContainersSuite) TestParseAutoReadinessProbeWithoutPorts(c *gc.C) {
+
+	specStr := `
+containers:
+  - name: gitlab
+    image: gitlab/latest
+    autoReadinessProbe: true
+`[1:]
+
+	spec, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(spec.Containers[0].AutoReadinessProbe, jc.IsTrue)
+	err = spec.Validate()
+	c.Assert(err, gc.ErrorMatches, `automatic readiness probe for container "gitlab" without ports not valid`)
+}
+
+func (s *ContainersSuite) TestParseGenericProbes(c *gc.C) {
+
+	specStr := `
+containers:
+  - name: gitlab
+    image: gitlab/latest
+    livenessProbe:
+      tcpPort: 80
+      periodSeconds: 5
+    readinessProbe:
+      command: ["ready", "--quick"]
+  - name: gitlab-helper
+    image: gitlab-helper/latest
+    livenessProbe:
+      exec:
+        command: ["alive"]
+    readinessProbe:
+      httpGet:
+        path: /ready
+        port: www
+`[1:]
+
+	spec, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(spec.Containers[0].LivenessProbe, jc.DeepEquals, &caas.Probe{TCPPort: 80, PeriodSeconds: 5})
+	c.Assert(spec.Containers[0].ReadinessProbe, jc.DeepEquals, &caas.Probe{Command: []string{"ready", "--quick"}})
+	c.Assert(spec.Containers[0].ProviderContainer, gc.IsNil)
+
+	// Probes with kubernetes handlers are parsed using the kubernetes type.
+	c.Assert(spec.Containers[1].LivenessProbe, gc.IsNil)
+	c.Assert(spec.Containers[1].ReadinessProbe, gc.IsNil)
+	c.Assert(spec.Containers[1].ProviderContainer, jc.DeepEquals, &provider.K8sContainerSpec{
+		LivenessProbe: &core.Probe{
+			Handler: core.Handler{
+				Exec: &core.ExecAction{Command: []string{"alive"}},
+			},
+		},
+		ReadinessProbe: &core.Probe{
+			Handler: core.Handler{
+				HTTPGet: &core.HTTPGetAction{
+					Path: "/ready",
+					Port: intstr.FromString("www"),
+				},
+			},
+		},
+	})
+	c.Assert(spec.Validate(), jc.ErrorIsNil)
+}
+
+func (s *ContainersSuite) TestParseGenericProbeMultipleHandlers(c *gc.C) {
+
+	specStr := `
+containers:
+  - name: gitlab
+    image: gitlab/latest
+    livenessProbe:
+      tcpPort: 80
+      command: ["alive"]
+`[1:]
+
+	spec, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, jc.ErrorIsNil)
+	err = spec.Validate()
+	c.Assert(err, gc.ErrorMatches, `liveness probe for container "gitlab": probe with 2 handlers not valid`)
+}
+
+func (s *ContainersSuite) TestParseStartupProbe(c *gc.C) {
+
+	specStr := `
+containers:
+  - name: gitlab
+    image: gitlab/latest
+    startupProbe:
+      tcpPort: 80
+`[1:]
+
+	_, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, jc.Satisfies, errors.IsNotSupported)
+	c.Assert(err, gc.ErrorMatches, `startup probe for container "gitlab" not supported`)
+}
+
+func (s *ContainersSuite) TestParseEnvFrom(c *gc.C) {
+
+	specStr := `
+containers:
+  - name: gitlab
+    image: gitlab/latest
+    envFrom:
+      - secretRef:
+          name: gitlab-secrets
+      - prefix: CFG_
+        configMapRef:
+          name: gitlab-config
+`[1:]
+
+	spec, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(spec.Containers[0].ProviderContainer, jc.DeepEquals, &provider.K8sContainerSpec{
+		EnvFrom: []core.EnvFromSource{{
+			SecretRef: &core.SecretEnvSource{LocalObjectReference: core.LocalObjectReference{Name: "gitlab-secrets"}},
+		}, {
+			Prefix:       "CFG_",
+			ConfigMapRef: &core.ConfigMapEnvSource{LocalObjectReference: core.LocalObjectReference{Name: "gitlab-config"}},
+		}},
+	})
+}
+
+func (s *ContainersSuite) TestParseEnvFromMissingSource(c *gc.C) {
+
+	specStr := `
+containers:
+  - name: gitlab
+    image: gitlab/latest
+    envFrom:
+      - prefix: CFG_
+`[1:]
+
+	_, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, gc.ErrorMatches, `envFrom without exactly one of secretRef or configMapRef not valid`)
+}
+
+func (s *ContainersSuite) TestParseLifecycle(c *gc.C) {
+
+	specStr := `
+containers:
+  - name: gitlab
+    image: gitlab/latest
+    lifecycle:
+      postStart:
+        exec:
+          command: ["/bin/register"]
+`[1:]
+
+	spec, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(spec.Containers[0].ProviderContainer, jc.DeepEquals, &provider.K8sContainerSpec{
+		Lifecycle: &core.Lifecycle{
+			PostStart: &core.Handler{
+				Exec: &core.ExecAction{Command: []string{"/bin/register"}},
+			},
+		},
+	})
+}
+
+func (s *ContainersSuite) TestParseLifecycleMultipleHandlers(c *gc.C) {
+
+	specStr := `
+containers:
+  - name: gitlab
+    image: gitlab/latest
+    lifecycle:
+      postStart:
+        exec:
+          command: ["/bin/register"]
+        httpGet:
+          path: /warm
+          port: 8080
+`[1:]
+
+	_, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, gc.ErrorMatches, `postStart hook without exactly one of exec, httpGet or tcpSocket not valid`)
+}
+
+func (s *ContainersSuite) TestParseStdinTTY(c *gc.C) {
+
+	specStr := `
+containers:
+  - name: gitlab
+    image: gitlab/latest
+    stdin: true
+    stdinOnce: true
+    tty: true
+`[1:]
+
+	spec, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(spec.Containers[0].ProviderContainer, jc.DeepEquals, &provider.K8sContainerSpec{
+		Stdin:     true,
+		StdinOnce: true,
+		TTY:       true,
+	})
+	unitSpec, err := provider.MakeUnitSpec("app-name", spec)
+	c.Assert(err, jc.ErrorIsNil)
+	container := provider.PodSpec(unitSpec).Containers[0]
+	c.Assert(container.Stdin, jc.IsTrue)
+	c.Assert(container.StdinOnce, jc.IsTrue)
+	c.Assert(container.TTY, jc.IsTrue)
+}
+
+func (s *ContainersSuite) TestParseTTYWithoutStdin(c *gc.C) {
+
+	specStr := `
+containers:
+  - name: gitlab
+    image: gitlab/latest
+    tty: true
+`[1:]
+
+	_, err := provider.ParseK8sPodSpec(specStr)
+	c.Assert(err, gc.ErrorMatches, `tty without stdin not valid`)
+}
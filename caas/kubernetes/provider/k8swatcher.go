@@ -95,6 +95,12 @@ func (w *kubernetesWatcher) Kill() {
 	w.catacomb.Kill(nil)
 }
 
+// killWithError stops the watcher, which then reports the specified
+// error so that its consumer knows to restart it.
+func (w *kubernetesWatcher) killWithError(err error) {
+	w.catacomb.Kill(err)
+}
+
 // Wait waits for the watcher to die and returns any
 // error encountered when it was running.
 func (w *kubernetesWatcher) Wait() error {
@@ -51,7 +51,7 @@ func (kubernetesEnvironProvider) Open(args environs.OpenParams) (caas.Broker, er
 	if err := validateCloudSpec(args.Cloud); err != nil {
 		return nil, errors.Annotate(err, "validating cloud spec")
 	}
-	broker, err := NewK8sBroker(args.Cloud, args.Config, newK8sClient, newKubernetesWatcher, jujuclock.WallClock)
+	broker, err := NewK8sBroker(args.Cloud, args.Config, args.ControllerUUID, newK8sClient, newKubernetesWatcher, jujuclock.WallClock)
 	if err != nil {
 		return nil, err
 	}
@@ -102,6 +102,21 @@ func (p kubernetesEnvironProvider) Validate(cfg, old *config.Config) (*config.Co
 	if err := config.Validate(cfg, old); err != nil {
 		return nil, err
 	}
+	if _, err := parseClientLimits(cfg.UnknownAttrs()); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if _, err := parseDeletionPropagation(cfg.UnknownAttrs()); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if _, err := parseFallbackStorageClass(cfg.UnknownAttrs()); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if _, err := parseNamespaceTakeover(cfg.UnknownAttrs()); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if _, err := parseDestroyKeepStorage(cfg.UnknownAttrs()); err != nil {
+		return nil, errors.Trace(err)
+	}
 	return cfg, nil
 }
 
@@ -120,6 +135,12 @@ func validateCloudSpec(spec environs.CloudSpec) error {
 	if _, err := url.Parse(spec.Endpoint); err != nil {
 		return errors.NotValidf("endpoint %q", spec.Endpoint)
 	}
+	if spec.StorageEndpoint != "" {
+		storageURL, err := url.Parse(spec.StorageEndpoint)
+		if err != nil || storageURL.Host == "" {
+			return errors.NotValidf("storage endpoint %q", spec.StorageEndpoint)
+		}
+	}
 	if spec.Credential == nil {
 		return errors.NotValidf("missing credential")
 	}
@@ -100,6 +100,12 @@ func (s *providerSuite) TestOpenUnsupportedCredential(c *gc.C) {
 	s.testOpenError(c, spec, `validating cloud spec: "oauth1" auth-type not supported`)
 }
 
+func (s *providerSuite) TestOpenInvalidStorageEndpoint(c *gc.C) {
+	spec := fakeCloudSpec()
+	spec.StorageEndpoint = "not-a-url"
+	s.testOpenError(c, spec, `validating cloud spec: storage endpoint "not-a-url" not valid`)
+}
+
 func (s *providerSuite) testOpenError(c *gc.C, spec environs.CloudSpec, expect string) {
 	_, err := s.provider.Open(environs.OpenParams{
 		Cloud:  spec,
@@ -125,3 +131,98 @@ func (s *providerSuite) TestValidate(c *gc.C) {
 	validAttrs := validCfg.AllAttrs()
 	c.Assert(config.AllAttrs(), gc.DeepEquals, validAttrs)
 }
+
+func (s *providerSuite) TestValidateClientLimits(c *gc.C) {
+	config := fakeConfig(c, coretesting.Attrs{
+		"kubernetes-client-qps":     20,
+		"kubernetes-client-burst":   40,
+		"kubernetes-client-timeout": "30s",
+	})
+	_, err := s.provider.Validate(config, nil)
+	c.Check(err, jc.ErrorIsNil)
+}
+
+func (s *providerSuite) TestValidateInvalidClientLimits(c *gc.C) {
+	for i, t := range []struct {
+		attrs  coretesting.Attrs
+		errStr string
+	}{{
+		attrs:  coretesting.Attrs{"kubernetes-client-qps": 0},
+		errStr: "kubernetes-client-qps 0 not valid",
+	}, {
+		attrs:  coretesting.Attrs{"kubernetes-client-qps": 20, "kubernetes-client-burst": 10},
+		errStr: "kubernetes-client-burst 10 less than kubernetes-client-qps 20 not valid",
+	}, {
+		attrs:  coretesting.Attrs{"kubernetes-client-timeout": "soon"},
+		errStr: `parsing kubernetes-client-timeout: time: invalid duration soon`,
+	}, {
+		attrs:  coretesting.Attrs{"kubernetes-client-timeout": "-1m"},
+		errStr: "negative kubernetes-client-timeout -1m0s not valid",
+	}} {
+		c.Logf("test %d", i)
+		_, err := s.provider.Validate(fakeConfig(c, t.attrs), nil)
+		c.Check(err, gc.ErrorMatches, t.errStr)
+	}
+}
+
+func (s *providerSuite) TestValidateDeletionPropagation(c *gc.C) {
+	config := fakeConfig(c, coretesting.Attrs{
+		"kubernetes-deletion-propagation": "Background",
+	})
+	_, err := s.provider.Validate(config, nil)
+	c.Check(err, jc.ErrorIsNil)
+
+	config = fakeConfig(c, coretesting.Attrs{
+		"kubernetes-deletion-propagation": "Later",
+	})
+	_, err = s.provider.Validate(config, nil)
+	c.Check(err, gc.ErrorMatches, `kubernetes-deletion-propagation "Later" not valid`)
+}
+
+func (s *providerSuite) TestValidateFallbackStorageClass(c *gc.C) {
+	config := fakeConfig(c, coretesting.Attrs{
+		"kubernetes-fallback-storage-class": "fast",
+	})
+	_, err := s.provider.Validate(config, nil)
+	c.Check(err, jc.ErrorIsNil)
+
+	config = fakeConfig(c, coretesting.Attrs{
+		"kubernetes-fallback-storage-class": 42,
+	})
+	_, err = s.provider.Validate(config, nil)
+	c.Check(err, gc.ErrorMatches, `validating fallback storage class config: kubernetes-fallback-storage-class: expected string, got int\(42\)`)
+}
+
+func (s *providerSuite) TestValidateNamespaceTakeover(c *gc.C) {
+	config := fakeConfig(c, coretesting.Attrs{
+		"kubernetes-namespace-takeover": true,
+	})
+	_, err := s.provider.Validate(config, nil)
+	c.Check(err, jc.ErrorIsNil)
+
+	config = fakeConfig(c, coretesting.Attrs{
+		"kubernetes-namespace-takeover": "true",
+	})
+	_, err = s.provider.Validate(config, nil)
+	c.Check(err, jc.ErrorIsNil)
+
+	config = fakeConfig(c, coretesting.Attrs{
+		"kubernetes-namespace-takeover": "yes",
+	})
+	_, err = s.provider.Validate(config, nil)
+	c.Check(err, gc.ErrorMatches, `validating namespace takeover config: kubernetes-namespace-takeover: expected bool, got string\("yes"\)`)
+}
+
+func (s *providerSuite) TestValidateDestroyKeepStorage(c *gc.C) {
+	config := fakeConfig(c, coretesting.Attrs{
+		"kubernetes-destroy-keep-storage": "true",
+	})
+	_, err := s.provider.Validate(config, nil)
+	c.Check(err, jc.ErrorIsNil)
+
+	config = fakeConfig(c, coretesting.Attrs{
+		"kubernetes-destroy-keep-storage": 1,
+	})
+	_, err = s.provider.Validate(config, nil)
+	c.Check(err, gc.ErrorMatches, `validating destroy storage config: kubernetes-destroy-keep-storage: expected bool, got int\(1\)`)
+}
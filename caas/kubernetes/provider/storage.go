@@ -11,6 +11,7 @@ import (
 	"github.com/juju/errors"
 	"github.com/juju/schema"
 	core "k8s.io/api/core/v1"
+	k8sstorage "k8s.io/api/storage/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -24,9 +25,11 @@ const (
 	K8s_ProviderType = storage.ProviderType("kubernetes")
 
 	// K8s storage pool attributes.
-	storageClass       = "storage-class"
-	storageProvisioner = "storage-provisioner"
-	storageLabel       = "storage-label"
+	storageClass         = "storage-class"
+	storageProvisioner   = "storage-provisioner"
+	storageLabel         = "storage-label"
+	storageReclaimPolicy = "storage-reclaim-policy"
+	storageBindingMode   = "storage-binding-mode"
 
 	// K8s storage pool attribute default values.
 	defaultStorageClass = "juju-unit-storage"
@@ -55,14 +58,24 @@ var storageConfigFields = schema.Fields{
 	storageClass:       schema.String(),
 	storageLabel:       schema.String(),
 	storageProvisioner: schema.String(),
+	storageReclaimPolicy: schema.OneOf(
+		schema.Const(string(core.PersistentVolumeReclaimRetain)),
+		schema.Const(string(core.PersistentVolumeReclaimDelete)),
+	),
+	storageBindingMode: schema.OneOf(
+		schema.Const(string(k8sstorage.VolumeBindingImmediate)),
+		schema.Const(string(k8sstorage.VolumeBindingWaitForFirstConsumer)),
+	),
 }
 
 var storageConfigChecker = schema.FieldMap(
 	storageConfigFields,
 	schema.Defaults{
-		storageClass:       schema.Omit,
-		storageLabel:       schema.Omit,
-		storageProvisioner: schema.Omit,
+		storageClass:         schema.Omit,
+		storageLabel:         schema.Omit,
+		storageProvisioner:   schema.Omit,
+		storageReclaimPolicy: schema.Omit,
+		storageBindingMode:   schema.Omit,
 	},
 )
 
@@ -91,6 +104,10 @@ type storageConfig struct {
 
 	// reclaimPolicy defines the volume reclaim policy.
 	reclaimPolicy core.PersistentVolumeReclaimPolicy
+
+	// volumeBindingMode defines when volume binding and
+	// dynamic provisioning should occur, if set.
+	volumeBindingMode *k8sstorage.VolumeBindingMode
 }
 
 func newStorageConfig(attrs map[string]interface{}, defaultStorageClass string) (*storageConfig, error) {
@@ -113,6 +130,13 @@ func newStorageConfig(attrs map[string]interface{}, defaultStorageClass string)
 	}
 	// By default, we'll retain volumes used for charm storage.
 	storageConfig.reclaimPolicy = core.PersistentVolumeReclaimRetain
+	if reclaimPolicy, ok := coerced[storageReclaimPolicy].(string); ok {
+		storageConfig.reclaimPolicy = core.PersistentVolumeReclaimPolicy(reclaimPolicy)
+	}
+	if bindingMode, ok := coerced[storageBindingMode].(string); ok {
+		mode := k8sstorage.VolumeBindingMode(bindingMode)
+		storageConfig.volumeBindingMode = &mode
+	}
 	storageConfig.parameters = make(map[string]string)
 	for k, v := range attrs {
 		k = strings.TrimPrefix(k, "parameters.")
@@ -121,6 +145,8 @@ func newStorageConfig(attrs map[string]interface{}, defaultStorageClass string)
 	delete(storageConfig.parameters, storageClass)
 	delete(storageConfig.parameters, storageLabel)
 	delete(storageConfig.parameters, storageProvisioner)
+	delete(storageConfig.parameters, storageReclaimPolicy)
+	delete(storageConfig.parameters, storageBindingMode)
 
 	return storageConfig, nil
 }
@@ -182,7 +208,7 @@ func (v *volumeSource) CreateVolumes(ctx context.ProviderCallContext, params []s
 
 // ListVolumes is specified on the storage.VolumeSource interface.
 func (v *volumeSource) ListVolumes(ctx context.ProviderCallContext) ([]string, error) {
-	pVolumes := v.client.CoreV1().PersistentVolumes()
+	pVolumes := v.client.client().CoreV1().PersistentVolumes()
 	vols, err := pVolumes.List(v1.ListOptions{})
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -196,7 +222,7 @@ func (v *volumeSource) ListVolumes(ctx context.ProviderCallContext) ([]string, e
 
 // DescribeVolumes is specified on the storage.VolumeSource interface.
 func (v *volumeSource) DescribeVolumes(ctx context.ProviderCallContext, volIds []string) ([]storage.DescribeVolumesResult, error) {
-	pVolumes := v.client.CoreV1().PersistentVolumes()
+	pVolumes := v.client.client().CoreV1().PersistentVolumes()
 	vols, err := pVolumes.List(v1.ListOptions{
 		// TODO(caas) - filter on volumes for the current model
 	})
@@ -227,11 +253,11 @@ func (v *volumeSource) DescribeVolumes(ctx context.ProviderCallContext, volIds [
 // DestroyVolumes is specified on the storage.VolumeSource interface.
 func (v *volumeSource) DestroyVolumes(ctx context.ProviderCallContext, volIds []string) ([]error, error) {
 	logger.Debugf("destroy k8s volumes: %v", volIds)
-	pVolumes := v.client.CoreV1().PersistentVolumes()
+	pVolumes := v.client.client().CoreV1().PersistentVolumes()
 	return foreachVolume(volIds, func(volumeId string) error {
 		if err := pVolumes.Delete(
 			volumeId,
-			&v1.DeleteOptions{PropagationPolicy: &defaultPropagationPolicy},
+			&v1.DeleteOptions{PropagationPolicy: v.client.propagationPolicy()},
 		); !k8serrors.IsNotFound(err) {
 			return errors.Annotate(err, "destroying k8s volumes")
 		}
@@ -8,6 +8,7 @@ import (
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
 	core "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -85,6 +86,62 @@ func (s *storageSuite) TestNewStorageConfig(c *gc.C) {
 	c.Assert(provider.StorageParameters(cfg), jc.DeepEquals, map[string]string{"type": "gp2"})
 }
 
+func (s *storageSuite) TestNewStorageConfigReclaimPolicyAndBindingMode(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	cfg, err := provider.NewStorageConfig(map[string]interface{}{
+		"storage-class":          "juju-ebs",
+		"storage-provisioner":    "ebs",
+		"storage-reclaim-policy": "Delete",
+		"storage-binding-mode":   "WaitForFirstConsumer",
+		"parameters.type":        "gp2",
+	}, "juju-unit-storage")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(provider.StorageReclaimPolicy(cfg), gc.Equals, core.PersistentVolumeReclaimDelete)
+	mode := storagev1.VolumeBindingWaitForFirstConsumer
+	c.Assert(provider.StorageVolumeBindingMode(cfg), jc.DeepEquals, &mode)
+	c.Assert(provider.StorageParameters(cfg), jc.DeepEquals, map[string]string{"type": "gp2"})
+}
+
+func (s *storageSuite) TestNewStorageConfigDefaultReclaimPolicy(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	cfg, err := provider.NewStorageConfig(map[string]interface{}{}, "juju-unit-storage")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(provider.StorageReclaimPolicy(cfg), gc.Equals, core.PersistentVolumeReclaimRetain)
+	c.Assert(provider.StorageVolumeBindingMode(cfg), gc.IsNil)
+}
+
+func (s *storageSuite) TestValidateConfigInvalidReclaimPolicy(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	p := s.k8sProvider(c, ctrl)
+	cfg, err := storage.NewConfig("name", provider.K8s_ProviderType, map[string]interface{}{
+		"storage-class":          "my-storage",
+		"storage-provisioner":    "aws-storage",
+		"storage-reclaim-policy": "Keep",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	err = p.ValidateConfig(cfg)
+	c.Assert(err, gc.ErrorMatches, `validating storage config: storage-reclaim-policy: .*`)
+}
+
+func (s *storageSuite) TestNewStorageConfigRecycleReclaimPolicy(c *gc.C) {
+	ctrl := s.setupBroker(c)
+	defer ctrl.Finish()
+
+	// Storage classes only support the Delete and Retain reclaim policies.
+	_, err := provider.NewStorageConfig(map[string]interface{}{
+		"storage-class":          "juju-ebs",
+		"storage-provisioner":    "ebs",
+		"storage-reclaim-policy": "Recycle",
+	}, "juju-unit-storage")
+	c.Assert(err, gc.ErrorMatches, `validating storage config: storage-reclaim-policy: .*`)
+}
+
 func (s *storageSuite) TestSupports(c *gc.C) {
 	ctrl := s.setupBroker(c)
 	defer ctrl.Finish()
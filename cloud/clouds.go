@@ -171,6 +171,12 @@ type Region struct {
 	// If the cloud/region does not have a storage-specific
 	// endpoint URL, this will be empty.
 	StorageEndpoint string
+
+	// CACertificates contains an optional list of Certificate
+	// Authority certificates to be used to validate certificates
+	// of the region's infrastructure components. If set, they
+	// are used instead of the cloud's CA certificates.
+	CACertificates []string
 }
 
 // cloudSet contains cloud definitions, used for marshalling and
@@ -212,9 +218,10 @@ type regions struct {
 
 // region is equivalent to Region, for marshalling and unmarshalling.
 type region struct {
-	Endpoint         string `yaml:"endpoint,omitempty"`
-	IdentityEndpoint string `yaml:"identity-endpoint,omitempty"`
-	StorageEndpoint  string `yaml:"storage-endpoint,omitempty"`
+	Endpoint         string   `yaml:"endpoint,omitempty"`
+	IdentityEndpoint string   `yaml:"identity-endpoint,omitempty"`
+	StorageEndpoint  string   `yaml:"storage-endpoint,omitempty"`
+	CACertificates   []string `yaml:"ca-certificates,omitempty"`
 }
 
 var caasCloudTypes = map[string]bool{
@@ -416,6 +423,7 @@ func cloudToInternal(in Cloud, withName bool) *cloud {
 				r.Endpoint,
 				r.IdentityEndpoint,
 				r.StorageEndpoint,
+				r.CACertificates,
 			},
 		})
 	}
@@ -453,6 +461,7 @@ func cloudFromInternal(in *cloud) Cloud {
 					r.Endpoint,
 					r.IdentityEndpoint,
 					r.StorageEndpoint,
+					r.CACertificates,
 				})
 			}
 		}
@@ -322,3 +322,28 @@ ca-certificates: [fakecacert]
 		CACertificates: []string{"fakecacert"},
 	})
 }
+
+func (s *cloudSuite) TestUnmarshalCloudRegionCACertificates(c *gc.C) {
+	in := []byte(`
+name: foo
+type: bar
+auth-types: [baz]
+endpoint: qux
+ca-certificates: [fakecacert]
+regions:
+  one:
+    endpoint: one-endpoint
+    ca-certificates: [onecacert]
+  two: {}
+`)
+	out, err := cloud.UnmarshalCloud(in)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(out.Regions, jc.DeepEquals, []cloud.Region{{
+		Name:           "one",
+		Endpoint:       "one-endpoint",
+		CACertificates: []string{"onecacert"},
+	}, {
+		Name:     "two",
+		Endpoint: "qux",
+	}})
+}
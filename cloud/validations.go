@@ -74,6 +74,10 @@ var regionsSchema = map[string]interface{}{
 			"endpoint":          map[string]interface{}{"type": "string"},
 			"identity-endpoint": map[string]interface{}{"type": "string"},
 			"storage-endpoint":  map[string]interface{}{"type": "string"},
+			"ca-certificates": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string"},
+			},
 		},
 		"additionalProperties": false,
 	},
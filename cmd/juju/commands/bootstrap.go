@@ -482,6 +482,11 @@ func (c *bootstrapCommand) Run(ctx *cmd.Context) (resultErr error) {
 		}
 	}()
 
+	// A region's CA certificates override those of the cloud.
+	caCertificates := cloud.CACertificates
+	if len(region.CACertificates) > 0 {
+		caCertificates = region.CACertificates
+	}
 	bootstrapCtx := modelcmd.BootstrapContext(ctx)
 	bootstrapPrepareParams := bootstrap.PrepareParams{
 		ModelConfig:      config.bootstrapModel,
@@ -495,7 +500,7 @@ func (c *bootstrapCommand) Run(ctx *cmd.Context) (resultErr error) {
 			IdentityEndpoint: region.IdentityEndpoint,
 			StorageEndpoint:  region.StorageEndpoint,
 			Credential:       credentials.credential,
-			CACertificates:   cloud.CACertificates,
+			CACertificates:   caCertificates,
 		},
 		CredentialName: credentials.name,
 		AdminSecret:    config.bootstrap.AdminSecret,
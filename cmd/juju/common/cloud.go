@@ -66,6 +66,7 @@ func ChooseCloudRegion(cloud jujucloud.Cloud, regionName string) (jujucloud.Regi
 		cloud.Endpoint,
 		cloud.IdentityEndpoint,
 		cloud.StorageEndpoint,
+		cloud.CACertificates,
 	}, nil
 }
 
@@ -16,6 +16,7 @@ import (
 	"github.com/juju/gnuflag"
 	"github.com/juju/loggo"
 	"github.com/juju/utils/featureflag"
+	"github.com/juju/utils/symlink"
 	"github.com/juju/utils/voyeur"
 	"github.com/prometheus/client_golang/prometheus"
 	"gopkg.in/juju/names.v2"
@@ -23,12 +24,14 @@ import (
 	"gopkg.in/juju/worker.v1/dependency"
 
 	"github.com/juju/juju/agent"
+	"github.com/juju/juju/agent/tools"
 	"github.com/juju/juju/api/base"
 	apicaasoperator "github.com/juju/juju/api/caasoperator"
 	jujucmd "github.com/juju/juju/cmd"
 	"github.com/juju/juju/cmd/jujud/agent/caasoperator"
 	cmdutil "github.com/juju/juju/cmd/jujud/util"
 	"github.com/juju/juju/core/machinelock"
+	jujunames "github.com/juju/juju/juju/names"
 	jujuversion "github.com/juju/juju/version"
 	jworker "github.com/juju/juju/worker"
 	"github.com/juju/juju/worker/gate"
@@ -148,6 +151,21 @@ func (op *CaasOperatorAgent) maybeCopyAgentConfig() error {
 	return op.ReadConfig(op.Tag().String())
 }
 
+// createIntrospectSymlink links juju-introspect to the operator's jujud,
+// so that the operator's liveness probe can query the agent through its
+// introspection socket.
+func createIntrospectSymlink(dataDir string) error {
+	toolsDir := tools.ToolsDir(dataDir, "")
+	if err := os.MkdirAll(toolsDir, 0755); err != nil {
+		return errors.Trace(err)
+	}
+	err := symlink.New(filepath.Join(toolsDir, jujunames.Jujud), filepath.Join(toolsDir, jujunames.JujuIntrospect))
+	if err != nil && !os.IsExist(err) {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
 func copyFile(dest, source string) error {
 	df, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0600)
 	if err != nil {
@@ -171,6 +189,9 @@ func (op *CaasOperatorAgent) Run(ctx *cmd.Context) (err error) {
 	if err := op.maybeCopyAgentConfig(); err != nil {
 		return errors.Annotate(err, "creating agent config from template")
 	}
+	if err := createIntrospectSymlink(op.DataDir()); err != nil {
+		return errors.Annotate(err, "creating juju-introspect symlink")
+	}
 	agentConfig := op.CurrentConfig()
 	machineLock, err := machinelock.New(machinelock.Config{
 		AgentName:   op.Tag().String(),
@@ -13,6 +13,7 @@ import (
 	"github.com/juju/cmd/cmdtesting"
 	"github.com/juju/juju/agent"
 	jc "github.com/juju/testing/checkers"
+	"github.com/juju/utils/symlink"
 	"github.com/juju/utils/voyeur"
 	gc "gopkg.in/check.v1"
 	"gopkg.in/juju/names.v2"
@@ -174,6 +175,19 @@ func (s *CAASOperatorSuite) TestRunCopiesConfigTemplate(c *gc.C) {
 	c.Assert(addr, jc.SameContents, []string{"localhost:17070"})
 }
 
+func (s *CAASOperatorSuite) TestCreateIntrospectSymlink(c *gc.C) {
+	dataDir := c.MkDir()
+	err := createIntrospectSymlink(dataDir)
+	c.Assert(err, jc.ErrorIsNil)
+	// Creating the symlink again is a no-op.
+	err = createIntrospectSymlink(dataDir)
+	c.Assert(err, jc.ErrorIsNil)
+
+	target, err := symlink.Read(filepath.Join(dataDir, "tools", "juju-introspect"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(target, gc.Equals, filepath.Join(dataDir, "tools", "jujud"))
+}
+
 func (s *CAASOperatorSuite) TestChangeConfig(c *gc.C) {
 	config := FakeAgentConfig{}
 	configChanged := voyeur.NewValue(true)
@@ -422,6 +422,7 @@ func CAASManifolds(config ManifoldsConfig) dependency.Manifolds {
 		caasBrokerTrackerName: ifResponsible(caasbroker.Manifold(caasbroker.ManifoldConfig{
 			APICallerName:          apiCallerName,
 			NewContainerBrokerFunc: config.NewContainerBrokerFunc,
+			ControllerUUID:         agentConfig.Controller().Id(),
 		})),
 		caasFirewallerName: ifNotMigrating(caasfirewaller.Manifold(
 			caasfirewaller.ManifoldConfig{
@@ -116,7 +116,11 @@ func PrepareController(
 		if err := do(); err != nil {
 			return nil, errors.Trace(err)
 		}
-		return caas.Open(p, environs.OpenParams{Cloud: args.Cloud, Config: cfg})
+		return caas.Open(p, environs.OpenParams{
+			Cloud:          args.Cloud,
+			Config:         cfg,
+			ControllerUUID: args.ControllerConfig.ControllerUUID(),
+		})
 	} else {
 		details.ModelType = model.IAAS
 		env, err := environs.Open(p, environs.OpenParams{
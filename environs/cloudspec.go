@@ -77,6 +77,9 @@ func MakeCloudSpec(cloud jujucloud.Cloud, cloudRegionName string, credential *ju
 		cloudSpec.Endpoint = cloudRegion.Endpoint
 		cloudSpec.IdentityEndpoint = cloudRegion.IdentityEndpoint
 		cloudSpec.StorageEndpoint = cloudRegion.StorageEndpoint
+		if len(cloudRegion.CACertificates) > 0 {
+			cloudSpec.CACertificates = cloudRegion.CACertificates
+		}
 	}
 	return cloudSpec, nil
 }
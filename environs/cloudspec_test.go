@@ -6,6 +6,7 @@ import (
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
 
+	"github.com/juju/juju/cloud"
 	"github.com/juju/juju/environs"
 )
 
@@ -51,3 +52,29 @@ func (s *cloudSpecSuite) TestNewRegionSpec(c *gc.C) {
 		c.Check(rspec, jc.DeepEquals, test.want)
 	}
 }
+
+func (s *cloudSpecSuite) TestMakeCloudSpecRegionCACertificates(c *gc.C) {
+	in := cloud.Cloud{
+		Name:           "acloud",
+		Type:           "kubernetes",
+		Endpoint:       "cloud-endpoint",
+		CACertificates: []string{"cloudcert"},
+		Regions: []cloud.Region{{
+			Name:           "one",
+			Endpoint:       "one-endpoint",
+			CACertificates: []string{"onecert"},
+		}, {
+			Name:     "two",
+			Endpoint: "two-endpoint",
+		}},
+	}
+	spec, err := environs.MakeCloudSpec(in, "one", nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(spec.Endpoint, gc.Equals, "one-endpoint")
+	c.Check(spec.CACertificates, jc.DeepEquals, []string{"onecert"})
+
+	spec, err = environs.MakeCloudSpec(in, "two", nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(spec.Endpoint, gc.Equals, "two-endpoint")
+	c.Check(spec.CACertificates, jc.DeepEquals, []string{"cloudcert"})
+}
@@ -69,6 +69,11 @@ type OpenParams struct {
 
 	// Config is the base configuration for the provider.
 	Config *config.Config
+
+	// ControllerUUID is the UUID of the controller managing the
+	// model. It is optional, and is used by providers which record
+	// the owning controller on the resources they create.
+	ControllerUUID string
 }
 
 // ProviderSchema can be implemented by a provider to provide
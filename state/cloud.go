@@ -39,9 +39,10 @@ type cloudDoc struct {
 
 // cloudRegionSubdoc records information about cloud regions.
 type cloudRegionSubdoc struct {
-	Endpoint         string `bson:"endpoint,omitempty"`
-	IdentityEndpoint string `bson:"identity-endpoint,omitempty"`
-	StorageEndpoint  string `bson:"storage-endpoint,omitempty"`
+	Endpoint         string   `bson:"endpoint,omitempty"`
+	IdentityEndpoint string   `bson:"identity-endpoint,omitempty"`
+	StorageEndpoint  string   `bson:"storage-endpoint,omitempty"`
+	CACertificates   []string `bson:"ca-certificates,omitempty"`
 }
 
 // createCloudOp returns a txn.Op that will initialize
@@ -57,6 +58,7 @@ func createCloudOp(cloud cloud.Cloud) txn.Op {
 			region.Endpoint,
 			region.IdentityEndpoint,
 			region.StorageEndpoint,
+			region.CACertificates,
 		}
 	}
 	return txn.Op{
@@ -132,6 +134,7 @@ func (d cloudDoc) toCloud() cloud.Cloud {
 			region.Endpoint,
 			region.IdentityEndpoint,
 			region.StorageEndpoint,
+			region.CACertificates,
 		}
 	}
 	return cloud.Cloud{
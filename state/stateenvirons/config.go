@@ -99,8 +99,9 @@ func GetNewCAASBrokerFunc(newBroker caas.NewContainerBrokerFunc) NewCAASBrokerFu
 			return nil, errors.Trace(err)
 		}
 		return newBroker(environs.OpenParams{
-			Cloud:  cloudSpec,
-			Config: cfg,
+			Cloud:          cloudSpec,
+			Config:         cfg,
+			ControllerUUID: st.ControllerUUID(),
 		})
 	}
 }
@@ -29,6 +29,7 @@ type ConfigAPI interface {
 type Config struct {
 	ConfigAPI              ConfigAPI
 	NewContainerBrokerFunc caas.NewContainerBrokerFunc
+	ControllerUUID         string
 }
 
 // Validate returns an error if the config cannot be used to start a Tracker.
@@ -39,6 +40,9 @@ func (config Config) Validate() error {
 	if config.NewContainerBrokerFunc == nil {
 		return errors.NotValidf("nil NewContainerBrokerFunc")
 	}
+	if config.ControllerUUID == "" {
+		return errors.NotValidf("empty ControllerUUID")
+	}
 	return nil
 }
 
@@ -68,8 +72,9 @@ func NewTracker(config Config) (*Tracker, error) {
 		return nil, errors.Trace(err)
 	}
 	broker, err := config.NewContainerBrokerFunc(environs.OpenParams{
-		Cloud:  cloudSpec,
-		Config: cfg,
+		ControllerUUID: config.ControllerUUID,
+		Cloud:          cloudSpec,
+		Config:         cfg,
 	})
 	if err != nil {
 		return nil, errors.Annotate(err, "cannot create caas broker")
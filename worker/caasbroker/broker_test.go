@@ -40,6 +40,17 @@ func (s *TrackerSuite) TestValidateNewBrokerFunc(c *gc.C) {
 	})
 }
 
+func (s *TrackerSuite) TestValidateControllerUUID(c *gc.C) {
+	config := caasbroker.Config{
+		ConfigAPI:              &runContext{},
+		NewContainerBrokerFunc: newMockBroker,
+	}
+	s.testValidate(c, config, func(err error) {
+		c.Check(err, jc.Satisfies, errors.IsNotValid)
+		c.Check(err, gc.ErrorMatches, "empty ControllerUUID not valid")
+	})
+}
+
 func (s *TrackerSuite) testValidate(c *gc.C, config caasbroker.Config, check func(err error)) {
 	err := config.Validate()
 	check(err)
@@ -59,6 +70,7 @@ func (s *TrackerSuite) TestCloudSpecFails(c *gc.C) {
 		tracker, err := caasbroker.NewTracker(caasbroker.Config{
 			ConfigAPI:              context,
 			NewContainerBrokerFunc: newMockBroker,
+			ControllerUUID:         coretesting.ControllerTag.Id(),
 		})
 		c.Check(err, gc.ErrorMatches, "cannot get cloud information: no you")
 		c.Check(tracker, gc.IsNil)
@@ -84,6 +96,7 @@ func (s *TrackerSuite) TestSuccess(c *gc.C) {
 		tracker, err := caasbroker.NewTracker(caasbroker.Config{
 			ConfigAPI:              context,
 			NewContainerBrokerFunc: newMockBroker,
+			ControllerUUID:         coretesting.ControllerTag.Id(),
 		})
 		c.Assert(err, jc.ErrorIsNil)
 		defer workertest.CleanKill(c, tracker)
@@ -97,10 +110,14 @@ func (s *TrackerSuite) TestInitialise(c *gc.C) {
 	fix := s.validFixture()
 	fix.Run(c, func(context *runContext) {
 		tracker, err := caasbroker.NewTracker(caasbroker.Config{
-			ConfigAPI: context,
+			ConfigAPI:      context,
+			ControllerUUID: coretesting.ControllerTag.Id(),
 			NewContainerBrokerFunc: func(args environs.OpenParams) (caas.Broker, error) {
 				c.Assert(args.Cloud, jc.DeepEquals, fix.cloud)
 				c.Assert(args.Config.Name(), jc.DeepEquals, "testmodel")
+				// The broker needs the controller UUID to check
+				// the ownership of the model's namespace.
+				c.Assert(args.ControllerUUID, gc.Equals, coretesting.ControllerTag.Id())
 				return nil, errors.NotValidf("cloud spec")
 			},
 		})
@@ -19,6 +19,7 @@ import (
 type ManifoldConfig struct {
 	APICallerName          string
 	NewContainerBrokerFunc caas.NewContainerBrokerFunc
+	ControllerUUID         string
 }
 
 // Manifold returns a Manifold that encapsulates a *Tracker and exposes it as
@@ -41,6 +42,7 @@ func Manifold(config ManifoldConfig) dependency.Manifold {
 			w, err := NewTracker(Config{
 				ConfigAPI:              api,
 				NewContainerBrokerFunc: config.NewContainerBrokerFunc,
+				ControllerUUID:         config.ControllerUUID,
 			})
 			if err != nil {
 				return nil, errors.Trace(err)